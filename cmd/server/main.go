@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -33,6 +34,11 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Handle "migrate status|up|down"
+	if flag.Arg(0) == "migrate" {
+		os.Exit(runMigrate(flag.Args()[1:]))
+	}
+
 	// 1. Load .env files and configuration from environment
 	loadEnvFiles()
 	cfg := loadConfig()
@@ -133,6 +139,12 @@ func validateConfig(cfg *api.Config) error {
 		return fmt.Errorf("BACKEND must be 'fly' or 'kubernetes', got: %s", cfg.Backend)
 	}
 
+	switch cfg.RateLimitStore {
+	case "memory", "postgres":
+	default:
+		return fmt.Errorf("RATE_LIMIT_STORE must be 'memory' or 'postgres', got: %s", cfg.RateLimitStore)
+	}
+
 	return nil
 }
 
@@ -159,6 +171,7 @@ func loadEnvFiles() {
 func loadConfig() *api.Config {
 	// Calculate development ports: Use 20000 + current port if not explicitly set
 	devPort := calculateDevPort(getEnv("PORT", ""))
+	environment := getEnv("ENVIRONMENT", "development")
 
 	return &api.Config{
 		Port:        devPort,
@@ -169,9 +182,10 @@ func loadConfig() *api.Config {
 		Backend: getEnv("BACKEND", ""),
 
 		// Fly.io config
-		FlyToken:   getEnv("FLY_API_TOKEN", ""),
-		FlyOrg:     getEnv("FLY_ORG", ""),
-		FlyAppName: getEnv("FLY_APP_NAME", ""),
+		FlyToken:       getEnv("FLY_API_TOKEN", ""),
+		FlyOrg:         getEnv("FLY_ORG", ""),
+		FlyAppName:     getEnv("FLY_APP_NAME", ""),
+		FlyBuildRegion: getEnv("FLY_BUILD_REGION", ""),
 
 		// Kubernetes config
 		K8sKubeconfig:     getEnv("K8S_KUBECONFIG", ""),
@@ -179,6 +193,30 @@ func loadConfig() *api.Config {
 		K8sServiceAccount: getEnv("K8S_SERVICE_ACCOUNT", ""),
 		K8sRegistry:       getEnv("K8S_REGISTRY", "ttl.sh"),
 		K8sImageTTL:       getEnv("K8S_IMAGE_TTL", "4h"),
+
+		// Budget alerts
+		SMTPAddr:              getEnv("SMTP_ADDR", ""),
+		SMTPUsername:          getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:          getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:              getEnv("SMTP_FROM", "billing@execbox.dev"),
+		BudgetAlertWebhookURL: getEnv("BUDGET_ALERT_WEBHOOK_URL", ""),
+
+		// Metrics
+		MetricsToken: getEnv("METRICS_TOKEN", ""),
+
+		// Tracing
+		OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+
+		// Rate limiting
+		RateLimitStore: getEnv("RATE_LIMIT_STORE", "memory"),
+
+		// API key hashing
+		APIKeyPepper: getEnv("API_KEY_PEPPER", ""),
+
+		Environment: environment,
+
+		// Migrations run on startup outside production, unless AUTO_MIGRATE says otherwise
+		AutoMigrate: getEnv("AUTO_MIGRATE", strconv.FormatBool(environment != "production")) == "true",
 	}
 }
 
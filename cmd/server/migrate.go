@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+)
+
+const migrateUsage = `usage: execbox-cloud migrate <command>
+
+Commands:
+  status  List migrations and whether they have been applied
+  up      Apply all pending migrations
+  down    Revert the most recently applied migration
+`
+
+// runMigrate runs the migrate subcommand against DATABASE_URL and returns the
+// process exit code.
+func runMigrate(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	loadEnvFiles()
+	cfg := loadConfig()
+	if cfg.DatabaseURL == "" {
+		fmt.Fprintln(os.Stderr, "Configuration error: DATABASE_URL is required")
+		return 1
+	}
+	setupLogging(cfg.LogLevel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	client, err := db.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	switch args[0] {
+	case "status":
+		err = migrateStatus(ctx, client)
+	case "up":
+		err = migrateUp(ctx, client)
+	case "down":
+		err = migrateDown(ctx, client)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// migrateStatus prints every migration with its state.
+func migrateStatus(ctx context.Context, client *db.Client) error {
+	statuses, err := client.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", ""
+		if status.AppliedAt != nil {
+			state, appliedAt = "applied", status.AppliedAt.Format(time.RFC3339)
+		}
+		if status.Modified {
+			state = "modified"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
+
+// migrateUp applies pending migrations and prints them.
+func migrateUp(ctx context.Context, client *db.Client) error {
+	ran, err := client.RunMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(ran) == 0 {
+		fmt.Println("No pending migrations")
+		return nil
+	}
+	for _, m := range ran {
+		fmt.Printf("Applied %s\n", m.Name)
+	}
+	return nil
+}
+
+// migrateDown reverts the latest migration and prints it.
+func migrateDown(ctx context.Context, client *db.Client) error {
+	reverted, err := client.RollbackMigration(ctx)
+	if err != nil {
+		return err
+	}
+
+	if reverted == nil {
+		fmt.Println("No applied migrations")
+		return nil
+	}
+	fmt.Printf("Reverted %s\n", reverted.Name)
+	return nil
+}
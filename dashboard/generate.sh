@@ -8,7 +8,7 @@ mkdir -p src/generated
 
 # Generate OpenAPI spec from the Go server and save it to the repo root
 echo "Generating OpenAPI spec..."
-go run ../cmd/server/main.go --openapi > ../openapi.json
+go run ../cmd/server --openapi > ../openapi.json
 
 # Generate TypeScript types from the spec
 echo "Generating TypeScript types..."
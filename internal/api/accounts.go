@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
@@ -26,13 +27,14 @@ func NewAccountService(db DBClient) *AccountService {
 }
 
 // GetAccount handles GET /v1/account
-// Returns account information for the authenticated API key.
+// Returns the account owning the authenticated API key, with the key's tier.
 func (a *AccountService) GetAccount(ctx context.Context, input *GetAccountInput) (*GetAccountOutput, error) {
-	// Get API key ID from context
+	// Get API key ID and account from context
 	apiKeyID, ok := GetAPIKeyID(ctx)
 	if !ok {
 		return nil, huma.Error401Unauthorized("unauthorized")
 	}
+	accountID, _ := callerAccountID(ctx)
 
 	// Get full API key details from database
 	apiKey, err := a.db.GetAPIKeyByID(ctx, apiKeyID)
@@ -40,30 +42,80 @@ func (a *AccountService) GetAccount(ctx context.Context, input *GetAccountInput)
 		return nil, huma.Error500InternalServerError("failed to get API key", err)
 	}
 
-	// Build response
-	response := AccountResponse{
+	account, err := a.db.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to get account", err)
+	}
+
+	return &GetAccountOutput{
+		Body: accountToResponse(account, apiKey),
+	}, nil
+}
+
+// UpdateAccount handles PATCH /v1/account
+// Updates the name and contact email of the authenticated account.
+func (a *AccountService) UpdateAccount(ctx context.Context, input *UpdateAccountInput) (*UpdateAccountOutput, error) {
+	// Get API key ID and account from context
+	apiKeyID, ok := GetAPIKeyID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+	accountID, _ := callerAccountID(ctx)
+
+	// Validate name length if provided
+	if input.Body.Name != nil && len(*input.Body.Name) > 100 {
+		return nil, huma.Error400BadRequest("name must be 100 characters or less")
+	}
+
+	if input.Body.Name == nil && input.Body.Email == nil {
+		return nil, huma.Error400BadRequest("no fields to update")
+	}
+
+	apiKey, err := a.db.GetAPIKeyByID(ctx, apiKeyID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to get API key", err)
+	}
+
+	account, err := a.db.UpdateAccount(ctx, accountID, &db.AccountUpdate{
+		Name:  input.Body.Name,
+		Email: input.Body.Email,
+	})
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to update account", err)
+	}
+
+	recordAudit(ctx, a.db, AuditAccountUpdated, "", input.Body)
+
+	return &UpdateAccountOutput{
+		Body: accountToResponse(account, apiKey),
+	}, nil
+}
+
+// accountToResponse converts an account and the caller's API key to an AccountResponse.
+func accountToResponse(account *db.Account, apiKey *db.APIKey) AccountResponse {
+	resp := AccountResponse{
+		ID:            account.ID.String(),
+		Name:          account.Name,
+		Email:         account.Email,
 		Tier:          apiKey.Tier,
-		Email:         apiKey.Email,
 		APIKeyID:      apiKey.ID.String(),
-		APIKeyPreview: maskAPIKey(apiKey.Key),
-		CreatedAt:     apiKey.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		APIKeyPreview: keyPreview(apiKey),
+		CreatedAt:     account.CreatedAt.Format(time.RFC3339),
 	}
 
 	if apiKey.TierExpiresAt != nil {
-		expiresAt := apiKey.TierExpiresAt.Format("2006-01-02T15:04:05Z07:00")
-		response.TierExpiresAt = &expiresAt
+		expiresAt := apiKey.TierExpiresAt.Format(time.RFC3339)
+		resp.TierExpiresAt = &expiresAt
 	}
 
-	return &GetAccountOutput{
-		Body: response,
-	}, nil
+	return resp
 }
 
 // GetUsage handles GET /v1/account/usage
-// Returns usage statistics for the authenticated API key.
+// Returns usage statistics across all API keys of the authenticated account.
 func (a *AccountService) GetUsage(ctx context.Context, input *GetUsageInput) (*GetUsageOutput, error) {
-	// Get API key ID and tier from context
-	apiKeyID, ok := GetAPIKeyID(ctx)
+	// Get account and tier from context
+	accountID, ok := callerAccountID(ctx)
 	if !ok {
 		return nil, huma.Error401Unauthorized("unauthorized")
 	}
@@ -74,12 +126,12 @@ func (a *AccountService) GetUsage(ctx context.Context, input *GetUsageInput) (*G
 	}
 
 	// Get session counts
-	dailyCount, err := a.db.GetDailySessionCount(ctx, apiKeyID)
+	dailyCount, err := a.db.GetAccountDailySessionCount(ctx, accountID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get daily session count", err)
 	}
 
-	activeCount, err := a.db.GetActiveSessionCount(ctx, apiKeyID)
+	activeCount, err := a.db.GetAccountActiveSessionCount(ctx, accountID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get active session count", err)
 	}
@@ -141,10 +193,10 @@ func (a *AccountService) JoinWaitlist(ctx context.Context, input *JoinWaitlistIn
 }
 
 // GetEnhancedUsage handles GET /v1/account/usage/enhanced
-// Returns enhanced usage statistics with detailed metrics for the authenticated API key.
+// Returns enhanced usage statistics with detailed metrics for the authenticated account.
 func (a *AccountService) GetEnhancedUsage(ctx context.Context, input *GetEnhancedUsageInput) (*GetEnhancedUsageOutput, error) {
-	// Get API key ID from context
-	apiKeyID, ok := GetAPIKeyID(ctx)
+	// Get account from context
+	accountID, ok := callerAccountID(ctx)
 	if !ok {
 		return nil, huma.Error401Unauthorized("unauthorized")
 	}
@@ -159,12 +211,12 @@ func (a *AccountService) GetEnhancedUsage(ctx context.Context, input *GetEnhance
 	limits := GetTierLimits(tier)
 
 	// Get daily and active counts
-	dailyCount, err := a.db.GetDailySessionCount(ctx, apiKeyID)
+	dailyCount, err := a.db.GetAccountDailySessionCount(ctx, accountID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get daily session count", err)
 	}
 
-	activeCount, err := a.db.GetActiveSessionCount(ctx, apiKeyID)
+	activeCount, err := a.db.GetAccountActiveSessionCount(ctx, accountID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get active session count", err)
 	}
@@ -190,10 +242,9 @@ func (a *AccountService) GetEnhancedUsage(ctx context.Context, input *GetEnhance
 		MaxMemoryMB:        limits.MemoryMB,
 	}
 
-	// Get hourly usage for last 24 hours
+	// Get hourly usage for the requested history; the last 24 hours are also returned hour by hour
 	now := time.Now().UTC()
-	start := now.Add(-24 * time.Hour)
-	hourlyUsage, err := a.db.GetHourlyAccountUsage(ctx, apiKeyID, start, now)
+	hourlyUsage, err := a.db.GetHourlyAccountUsage(ctx, accountID, now.AddDate(0, 0, -input.Days), now)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get hourly account usage", err)
 	}
@@ -201,49 +252,35 @@ func (a *AccountService) GetEnhancedUsage(ctx context.Context, input *GetEnhance
 	// Convert to API format
 	var hourlyAPIUsage []HourlyUsage
 	for _, h := range hourlyUsage {
+		if h.Hour.Before(now.Add(-24 * time.Hour)) {
+			continue
+		}
 		hourlyAPIUsage = append(hourlyAPIUsage, HourlyUsage{
-			Hour:       h.Hour.Format("2006-01-02T15:04:05Z07:00"),
-			Executions: h.Executions,
-			CostCents:  h.CostEstimateCents,
-			Errors:     h.Errors,
+			Hour:            h.Hour.Format("2006-01-02T15:04:05Z07:00"),
+			Executions:      h.Executions,
+			CostCents:       h.CostEstimateCents,
+			CPUMillis:       h.CPUMillisUsed,
+			MemoryMBSeconds: h.MemoryMBSeconds,
+			Errors:          h.Errors,
 		})
 	}
 
 	// Get daily usage history
-	dailyUsage, err := a.db.GetDailyAccountUsage(ctx, apiKeyID, input.Days)
+	dailyUsage, err := a.db.GetDailyAccountUsage(ctx, accountID, input.Days)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get daily account usage", err)
 	}
 
-	// Convert to API format and calculate cost estimate
-	var dailyAPIUsage []DayUsage
+	dailyAPIUsage := dayUsages(dailyUsage, hourlyUsage)
 	var totalCostEstimate int64
-	for _, d := range dailyUsage {
-		// Use consistent cost calculation - estimate with duration-based CPU usage
-		costCents := DefaultCostCalculator.CalculateSessionCost(d.DurationMs, d.DurationMs, 256)
-		totalCostEstimate += costCents
-
-		// Aggregate errors from hourly usage for this day
-		dayErrors := 0
-		for _, h := range hourlyUsage {
-			if h.Hour.Year() == d.Date.Year() && h.Hour.Month() == d.Date.Month() && h.Hour.Day() == d.Date.Day() {
-				dayErrors += h.Errors
-			}
-		}
-
-		dailyAPIUsage = append(dailyAPIUsage, DayUsage{
-			Date:       d.Date.Format("2006-01-02"),
-			Executions: d.Executions,
-			DurationMs: d.DurationMs,
-			CostCents:  costCents,
-			Errors:     dayErrors,
-		})
+	for _, d := range dailyAPIUsage {
+		totalCostEstimate += d.CostCents
 	}
 
 	// Build enhanced response
 	response := EnhancedUsageResponse{
 		UsageResponse:     usageResponse,
-		AccountID:         apiKeyID.String(),
+		AccountID:         accountID.String(),
 		HourlyUsage:       hourlyAPIUsage,
 		DailyHistory:      dailyAPIUsage,
 		CostEstimateCents: totalCostEstimate,
@@ -256,16 +293,16 @@ func (a *AccountService) GetEnhancedUsage(ctx context.Context, input *GetEnhance
 }
 
 // GetAccountLimits handles GET /v1/account/limits
-// Returns account limits for the authenticated API key.
+// Returns the limits of the authenticated account.
 func (a *AccountService) GetAccountLimits(ctx context.Context, input *GetAccountLimitsInput) (*GetAccountLimitsOutput, error) {
-	// Get API key ID from context
-	apiKeyID, ok := GetAPIKeyID(ctx)
+	// Get account from context
+	accountID, ok := callerAccountID(ctx)
 	if !ok {
 		return nil, huma.Error401Unauthorized("unauthorized")
 	}
 
 	// Get existing limits
-	limits, err := a.db.GetAccountLimits(ctx, apiKeyID)
+	limits, err := a.db.GetAccountLimits(ctx, accountID)
 	if err != nil {
 		// If not found, return default limits based on tier
 		if strings.Contains(err.Error(), "not found") {
@@ -304,10 +341,10 @@ func (a *AccountService) GetAccountLimits(ctx context.Context, input *GetAccount
 }
 
 // UpdateAccountLimits handles PUT /v1/account/limits
-// Updates account limits for the authenticated API key.
+// Updates the limits of the authenticated account.
 func (a *AccountService) UpdateAccountLimits(ctx context.Context, input *UpdateAccountLimitsInput) (*UpdateAccountLimitsOutput, error) {
-	// Get API key ID from context
-	apiKeyID, ok := GetAPIKeyID(ctx)
+	// Get account from context
+	accountID, ok := callerAccountID(ctx)
 	if !ok {
 		return nil, huma.Error401Unauthorized("unauthorized")
 	}
@@ -321,7 +358,7 @@ func (a *AccountService) UpdateAccountLimits(ctx context.Context, input *UpdateA
 
 	// Build updated limits, applying only non-nil fields
 	limits := &db.AccountLimits{
-		AccountID:                apiKeyID,
+		AccountID:                accountID,
 		DailyRequestsLimit:       existing.DailyRequestsLimit,
 		ConcurrentRequestsLimit:  existing.ConcurrentRequestsLimit,
 		MonthlyCostLimitCents:    existing.MonthlyCostLimitCents,
@@ -358,6 +395,8 @@ func (a *AccountService) UpdateAccountLimits(ctx context.Context, input *UpdateA
 		return nil, huma.Error500InternalServerError("failed to update account limits", err)
 	}
 
+	recordAudit(ctx, a.db, AuditLimitsUpdated, "", input.Body)
+
 	// Return updated limits
 	response := AccountLimitsResponse{
 		DailyRequestsLimit:      limits.DailyRequestsLimit,
@@ -374,54 +413,64 @@ func (a *AccountService) UpdateAccountLimits(ctx context.Context, input *UpdateA
 }
 
 // ExportUsage handles GET /v1/account/usage/export
-// Returns usage data in exportable format for the authenticated API key.
+// Returns usage data of the authenticated account in exportable format.
 func (a *AccountService) ExportUsage(ctx context.Context, input *ExportUsageInput) (*ExportUsageOutput, error) {
-	// Get API key ID from context
-	apiKeyID, ok := GetAPIKeyID(ctx)
+	// Get account from context
+	accountID, ok := callerAccountID(ctx)
 	if !ok {
 		return nil, huma.Error401Unauthorized("unauthorized")
 	}
 
 	// Get daily usage history
-	dailyUsage, err := a.db.GetDailyAccountUsage(ctx, apiKeyID, input.Days)
+	dailyUsage, err := a.db.GetDailyAccountUsage(ctx, accountID, input.Days)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get daily account usage", err)
 	}
 
-	// Get hourly usage for error calculation
+	// Get hourly usage for metered costs and errors
 	now := time.Now().UTC()
 	start := now.AddDate(0, 0, -input.Days) // Go back the requested number of days
-	hourlyUsage, err := a.db.GetHourlyAccountUsage(ctx, apiKeyID, start, now)
+	hourlyUsage, err := a.db.GetHourlyAccountUsage(ctx, accountID, start, now)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get hourly account usage", err)
 	}
 
-	// Convert to API format
-	var dailyAPIUsage []DayUsage
+	dailyAPIUsage := dayUsages(dailyUsage, hourlyUsage)
+
+	return &ExportUsageOutput{
+		Body: dailyAPIUsage,
+	}, nil
+}
+
+// dayUsages converts daily usage to API format, adding each day's metered cost,
+// CPU time, memory and errors from the hourly usage. Days without hourly usage,
+// recorded before sessions were metered, get a cost estimated from their duration.
+func dayUsages(dailyUsage []db.UsageMetric, hourlyUsage []db.HourlyAccountUsage) []DayUsage {
+	var days []DayUsage
 	for _, d := range dailyUsage {
-		// Use consistent cost calculation - estimate with duration-based CPU usage
-		costCents := DefaultCostCalculator.CalculateSessionCost(d.DurationMs, d.DurationMs, 256)
+		day := DayUsage{
+			Date:       d.Date.Format("2006-01-02"),
+			Executions: d.Executions,
+			DurationMs: d.DurationMs,
+		}
 
-		// Aggregate errors from hourly usage for this day
-		dayErrors := 0
+		metered := false
 		for _, h := range hourlyUsage {
 			if h.Hour.Year() == d.Date.Year() && h.Hour.Month() == d.Date.Month() && h.Hour.Day() == d.Date.Day() {
-				dayErrors += h.Errors
+				metered = true
+				day.CostCents += h.CostEstimateCents
+				day.CPUMillis += h.CPUMillisUsed
+				day.MemoryMBSeconds += h.MemoryMBSeconds
+				day.Errors += h.Errors
 			}
 		}
+		if !metered {
+			day.CostCents = DefaultCostCalculator.EstimateSessionCost(d.DurationMs)
+		}
 
-		dailyAPIUsage = append(dailyAPIUsage, DayUsage{
-			Date:       d.Date.Format("2006-01-02"),
-			Executions: d.Executions,
-			DurationMs: d.DurationMs,
-			CostCents:  costCents,
-			Errors:     dayErrors,
-		})
+		days = append(days, day)
 	}
-
-	return &ExportUsageOutput{
-		Body: dailyAPIUsage,
-	}, nil
+	return days
 }
 
 // ============================================================================
@@ -429,7 +478,8 @@ func (a *AccountService) ExportUsage(ctx context.Context, input *ExportUsageInpu
 // ============================================================================
 
 // ListAPIKeys handles GET /v1/account/keys
-// Returns all API keys for the authenticated account.
+// Returns the API keys of the authenticated account the caller may manage:
+// all of them for owners and admins, the caller's own for other members.
 func (a *AccountService) ListAPIKeys(ctx context.Context, input *ListAPIKeysInput) (*ListAPIKeysOutput, error) {
 	// Get API key ID from context (used as account ID for primary keys)
 	apiKeyID, ok := GetAPIKeyID(ctx)
@@ -452,6 +502,9 @@ func (a *AccountService) ListAPIKeys(ctx context.Context, input *ListAPIKeysInpu
 	// Convert to API response format
 	var keyResponses []APIKeyResponse
 	for _, k := range keys {
+		if authorizeKeyAccess(ctx, &k) != nil {
+			continue
+		}
 		keyResp := apiKeyToResponse(&k)
 		keyResponses = append(keyResponses, keyResp)
 	}
@@ -496,12 +549,33 @@ func (a *AccountService) CreateAPIKey(ctx context.Context, input *CreateAPIKeyIn
 		return nil, huma.Error400BadRequest("custom_concurrent_limit must be greater than 0")
 	}
 
+	// Validate scopes if provided
+	if input.Body.Scopes != nil {
+		if len(input.Body.Scopes) == 0 {
+			return nil, huma.Error400BadRequest("scopes must not be empty; omit them for an unrestricted key")
+		}
+		for _, scope := range input.Body.Scopes {
+			if !isValidScope(scope) {
+				return nil, huma.Error400BadRequest(fmt.Sprintf("unknown scope %q", scope))
+			}
+		}
+	}
+
 	// Get the current API key to find the account ID
 	currentKey, err := a.db.GetAPIKeyByID(ctx, apiKeyID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to get current API key", err)
 	}
 
+	// A scoped key only hands out its own scopes, and by default all of them
+	scopes := input.Body.Scopes
+	if scopes == nil {
+		scopes = currentKey.Scopes
+	}
+	if !scopesCovered(currentKey.Scopes, scopes) {
+		return nil, huma.Error403Forbidden("a scoped API key can only create keys with scopes it has")
+	}
+
 	// Get description
 	description := ""
 	if input.Body.Description != nil {
@@ -509,7 +583,7 @@ func (a *AccountService) CreateAPIKey(ctx context.Context, input *CreateAPIKeyIn
 	}
 
 	// Create the new key
-	newKey, err := a.db.CreateAPIKeyForAccount(ctx, currentKey.AccountID, input.Body.Name, description, apiKeyID)
+	newKey, err := a.db.CreateAPIKeyForAccount(ctx, currentKey.AccountID, input.Body.Name, description, apiKeyID, scopes)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to create API key", err)
 	}
@@ -549,6 +623,8 @@ func (a *AccountService) CreateAPIKey(ctx context.Context, input *CreateAPIKeyIn
 		}
 	}
 
+	recordAudit(ctx, a.db, AuditAPIKeyCreated, newKey.ID.String(), map[string]any{"name": input.Body.Name, "scopes": scopes})
+
 	// Build response with full key visible
 	keyResp := apiKeyToResponse(newKey)
 	return &CreateAPIKeyOutput{
@@ -589,10 +665,13 @@ func (a *AccountService) GetAPIKey(ctx context.Context, input *GetAPIKeyInput) (
 		return nil, huma.Error500InternalServerError("failed to get API key", err)
 	}
 
-	// Verify the key belongs to the same account
+	// Verify the key belongs to the same account and the caller may manage it
 	if targetKey.AccountID != currentKey.AccountID {
 		return nil, huma.Error404NotFound("API key not found")
 	}
+	if err := authorizeKeyAccess(ctx, targetKey); err != nil {
+		return nil, err
+	}
 
 	return &GetAPIKeyOutput{
 		Body: apiKeyToResponse(targetKey),
@@ -649,10 +728,17 @@ func (a *AccountService) UpdateAPIKey(ctx context.Context, input *UpdateAPIKeyIn
 		return nil, huma.Error500InternalServerError("failed to get API key", err)
 	}
 
-	// Verify the key belongs to the same account
+	// Verify the key belongs to the same account and the caller may manage it
 	if targetKey.AccountID != currentKey.AccountID {
 		return nil, huma.Error404NotFound("API key not found")
 	}
+	if err := authorizeKeyAccess(ctx, targetKey); err != nil {
+		return nil, err
+	}
+
+	if err := a.requireOwnerForPrimaryKey(ctx, targetKeyID); err != nil {
+		return nil, err
+	}
 
 	// Build update from input
 	update := &db.APIKeyUpdate{}
@@ -696,6 +782,8 @@ func (a *AccountService) UpdateAPIKey(ctx context.Context, input *UpdateAPIKeyIn
 		return nil, huma.Error500InternalServerError("failed to update API key", err)
 	}
 
+	recordAudit(ctx, a.db, AuditAPIKeyUpdated, targetKeyID.String(), input.Body)
+
 	// Get updated key
 	updatedKey, err := a.db.GetAPIKeyByID(ctx, targetKeyID)
 	if err != nil {
@@ -737,10 +825,13 @@ func (a *AccountService) DeleteAPIKey(ctx context.Context, input *DeleteAPIKeyIn
 		return nil, huma.Error500InternalServerError("failed to get API key", err)
 	}
 
-	// Verify the key belongs to the same account
+	// Verify the key belongs to the same account and the caller may manage it
 	if targetKey.AccountID != currentKey.AccountID {
 		return nil, huma.Error404NotFound("API key not found")
 	}
+	if err := authorizeKeyAccess(ctx, targetKey); err != nil {
+		return nil, err
+	}
 
 	// Check if this is the primary key
 	isPrimary, err := a.db.IsPrimaryKey(ctx, targetKeyID)
@@ -757,6 +848,8 @@ func (a *AccountService) DeleteAPIKey(ctx context.Context, input *DeleteAPIKeyIn
 		return nil, huma.Error500InternalServerError("failed to delete API key", err)
 	}
 
+	recordAudit(ctx, a.db, AuditAPIKeyDeleted, targetKeyID.String(), nil)
+
 	return &DeleteAPIKeyOutput{}, nil
 }
 
@@ -790,18 +883,33 @@ func (a *AccountService) RotateAPIKey(ctx context.Context, input *RotateAPIKeyIn
 		return nil, huma.Error500InternalServerError("failed to get API key", err)
 	}
 
-	// Verify the key belongs to the same account
+	// Verify the key belongs to the same account and the caller may manage it
 	if targetKey.AccountID != currentKey.AccountID {
 		return nil, huma.Error404NotFound("API key not found")
 	}
+	if err := authorizeKeyAccess(ctx, targetKey); err != nil {
+		return nil, err
+	}
+
+	if err := a.requireOwnerForPrimaryKey(ctx, targetKeyID); err != nil {
+		return nil, err
+	}
+
+	// Validate the overlap window
+	overlap := time.Duration(input.OverlapSeconds) * time.Second
+	if overlap < 0 || overlap > MaxRotationOverlap {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("overlap_seconds must be between 0 and %d", int(MaxRotationOverlap.Seconds())))
+	}
 
 	// Rotate the key
 	performedBy := currentKey.ID.String()
-	rotatedKey, err := a.db.RotateAPIKey(ctx, targetKeyID, performedBy)
+	rotatedKey, err := a.db.RotateAPIKey(ctx, targetKeyID, performedBy, overlap)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("failed to rotate API key", err)
 	}
 
+	recordAudit(ctx, a.db, AuditAPIKeyRotated, targetKeyID.String(), map[string]int{"overlap_seconds": input.OverlapSeconds})
+
 	// Build response with full key visible
 	keyResp := apiKeyToResponse(rotatedKey)
 	return &RotateAPIKeyOutput{
@@ -812,13 +920,47 @@ func (a *AccountService) RotateAPIKey(ctx context.Context, input *RotateAPIKeyIn
 	}, nil
 }
 
+// authorizeKeyAccess checks that the caller's role and scopes let them manage
+// a key of their account. Owners and admins manage every key, other members
+// only the keys issued to them, and a scoped key only keys with no scopes
+// beyond its own; keys they may not manage are reported as not found.
+func authorizeKeyAccess(ctx context.Context, key *db.APIKey) error {
+	if scopes, ok := GetScopes(ctx); ok && !scopesCovered(scopes, key.Scopes) {
+		return huma.Error404NotFound("API key not found")
+	}
+	if isManager(callerRole(ctx)) {
+		return nil
+	}
+	memberID, ok := GetMemberID(ctx)
+	if !ok || key.MemberID == nil || *key.MemberID != memberID {
+		return huma.Error404NotFound("API key not found")
+	}
+	return nil
+}
+
+// requireOwnerForPrimaryKey rejects changes to the account's primary key by
+// callers that are not owners.
+func (a *AccountService) requireOwnerForPrimaryKey(ctx context.Context, keyID uuid.UUID) error {
+	if callerRole(ctx) == RoleOwner {
+		return nil
+	}
+	isPrimary, err := a.db.IsPrimaryKey(ctx, keyID)
+	if err != nil {
+		return huma.Error500InternalServerError("failed to check primary key status", err)
+	}
+	if isPrimary {
+		return huma.Error403Forbidden("only owners can change the primary API key")
+	}
+	return nil
+}
+
 // apiKeyToResponse converts a db.APIKey to an APIKeyResponse.
 func apiKeyToResponse(k *db.APIKey) APIKeyResponse {
 	resp := APIKeyResponse{
 		ID:                    k.ID.String(),
 		Name:                  k.Name,
 		Description:           k.Description,
-		KeyPreview:            maskAPIKey(k.Key),
+		KeyPreview:            keyPreview(k),
 		IsActive:              k.IsActive,
 		CustomDailyLimit:      k.CustomDailyLimit,
 		CustomConcurrentLimit: k.CustomConcurrentLimit,
@@ -835,5 +977,17 @@ func apiKeyToResponse(k *db.APIKey) APIKeyResponse {
 		resp.LastUsedAt = &lastUsedAt
 	}
 
+	if k.MemberID != nil {
+		memberID := k.MemberID.String()
+		resp.MemberID = &memberID
+	}
+
+	resp.Scopes = k.Scopes
+
+	if k.RotatingExpiresAt != nil {
+		rotatingExpiresAt := k.RotatingExpiresAt.Format(time.RFC3339)
+		resp.RotatingKeyExpiresAt = &rotatingExpiresAt
+	}
+
 	return resp
 }
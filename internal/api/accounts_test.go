@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -74,6 +75,7 @@ func TestAccountService_GetEnhancedUsage_Success(t *testing.T) {
 		mockDB.sessions[sessionID] = &db.Session{
 			ID:        sessionID,
 			APIKeyID:  apiKeyID,
+			AccountID: apiKeyID,
 			Status:    status,
 			CreatedAt: time.Now().UTC(),
 		}
@@ -156,6 +158,73 @@ func TestAccountService_GetEnhancedUsage_Unauthorized(t *testing.T) {
 	assert.Contains(t, err.Error(), "unauthorized")
 }
 
+func TestAccountService_GetUsage_CountsAllKeysOfAccount(t *testing.T) {
+	mockDB := newExtendedMockHandlerDB()
+	accountID := uuid.New()
+	primaryKeyID := uuid.New()
+	subKeyID := uuid.New()
+
+	// One session from each key of the account, and one from another account
+	mockDB.sessions["sess_primary"] = &db.Session{ID: "sess_primary", APIKeyID: primaryKeyID, AccountID: accountID, Status: "running", CreatedAt: time.Now().UTC()}
+	mockDB.sessions["sess_sub"] = &db.Session{ID: "sess_sub", APIKeyID: subKeyID, AccountID: accountID, Status: "running", CreatedAt: time.Now().UTC()}
+	mockDB.sessions["sess_other"] = &db.Session{ID: "sess_other", APIKeyID: uuid.New(), AccountID: uuid.New(), Status: "running", CreatedAt: time.Now().UTC()}
+
+	service := NewAccountService(mockDB)
+	ctx := WithAccountID(WithAPIKeyID(context.Background(), subKeyID), accountID)
+	ctx = WithAPIKeyTier(ctx, "free")
+
+	usage, err := service.GetUsage(ctx, &GetUsageInput{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage.Body.SessionsToday)
+	assert.Equal(t, 2, usage.Body.ActiveSessions)
+
+	enhanced, err := service.GetEnhancedUsage(ctx, &GetEnhancedUsageInput{Days: 7})
+	require.NoError(t, err)
+	assert.Equal(t, 2, enhanced.Body.SessionsToday)
+	assert.Equal(t, accountID.String(), enhanced.Body.AccountID)
+}
+
+func TestAccountService_UpdateAccount(t *testing.T) {
+	mockDB := newExtendedMockHandlerDB()
+	service := NewAccountService(mockDB)
+
+	name := "Acme"
+	primary, err := mockDB.CreateAPIKey(context.Background(), "owner@example.com", &name)
+	require.NoError(t, err)
+	subKey, err := mockDB.CreateAPIKeyForAccount(context.Background(), primary.AccountID, "ci", "", primary.ID, nil)
+	require.NoError(t, err)
+
+	// A sub-key reads and updates the account it belongs to
+	ctx := WithAccountID(WithAPIKeyID(context.Background(), subKey.ID), primary.AccountID)
+
+	email := "team@example.com"
+	output, err := service.UpdateAccount(ctx, &UpdateAccountInput{Body: UpdateAccountRequest{Email: &email}})
+	require.NoError(t, err)
+	assert.Equal(t, primary.AccountID.String(), output.Body.ID)
+	require.NotNil(t, output.Body.Email)
+	assert.Equal(t, email, *output.Body.Email)
+	require.NotNil(t, output.Body.Name)
+	assert.Equal(t, "Acme", *output.Body.Name)
+	assert.Equal(t, subKey.ID.String(), output.Body.APIKeyID)
+
+	account, err := service.GetAccount(ctx, &GetAccountInput{})
+	require.NoError(t, err)
+	assert.Equal(t, email, *account.Body.Email)
+
+	_, err = service.UpdateAccount(ctx, &UpdateAccountInput{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no fields to update")
+
+	longName := strings.Repeat("a", 101)
+	_, err = service.UpdateAccount(ctx, &UpdateAccountInput{Body: UpdateAccountRequest{Name: &longName}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "100 characters")
+
+	_, err = service.UpdateAccount(context.Background(), &UpdateAccountInput{Body: UpdateAccountRequest{Email: &email}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+}
+
 func TestAccountService_GetAccountLimits_Success(t *testing.T) {
 	mockDB := newExtendedMockHandlerDB()
 	apiKeyID := uuid.New()
@@ -333,6 +402,40 @@ func TestAccountService_ExportUsage_Success(t *testing.T) {
 	assert.Equal(t, 1, output.Body[2].Errors) // From hourly data
 }
 
+func TestAccountService_ExportUsage_Metered(t *testing.T) {
+	mockDB := newExtendedMockHandlerDB()
+	apiKeyID := uuid.New()
+
+	now := time.Now().UTC()
+	mockDB.dailyUsage = []db.UsageMetric{
+		{Date: now.AddDate(0, 0, -1), Executions: 4, DurationMs: 60000},
+		{Date: now, Executions: 2, DurationMs: 30000},
+	}
+	// Only today has metered sessions
+	mockDB.hourlyUsage = []db.HourlyAccountUsage{
+		{Hour: now, Executions: 1, CostEstimateCents: 3, CPUMillisUsed: 12000, MemoryMBSeconds: 1920},
+		{Hour: now, Executions: 1, CostEstimateCents: 2, CPUMillisUsed: 500, MemoryMBSeconds: 640, Errors: 1},
+	}
+
+	service := NewAccountService(mockDB)
+	ctx := WithAPIKeyID(context.Background(), apiKeyID)
+
+	output, err := service.ExportUsage(ctx, &ExportUsageInput{Days: 2})
+
+	require.NoError(t, err)
+	require.Len(t, output.Body, 2)
+
+	// Days without hourly usage are estimated from their duration
+	assert.Equal(t, DefaultCostCalculator.EstimateSessionCost(60000), output.Body[0].CostCents)
+	assert.Equal(t, int64(0), output.Body[0].CPUMillis)
+
+	// Metered days report what sessions used
+	assert.Equal(t, int64(5), output.Body[1].CostCents)
+	assert.Equal(t, int64(12500), output.Body[1].CPUMillis)
+	assert.Equal(t, int64(2560), output.Body[1].MemoryMBSeconds)
+	assert.Equal(t, 1, output.Body[1].Errors)
+}
+
 func TestAccountService_ExportUsage_Unauthorized(t *testing.T) {
 	mockDB := newExtendedMockHandlerDB()
 	service := NewAccountService(mockDB)
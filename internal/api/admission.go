@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// Limit names reported in the error detail when a session is refused.
+const (
+	LimitKeyConcurrentSessions     = "key_concurrent_sessions"
+	LimitKeyDailySessions          = "key_daily_sessions"
+	LimitAccountConcurrentSessions = "account_concurrent_sessions"
+	LimitAccountDailySessions      = "account_daily_sessions"
+	LimitTierConcurrentSessions    = "tier_concurrent_sessions"
+	LimitTierDailySessions         = "tier_daily_sessions"
+	LimitAccountMonthlyCost        = "account_monthly_cost"
+)
+
+// APIKeyLimits are the custom session limits set on an API key.
+// A nil field means the key has no limit of its own.
+type APIKeyLimits struct {
+	DailySessions      *int
+	ConcurrentSessions *int
+}
+
+// sessionLimit is a single limit a new session is checked against.
+type sessionLimit struct {
+	name  string // One of the Limit* constants
+	scope string // What the limit applies to, for the error message
+	kind  string // "concurrent" or "daily"
+	max   int
+	used  int
+}
+
+// admitSession checks whether the caller may create another session. Per-key
+// custom limits, account limits and tier limits all apply; if several are
+// reached, the 429 names the strictest. Sessions within those limits are then
+// checked against the account's monthly cost limit.
+func (s *SessionService) admitSession(ctx context.Context, apiKeyID uuid.UUID, tier string) error {
+	accountID, accountLimits, err := s.accountLimits(ctx)
+	if err != nil {
+		return err
+	}
+
+	limits, err := s.sessionLimits(ctx, apiKeyID, tier, accountID, accountLimits)
+	if err != nil {
+		return err
+	}
+
+	var hit *sessionLimit
+	for i := range limits {
+		limit := &limits[i]
+		if limit.used >= limit.max && (hit == nil || limit.max < hit.max) {
+			hit = limit
+		}
+	}
+	if hit != nil {
+		return huma.NewError(http.StatusTooManyRequests,
+			fmt.Sprintf("%s session limit reached for this %s (%d/%d)", hit.kind, hit.scope, hit.used, hit.max),
+			&huma.ErrorDetail{
+				Message:  fmt.Sprintf("%s session limit reached", hit.kind),
+				Location: "limit",
+				Value:    hit.name,
+			},
+		)
+	}
+
+	if accountLimits == nil {
+		return nil
+	}
+	return s.checkBudget(ctx, accountID, accountLimits)
+}
+
+// accountLimits loads the limits of the account owning the caller's API key.
+// Returns nil limits if the account is unknown or has no limits row.
+func (s *SessionService) accountLimits(ctx context.Context) (uuid.UUID, *db.AccountLimits, error) {
+	accountID, ok := GetAccountID(ctx)
+	if !ok || accountID == uuid.Nil {
+		return uuid.Nil, nil, nil
+	}
+
+	limits, err := s.db.GetAccountLimits(ctx, accountID)
+	if err != nil {
+		// Accounts without a limits row are only bound by key and tier limits
+		if strings.Contains(err.Error(), "not found") {
+			return accountID, nil, nil
+		}
+		return uuid.Nil, nil, huma.Error500InternalServerError(fmt.Sprintf("failed to get account limits: %v", err))
+	}
+	return accountID, limits, nil
+}
+
+// sessionLimits collects every limit that applies to the caller, with current
+// usage. Unlimited values are left out, and counts are only queried when a
+// limit needs them.
+func (s *SessionService) sessionLimits(ctx context.Context, apiKeyID uuid.UUID, tier string, accountID uuid.UUID, accountLimits *db.AccountLimits) ([]sessionLimit, error) {
+	tierLimits := GetTierLimits(tier)
+	keyLimits, _ := GetAPIKeyLimits(ctx)
+
+	var limits []sessionLimit
+
+	// Key scope: the tier limits and the key's own overrides
+	var concurrent []sessionLimit
+	if !IsUnlimited(tierLimits.ConcurrentSessions) {
+		concurrent = append(concurrent, sessionLimit{name: LimitTierConcurrentSessions, scope: "tier", max: tierLimits.ConcurrentSessions})
+	}
+	if keyLimits.ConcurrentSessions != nil && !IsUnlimited(*keyLimits.ConcurrentSessions) {
+		concurrent = append(concurrent, sessionLimit{name: LimitKeyConcurrentSessions, scope: "API key", max: *keyLimits.ConcurrentSessions})
+	}
+	if len(concurrent) > 0 {
+		activeCount, err := s.db.GetActiveSessionCount(ctx, apiKeyID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to check concurrent sessions: %v", err))
+		}
+		limits = appendUsage(limits, concurrent, "concurrent", activeCount)
+	}
+
+	var daily []sessionLimit
+	if !IsUnlimited(tierLimits.SessionsPerDay) {
+		daily = append(daily, sessionLimit{name: LimitTierDailySessions, scope: "tier", max: tierLimits.SessionsPerDay})
+	}
+	if keyLimits.DailySessions != nil && !IsUnlimited(*keyLimits.DailySessions) {
+		daily = append(daily, sessionLimit{name: LimitKeyDailySessions, scope: "API key", max: *keyLimits.DailySessions})
+	}
+	if len(daily) > 0 {
+		dailyCount, err := s.db.GetDailySessionCount(ctx, apiKeyID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to check daily sessions: %v", err))
+		}
+		limits = appendUsage(limits, daily, "daily", dailyCount)
+	}
+
+	// Account scope: shared by every key of the account
+	if accountLimits == nil {
+		return limits, nil
+	}
+
+	if !IsUnlimited(accountLimits.ConcurrentRequestsLimit) {
+		activeCount, err := s.db.GetAccountActiveSessionCount(ctx, accountID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to check account concurrent sessions: %v", err))
+		}
+		limits = appendUsage(limits, []sessionLimit{
+			{name: LimitAccountConcurrentSessions, scope: "account", max: accountLimits.ConcurrentRequestsLimit},
+		}, "concurrent", activeCount)
+	}
+	if !IsUnlimited(accountLimits.DailyRequestsLimit) {
+		dailyCount, err := s.db.GetAccountDailySessionCount(ctx, accountID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to check account daily sessions: %v", err))
+		}
+		limits = appendUsage(limits, []sessionLimit{
+			{name: LimitAccountDailySessions, scope: "account", max: accountLimits.DailyRequestsLimit},
+		}, "daily", dailyCount)
+	}
+
+	return limits, nil
+}
+
+// appendUsage fills in kind and current usage for limits that share a counter.
+func appendUsage(limits, add []sessionLimit, kind string, used int) []sessionLimit {
+	for _, limit := range add {
+		limit.kind = kind
+		limit.used = used
+		limits = append(limits, limit)
+	}
+	return limits
+}
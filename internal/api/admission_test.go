@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// addSessions adds n sessions with the given status for an API key of an account.
+func addSessions(mockDB *mockHandlerDB, apiKeyID, accountID uuid.UUID, status string, n int) {
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("sess_%s_%d", uuid.NewString()[:8], i)
+		mockDB.sessions[id] = &db.Session{
+			ID:        id,
+			APIKeyID:  apiKeyID,
+			AccountID: accountID,
+			Status:    status,
+			CreatedAt: time.Now().UTC(),
+		}
+	}
+}
+
+func TestSessionService_AdmitSession(t *testing.T) {
+	tests := []struct {
+		name          string
+		tier          string
+		keyLimits     APIKeyLimits
+		accountLimits *db.AccountLimits
+		active        int // Active sessions of the calling key
+		stopped       int // Sessions of the calling key that ended today
+		otherActive   int // Active sessions of another key in the same account
+		wantLimit     string
+	}{
+		{name: "within all limits", tier: TierFree, active: 1},
+		{name: "key concurrent override", tier: TierFree, keyLimits: APIKeyLimits{ConcurrentSessions: intPtr(2)}, active: 2, wantLimit: LimitKeyConcurrentSessions},
+		{name: "key daily override", tier: TierFree, keyLimits: APIKeyLimits{DailySessions: intPtr(3)}, stopped: 3, wantLimit: LimitKeyDailySessions},
+		{
+			name:          "account concurrent shared by keys",
+			tier:          TierFree,
+			accountLimits: &db.AccountLimits{DailyRequestsLimit: 100, ConcurrentRequestsLimit: 1},
+			otherActive:   1,
+			wantLimit:     LimitAccountConcurrentSessions,
+		},
+		{
+			name:          "account daily",
+			tier:          TierPro,
+			accountLimits: &db.AccountLimits{DailyRequestsLimit: 4, ConcurrentRequestsLimit: -1},
+			stopped:       2,
+			otherActive:   2,
+			wantLimit:     LimitAccountDailySessions,
+		},
+		{
+			name:          "strictest of several reached limits",
+			tier:          TierFree,
+			keyLimits:     APIKeyLimits{ConcurrentSessions: intPtr(3)},
+			accountLimits: &db.AccountLimits{DailyRequestsLimit: 100, ConcurrentRequestsLimit: 2},
+			active:        3,
+			wantLimit:     LimitAccountConcurrentSessions,
+		},
+		{name: "override cannot raise tier limit", tier: TierFree, keyLimits: APIKeyLimits{ConcurrentSessions: intPtr(10)}, active: 5, wantLimit: LimitTierConcurrentSessions},
+		{
+			name:          "unlimited everywhere",
+			tier:          TierEnterprise,
+			keyLimits:     APIKeyLimits{ConcurrentSessions: intPtr(-1), DailySessions: intPtr(-1)},
+			accountLimits: &db.AccountLimits{DailyRequestsLimit: -1, ConcurrentRequestsLimit: -1},
+			active:        100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := newExtendedMockHandlerDB()
+			mockDB.accountLimits = tt.accountLimits
+			apiKeyID, accountID := uuid.New(), uuid.New()
+			addSessions(mockDB.mockHandlerDB, apiKeyID, accountID, SessionStatusRunning, tt.active)
+			addSessions(mockDB.mockHandlerDB, apiKeyID, accountID, SessionStatusStopped, tt.stopped)
+			addSessions(mockDB.mockHandlerDB, uuid.New(), accountID, SessionStatusRunning, tt.otherActive)
+
+			ctx := WithAPIKeyLimits(WithAccountID(context.Background(), accountID), tt.keyLimits)
+			err := NewSessionService(mockDB, &mockBackendHandler{}).admitSession(ctx, apiKeyID, tt.tier)
+
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("expected session to be admitted, got %v", err)
+				}
+				return
+			}
+
+			var model *huma.ErrorModel
+			if !errors.As(err, &model) {
+				t.Fatalf("expected huma error, got %v", err)
+			}
+			if model.Status != http.StatusTooManyRequests {
+				t.Errorf("expected status 429, got %d", model.Status)
+			}
+			if len(model.Errors) != 1 || model.Errors[0].Value != tt.wantLimit {
+				t.Errorf("expected limit %s in error details, got %+v", tt.wantLimit, model.Errors)
+			}
+		})
+	}
+}
+
+func TestSessionService_CreateSession_LimitReached(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	apiKeyID, accountID := uuid.New(), uuid.New()
+	addSessions(mockDB, apiKeyID, accountID, SessionStatusStopped, 1)
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+
+	ctx := WithAPIKeyTier(WithAPIKeyID(context.Background(), apiKeyID), TierFree)
+	ctx = WithAccountID(ctx, accountID)
+	ctx = WithAPIKeyLimits(ctx, APIKeyLimits{DailySessions: intPtr(2)})
+	input := &CreateSessionInput{Body: CreateSessionRequest{Image: "python:3.12"}}
+
+	// The first session fits and is attributed to the key's account
+	output, err := sessionSvc.CreateSession(ctx, input)
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if got := mockDB.sessions[output.Body.ID].AccountID; got != accountID {
+		t.Errorf("expected session account %s, got %s", accountID, got)
+	}
+
+	_, err = sessionSvc.CreateSession(ctx, input)
+	var model *huma.ErrorModel
+	if !errors.As(err, &model) || model.Status != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %v", err)
+	}
+	if want := "daily session limit reached for this API key (2/2)"; model.Detail != want {
+		t.Errorf("expected detail %q, got %q", want, model.Detail)
+	}
+}
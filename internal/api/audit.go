@@ -0,0 +1,290 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Audit log actions
+const (
+	AuditAccessDenied      = "access.denied"
+	AuditAccountUpdated    = "account.updated"
+	AuditLimitsUpdated     = "account.limits_updated"
+	AuditAPIKeyCreated     = "api_key.created"
+	AuditAPIKeyUpdated     = "api_key.updated"
+	AuditAPIKeyDeleted     = "api_key.deleted"
+	AuditAPIKeyRotated     = "api_key.rotated"
+	AuditRotatingKeyUsed   = "api_key.rotating_key_used"
+	AuditMemberInvited     = "member.invited"
+	AuditMemberJoined      = "member.joined"
+	AuditMemberRoleChanged = "member.role_changed"
+	AuditMemberRemoved     = "member.removed"
+	AuditInvitationRevoked = "invitation.revoked"
+	AuditSessionCreated    = "session.created"
+	AuditSessionExec       = "session.exec"
+)
+
+// AuditService serves the audit log of the authenticated account.
+type AuditService struct {
+	db DBClient
+}
+
+// NewAuditService creates a new AuditService.
+func NewAuditService(db DBClient) *AuditService {
+	return &AuditService{db: db}
+}
+
+// ListAuditLog handles GET /v1/account/audit
+// Returns the account's audit log newest first, a page at a time. The
+// response carries next_cursor while older entries match.
+func (s *AuditService) ListAuditLog(ctx context.Context, input *ListAuditLogInput) (*ListAuditLogOutput, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	filter, err := input.AuditLogFilter.toDB()
+	if err != nil {
+		return nil, err
+	}
+	if input.Cursor != "" {
+		createdAt, id, err := decodeCursor(input.Cursor)
+		if err != nil {
+			return nil, huma.Error400BadRequest("invalid cursor")
+		}
+		filter.BeforeCreatedAt = &createdAt
+		if filter.BeforeID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			return nil, huma.Error400BadRequest("invalid cursor")
+		}
+	}
+	// One more than a page tells whether another page follows
+	filter.Limit = input.Limit + 1
+
+	entries, err := s.db.ListAuditEntries(ctx, accountID, filter)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to list audit log", err)
+	}
+
+	resp := ListAuditLogResponse{Entries: make([]AuditEntryResponse, 0, len(entries))}
+	if len(entries) > input.Limit {
+		entries = entries[:input.Limit]
+		last := entries[len(entries)-1]
+		cursor := encodeCursor(last.CreatedAt, strconv.FormatInt(last.ID, 10))
+		resp.NextCursor = &cursor
+	}
+	for i := range entries {
+		resp.Entries = append(resp.Entries, auditEntryToResponse(&entries[i]))
+	}
+
+	return &ListAuditLogOutput{Body: resp}, nil
+}
+
+// ExportAuditLog handles GET /v1/account/audit/export
+// Returns every matching entry of the account's audit log, newest first, as a
+// JSON array or a CSV file. Exports matching more than MaxAuditExportEntries
+// entries are refused; narrow them with since and until.
+func (s *AuditService) ExportAuditLog(ctx context.Context, input *ExportAuditLogInput) (*ExportAuditLogOutput, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	filter, err := input.AuditLogFilter.toDB()
+	if err != nil {
+		return nil, err
+	}
+	filter.Limit = MaxAuditExportEntries + 1
+
+	entries, err := s.db.ListAuditEntries(ctx, accountID, filter)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to list audit log", err)
+	}
+	if len(entries) > MaxAuditExportEntries {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("more than %d entries match; narrow the export with since and until", MaxAuditExportEntries))
+	}
+
+	responses := make([]AuditEntryResponse, 0, len(entries))
+	for i := range entries {
+		responses = append(responses, auditEntryToResponse(&entries[i]))
+	}
+
+	if input.Format == "csv" {
+		body, err := auditEntriesCSV(responses)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("failed to encode audit log", err)
+		}
+		return &ExportAuditLogOutput{
+			ContentType:        "text/csv",
+			ContentDisposition: `attachment; filename="audit-log.csv"`,
+			Body:               body,
+		}, nil
+	}
+
+	body, err := json.Marshal(responses)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to encode audit log", err)
+	}
+	return &ExportAuditLogOutput{
+		ContentType:        "application/json",
+		ContentDisposition: `attachment; filename="audit-log.json"`,
+		Body:               body,
+	}, nil
+}
+
+// toDB parses the filter's query parameters.
+func (f *AuditLogFilter) toDB() (*db.AuditFilter, error) {
+	filter := &db.AuditFilter{Action: f.Action}
+	if f.ActorKeyID != "" {
+		id, err := parseUUID(f.ActorKeyID)
+		if err != nil {
+			return nil, huma.Error400BadRequest("invalid actor_key_id format")
+		}
+		filter.ActorKeyID = &id
+	}
+	if f.ActorMemberID != "" {
+		id, err := parseUUID(f.ActorMemberID)
+		if err != nil {
+			return nil, huma.Error400BadRequest("invalid actor_member_id format")
+		}
+		filter.ActorMemberID = &id
+	}
+	if f.Since != "" {
+		since, err := time.Parse(time.RFC3339, f.Since)
+		if err != nil {
+			return nil, huma.Error400BadRequest("since must be an RFC3339 timestamp")
+		}
+		filter.Since = &since
+	}
+	if f.Until != "" {
+		until, err := time.Parse(time.RFC3339, f.Until)
+		if err != nil {
+			return nil, huma.Error400BadRequest("until must be an RFC3339 timestamp")
+		}
+		filter.Until = &until
+	}
+	return filter, nil
+}
+
+// auditEntriesCSV encodes audit log entries as CSV with a header row. Details
+// are kept as JSON. Cells are neutralized with csvCell.
+func auditEntriesCSV(entries []AuditEntryResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"id", "created_at", "action", "target", "actor_key_id", "actor_member_id", "ip_address", "details"})
+	for _, e := range entries {
+		_ = w.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt,
+			csvCell(e.Action),
+			csvCell(stringOrEmpty(e.Target)),
+			stringOrEmpty(e.ActorKeyID),
+			stringOrEmpty(e.ActorMemberID),
+			csvCell(stringOrEmpty(e.IPAddress)),
+			csvCell(string(e.Details)),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// csvCell keeps a user-controlled value from running as a formula when the
+// CSV is opened in a spreadsheet, by prefixing values that start like one
+// with a single quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// auditEntryToResponse converts a db.AuditEntry to an AuditEntryResponse.
+func auditEntryToResponse(entry *db.AuditEntry) AuditEntryResponse {
+	resp := AuditEntryResponse{
+		ID:        entry.ID,
+		Action:    entry.Action,
+		Target:    entry.Target,
+		IPAddress: entry.IPAddress,
+		Details:   entry.Details,
+		CreatedAt: entry.CreatedAt.Format(time.RFC3339),
+	}
+	if entry.ActorKeyID != nil {
+		id := entry.ActorKeyID.String()
+		resp.ActorKeyID = &id
+	}
+	if entry.ActorMemberID != nil {
+		id := entry.ActorMemberID.String()
+		resp.ActorMemberID = &id
+	}
+	return resp
+}
+
+// recordRotatingKeyUse records an authentication with the previous value of a
+// key whose rotation overlap has not ended yet.
+func recordRotatingKeyUse(ctx context.Context, dbClient DBClient, key *db.APIKey) {
+	var details map[string]string
+	if key.RotatingExpiresAt != nil {
+		details = map[string]string{"rotating_key_expires_at": key.RotatingExpiresAt.Format(time.RFC3339)}
+	}
+	recordAudit(ctx, dbClient, AuditRotatingKeyUsed, key.ID.String(), details)
+}
+
+// recordAudit appends an entry to the caller's account audit log, with the
+// calling key and member as the actor and the client IP. target is the ID of what was acted on,
+// empty if the account itself; details is encoded as JSON if non-nil.
+// Failures are logged rather than failing the request that was audited.
+func recordAudit(ctx context.Context, dbClient DBClient, action, target string, details any) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return
+	}
+
+	entry := &db.AuditEntry{
+		AccountID: accountID,
+		Action:    action,
+	}
+	if keyID, ok := GetAPIKeyID(ctx); ok {
+		entry.ActorKeyID = &keyID
+	}
+	if memberID, ok := GetMemberID(ctx); ok {
+		entry.ActorMemberID = &memberID
+	}
+	if ip, ok := GetClientIP(ctx); ok && ip != "" {
+		entry.IPAddress = &ip
+	}
+	if target != "" {
+		entry.Target = &target
+	}
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			slog.Warn("failed to encode audit details", "error", err, "action", action)
+		} else {
+			entry.Details = data
+		}
+	}
+
+	if err := dbClient.CreateAuditEntry(ctx, entry); err != nil {
+		slog.Warn("failed to record audit entry", "error", err, "action", action, "account_id", accountID)
+	}
+}
+
+// stringOrEmpty returns *s, or "" if s is nil.
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
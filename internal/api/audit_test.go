@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditService_ListAuditLog(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	dev := inviteMember(t, mock, owner, "dev@example.com", RoleDeveloper)
+	service := NewAuditService(mock)
+	ctx := memberCtx(owner)
+
+	recordAudit(memberCtx(dev), mock, AuditAPIKeyCreated, "key-1", nil)
+	recordAudit(ctx, mock, AuditAPIKeyRotated, "key-1", nil)
+	recordAudit(ctx, mock, AuditAccountUpdated, "", nil)
+
+	// Another account's entries are never listed
+	other, err := mock.CreateAPIKey(context.Background(), "other@example.com", nil)
+	require.NoError(t, err)
+	recordAudit(memberCtx(other), mock, AuditAccountUpdated, "", nil)
+
+	list := func(filter AuditLogFilter) []string {
+		t.Helper()
+		output, err := service.ListAuditLog(ctx, &ListAuditLogInput{AuditLogFilter: filter, Limit: 50})
+		require.NoError(t, err)
+		actions := make([]string, 0, len(output.Body.Entries))
+		for _, entry := range output.Body.Entries {
+			actions = append(actions, entry.Action)
+		}
+		return actions
+	}
+
+	assert.Equal(t, []string{AuditAccountUpdated, AuditAPIKeyRotated, AuditAPIKeyCreated, AuditMemberJoined, AuditMemberInvited}, list(AuditLogFilter{}))
+	assert.Equal(t, []string{AuditAPIKeyRotated, AuditAPIKeyCreated}, list(AuditLogFilter{Action: "api_key.*"}))
+	assert.Equal(t, []string{AuditAPIKeyRotated}, list(AuditLogFilter{Action: AuditAPIKeyRotated}))
+	assert.Equal(t, []string{AuditAPIKeyCreated, AuditMemberJoined}, list(AuditLogFilter{ActorKeyID: dev.ID.String()}))
+	assert.Equal(t, []string{AuditAPIKeyCreated, AuditMemberJoined}, list(AuditLogFilter{ActorMemberID: dev.MemberID.String()}))
+	assert.Empty(t, list(AuditLogFilter{Since: "2999-01-01T00:00:00Z"}))
+	assert.Empty(t, list(AuditLogFilter{Until: "2000-01-01T00:00:00Z"}))
+}
+
+func TestAuditService_ListAuditLog_Pagination(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	service := NewAuditService(mock)
+	ctx := memberCtx(owner)
+
+	for range 5 {
+		recordAudit(ctx, mock, AuditAccountUpdated, "", nil)
+	}
+
+	var ids []int64
+	cursor := ""
+	for pages := 1; ; pages++ {
+		require.LessOrEqual(t, pages, 3, "expected 3 pages")
+		output, err := service.ListAuditLog(ctx, &ListAuditLogInput{Cursor: cursor, Limit: 2})
+		require.NoError(t, err)
+		for _, entry := range output.Body.Entries {
+			ids = append(ids, entry.ID)
+		}
+		if output.Body.NextCursor == nil {
+			break
+		}
+		cursor = *output.Body.NextCursor
+	}
+	assert.Equal(t, []int64{5, 4, 3, 2, 1}, ids)
+}
+
+func TestAuditService_ListAuditLog_InvalidInput(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	service := NewAuditService(mock)
+
+	tests := []struct {
+		name  string
+		input ListAuditLogInput
+	}{
+		{"cursor", ListAuditLogInput{Cursor: "not-a-cursor"}},
+		{"cursor id", ListAuditLogInput{Cursor: encodeCursor(owner.CreatedAt, "abc")}},
+		{"since", ListAuditLogInput{AuditLogFilter: AuditLogFilter{Since: "yesterday"}}},
+		{"actor key", ListAuditLogInput{AuditLogFilter: AuditLogFilter{ActorKeyID: "key"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.Limit = 50
+			_, err := service.ListAuditLog(memberCtx(owner), &tt.input)
+			requireStatus(t, err, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestAuditService_ExportAuditLog(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	service := NewAuditService(mock)
+	ctx := WithClientIP(memberCtx(owner), "203.0.113.7")
+
+	recordAudit(ctx, mock, AuditAPIKeyRotated, owner.ID.String(), map[string]string{"reason": "scheduled"})
+	recordAudit(ctx, mock, AuditAccountUpdated, "", nil)
+
+	output, err := service.ExportAuditLog(ctx, &ExportAuditLogInput{Format: "json"})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", output.ContentType)
+	var entries []AuditEntryResponse
+	require.NoError(t, json.Unmarshal(output.Body, &entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, AuditAccountUpdated, entries[0].Action)
+	require.NotNil(t, entries[1].IPAddress)
+	assert.Equal(t, "203.0.113.7", *entries[1].IPAddress)
+	assert.JSONEq(t, `{"reason":"scheduled"}`, string(entries[1].Details))
+
+	output, err = service.ExportAuditLog(ctx, &ExportAuditLogInput{
+		AuditLogFilter: AuditLogFilter{Action: AuditAPIKeyRotated},
+		Format:         "csv",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv", output.ContentType)
+	assert.Contains(t, output.ContentDisposition, "audit-log.csv")
+	records, err := csv.NewReader(strings.NewReader(string(output.Body))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, []string{"id", "created_at", "action", "target", "actor_key_id", "actor_member_id", "ip_address", "details"}, records[0])
+	assert.Equal(t, AuditAPIKeyRotated, records[1][2])
+	assert.Equal(t, owner.ID.String(), records[1][3])
+	assert.Equal(t, "203.0.113.7", records[1][6])
+}
+
+func TestAuditService_ExportAuditLog_NeutralizesFormulas(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	service := NewAuditService(mock)
+
+	recordAudit(memberCtx(owner), mock, AuditMemberInvited, `=HYPERLINK("https://evil.example","x")`, nil)
+
+	output, err := service.ExportAuditLog(memberCtx(owner), &ExportAuditLogInput{Format: "csv"})
+	require.NoError(t, err)
+	records, err := csv.NewReader(strings.NewReader(string(output.Body))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, `'=HYPERLINK("https://evil.example","x")`, records[1][3])
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: ""},
+		{input: "owner@example.com", want: "owner@example.com"},
+		{input: "=1+1", want: "'=1+1"},
+		{input: "+1", want: "'+1"},
+		{input: "-1", want: "'-1"},
+		{input: "@SUM(A1)", want: "'@SUM(A1)"},
+		{input: "\t=1", want: "'\t=1"},
+		{input: "a=1", want: "a=1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, csvCell(tt.input), "input %q", tt.input)
+	}
+}
+
+func TestAuditService_ExportAuditLog_TooManyEntries(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	service := NewAuditService(mock)
+
+	for range MaxAuditExportEntries + 1 {
+		require.NoError(t, mock.CreateAuditEntry(context.Background(), &db.AuditEntry{AccountID: owner.AccountID, Action: AuditAccountUpdated}))
+	}
+
+	_, err = service.ExportAuditLog(memberCtx(owner), &ExportAuditLogInput{Format: "json"})
+	requireStatus(t, err, http.StatusBadRequest)
+}
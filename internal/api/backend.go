@@ -17,6 +17,15 @@ type Session struct {
 	ExitCode  *int      // Exit code if session has completed
 }
 
+// ResourceUsage is a sample of the resources a session has consumed so far.
+// Backends report either cumulative CPU time or, where they only see a rate,
+// current CPU use, which the meter integrates between samples.
+type ResourceUsage struct {
+	CPUMillis         int64 // CPU time used since the session started
+	CPURateMillicores int64 // Current CPU use, for backends without cumulative accounting
+	MemoryPeakMB      int64 // Highest memory use, or current use where the backend tracks no peak
+}
+
 // SessionNetwork contains network configuration for a session.
 type SessionNetwork struct {
 	Mode  string                  // Network mode: none, outgoing, exposed
@@ -35,6 +44,9 @@ type BackendPortInfo struct {
 // CreateSessionConfig contains configuration for creating a new session.
 // This maps from the API's CreateSessionRequest to a backend-agnostic format.
 type CreateSessionConfig struct {
+	// SessionID is the API session the backend resource is created for
+	SessionID string
+
 	// Container configuration
 	Image   string            // Container image
 	Command []string          // Command to run
@@ -73,13 +85,47 @@ type Backend interface {
 	StopSession(ctx context.Context, sessionID string) error
 
 	// DestroySession permanently destroys a session and releases all resources.
+	// A session that is already gone counts as destroyed.
 	DestroySession(ctx context.Context, sessionID string) error
 
+	// ListSessions returns every session the backend currently runs or retains,
+	// whether or not the API has a record of it.
+	ListSessions(ctx context.Context) ([]*Session, error)
+
 	// AttachSession returns I/O streams for a running session.
 	// Returns stdin writer, stdout reader, stderr reader, and a wait function.
 	// The wait function blocks until the session exits and returns the exit code.
 	Attach(ctx context.Context, sessionID string) (stdin io.WriteCloser, stdout io.Reader, stderr io.Reader, wait func() int, err error)
 
+	// Exec runs a one-shot command inside a running session and waits for it to finish.
+	// A non-zero exit code is not an error; err is only set when the command could not run.
+	// Implementations must honour ctx cancellation so callers can apply timeouts.
+	Exec(ctx context.Context, sessionID string, cmd []string) (stdout, stderr string, exitCode int, err error)
+
+	// WriteFile writes content to an absolute path inside a running session,
+	// creating parent directories as needed.
+	WriteFile(ctx context.Context, sessionID, path string, content []byte) error
+
+	// ReadFile reads a regular file from a running session.
+	// Returns ErrFileNotFound if the path is not a regular file and ErrFileTooLarge
+	// if the file is larger than maxSize bytes.
+	ReadFile(ctx context.Context, sessionID, path string, maxSize int64) ([]byte, error)
+
+	// Usage samples the CPU time and memory a running session has used.
+	Usage(ctx context.Context, sessionID string) (*ResourceUsage, error)
+
+	// URL returns a URL through which a container port of a running session can be reached.
+	// The port must have been exposed when the session was created.
+	URL(ctx context.Context, sessionID string, port int) (string, error)
+
 	// Name returns the backend name (e.g., "fly", "kubernetes").
 	Name() string
 }
+
+// StatusWatcher is implemented by backends that notice status changes of
+// their sessions as they happen, rather than only when asked.
+type StatusWatcher interface {
+	// WatchStatus sets the function called with the backend ID, the new
+	// status and, for sessions that ended, the exit code.
+	WatchStatus(fn func(backendID, status string, exitCode *int))
+}
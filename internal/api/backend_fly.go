@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -9,6 +10,11 @@ import (
 	"github.com/burka/execbox-cloud/internal/backend/fly"
 )
 
+// flySessionMetadataKey tags the machines created for sessions with their
+// session ID. The app also runs the control plane and image build machines,
+// so only machines carrying this tag are treated as sessions.
+const flySessionMetadataKey = "execbox_session"
+
 // FlyBackend wraps a Fly.io client to implement the Backend interface.
 type FlyBackend struct {
 	client FlyClient
@@ -33,6 +39,7 @@ func (b *FlyBackend) CreateSession(ctx context.Context, config *CreateSessionCon
 		Cmd:         config.Command,
 		Env:         config.Env,
 		AutoDestroy: config.AutoDestroy,
+		Metadata:    map[string]string{flySessionMetadataKey: config.SessionID},
 	}
 
 	// Add resource configuration
@@ -111,10 +118,50 @@ func (b *FlyBackend) CreateSession(ctx context.Context, config *CreateSessionCon
 }
 
 // GetSession retrieves session information for a Fly machine.
-// Note: This is not currently implemented for Fly backend since the FlyClient
-// interface doesn't expose GetMachine. Session state is tracked in the database.
 func (b *FlyBackend) GetSession(ctx context.Context, sessionID string) (*Session, error) {
-	return nil, fmt.Errorf("GetSession not implemented for Fly backend - use database for session state")
+	machine, err := b.client.GetMachine(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fly machine: %w", err)
+	}
+	return machineToSession(machine), nil
+}
+
+// ListSessions lists the app's session machines: those tagged with a session
+// ID at creation. Every other machine in the app is left out.
+func (b *FlyBackend) ListSessions(ctx context.Context) ([]*Session, error) {
+	machines, err := b.client.ListMachines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fly machines: %w", err)
+	}
+
+	sessions := make([]*Session, 0, len(machines))
+	for i := range machines {
+		machine := &machines[i]
+		if !isSessionMachine(machine) {
+			continue
+		}
+		sessions = append(sessions, machineToSession(machine))
+	}
+	return sessions, nil
+}
+
+// isSessionMachine reports whether a machine was created for a session.
+func isSessionMachine(machine *fly.Machine) bool {
+	return machine.Config != nil && machine.Config.Metadata[flySessionMetadataKey] != ""
+}
+
+// machineToSession converts a Fly machine to session metadata.
+func machineToSession(machine *fly.Machine) *Session {
+	session := &Session{
+		BackendID: machine.ID,
+		Status:    mapFlyState(machine.State),
+		Host:      machine.Region,
+		CreatedAt: parseTime(machine.CreatedAt),
+	}
+	if code, ok := machine.ExitCode(); ok {
+		session.ExitCode = &code
+	}
+	return session
 }
 
 // StopSession stops a Fly machine.
@@ -125,9 +172,15 @@ func (b *FlyBackend) StopSession(ctx context.Context, sessionID string) error {
 	return nil
 }
 
-// DestroySession destroys a Fly machine.
+// DestroySession destroys a Fly machine. A machine that no longer exists
+// counts as destroyed.
 func (b *FlyBackend) DestroySession(ctx context.Context, sessionID string) error {
-	if err := b.client.DestroyMachine(ctx, sessionID); err != nil {
+	err := b.client.DestroyMachine(ctx, sessionID)
+	var flyErr *fly.FlyError
+	if errors.As(err, &flyErr) && flyErr.IsNotFound() {
+		return nil
+	}
+	if err != nil {
 		return fmt.Errorf("failed to destroy fly machine: %w", err)
 	}
 	return nil
@@ -138,6 +191,67 @@ func (b *FlyBackend) Attach(ctx context.Context, sessionID string) (stdin io.Wri
 	return nil, nil, nil, nil, fmt.Errorf("attach not supported for fly backend")
 }
 
+// Exec runs a command inside a running Fly machine using the machines exec API.
+// The exec timeout is derived from the context deadline when one is set.
+func (b *FlyBackend) Exec(ctx context.Context, sessionID string, cmd []string) (stdout, stderr string, exitCode int, err error) {
+	req := &fly.ExecRequest{
+		Cmd: fly.QuoteShellCmd(cmd),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		// Fly expects whole seconds; round up so short deadlines don't become zero (= default)
+		req.Timeout = int((time.Until(deadline) + time.Second - 1) / time.Second)
+	}
+
+	resp, err := b.client.Exec(ctx, sessionID, req)
+	if err != nil {
+		return "", "", -1, fmt.Errorf("failed to exec in fly machine: %w", err)
+	}
+
+	return resp.Stdout, resp.Stderr, int(resp.ExitCode), nil
+}
+
+// WriteFile writes a file into a Fly machine.
+func (b *FlyBackend) WriteFile(ctx context.Context, sessionID, path string, content []byte) error {
+	if err := b.client.WriteFile(ctx, sessionID, path, content); err != nil {
+		return fmt.Errorf("failed to write file to fly machine: %w", err)
+	}
+	return nil
+}
+
+// ReadFile reads a file from a Fly machine.
+func (b *FlyBackend) ReadFile(ctx context.Context, sessionID, path string, maxSize int64) ([]byte, error) {
+	content, err := b.client.ReadFile(ctx, sessionID, path, maxSize)
+	switch {
+	case errors.Is(err, fly.ErrFileNotFound):
+		return nil, ErrFileNotFound
+	case errors.Is(err, fly.ErrFileTooLarge):
+		return nil, ErrFileTooLarge
+	case err != nil:
+		return nil, fmt.Errorf("failed to read file from fly machine: %w", err)
+	}
+	return content, nil
+}
+
+// Usage samples a Fly machine from the platform's metrics. Each session has
+// the machine to itself, so the VM's usage is the session's usage.
+func (b *FlyBackend) Usage(ctx context.Context, sessionID string) (*ResourceUsage, error) {
+	usage, err := b.client.MachineUsage(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fly machine metrics: %w", err)
+	}
+	return &ResourceUsage{
+		CPUMillis:    usage.CPUMillis,
+		MemoryPeakMB: bytesToMB(usage.MemoryBytes),
+	}, nil
+}
+
+// URL is not supported on Fly. Exposed ports are published on the app's
+// shared address, which the Fly proxy balances across every machine in the
+// app, so no URL there reaches this session alone.
+func (b *FlyBackend) URL(ctx context.Context, sessionID string, port int) (string, error) {
+	return "", ErrNoSessionURL
+}
+
 // Name returns "fly".
 func (b *FlyBackend) Name() string {
 	return "fly"
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burka/execbox-cloud/internal/backend/fly"
+)
+
+// fakeFlyClient records created machines and serves a fixed machine list.
+type fakeFlyClient struct {
+	FlyClient
+	created    []*fly.MachineConfig
+	machines   []fly.Machine
+	destroyErr error
+}
+
+func (f *fakeFlyClient) CreateMachine(ctx context.Context, config *fly.MachineConfig) (*fly.Machine, error) {
+	f.created = append(f.created, config)
+	return &fly.Machine{ID: "m-new", State: "created", Config: config}, nil
+}
+
+func (f *fakeFlyClient) DestroyMachine(ctx context.Context, machineID string) error {
+	return f.destroyErr
+}
+
+func (f *fakeFlyClient) ListMachines(ctx context.Context) ([]fly.Machine, error) {
+	return f.machines, nil
+}
+
+func TestFlyBackend_CreateSession_TagsMachine(t *testing.T) {
+	client := &fakeFlyClient{}
+	backend := NewFlyBackend(client)
+
+	_, _, err := backend.CreateSession(context.Background(), &CreateSessionConfig{
+		SessionID: "sess_abc",
+		Image:     "alpine:3.20",
+	})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	if len(client.created) != 1 {
+		t.Fatalf("expected 1 machine created, got %d", len(client.created))
+	}
+	if got := client.created[0].Metadata[flySessionMetadataKey]; got != "sess_abc" {
+		t.Errorf("expected machine tagged with sess_abc, got %q", got)
+	}
+}
+
+func TestFlyBackend_ListSessions_OnlyTaggedMachines(t *testing.T) {
+	client := &fakeFlyClient{
+		machines: []fly.Machine{
+			{ID: "session", State: "started", Config: &fly.MachineConfig{
+				Image:    "alpine:3.20",
+				Metadata: map[string]string{flySessionMetadataKey: "sess_abc"},
+			}},
+			// A session that asked for the builder image is still a session
+			{ID: "session-kaniko", State: "started", Config: &fly.MachineConfig{
+				Image:    fly.BuilderImage,
+				Metadata: map[string]string{flySessionMetadataKey: "sess_def"},
+			}},
+			{ID: "api", State: "started", Config: &fly.MachineConfig{Image: "registry.fly.io/execbox-cloud:deploy"}},
+			{ID: "builder", State: "started", Config: &fly.MachineConfig{Image: fly.BuilderImage}},
+			{ID: "pusher", State: "started", Config: &fly.MachineConfig{Image: fly.PusherImage}},
+			{ID: "no-config", State: "started"},
+		},
+	}
+	backend := NewFlyBackend(client)
+
+	sessions, err := backend.ListSessions(context.Background())
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.BackendID)
+	}
+	if len(ids) != 2 || ids[0] != "session" || ids[1] != "session-kaniko" {
+		t.Errorf("expected only tagged machines, got %v", ids)
+	}
+}
+
+func TestFlyBackend_DestroySession_MachineGone(t *testing.T) {
+	client := &fakeFlyClient{destroyErr: &fly.FlyError{StatusCode: 404, Message: "machine not found"}}
+	backend := NewFlyBackend(client)
+
+	if err := backend.DestroySession(context.Background(), "m-gone"); err != nil {
+		t.Errorf("expected a missing machine to count as destroyed, got %v", err)
+	}
+
+	client.destroyErr = &fly.FlyError{StatusCode: 500, Message: "internal error"}
+	if err := backend.DestroySession(context.Background(), "m-busy"); err == nil {
+		t.Error("expected other destroy errors to be returned")
+	}
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/burka/execbox-cloud/internal/backend/fly"
 	"github.com/burka/execbox-cloud/internal/backend/k8s"
 	"github.com/burka/execbox/pkg/execbox"
 )
@@ -142,6 +145,26 @@ func (b *K8sBackend) GetSession(ctx context.Context, sessionID string) (*Session
 	return session, nil
 }
 
+// ListSessions lists the session pods in the backend's namespace.
+func (b *K8sBackend) ListSessions(ctx context.Context) ([]*Session, error) {
+	infos, err := b.backend.List(ctx, execbox.Filter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kubernetes pods: %w", err)
+	}
+
+	sessions := make([]*Session, 0, len(infos))
+	for _, info := range infos {
+		sessions = append(sessions, &Session{
+			BackendID: info.ID,
+			Status:    mapExecboxStatus(info.Status),
+			Host:      "kubernetes",
+			CreatedAt: info.CreatedAt,
+			ExitCode:  info.ExitCode,
+		})
+	}
+	return sessions, nil
+}
+
 // StopSession gracefully stops a Kubernetes pod.
 func (b *K8sBackend) StopSession(ctx context.Context, sessionID string) error {
 	if err := b.backend.Stop(ctx, sessionID); err != nil {
@@ -183,11 +206,141 @@ func (b *K8sBackend) Attach(ctx context.Context, sessionID string) (stdin io.Wri
 	return stdin, stdout, stderr, wait, nil
 }
 
+// Exec runs a command inside a running Kubernetes pod.
+func (b *K8sBackend) Exec(ctx context.Context, sessionID string, cmd []string) (stdout, stderr string, exitCode int, err error) {
+	stdout, stderr, exitCode, err = b.backend.Exec(ctx, sessionID, cmd)
+	if err != nil {
+		return stdout, stderr, -1, fmt.Errorf("failed to exec in kubernetes pod: %w", err)
+	}
+	return stdout, stderr, exitCode, nil
+}
+
+// WriteFile copies a file into a Kubernetes pod.
+func (b *K8sBackend) WriteFile(ctx context.Context, sessionID, path string, content []byte) error {
+	if err := b.backend.WriteFile(ctx, sessionID, path, content); err != nil {
+		return fmt.Errorf("failed to write file to kubernetes pod: %w", err)
+	}
+	return nil
+}
+
+// ReadFile copies a file out of a Kubernetes pod.
+func (b *K8sBackend) ReadFile(ctx context.Context, sessionID, path string, maxSize int64) ([]byte, error) {
+	content, err := b.backend.ReadFile(ctx, sessionID, path, maxSize)
+	switch {
+	case errors.Is(err, k8s.ErrFileNotFound):
+		return nil, ErrFileNotFound
+	case errors.Is(err, k8s.ErrFileTooLarge):
+		return nil, ErrFileTooLarge
+	case err != nil:
+		return nil, fmt.Errorf("failed to read file from kubernetes pod: %w", err)
+	}
+	return content, nil
+}
+
+// Usage samples a Kubernetes pod through the metrics API, which the kubelet
+// measures from outside the container.
+func (b *K8sBackend) Usage(ctx context.Context, sessionID string) (*ResourceUsage, error) {
+	usage, err := b.backend.Usage(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubernetes pod metrics: %w", err)
+	}
+	return &ResourceUsage{
+		CPURateMillicores: usage.CPUMillicores,
+		MemoryPeakMB:      bytesToMB(usage.MemoryBytes),
+	}, nil
+}
+
+// URL starts (or reuses) a port forward to a Kubernetes pod and returns its local URL.
+// The forward listens on the API server's loopback interface, so the URL is
+// only reachable from the host the API server runs on.
+func (b *K8sBackend) URL(ctx context.Context, sessionID string, port int) (string, error) {
+	u, err := b.backend.URL(ctx, sessionID, port)
+	if err != nil {
+		return "", fmt.Errorf("failed to forward kubernetes pod port: %w", err)
+	}
+	return u, nil
+}
+
 // Name returns "kubernetes".
 func (b *K8sBackend) Name() string {
 	return "kubernetes"
 }
 
+// K8sImageBuilder wraps a Kubernetes Kaniko builder to implement the ImageBuilder interface.
+type K8sImageBuilder struct {
+	builder *k8s.Builder
+}
+
+// NewK8sImageBuilder creates a new Kubernetes image builder adapter.
+func NewK8sImageBuilder(builder *k8s.Builder) *K8sImageBuilder {
+	return &K8sImageBuilder{
+		builder: builder,
+	}
+}
+
+// Resolve returns an image for the build spec, building it with Kaniko on a cache miss.
+func (b *K8sImageBuilder) Resolve(ctx context.Context, spec *fly.BuildSpec, cache fly.BuildCache) (string, error) {
+	// Fast path: no setup and no files means use base image directly
+	if len(spec.Setup) == 0 && len(spec.Files) == 0 {
+		return spec.BaseImage, nil
+	}
+
+	if strings.TrimSpace(spec.BaseImage) == "" {
+		return "", fmt.Errorf("base image cannot be empty when setup is provided")
+	}
+	if err := fly.ValidateSetup(spec.Setup); err != nil {
+		return "", err
+	}
+
+	hash := fly.ComputeHash(spec)
+
+	if cache != nil {
+		if imageRef, ok, err := cache.Get(ctx, hash); err != nil {
+			return "", fmt.Errorf("check cache: %w", err)
+		} else if ok {
+			go func() {
+				_ = cache.Touch(context.Background(), hash)
+			}()
+			return imageRef, nil
+		}
+	}
+
+	files := make([]execbox.BuildFile, 0, len(spec.Files))
+	for _, f := range spec.Files {
+		files = append(files, execbox.BuildFile{
+			Path:    f.Path,
+			Content: f.Content,
+		})
+	}
+
+	imageRef, err := b.builder.Build(ctx, k8s.BuildSpec{
+		BaseImage: spec.BaseImage,
+		Setup:     spec.Setup,
+		Files:     files,
+		OnProgress: func(phase, logTail string) {
+			fly.ReportBuildProgress(ctx, phase, logTail)
+		},
+		LogWriter: fly.BuildLogWriter(ctx),
+	})
+	if err != nil {
+		return "", fmt.Errorf("build image: %w", err)
+	}
+
+	if cache != nil {
+		// The image is built and pushed; a failed cache write only costs a rebuild later
+		_ = cache.Put(ctx, hash, spec.BaseImage, imageRef)
+	}
+
+	return imageRef, nil
+}
+
+// WatchStatus reports the status changes seen by the backend's pod watchers to fn.
+func (k *K8sBackend) WatchStatus(fn func(backendID, status string, exitCode *int)) {
+	k.backend.SetStatusObserver(func(sessionID string, status execbox.Status, exitCode *int) {
+		fn(sessionID, mapExecboxStatus(status), exitCode)
+	})
+}
+
 // mapExecboxStatus maps execbox.Status to session status strings.
 func mapExecboxStatus(status execbox.Status) string {
 	switch status {
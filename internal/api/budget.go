@@ -0,0 +1,392 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// budgetAlertTimeout bounds the delivery of a single budget alert.
+	budgetAlertTimeout = 30 * time.Second
+
+	// budgetAlertPollInterval is how often alerts whose delivery failed are retried.
+	budgetAlertPollInterval = time.Minute
+
+	// budgetAlertBatchSize is the most alerts claimed for delivery at once.
+	budgetAlertBatchSize = 20
+
+	// budgetAlertMaxAttempts is how often an alert is tried before it is given up.
+	// With budgetAlertRetryBackoff doubling, the last attempt is about two hours after the first.
+	budgetAlertMaxAttempts = 8
+
+	// budgetAlertRetryBackoff is the wait before the first retry; it doubles with every attempt.
+	budgetAlertRetryBackoff = time.Minute
+)
+
+// BudgetNotifier delivers alerts for accounts whose spend crossed their alert threshold.
+type BudgetNotifier interface {
+	NotifyBudgetAlert(ctx context.Context, alert *db.BudgetAlert) error
+}
+
+// BudgetNotifiers sends each alert to every notifier in the list.
+type BudgetNotifiers []BudgetNotifier
+
+// NotifyBudgetAlert notifies all notifiers, even if some fail.
+func (n BudgetNotifiers) NotifyBudgetAlert(ctx context.Context, alert *db.BudgetAlert) error {
+	var errs []error
+	for _, notifier := range n {
+		if err := notifier.NotifyBudgetAlert(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// budgetAlertPayload is the JSON body posted by WebhookBudgetNotifier.
+type budgetAlertPayload struct {
+	Event               string  `json:"event"`
+	AccountID           string  `json:"accountId"`
+	BillingPeriodStart  string  `json:"billingPeriodStart"`
+	ThresholdPercentage int     `json:"thresholdPercentage"`
+	SpentCents          int64   `json:"spentCents"`
+	LimitCents          int64   `json:"limitCents"`
+	BillingEmail        *string `json:"billingEmail,omitempty"`
+	CreatedAt           string  `json:"createdAt"`
+}
+
+// WebhookBudgetNotifier posts budget alerts as JSON to a fixed URL.
+type WebhookBudgetNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookBudgetNotifier creates a notifier posting to url.
+func NewWebhookBudgetNotifier(url string) *WebhookBudgetNotifier {
+	return &WebhookBudgetNotifier{
+		url:    url,
+		client: &http.Client{Timeout: budgetAlertTimeout},
+	}
+}
+
+// NotifyBudgetAlert posts the alert and expects a 2xx response.
+func (n *WebhookBudgetNotifier) NotifyBudgetAlert(ctx context.Context, alert *db.BudgetAlert) error {
+	body, err := json.Marshal(budgetAlertPayload{
+		Event:               "budget.alert",
+		AccountID:           alert.AccountID.String(),
+		BillingPeriodStart:  alert.BillingPeriodStart.Format(time.DateOnly),
+		ThresholdPercentage: alert.ThresholdPercentage,
+		SpentCents:          alert.SpentCents,
+		LimitCents:          alert.LimitCents,
+		BillingEmail:        alert.BillingEmail,
+		CreatedAt:           alert.CreatedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode budget alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post budget alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("budget alert webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// EmailBudgetNotifier mails budget alerts to the account's billing email over SMTP.
+// Accounts without a billing email are skipped.
+type EmailBudgetNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+
+	// sendMail is smtp.SendMail, replaced in tests
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmailBudgetNotifier creates a notifier sending through the SMTP server at
+// addr (host:port). Username and password may be empty for servers without auth.
+func NewEmailBudgetNotifier(addr, username, password, from string) *EmailBudgetNotifier {
+	return &EmailBudgetNotifier{
+		addr:     addr,
+		from:     from,
+		auth:     smtpAuth(addr, username, password),
+		sendMail: smtp.SendMail,
+	}
+}
+
+// smtpAuth returns PLAIN auth for the SMTP server at addr, or nil if username
+// is empty.
+func smtpAuth(addr, username, password string) smtp.Auth {
+	if username == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return smtp.PlainAuth("", username, password, host)
+}
+
+// NotifyBudgetAlert sends the alert email.
+func (n *EmailBudgetNotifier) NotifyBudgetAlert(ctx context.Context, alert *db.BudgetAlert) error {
+	if alert.BillingEmail == nil || *alert.BillingEmail == "" {
+		return nil
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: execbox: %d%% of your monthly cost limit reached\r\n\r\n"+
+		"Your account has used %s of its %s monthly cost limit in the billing period starting %s.\r\n"+
+		"New sessions are refused once the limit is reached.\r\n",
+		n.from, *alert.BillingEmail, alert.ThresholdPercentage,
+		formatCents(alert.SpentCents), formatCents(alert.LimitCents), alert.BillingPeriodStart.Format(time.DateOnly))
+
+	if err := n.sendMail(n.addr, n.auth, n.from, []string{*alert.BillingEmail}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send budget alert email: %w", err)
+	}
+	return nil
+}
+
+// formatCents formats an amount in cents as dollars.
+func formatCents(cents int64) string {
+	return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
+}
+
+// billingPeriodStart returns the first day of the billing month containing t, in UTC.
+func billingPeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// spentCost is what an account has spent this billing period so far: ended
+// sessions at their recorded cost and running ones as if they ended now.
+func spentCost(spend *db.AccountSpend, now time.Time) int64 {
+	cost := spend.SettledCents
+	for _, startedAt := range spend.ActiveSessionStarts {
+		cost += DefaultCostCalculator.EstimateSessionCost(now.Sub(startedAt).Milliseconds())
+	}
+	return cost
+}
+
+// projectedCost is what an account will have spent this billing period once
+// another session starts: its spend so far and the new session's base cost.
+func projectedCost(spend *db.AccountSpend, now time.Time) int64 {
+	return spentCost(spend, now) + DefaultCostCalculator.BaseCostPerRequest
+}
+
+// BudgetMonitor watches accounts' spend against their monthly cost limit.
+// Spend is checked when a session is admitted, when usage is recorded and when
+// a session ends, so the alert threshold is noticed as soon as it is crossed,
+// not only when the next session starts.
+type BudgetMonitor struct {
+	db       DBClient
+	notifier BudgetNotifier
+}
+
+// NewBudgetMonitor creates a new BudgetMonitor.
+func NewBudgetMonitor(db DBClient) *BudgetMonitor {
+	return &BudgetMonitor{db: db}
+}
+
+// SetNotifier sets where alerts go when an account nears its monthly cost limit.
+func (b *BudgetMonitor) SetNotifier(notifier BudgetNotifier) {
+	b.notifier = notifier
+}
+
+// CheckAccount re-checks an account's spend after its usage changed, alerting
+// if it crossed the alert threshold. Failures are logged.
+func (b *BudgetMonitor) CheckAccount(ctx context.Context, accountID uuid.UUID) {
+	if b == nil || accountID == uuid.Nil {
+		return
+	}
+
+	limits, err := b.db.GetAccountLimits(ctx, accountID)
+	if err != nil {
+		// Accounts without a limits row have no budget
+		if !strings.Contains(err.Error(), "not found") {
+			slog.Warn("failed to check budget", "error", err, "account_id", accountID)
+		}
+		return
+	}
+	if limits == nil {
+		return
+	}
+	if _, _, err := b.check(ctx, accountID, limits, 0); err != nil {
+		slog.Warn("failed to check budget", "error", err, "account_id", accountID)
+	}
+}
+
+// SessionUpdated re-checks the budget of a session's account when update ended
+// the session with a recorded cost.
+func (b *BudgetMonitor) SessionUpdated(ctx context.Context, session *db.Session, update *db.SessionUpdate) {
+	if update.CostEstimateCents == nil {
+		return
+	}
+	b.CheckAccount(ctx, session.AccountID)
+}
+
+// check computes an account's month-to-date cost plus extraCents and records
+// an alert if that crosses the alert threshold. Returns the cost and the
+// monthly limit, or a negative limit if the account has none.
+func (b *BudgetMonitor) check(ctx context.Context, accountID uuid.UUID, limits *db.AccountLimits, extraCents int64) (int64, int64, error) {
+	if limits.MonthlyCostLimitCents == nil || *limits.MonthlyCostLimitCents < 0 {
+		return 0, -1, nil
+	}
+	limit := *limits.MonthlyCostLimitCents
+
+	now := time.Now().UTC()
+	periodStart := billingPeriodStart(now)
+	spend, err := b.db.GetAccountSpend(ctx, accountID, periodStart)
+	if err != nil {
+		return 0, 0, err
+	}
+	cost := spentCost(spend, now) + extraCents
+
+	threshold := limits.AlertThresholdPercentage
+	if threshold > 0 && cost*100 >= limit*int64(threshold) {
+		b.alert(ctx, &db.BudgetAlert{
+			AccountID:           accountID,
+			BillingPeriodStart:  periodStart,
+			ThresholdPercentage: threshold,
+			SpentCents:          cost,
+			LimitCents:          limit,
+			BillingEmail:        limits.BillingEmail,
+		})
+	}
+	return cost, limit, nil
+}
+
+// checkBudget refuses a new session once the account's projected month-to-date
+// cost passes its monthly cost limit. Crossing the alert threshold records an
+// alert, at most once per billing period, and notifies the budget notifier.
+func (s *SessionService) checkBudget(ctx context.Context, accountID uuid.UUID, limits *db.AccountLimits) error {
+	projected, limit, err := s.budget.check(ctx, accountID, limits, DefaultCostCalculator.BaseCostPerRequest)
+	if err != nil {
+		return huma.Error500InternalServerError(fmt.Sprintf("failed to check monthly cost: %v", err))
+	}
+
+	if limit >= 0 && projected > limit {
+		return huma.NewError(http.StatusTooManyRequests,
+			fmt.Sprintf("monthly cost limit reached for this account (%s/%s)", formatCents(projected), formatCents(limit)),
+			&huma.ErrorDetail{
+				Message:  "monthly cost limit reached",
+				Location: "limit",
+				Value:    LimitAccountMonthlyCost,
+			},
+		)
+	}
+	return nil
+}
+
+// alert records a budget alert and, if it is the first of the billing period,
+// makes the first delivery attempt in the background. Alerts whose delivery
+// fails are retried by Run. Failures are logged and never block the caller.
+func (b *BudgetMonitor) alert(ctx context.Context, alert *db.BudgetAlert) {
+	// Leave the first attempt time to finish and be recorded before Run may retry it
+	leaseUntil := time.Now().Add(2 * budgetAlertTimeout)
+	alert.NextDeliveryAt = &leaseUntil
+
+	created, err := b.db.CreateBudgetAlert(ctx, alert)
+	if err != nil {
+		slog.Warn("failed to record budget alert", "error", err, "account_id", alert.AccountID)
+		return
+	}
+	if !created {
+		return
+	}
+
+	slog.Warn("account crossed budget alert threshold",
+		"account_id", alert.AccountID,
+		"threshold_percentage", alert.ThresholdPercentage,
+		"spent_cents", alert.SpentCents,
+		"limit_cents", alert.LimitCents,
+	)
+
+	if b.notifier == nil {
+		return
+	}
+	// Delivery outlives the request that crossed the threshold
+	go b.deliver(context.Background(), *alert)
+}
+
+// Run retries the delivery of budget alerts whose earlier attempts failed,
+// every budgetAlertPollInterval. It blocks until ctx is done.
+func (b *BudgetMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(budgetAlertPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.deliverDue(ctx); err != nil {
+			slog.Warn("failed to deliver budget alerts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue claims the alerts due for another delivery attempt and makes it.
+func (b *BudgetMonitor) deliverDue(ctx context.Context) error {
+	if b.notifier == nil {
+		return nil
+	}
+	alerts, err := b.db.ClaimBudgetAlerts(ctx, budgetAlertBatchSize, time.Now().Add(2*budgetAlertTimeout))
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		b.deliver(ctx, alert)
+	}
+	return nil
+}
+
+// deliver makes one attempt at delivering an alert and records the outcome:
+// delivered, retried later with the wait doubling, or given up after
+// budgetAlertMaxAttempts.
+func (b *BudgetMonitor) deliver(ctx context.Context, alert db.BudgetAlert) {
+	notifyCtx, cancel := context.WithTimeout(ctx, budgetAlertTimeout)
+	err := b.notifier.NotifyBudgetAlert(notifyCtx, &alert)
+	cancel()
+
+	attempts := alert.DeliveryAttempts + 1
+	now := time.Now().UTC()
+	var deliveredAt, nextDeliveryAt *time.Time
+	switch {
+	case err == nil:
+		deliveredAt = &now
+	case attempts >= budgetAlertMaxAttempts:
+		slog.Warn("giving up on budget alert", "error", err, "account_id", alert.AccountID, "attempts", attempts)
+	default:
+		next := now.Add(budgetAlertRetryBackoff << (attempts - 1))
+		nextDeliveryAt = &next
+		slog.Warn("failed to deliver budget alert", "error", err, "account_id", alert.AccountID, "attempts", attempts)
+	}
+
+	if err := b.db.RecordBudgetAlertDelivery(ctx, alert.ID, attempts, deliveredAt, nextDeliveryAt); err != nil {
+		slog.Warn("failed to record budget alert delivery", "error", err, "account_id", alert.AccountID)
+	}
+}
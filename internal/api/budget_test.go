@@ -0,0 +1,343 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// recordingBudgetNotifier passes delivered alerts to a channel.
+type recordingBudgetNotifier struct {
+	alerts chan *db.BudgetAlert
+}
+
+func (n *recordingBudgetNotifier) NotifyBudgetAlert(ctx context.Context, alert *db.BudgetAlert) error {
+	n.alerts <- alert
+	return nil
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func TestProjectedCost(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	spend := &db.AccountSpend{
+		SettledCents:        100,
+		ActiveSessionStarts: []time.Time{now.Add(-10 * time.Second)},
+	}
+
+	want := 100 + DefaultCostCalculator.EstimateSessionCost(10000) + DefaultCostCalculator.BaseCostPerRequest
+	if got := projectedCost(spend, now); got != want {
+		t.Errorf("projectedCost() = %d, want %d", got, want)
+	}
+}
+
+func TestBillingPeriodStart(t *testing.T) {
+	got := billingPeriodStart(time.Date(2024, 2, 29, 23, 59, 0, 0, time.UTC))
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("billingPeriodStart() = %v, want %v", got, want)
+	}
+}
+
+func TestSessionService_CheckBudget(t *testing.T) {
+	billingEmail := "billing@example.com"
+
+	tests := []struct {
+		name         string
+		limitCents   *int64
+		settledCents int64
+		wantAlert    bool
+		wantRefused  bool
+	}{
+		{name: "no monthly limit", settledCents: 1000000},
+		{name: "unlimited", limitCents: int64Ptr(-1), settledCents: 1000000},
+		{name: "below alert threshold", limitCents: int64Ptr(1000), settledCents: 100},
+		{name: "alert threshold crossed", limitCents: int64Ptr(1000), settledCents: 850, wantAlert: true},
+		{name: "monthly limit passed", limitCents: int64Ptr(1000), settledCents: 1000, wantAlert: true, wantRefused: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accountID := uuid.New()
+			mockDB := newExtendedMockHandlerDB()
+			mockDB.settledCents = map[uuid.UUID]int64{accountID: tt.settledCents}
+			mockDB.accountLimits = &db.AccountLimits{
+				AccountID:                accountID,
+				DailyRequestsLimit:       -1,
+				ConcurrentRequestsLimit:  -1,
+				MonthlyCostLimitCents:    tt.limitCents,
+				AlertThresholdPercentage: 80,
+				BillingEmail:             &billingEmail,
+			}
+			notifier := &recordingBudgetNotifier{alerts: make(chan *db.BudgetAlert, 1)}
+			budget := NewBudgetMonitor(mockDB)
+			budget.SetNotifier(notifier)
+			sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+			sessionSvc.SetBudgetMonitor(budget)
+
+			ctx := WithAccountID(context.Background(), accountID)
+			err := sessionSvc.admitSession(ctx, uuid.New(), TierFree)
+
+			if tt.wantRefused {
+				var model *huma.ErrorModel
+				if !errors.As(err, &model) || model.Status != http.StatusTooManyRequests {
+					t.Fatalf("expected 429, got %v", err)
+				}
+				if len(model.Errors) != 1 || model.Errors[0].Value != LimitAccountMonthlyCost {
+					t.Errorf("expected limit %s in error details, got %+v", LimitAccountMonthlyCost, model.Errors)
+				}
+			} else if err != nil {
+				t.Fatalf("expected session to be admitted, got %v", err)
+			}
+
+			if !tt.wantAlert {
+				if len(mockDB.budgetAlerts) != 0 {
+					t.Errorf("expected no budget alert, got %d", len(mockDB.budgetAlerts))
+				}
+				return
+			}
+			if len(mockDB.budgetAlerts) != 1 {
+				t.Fatalf("expected one budget alert, got %d", len(mockDB.budgetAlerts))
+			}
+			select {
+			case alert := <-notifier.alerts:
+				if alert.AccountID != accountID || alert.LimitCents != 1000 || alert.SpentCents <= tt.settledCents {
+					t.Errorf("unexpected alert %+v", alert)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected budget alert to be delivered")
+			}
+
+			// Further sessions in the same billing period do not alert again
+			_ = sessionSvc.admitSession(ctx, uuid.New(), TierFree)
+			if len(mockDB.budgetAlerts) != 1 {
+				t.Errorf("expected a single alert per billing period, got %d", len(mockDB.budgetAlerts))
+			}
+			select {
+			case <-notifier.alerts:
+				t.Error("expected no second delivery")
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// newBudgetTestDB returns a mock database for an account with a $10 monthly
+// limit, an 80% alert threshold and settledCents already spent.
+func newBudgetTestDB(accountID uuid.UUID, settledCents int64) *extendedMockHandlerDB {
+	mockDB := newExtendedMockHandlerDB()
+	mockDB.settledCents = map[uuid.UUID]int64{accountID: settledCents}
+	mockDB.accountLimits = &db.AccountLimits{
+		AccountID:                accountID,
+		DailyRequestsLimit:       -1,
+		ConcurrentRequestsLimit:  -1,
+		MonthlyCostLimitCents:    int64Ptr(1000),
+		AlertThresholdPercentage: 80,
+	}
+	return mockDB
+}
+
+func TestSessionService_StopSession_ChecksBudget(t *testing.T) {
+	accountID := uuid.New()
+	mockDB := newBudgetTestDB(accountID, 100)
+	session := newExpiringSession("sess_budget", SessionStatusRunning, time.Now().Add(time.Hour))
+	session.AccountID = accountID
+	mockDB.sessions[session.ID] = session
+
+	notifier := &recordingBudgetNotifier{alerts: make(chan *db.BudgetAlert, 1)}
+	budget := NewBudgetMonitor(mockDB)
+	budget.SetNotifier(notifier)
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+	sessionSvc.SetBudgetMonitor(budget)
+
+	// The session's cost is settled when it ends and pushes spend past the threshold
+	mockDB.settledCents[accountID] = 850
+	ctx := WithAPIKeyID(context.Background(), session.APIKeyID)
+	if _, err := sessionSvc.StopSession(ctx, &StopSessionInput{ID: session.ID}); err != nil {
+		t.Fatalf("StopSession failed: %v", err)
+	}
+
+	if len(mockDB.budgetAlerts) != 1 || mockDB.budgetAlerts[0].AccountID != accountID {
+		t.Fatalf("expected a budget alert when the session ended, got %+v", mockDB.budgetAlerts)
+	}
+	select {
+	case <-notifier.alerts:
+	case <-time.After(time.Second):
+		t.Fatal("expected budget alert to be delivered")
+	}
+}
+
+func TestMeter_Sweep_ChecksBudget(t *testing.T) {
+	accountID := uuid.New()
+	mockDB := newBudgetTestDB(accountID, 100)
+	session := newExpiringSession("sess_budget", SessionStatusRunning, time.Now().Add(time.Hour))
+	session.AccountID = accountID
+	mockDB.sessions[session.ID] = session
+
+	meter := NewMeter(mockDB, &mockBackendHandler{usage: &ResourceUsage{CPUMillis: 1000, MemoryPeakMB: 128}})
+	meter.SetBudgetMonitor(NewBudgetMonitor(mockDB))
+
+	if err := meter.sweep(context.Background()); err != nil {
+		t.Fatalf("sweep failed: %v", err)
+	}
+	if len(mockDB.budgetAlerts) != 0 {
+		t.Fatalf("expected no alert below the threshold, got %d", len(mockDB.budgetAlerts))
+	}
+
+	// Usage recorded while the session runs crosses the threshold
+	mockDB.settledCents[accountID] = 850
+	if err := meter.sweep(context.Background()); err != nil {
+		t.Fatalf("sweep failed: %v", err)
+	}
+	if len(mockDB.budgetAlerts) != 1 {
+		t.Errorf("expected a budget alert after usage was recorded, got %d", len(mockDB.budgetAlerts))
+	}
+}
+
+// flakyBudgetNotifier fails its first deliveries, then succeeds.
+type flakyBudgetNotifier struct {
+	failures int
+	calls    chan struct{}
+}
+
+func (n *flakyBudgetNotifier) NotifyBudgetAlert(ctx context.Context, alert *db.BudgetAlert) error {
+	defer func() { n.calls <- struct{}{} }()
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("smtp server unavailable")
+	}
+	return nil
+}
+
+func TestBudgetMonitor_RetriesFailedDelivery(t *testing.T) {
+	accountID := uuid.New()
+	mockDB := newBudgetTestDB(accountID, 850)
+	notifier := &flakyBudgetNotifier{failures: 1, calls: make(chan struct{}, 2)}
+	budget := NewBudgetMonitor(mockDB)
+	budget.SetNotifier(notifier)
+
+	budget.CheckAccount(context.Background(), accountID)
+	select {
+	case <-notifier.calls:
+	case <-time.After(time.Second):
+		t.Fatal("expected a first delivery attempt")
+	}
+
+	// The failed attempt is recorded with a retry scheduled
+	deadline := time.Now().Add(time.Second)
+	for mockDB.budgetAlert(0).DeliveryAttempts != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the failed attempt to be recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	alert := mockDB.budgetAlert(0)
+	if alert.DeliveredAt != nil || alert.NextDeliveryAt == nil || alert.NextDeliveryAt.Before(time.Now()) {
+		t.Fatalf("expected a retry to be scheduled, got %+v", alert)
+	}
+
+	// Once due, the retry delivers the alert
+	mockDB.budgetAlertsMu.Lock()
+	past := time.Now().Add(-time.Second)
+	mockDB.budgetAlerts[0].NextDeliveryAt = &past
+	mockDB.budgetAlertsMu.Unlock()
+	if err := budget.deliverDue(context.Background()); err != nil {
+		t.Fatalf("deliverDue failed: %v", err)
+	}
+	alert = mockDB.budgetAlert(0)
+	if alert.DeliveredAt == nil || alert.NextDeliveryAt != nil || alert.DeliveryAttempts != 2 {
+		t.Errorf("expected the alert to be delivered on the retry, got %+v", alert)
+	}
+
+	// Delivered alerts are not sent again
+	if err := budget.deliverDue(context.Background()); err != nil {
+		t.Fatalf("deliverDue failed: %v", err)
+	}
+	if len(notifier.calls) != 1 {
+		t.Errorf("expected no further delivery attempts, got %d", len(notifier.calls))
+	}
+}
+
+func newTestBudgetAlert(billingEmail *string) *db.BudgetAlert {
+	return &db.BudgetAlert{
+		AccountID:           uuid.New(),
+		BillingPeriodStart:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ThresholdPercentage: 80,
+		SpentCents:          8012,
+		LimitCents:          10000,
+		BillingEmail:        billingEmail,
+		CreatedAt:           time.Now().UTC(),
+	}
+}
+
+func TestEmailBudgetNotifier(t *testing.T) {
+	var sentTo []string
+	var sentMsg string
+	notifier := NewEmailBudgetNotifier("smtp.example.com:587", "user", "secret", "billing@execbox.dev")
+	notifier.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sentTo, sentMsg = to, string(msg)
+		return nil
+	}
+
+	billingEmail := "billing@example.com"
+	if err := notifier.NotifyBudgetAlert(context.Background(), newTestBudgetAlert(&billingEmail)); err != nil {
+		t.Fatalf("NotifyBudgetAlert failed: %v", err)
+	}
+	if len(sentTo) != 1 || sentTo[0] != billingEmail {
+		t.Errorf("expected mail to %s, got %v", billingEmail, sentTo)
+	}
+	if !strings.Contains(sentMsg, "$80.12 of its $100.00") {
+		t.Errorf("expected amounts in message, got %q", sentMsg)
+	}
+
+	// Accounts without a billing email get no mail
+	sentTo = nil
+	if err := notifier.NotifyBudgetAlert(context.Background(), newTestBudgetAlert(nil)); err != nil {
+		t.Fatalf("NotifyBudgetAlert failed: %v", err)
+	}
+	if sentTo != nil {
+		t.Errorf("expected no mail, got one to %v", sentTo)
+	}
+}
+
+func TestWebhookBudgetNotifier(t *testing.T) {
+	var payload budgetAlertPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	alert := newTestBudgetAlert(nil)
+	if err := NewWebhookBudgetNotifier(server.URL).NotifyBudgetAlert(context.Background(), alert); err != nil {
+		t.Fatalf("NotifyBudgetAlert failed: %v", err)
+	}
+	if payload.Event != "budget.alert" || payload.AccountID != alert.AccountID.String() ||
+		payload.BillingPeriodStart != "2024-01-01" || payload.SpentCents != 8012 {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestWebhookBudgetNotifier_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookBudgetNotifier(server.URL).NotifyBudgetAlert(context.Background(), newTestBudgetAlert(nil)); err == nil {
+		t.Fatal("expected error for a failing webhook")
+	}
+}
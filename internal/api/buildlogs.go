@@ -0,0 +1,287 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxBuildLogEvents caps the events kept in memory per running build.
+	// Subscribers that fall further behind skip the oldest events.
+	maxBuildLogEvents = 10000
+
+	// buildLogKeepalive is how often an idle log stream sends an SSE comment
+	// so proxies don't close the connection.
+	buildLogKeepalive = 15 * time.Second
+
+	// buildLogPollInterval is how often a build running elsewhere is re-read from the database.
+	buildLogPollInterval = 2 * time.Second
+)
+
+// Build log stream event types
+const (
+	buildEventLog    = "log"    // One line of builder output
+	buildEventPhase  = "phase"  // The build entered a new phase
+	buildEventStatus = "status" // Final build state; always the last event
+)
+
+// buildLogEvent is a single entry in a build's live log.
+type buildLogEvent struct {
+	Type string
+	Data string
+}
+
+// buildLog collects the output and phase changes of a build running in this
+// process and lets any number of readers follow it. It implements io.Writer
+// so builders can copy raw output into it; output is split into lines, with a
+// bare \r ending a line like \n does, since SSE clients treat it as one.
+type buildLog struct {
+	mu      sync.Mutex
+	events  []buildLogEvent
+	dropped int           // events discarded from the front to respect maxBuildLogEvents
+	partial []byte        // output after the last line break
+	changed chan struct{} // closed and replaced whenever events are added or the log closes
+	closed  bool
+}
+
+func newBuildLog() *buildLog {
+	return &buildLog{changed: make(chan struct{})}
+}
+
+// Write appends complete lines of p as log events.
+func (l *buildLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0, fmt.Errorf("build log closed")
+	}
+
+	data := append(l.partial, p...)
+	for {
+		i := bytes.IndexAny(data, "\r\n")
+		// A trailing \r may be the start of a \r\n split across writes
+		if i < 0 || (data[i] == '\r' && i == len(data)-1) {
+			break
+		}
+		l.appendLocked(buildLogEvent{Type: buildEventLog, Data: string(data[:i])})
+		if data[i] == '\r' && data[i+1] == '\n' {
+			i++
+		}
+		data = data[i+1:]
+	}
+	l.partial = append([]byte(nil), data...)
+	l.notifyLocked()
+
+	return len(p), nil
+}
+
+// Phase records a phase change.
+func (l *buildLog) Phase(phase string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	l.appendLocked(buildLogEvent{Type: buildEventPhase, Data: phase})
+	l.notifyLocked()
+}
+
+// Close flushes any unterminated output line and wakes all readers for the last time.
+func (l *buildLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	if line := strings.TrimSuffix(string(l.partial), "\r"); line != "" {
+		l.appendLocked(buildLogEvent{Type: buildEventLog, Data: line})
+	}
+	l.partial = nil
+	l.closed = true
+	l.notifyLocked()
+}
+
+// read returns the events from position from onwards, the position to read from
+// next, whether the log is closed, and a channel that is closed on the next change.
+func (l *buildLog) read(from int) ([]buildLogEvent, int, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if from < l.dropped {
+		from = l.dropped
+	}
+	events := append([]buildLogEvent(nil), l.events[from-l.dropped:]...)
+	return events, l.dropped + len(l.events), l.closed, l.changed
+}
+
+func (l *buildLog) appendLocked(event buildLogEvent) {
+	l.events = append(l.events, event)
+	if over := len(l.events) - maxBuildLogEvents; over > 0 {
+		l.events = append([]buildLogEvent(nil), l.events[over:]...)
+		l.dropped += over
+	}
+}
+
+func (l *buildLog) notifyLocked() {
+	close(l.changed)
+	if !l.closed {
+		l.changed = make(chan struct{})
+	}
+}
+
+// StreamBuildLogs sends a build's log to emit until the build finishes, then
+// emits a final status event with the build as JSON. Builds running in this
+// process are followed line by line; builds running elsewhere only report phase
+// changes, and finished builds replay their stored log tail.
+func (s *BuildService) StreamBuildLogs(ctx context.Context, build *db.Build, emit func(event, data string) error) error {
+	if log := s.liveLog(build.ID); log != nil {
+		if err := followBuildLog(ctx, log, emit); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if build, err = s.pollBuild(ctx, build, emit); err != nil {
+			return err
+		}
+		if build.LogTail != nil {
+			for _, line := range splitLogLines(*build.LogTail) {
+				if err := emit(buildEventLog, line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Re-read so the status reflects the final database state
+	final, err := s.db.GetBuild(ctx, build.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get build: %w", err)
+	}
+	status, err := json.Marshal(buildResponse(final))
+	if err != nil {
+		return fmt.Errorf("failed to encode build status: %w", err)
+	}
+	return emit(buildEventStatus, string(status))
+}
+
+// splitLogLines splits a stored log tail into lines the way buildLog does,
+// ending lines at \n, \r\n and bare \r.
+func splitLogLines(tail string) []string {
+	tail = strings.ReplaceAll(tail, "\r\n", "\n")
+	tail = strings.ReplaceAll(tail, "\r", "\n")
+	return strings.Split(strings.TrimRight(tail, "\n"), "\n")
+}
+
+// followBuildLog emits events from a live build log until it closes.
+func followBuildLog(ctx context.Context, log *buildLog, emit func(event, data string) error) error {
+	keepalive := time.NewTicker(buildLogKeepalive)
+	defer keepalive.Stop()
+
+	next := 0
+	for {
+		events, n, closed, changed := log.read(next)
+		next = n
+		for _, e := range events {
+			if err := emit(e.Type, e.Data); err != nil {
+				return err
+			}
+		}
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-keepalive.C:
+			if err := emit("", ""); err != nil {
+				return err
+			}
+		case <-changed:
+		}
+	}
+}
+
+// pollBuild waits for a build that is not running in this process to finish,
+// emitting its phase changes, and returns the finished build.
+func (s *BuildService) pollBuild(ctx context.Context, build *db.Build, emit func(event, data string) error) (*db.Build, error) {
+	ticker := time.NewTicker(buildLogPollInterval)
+	defer ticker.Stop()
+
+	phase := ""
+	for {
+		if build.Phase != phase {
+			phase = build.Phase
+			if err := emit(buildEventPhase, phase); err != nil {
+				return nil, err
+			}
+		}
+		if build.Phase == BuildPhaseReady || build.Phase == BuildPhaseFailed {
+			return build, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		latest, err := s.db.GetBuild(ctx, build.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get build: %w", err)
+		}
+		build = latest
+	}
+}
+
+// handleBuildLogs creates a handler that streams a build's log as Server-Sent Events.
+// Each log line is a "log" event, phase changes are "phase" events, and the stream
+// ends with a "status" event carrying the final build as JSON.
+// This needs special handling because huma handlers return a single response body.
+func handleBuildLogs(buildSvc *BuildService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		build, err := getAuthorizedBuild(r.Context(), buildSvc.db, chi.URLParam(r, "id"))
+		if err != nil {
+			WriteHumaError(w, err)
+			return
+		}
+
+		// Builds can run far longer than the server's write timeout
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		_ = rc.Flush()
+
+		emit := func(event, data string) error {
+			var err error
+			if event == "" {
+				_, err = fmt.Fprint(w, ": keepalive\n\n")
+			} else {
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			}
+			if err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		// The client going away is the only way this ends early; nothing left to report
+		_ = buildSvc.StreamBuildLogs(r.Context(), build, emit)
+	}
+}
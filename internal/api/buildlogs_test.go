@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent is one parsed Server-Sent Event.
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// parseSSE splits an event stream into events, skipping comments.
+func parseSSE(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(body, "\n\n") {
+		var e sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				e.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		if e.Event != "" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// newBuildLogTestRouter wires the build log handler behind a stub auth middleware.
+func newBuildLogTestRouter(buildSvc *BuildService, apiKeyID uuid.UUID) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithAPIKeyID(r.Context(), apiKeyID)))
+		})
+	})
+	router.Get("/v1/builds/{id}/logs", handleBuildLogs(buildSvc))
+	return router
+}
+
+func TestBuildLog_SplitsLines(t *testing.T) {
+	log := newBuildLog()
+
+	_, err := log.Write([]byte("Step 1/2\r\nStep "))
+	require.NoError(t, err)
+	_, err = log.Write([]byte("2/2\nPushing"))
+	require.NoError(t, err)
+	log.Phase(BuildPhasePushing)
+	log.Close()
+
+	events, next, closed, _ := log.read(0)
+	assert.True(t, closed)
+	assert.Equal(t, 4, next)
+	assert.Equal(t, []buildLogEvent{
+		{Type: buildEventLog, Data: "Step 1/2"},
+		{Type: buildEventLog, Data: "Step 2/2"},
+		{Type: buildEventPhase, Data: BuildPhasePushing},
+		{Type: buildEventLog, Data: "Pushing"},
+	}, events)
+
+	_, err = log.Write([]byte("late\n"))
+	assert.Error(t, err)
+}
+
+func TestBuildLog_SplitsCarriageReturns(t *testing.T) {
+	log := newBuildLog()
+
+	// Progress redraws end with a bare \r; a \r\n may be split across writes
+	_, err := log.Write([]byte("Pushing 10%\rPushing 50%\rPushing 100%\r"))
+	require.NoError(t, err)
+	_, err = log.Write([]byte("\ndone\r"))
+	require.NoError(t, err)
+	log.Close()
+
+	events, _, _, _ := log.read(0)
+	assert.Equal(t, []buildLogEvent{
+		{Type: buildEventLog, Data: "Pushing 10%"},
+		{Type: buildEventLog, Data: "Pushing 50%"},
+		{Type: buildEventLog, Data: "Pushing 100%"},
+		{Type: buildEventLog, Data: "done"},
+	}, events)
+	for _, e := range events {
+		assert.NotContains(t, e.Data, "\r")
+	}
+}
+
+func TestSplitLogLines(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c", "", "d"}, splitLogLines("a\r\nb\rc\n\nd\r\n"))
+}
+
+func TestBuildLog_DropsOldestEvents(t *testing.T) {
+	log := newBuildLog()
+	for i := 0; i < maxBuildLogEvents+5; i++ {
+		_, _ = log.Write([]byte("line\n"))
+	}
+
+	events, next, closed, _ := log.read(0)
+	assert.False(t, closed)
+	assert.Len(t, events, maxBuildLogEvents)
+	assert.Equal(t, maxBuildLogEvents+5, next)
+
+	events, _, _, _ = log.read(next)
+	assert.Empty(t, events)
+}
+
+func TestHandleBuildLogs_LiveBuild(t *testing.T) {
+	builder := &progressImageBuilder{release: make(chan struct{}), image: "ttl.sh/execbox-abc:4h"}
+	svc := NewBuildService(newMockHandlerDB())
+	svc.SetBuilder(builder, nil)
+	apiKeyID := uuid.New()
+
+	out, err := svc.CreateBuild(WithAPIKeyID(context.Background(), apiKeyID), newTestBuildInput())
+	require.NoError(t, err)
+	close(builder.release)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/builds/"+out.Body.ID+"/logs", nil)
+	rec := httptest.NewRecorder()
+	newBuildLogTestRouter(svc, apiKeyID).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+
+	events := parseSSE(rec.Body.String())
+	require.NotEmpty(t, events)
+	assert.Equal(t, []sseEvent{
+		{Event: buildEventPhase, Data: BuildPhaseQueued},
+		{Event: buildEventPhase, Data: BuildPhaseBuilding},
+		{Event: buildEventLog, Data: "RUN pip install requests"},
+		{Event: buildEventLog, Data: "Successfully installed requests"},
+		{Event: buildEventPhase, Data: BuildPhasePushing},
+	}, events[:len(events)-1])
+
+	last := events[len(events)-1]
+	require.Equal(t, buildEventStatus, last.Event)
+	var status BuildResponse
+	require.NoError(t, json.Unmarshal([]byte(last.Data), &status))
+	assert.Equal(t, BuildPhaseReady, status.Phase)
+	require.NotNil(t, status.RegistryTag)
+	assert.Equal(t, builder.image, *status.RegistryTag)
+}
+
+func TestHandleBuildLogs_FinishedBuild(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	apiKeyID := uuid.New()
+	logTail := "RUN false\nexit code 1\n"
+	msg := "RUN exited with code 1"
+	mockDB.builds["build_done"] = &db.Build{
+		ID:       "build_done",
+		APIKeyID: apiKeyID,
+		Phase:    BuildPhaseFailed,
+		LogTail:  &logTail,
+		Error:    &msg,
+	}
+	svc := NewBuildService(mockDB)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/builds/build_done/logs", nil)
+	rec := httptest.NewRecorder()
+	newBuildLogTestRouter(svc, apiKeyID).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	events := parseSSE(rec.Body.String())
+	require.Len(t, events, 4)
+	assert.Equal(t, sseEvent{Event: buildEventPhase, Data: BuildPhaseFailed}, events[0])
+	assert.Equal(t, sseEvent{Event: buildEventLog, Data: "RUN false"}, events[1])
+	assert.Equal(t, sseEvent{Event: buildEventLog, Data: "exit code 1"}, events[2])
+	assert.Equal(t, buildEventStatus, events[3].Event)
+	assert.Contains(t, events[3].Data, msg)
+}
+
+func TestHandleBuildLogs_NotOwner(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockDB.builds["build_other"] = &db.Build{ID: "build_other", APIKeyID: uuid.New(), Phase: BuildPhaseReady}
+	svc := NewBuildService(mockDB)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/builds/build_other/logs", nil)
+	rec := httptest.NewRecorder()
+	newBuildLogTestRouter(svc, uuid.New()).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
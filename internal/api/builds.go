@@ -0,0 +1,320 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/backend/fly"
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// staleBuildAge is how long after it started a running build is considered
+	// orphaned: well past BuildTimeout.
+	staleBuildAge = 2 * fly.BuildTimeout
+
+	// staleQueuedBuildAge is how long a build may stay queued before it is
+	// considered orphaned: long enough for a full queue ahead of it to run.
+	staleQueuedBuildAge = (MaxQueuedBuilds/MaxConcurrentBuilds + 1) * staleBuildAge
+)
+
+// BuildService handles asynchronous image build operations.
+// Builds run in the background so clients are not held past the server's write timeout.
+type BuildService struct {
+	db      DBClient
+	builder ImageBuilder
+	cache   fly.BuildCache
+	slots   chan struct{} // one token per running build
+	queue   chan struct{} // one token per build running or waiting for a slot
+
+	webhooks *WebhookDispatcher
+
+	mu   sync.Mutex
+	live map[string]*buildLog // logs of builds running in this process
+}
+
+// NewBuildService creates a new BuildService.
+func NewBuildService(db DBClient) *BuildService {
+	return &BuildService{
+		db:    db,
+		slots: make(chan struct{}, MaxConcurrentBuilds),
+		queue: make(chan struct{}, MaxConcurrentBuilds+MaxQueuedBuilds),
+		live:  make(map[string]*buildLog),
+	}
+}
+
+// SetBuilder sets the image builder and cache used to run builds.
+func (s *BuildService) SetBuilder(builder ImageBuilder, cache fly.BuildCache) {
+	s.builder = builder
+	s.cache = cache
+}
+
+// SetWebhooks sets the dispatcher that publishes build.ready and build.failed events.
+func (s *BuildService) SetWebhooks(webhooks *WebhookDispatcher) {
+	s.webhooks = webhooks
+}
+
+// CreateBuild handles POST /v1/builds
+// Records the build and starts it in the background. A build whose image is
+// already cached is returned ready without running the builder.
+func (s *BuildService) CreateBuild(ctx context.Context, input *CreateBuildInput) (*CreateBuildOutput, error) {
+	apiKeyID, ok := GetAPIKeyID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	if s.builder == nil {
+		return nil, huma.Error500InternalServerError("image building not configured")
+	}
+
+	req := input.Body
+	if len(req.Setup) == 0 && len(req.Files) == 0 {
+		return nil, huma.Error400BadRequest("setup or files are required")
+	}
+
+	spec, err := buildSpecFromRequest(req.Image, req.Setup, req.Files)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	if err := fly.ValidateSetup(spec.Setup); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	build := &db.Build{
+		ID:        generateBuildID(),
+		APIKeyID:  apiKeyID,
+		Hash:      fly.ComputeHash(spec),
+		BaseImage: spec.BaseImage,
+		Phase:     BuildPhaseQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	// Cache hit: nothing to build
+	if s.cache != nil {
+		if registryTag, ok, err := s.cache.Get(ctx, build.Hash); err == nil && ok {
+			// Misses are counted by the lookup in resolveImage
+			observeCacheLookup(true)
+			go func() {
+				_ = s.cache.Touch(context.Background(), build.Hash)
+			}()
+			build.Phase = BuildPhaseReady
+			build.RegistryTag = &registryTag
+			build.CompletedAt = &build.CreatedAt
+		}
+	}
+
+	if build.Phase == BuildPhaseQueued {
+		select {
+		case s.queue <- struct{}{}:
+		default:
+			return nil, huma.NewError(http.StatusTooManyRequests, "build queue is full, retry later")
+		}
+	}
+
+	if err := s.db.CreateBuild(ctx, build); err != nil {
+		if build.Phase == BuildPhaseQueued {
+			<-s.queue
+		}
+		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to create build: %v", err))
+	}
+
+	accountID, _ := callerAccountID(ctx)
+	if build.Phase == BuildPhaseReady {
+		s.webhooks.Publish(ctx, accountID, EventBuildReady, buildResponse(build))
+	}
+
+	if build.Phase == BuildPhaseQueued {
+		// Register the log before returning so a client can follow it right away
+		log := newBuildLog()
+		log.Phase(BuildPhaseQueued)
+		s.mu.Lock()
+		s.live[build.ID] = log
+		s.mu.Unlock()
+
+		go s.run(build.ID, accountID, spec, log)
+	}
+
+	return &CreateBuildOutput{Body: buildResponse(build)}, nil
+}
+
+// GetBuild handles GET /v1/builds/{id}
+// Returns the build's phase, registry tag once ready, and the latest log tail.
+func (s *BuildService) GetBuild(ctx context.Context, input *GetBuildInput) (*GetBuildOutput, error) {
+	build, err := getAuthorizedBuild(ctx, s.db, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetBuildOutput{Body: buildResponse(build)}, nil
+}
+
+// run waits for a free build slot, then builds the image, recording progress
+// and the outcome on the build record and streaming output to log.
+func (s *BuildService) run(buildID string, accountID uuid.UUID, spec *fly.BuildSpec, log *buildLog) {
+	// Builds outlive the request that created them
+	ctx := context.Background()
+
+	// Runs last, after the final state is in the database, so followers
+	// that wake up on close read the finished build
+	defer func() {
+		s.mu.Lock()
+		delete(s.live, buildID)
+		s.mu.Unlock()
+		log.Close()
+		<-s.queue
+	}()
+
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	startedAt := time.Now().UTC()
+	phase := BuildPhaseBuilding
+	s.updateBuild(ctx, buildID, &db.BuildUpdate{Phase: &phase, StartedAt: &startedAt})
+	log.Phase(phase)
+
+	// Only write to the database when something changed since the last poll
+	lastPhase, lastLogs := phase, ""
+	observer := func(phase, logTail string) {
+		if phase == lastPhase && logTail == lastLogs {
+			return
+		}
+		if phase != lastPhase {
+			log.Phase(phase)
+		}
+		lastPhase, lastLogs = phase, logTail
+
+		update := &db.BuildUpdate{Phase: &phase}
+		if logTail != "" {
+			update.LogTail = &logTail
+		}
+		s.updateBuild(ctx, buildID, update)
+	}
+
+	buildCtx := fly.WithBuildLog(fly.WithBuildObserver(ctx, observer), log)
+	registryTag, err := resolveImage(buildCtx, s.builder, spec, s.cache)
+	completedAt := time.Now().UTC()
+	if err != nil {
+		phase := BuildPhaseFailed
+		msg := err.Error()
+		s.updateBuild(ctx, buildID, &db.BuildUpdate{Phase: &phase, Error: &msg, CompletedAt: &completedAt})
+		s.publishBuild(ctx, accountID, EventBuildFailed, buildID)
+		return
+	}
+
+	phase = BuildPhaseReady
+	s.updateBuild(ctx, buildID, &db.BuildUpdate{Phase: &phase, RegistryTag: &registryTag, CompletedAt: &completedAt})
+	s.publishBuild(ctx, accountID, EventBuildReady, buildID)
+}
+
+// publishBuild publishes a build event carrying the build as recorded.
+func (s *BuildService) publishBuild(ctx context.Context, accountID uuid.UUID, eventType, buildID string) {
+	if s.webhooks == nil {
+		return
+	}
+	build, err := s.db.GetBuild(ctx, buildID)
+	if err != nil {
+		slog.Warn("failed to load build for webhook", "error", err, "build_id", buildID)
+		return
+	}
+	s.webhooks.Publish(ctx, accountID, eventType, buildResponse(build))
+}
+
+// liveLog returns the log of a build running in this process, or nil.
+func (s *BuildService) liveLog(buildID string) *buildLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.live[buildID]
+}
+
+// updateBuild applies an update to a build record, logging failures since
+// there is no request left to report them to. Builds already marked failed,
+// e.g. by a sweep that took them for orphans, are left as they are.
+func (s *BuildService) updateBuild(ctx context.Context, buildID string, update *db.BuildUpdate) {
+	if err := s.db.UpdateBuild(ctx, buildID, update); err != nil {
+		slog.Warn("failed to update build", "error", err, "build_id", buildID)
+	}
+}
+
+// SweepStaleBuilds periodically fails builds that were orphaned by a server
+// restart, so clients polling them see a final phase. Builds still running or
+// queued in this process are never swept. It blocks until ctx is done.
+func (s *BuildService) SweepStaleBuilds(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		n, err := s.db.FailStaleBuilds(ctx, now.Add(-staleBuildAge), now.Add(-staleQueuedBuildAge), s.liveIDs(), "build interrupted by server restart")
+		if err != nil {
+			slog.Warn("failed to sweep stale builds", "error", err)
+		} else if n > 0 {
+			slog.Info("failed stale builds", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// liveIDs returns the IDs of the builds running or queued in this process.
+func (s *BuildService) liveIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.live))
+	for id := range s.live {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// getAuthorizedBuild retrieves a build and verifies the caller owns it.
+// Builds owned by other keys are reported as not found.
+func getAuthorizedBuild(ctx context.Context, dbClient DBClient, buildID string) (*db.Build, error) {
+	apiKeyID, ok := GetAPIKeyID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	build, err := dbClient.GetBuild(ctx, buildID)
+	if err != nil || build.APIKeyID != apiKeyID {
+		return nil, huma.Error404NotFound("build not found")
+	}
+
+	return build, nil
+}
+
+// generateBuildID generates a unique build ID
+func generateBuildID() string {
+	return fmt.Sprintf("build_%s", randHex(12))
+}
+
+// buildResponse converts a db.Build to a BuildResponse.
+func buildResponse(build *db.Build) BuildResponse {
+	resp := BuildResponse{
+		ID:          build.ID,
+		Phase:       build.Phase,
+		Image:       build.BaseImage,
+		RegistryTag: build.RegistryTag,
+		Error:       build.Error,
+		Logs:        build.LogTail,
+		CreatedAt:   build.CreatedAt.Format(time.RFC3339),
+	}
+	if build.StartedAt != nil {
+		startedAt := build.StartedAt.Format(time.RFC3339)
+		resp.StartedAt = &startedAt
+	}
+	if build.CompletedAt != nil {
+		completedAt := build.CompletedAt.Format(time.RFC3339)
+		resp.CompletedAt = &completedAt
+	}
+	return resp
+}
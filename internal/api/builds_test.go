@@ -0,0 +1,304 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/backend/fly"
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// progressImageBuilder reports a build and push phase and writes build output,
+// then waits for release before finishing.
+type progressImageBuilder struct {
+	release chan struct{}
+	image   string
+	err     error
+}
+
+func (b *progressImageBuilder) Resolve(ctx context.Context, spec *fly.BuildSpec, cache fly.BuildCache) (string, error) {
+	fly.ReportBuildProgress(ctx, fly.BuildPhaseBuilding, "RUN pip install requests")
+	if w := fly.BuildLogWriter(ctx); w != nil {
+		_, _ = io.WriteString(w, "RUN pip install requests\nSuccessfully installed requests\n")
+	}
+	fly.ReportBuildProgress(ctx, fly.BuildPhasePushing, "Pushing image to "+b.image)
+	<-b.release
+	if b.err != nil {
+		return "", b.err
+	}
+	return b.image, nil
+}
+
+// mapBuildCache is an in-memory fly.BuildCache.
+type mapBuildCache map[string]string
+
+func (c mapBuildCache) Get(ctx context.Context, hash string) (string, bool, error) {
+	tag, ok := c[hash]
+	return tag, ok, nil
+}
+
+func (c mapBuildCache) Put(ctx context.Context, hash, baseImage, registryTag string) error {
+	c[hash] = registryTag
+	return nil
+}
+
+func (c mapBuildCache) Touch(ctx context.Context, hash string) error {
+	return nil
+}
+
+// waitForBuildPhase polls a build until it reaches phase or the deadline passes.
+func waitForBuildPhase(t *testing.T, svc *BuildService, ctx context.Context, id, phase string) BuildResponse {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		out, err := svc.GetBuild(ctx, &GetBuildInput{ID: id})
+		if err != nil {
+			t.Fatalf("GetBuild failed: %v", err)
+		}
+		if out.Body.Phase == phase {
+			return out.Body
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("build %s stuck in phase %s, want %s", id, out.Body.Phase, phase)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestBuildInput() *CreateBuildInput {
+	return &CreateBuildInput{
+		Body: CreateBuildRequest{
+			Image: "python:3.12",
+			Setup: []string{"pip install requests"},
+		},
+	}
+}
+
+func TestBuildService_CreateBuild_Async(t *testing.T) {
+	builder := &progressImageBuilder{release: make(chan struct{}), image: "ttl.sh/execbox-abc:4h"}
+	svc := NewBuildService(newMockHandlerDB())
+	svc.SetBuilder(builder, nil)
+
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+	out, err := svc.CreateBuild(ctx, newTestBuildInput())
+	if err != nil {
+		t.Fatalf("CreateBuild failed: %v", err)
+	}
+	if out.Body.Phase != BuildPhaseQueued {
+		t.Errorf("expected phase %s, got %s", BuildPhaseQueued, out.Body.Phase)
+	}
+
+	pushing := waitForBuildPhase(t, svc, ctx, out.Body.ID, BuildPhasePushing)
+	if pushing.Logs == nil || *pushing.Logs != "Pushing image to ttl.sh/execbox-abc:4h" {
+		t.Errorf("expected latest log tail, got %v", pushing.Logs)
+	}
+
+	close(builder.release)
+	ready := waitForBuildPhase(t, svc, ctx, out.Body.ID, BuildPhaseReady)
+	if ready.RegistryTag == nil || *ready.RegistryTag != builder.image {
+		t.Errorf("expected registry tag %s, got %v", builder.image, ready.RegistryTag)
+	}
+	if ready.StartedAt == nil || ready.CompletedAt == nil {
+		t.Error("expected start and completion timestamps")
+	}
+}
+
+func TestBuildService_CreateBuild_Failure(t *testing.T) {
+	builder := &progressImageBuilder{release: make(chan struct{}), err: errors.New("RUN exited with code 1")}
+	close(builder.release)
+	svc := NewBuildService(newMockHandlerDB())
+	svc.SetBuilder(builder, nil)
+
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+	out, err := svc.CreateBuild(ctx, newTestBuildInput())
+	if err != nil {
+		t.Fatalf("CreateBuild failed: %v", err)
+	}
+
+	failed := waitForBuildPhase(t, svc, ctx, out.Body.ID, BuildPhaseFailed)
+	if failed.Error == nil || *failed.Error != "RUN exited with code 1" {
+		t.Errorf("expected build error, got %v", failed.Error)
+	}
+}
+
+func TestBuildService_CreateBuild_CacheHit(t *testing.T) {
+	builder := &progressImageBuilder{release: make(chan struct{})}
+	input := newTestBuildInput()
+	spec, _ := buildSpecFromRequest(input.Body.Image, input.Body.Setup, input.Body.Files)
+	cache := mapBuildCache{fly.ComputeHash(spec): "ttl.sh/execbox-cached:4h"}
+
+	svc := NewBuildService(newMockHandlerDB())
+	svc.SetBuilder(builder, cache)
+
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+	out, err := svc.CreateBuild(ctx, input)
+	if err != nil {
+		t.Fatalf("CreateBuild failed: %v", err)
+	}
+	if out.Body.Phase != BuildPhaseReady {
+		t.Errorf("expected phase %s, got %s", BuildPhaseReady, out.Body.Phase)
+	}
+	if out.Body.RegistryTag == nil || *out.Body.RegistryTag != "ttl.sh/execbox-cached:4h" {
+		t.Errorf("expected cached registry tag, got %v", out.Body.RegistryTag)
+	}
+}
+
+func TestBuildService_CreateBuild_QueueFull(t *testing.T) {
+	builder := &progressImageBuilder{release: make(chan struct{}), image: "ttl.sh/execbox-abc:4h"}
+	defer close(builder.release)
+	svc := NewBuildService(newMockHandlerDB())
+	svc.SetBuilder(builder, nil)
+
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+	for i := 0; i < MaxConcurrentBuilds+MaxQueuedBuilds; i++ {
+		if _, err := svc.CreateBuild(ctx, newTestBuildInput()); err != nil {
+			t.Fatalf("CreateBuild %d failed: %v", i, err)
+		}
+	}
+
+	_, err := svc.CreateBuild(ctx, newTestBuildInput())
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != 429 {
+		t.Fatalf("expected 429 error, got %v", err)
+	}
+	if n := len(svc.liveIDs()); n != MaxConcurrentBuilds+MaxQueuedBuilds {
+		t.Errorf("expected %d live builds, got %d", MaxConcurrentBuilds+MaxQueuedBuilds, n)
+	}
+}
+
+func TestBuildService_Run_KeepsSweptFailure(t *testing.T) {
+	builder := &progressImageBuilder{release: make(chan struct{}), image: "ttl.sh/execbox-abc:4h"}
+	mockDB := newMockHandlerDB()
+	svc := NewBuildService(mockDB)
+	svc.SetBuilder(builder, nil)
+
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+	out, err := svc.CreateBuild(ctx, newTestBuildInput())
+	if err != nil {
+		t.Fatalf("CreateBuild failed: %v", err)
+	}
+	waitForBuildPhase(t, svc, ctx, out.Body.ID, BuildPhasePushing)
+
+	// Another replica's sweep fails the build while it is still running here
+	mockDB.buildsMu.Lock()
+	mockDB.builds[out.Body.ID].Phase = BuildPhaseFailed
+	mockDB.buildsMu.Unlock()
+
+	close(builder.release)
+	deadline := time.Now().Add(2 * time.Second)
+	for svc.liveLog(out.Body.ID) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("build did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got, _ := svc.GetBuild(ctx, &GetBuildInput{ID: out.Body.ID})
+	if got.Body.Phase != BuildPhaseFailed || got.Body.RegistryTag != nil {
+		t.Errorf("expected the build to stay failed, got %+v", got.Body)
+	}
+}
+
+func TestBuildService_CreateBuild_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		body CreateBuildRequest
+	}{
+		{name: "no setup or files", body: CreateBuildRequest{Image: "alpine"}},
+		{name: "FROM in setup", body: CreateBuildRequest{Image: "alpine", Setup: []string{"FROM ubuntu"}}},
+		{name: "malformed base64", body: CreateBuildRequest{Image: "alpine", Files: []FileSpec{{Path: "/a", Content: "!!", Encoding: "base64"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewBuildService(newMockHandlerDB())
+			svc.SetBuilder(&progressImageBuilder{release: make(chan struct{})}, nil)
+
+			ctx := WithAPIKeyID(context.Background(), uuid.New())
+			_, err := svc.CreateBuild(ctx, &CreateBuildInput{Body: tt.body})
+
+			var statusErr huma.StatusError
+			if !errors.As(err, &statusErr) || statusErr.GetStatus() != 400 {
+				t.Fatalf("expected 400 error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildService_GetBuild_NotOwner(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockDB.builds["build_other"] = &db.Build{ID: "build_other", APIKeyID: uuid.New(), Phase: BuildPhaseReady}
+	svc := NewBuildService(mockDB)
+
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+	_, err := svc.GetBuild(ctx, &GetBuildInput{ID: "build_other"})
+
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != 404 {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+}
+
+func TestSessionService_CreateSession_FromBuild(t *testing.T) {
+	apiKeyID := uuid.New()
+	tag := "ttl.sh/execbox-abc:4h"
+
+	tests := []struct {
+		name       string
+		build      *db.Build
+		wantStatus int
+	}{
+		{
+			name:  "ready build",
+			build: &db.Build{ID: "build_1", APIKeyID: apiKeyID, Hash: "0123456789abcdef", Phase: BuildPhaseReady, RegistryTag: &tag},
+		},
+		{
+			name:       "build still running",
+			build:      &db.Build{ID: "build_1", APIKeyID: apiKeyID, Phase: BuildPhaseBuilding},
+			wantStatus: 409,
+		},
+		{
+			name:       "build owned by another key",
+			build:      &db.Build{ID: "build_1", APIKeyID: uuid.New(), Phase: BuildPhaseReady, RegistryTag: &tag},
+			wantStatus: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := newMockHandlerDB()
+			mockDB.builds[tt.build.ID] = tt.build
+			mockBackend := &mockBackendHandler{}
+			sessionSvc := NewSessionService(mockDB, mockBackend)
+
+			ctx := WithAPIKeyID(context.Background(), apiKeyID)
+			output, err := sessionSvc.CreateSession(ctx, &CreateSessionInput{
+				Body: CreateSessionRequest{BuildID: "build_1", Command: []string{"python"}},
+			})
+
+			if tt.wantStatus != 0 {
+				var statusErr huma.StatusError
+				if !errors.As(err, &statusErr) || statusErr.GetStatus() != tt.wantStatus {
+					t.Fatalf("expected %d error, got %v", tt.wantStatus, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CreateSession failed: %v", err)
+			}
+			if mockBackend.createConfig.Image != tag {
+				t.Errorf("expected backend to run %s, got %s", tag, mockBackend.createConfig.Image)
+			}
+			session := mockDB.sessions[output.Body.ID]
+			if session.SetupHash == nil || *session.SetupHash != tt.build.Hash {
+				t.Errorf("expected setup hash %s, got %v", tt.build.Hash, session.SetupHash)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 // Session status constants
 const (
 	SessionStatusPending = "pending"
@@ -7,8 +9,46 @@ const (
 	SessionStatusStopped = "stopped"
 	SessionStatusKilled  = "killed"
 	SessionStatusFailed  = "failed"
+	SessionStatusTimeout = "timeout" // Destroyed after running past its maximum duration
+)
+
+// Build phase constants
+const (
+	BuildPhaseQueued   = "queued"
+	BuildPhaseBuilding = "building"
+	BuildPhasePushing  = "pushing"
+	BuildPhaseReady    = "ready"
+	BuildPhaseFailed   = "failed"
+)
+
+// MaxConcurrentBuilds caps the image builds running at once on this server.
+// Further builds wait in the queued phase.
+const MaxConcurrentBuilds = 4
+
+// MaxQueuedBuilds caps the builds waiting for a slot on this server. Requests
+// beyond it are refused with 429 rather than queued.
+const MaxQueuedBuilds = 16
+
+// Exec timeout bounds for one-shot commands
+const (
+	DefaultExecTimeout = 30 * time.Second
+	MaxExecTimeout     = 5 * time.Minute
+
+	// ExecWriteGrace is how long past its timeout an exec response may take
+	// to write, beyond the server's write timeout.
+	ExecWriteGrace = 15 * time.Second
 )
 
+// Session label limits
+const (
+	MaxSessionLabels    = 20
+	MaxLabelKeyLength   = 63
+	MaxLabelValueLength = 255
+)
+
+// MaxFileSize is the largest file that can be uploaded to or downloaded from a session.
+const MaxFileSize = 10 << 20 // 10 MiB
+
 // Tier constants
 const (
 	TierAnonymous  = "anonymous"
@@ -18,6 +58,34 @@ const (
 	TierEnterprise = "enterprise"
 )
 
+// Member role constants. API keys act with the role of the member they were issued to.
+const (
+	RoleOwner         = "owner"          // Everything, including limits and the primary key
+	RoleAdmin         = "admin"          // Manages members, keys and webhooks
+	RoleDeveloper     = "developer"      // Runs sessions and builds with their own keys
+	RoleBillingViewer = "billing-viewer" // Reads the account, usage and limits
+)
+
+// API key scope constants. A key with scopes can only call the operations they cover.
+const (
+	ScopeSessionsCreate = "sessions:create" // Create, stop and kill sessions; create builds
+	ScopeSessionsRead   = "sessions:read"   // Read sessions, builds, their files, logs and events
+	ScopeSessionsExec   = "sessions:exec"   // Exec into and attach to sessions
+	ScopeFilesWrite     = "files:write"     // Upload files to sessions
+	ScopeKeysManage     = "keys:manage"     // Create, update, rotate and delete API keys
+	ScopeUsageRead      = "usage:read"      // Read usage, costs and limits
+	ScopeAccountManage  = "account:manage"  // Change the account and its limits, webhooks and members
+)
+
+// MaxRotationOverlap is the longest a rotated API key's previous value may keep working.
+const MaxRotationOverlap = 7 * 24 * time.Hour
+
+// MaxAuditExportEntries caps the entries a single audit log export returns.
+const MaxAuditExportEntries = 10000
+
+// InvitationTTL is how long an invitation to join an account can be accepted.
+const InvitationTTL = 7 * 24 * time.Hour
+
 // Quota request status constants
 const (
 	QuotaStatusPending   = "pending"
@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"net"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -13,6 +15,13 @@ const (
 	ctxAPIKeyID        ctxKey = "api_key_id"
 	ctxAPIKeyRateLimit ctxKey = "api_key_rate_limit"
 	ctxAPIKeyTier      ctxKey = "api_key_tier"
+	ctxAPIKeyLimits    ctxKey = "api_key_limits"
+	ctxAccountID       ctxKey = "account_id"
+	ctxMemberID        ctxKey = "member_id"
+	ctxRole            ctxKey = "role"
+	ctxScopes          ctxKey = "scopes"
+	ctxClientIP        ctxKey = "client_ip"
+	ctxWriteDeadline   ctxKey = "write_deadline"
 )
 
 // GetAPIKeyID retrieves the API key ID from the request context.
@@ -53,3 +62,128 @@ func GetAPIKeyTier(ctx context.Context) (string, bool) {
 func WithAPIKeyTier(ctx context.Context, tier string) context.Context {
 	return context.WithValue(ctx, ctxAPIKeyTier, tier)
 }
+
+// GetAPIKeyLimits retrieves the per-key session limit overrides from the request context.
+// Returns the overrides and true if found, otherwise returns empty overrides and false.
+func GetAPIKeyLimits(ctx context.Context) (APIKeyLimits, bool) {
+	limits, ok := ctx.Value(ctxAPIKeyLimits).(APIKeyLimits)
+	return limits, ok
+}
+
+// WithAPIKeyLimits adds the per-key session limit overrides to the request context.
+// This is typically called by authentication middleware after validating the API key.
+func WithAPIKeyLimits(ctx context.Context, limits APIKeyLimits) context.Context {
+	return context.WithValue(ctx, ctxAPIKeyLimits, limits)
+}
+
+// GetAccountID retrieves the ID of the account owning the API key from the request context.
+// Returns the account ID and true if found, otherwise returns a zero UUID and false.
+func GetAccountID(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(ctxAccountID).(uuid.UUID)
+	return id, ok
+}
+
+// WithAccountID adds the ID of the account owning the API key to the request context.
+// This is typically called by authentication middleware after validating the API key.
+func WithAccountID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, ctxAccountID, id)
+}
+
+// GetMemberID retrieves the ID of the member the API key was issued to from the request context.
+// Returns the member ID and true if found, otherwise returns a zero UUID and false.
+func GetMemberID(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(ctxMemberID).(uuid.UUID)
+	return id, ok
+}
+
+// WithMemberID adds the ID of the member the API key was issued to to the request context.
+// This is typically called by authentication middleware after validating the API key.
+func WithMemberID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, ctxMemberID, id)
+}
+
+// GetRole retrieves the role the API key acts with from the request context.
+// Returns the role and true if found, otherwise returns empty string and false.
+func GetRole(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(ctxRole).(string)
+	return role, ok
+}
+
+// WithRole adds the role the API key acts with to the request context.
+// This is typically called by authentication middleware after validating the API key.
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, ctxRole, role)
+}
+
+// GetScopes retrieves the scopes the API key is limited to from the request context.
+// Returns the scopes and true if the key is scoped, otherwise returns nil and false.
+func GetScopes(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(ctxScopes).([]string)
+	return scopes, ok
+}
+
+// WithScopes adds the scopes the API key is limited to to the request context.
+// This is typically called by authentication middleware for scoped API keys.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, ctxScopes, scopes)
+}
+
+// GetClientIP retrieves the IP address the request came from from the request context.
+// Returns the IP and true if found, otherwise returns empty string and false.
+func GetClientIP(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(ctxClientIP).(string)
+	return ip, ok
+}
+
+// WithClientIP adds the IP address the request came from to the request context.
+// This is typically called by authentication middleware, so audit entries record it.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ctxClientIP, ip)
+}
+
+// WithWriteDeadline adds a function setting the response's write deadline to
+// the request context. This is set by writeDeadlineMiddleware for operations
+// whose responses may take longer than the server's write timeout.
+func WithWriteDeadline(ctx context.Context, setDeadline func(time.Time) error) context.Context {
+	return context.WithValue(ctx, ctxWriteDeadline, setDeadline)
+}
+
+// extendWriteDeadline lets the response be written until deadline, past the
+// server's write timeout. It does nothing if the request context cannot set
+// the deadline.
+func extendWriteDeadline(ctx context.Context, deadline time.Time) {
+	if setDeadline, ok := ctx.Value(ctxWriteDeadline).(func(time.Time) error); ok {
+		_ = setDeadline(deadline)
+	}
+}
+
+// clientIP returns the host of a request's remote address, which chi's RealIP
+// middleware has set from X-Forwarded-For or X-Real-IP if present.
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// callerRole returns the role of the authenticated API key. The authentication
+// middleware always sets it; calls that bypass it act as the account owner.
+func callerRole(ctx context.Context) string {
+	if role, ok := GetRole(ctx); ok {
+		return role
+	}
+	return RoleOwner
+}
+
+// callerAccountID returns the account of the authenticated API key. Keys
+// created before accounts existed are their own account.
+func callerAccountID(ctx context.Context) (uuid.UUID, bool) {
+	apiKeyID, ok := GetAPIKeyID(ctx)
+	if !ok {
+		return uuid.Nil, false
+	}
+	if accountID, ok := GetAccountID(ctx); ok && accountID != uuid.Nil {
+		return accountID, true
+	}
+	return apiKeyID, true
+}
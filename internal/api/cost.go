@@ -7,6 +7,16 @@ type CostCalculator struct {
 	MemoryCostPerGBSecond int64 // in cents per GB-second (0.001 cents = $0.00001)
 }
 
+// DefaultSessionMemoryMB is the memory assumed for a session when estimating its cost.
+const DefaultSessionMemoryMB = 256
+
+// A session is billed at least the smallest allocation it can request (see
+// Resources) for its whole wall-clock duration, whatever was metered.
+const (
+	MinBilledCPUMillicores = 100
+	MinBilledMemoryMB      = 128
+)
+
 // DefaultCostCalculator is the default cost calculator with standard rates
 var DefaultCostCalculator = &CostCalculator{
 	BaseCostPerRequest:    1, // 0.1 cents = $0.001
@@ -26,3 +36,15 @@ func (c *CostCalculator) CalculateSessionCost(durationMs int64, cpuMillis int64,
 
 	return baseCost + cpuCost + memoryCost
 }
+
+// BillableUsage raises metered CPU time and memory to the wall-clock floor
+// for a session that ran for durationMs.
+func BillableUsage(durationMs, cpuMillis, memoryMB int64) (int64, int64) {
+	return max(cpuMillis, durationMs*MinBilledCPUMillicores/1000), max(memoryMB, MinBilledMemoryMB)
+}
+
+// EstimateSessionCost estimates the cost in cents of a session that ran for
+// durationMs, assuming one core and DefaultSessionMemoryMB.
+func (c *CostCalculator) EstimateSessionCost(durationMs int64) int64 {
+	return c.CalculateSessionCost(durationMs, durationMs, DefaultSessionMemoryMB)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// encodeCursor returns the opaque cursor of a page ending at the item with
+// the given creation time and ID. Lists are ordered by (created_at, id), so
+// the next page starts right after it.
+func encodeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+// decodeCursor returns the creation time and ID a cursor from encodeCursor
+// points at.
+func decodeCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	ts, id, ok := strings.Cut(string(data), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	return createdAt, id, nil
+}
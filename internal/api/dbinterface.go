@@ -17,26 +17,93 @@ type DBClient interface {
 	GetSession(ctx context.Context, id string) (*db.Session, error)
 	CreateSession(ctx context.Context, sess *db.Session) error
 	UpdateSession(ctx context.Context, id string, update *db.SessionUpdate) error
-	ListSessions(ctx context.Context, apiKeyID uuid.UUID, status *string) ([]db.Session, error)
+	EndActiveSession(ctx context.Context, id string, update *db.SessionUpdate) (bool, error)
+	RecordSessionSample(ctx context.Context, id string, sample *db.SessionSample) (*db.SessionSampleResult, error)
+	ListSessions(ctx context.Context, filter *db.SessionFilter) ([]db.Session, error)
+	ListExpiringSessions(ctx context.Context) ([]db.Session, error)
+	ListActiveSessions(ctx context.Context) ([]db.Session, error)
+	CountActiveSessionsByTier(ctx context.Context) (map[string]int, error)
+	FilterKnownBackendIDs(ctx context.Context, backendIDs []string) ([]string, error)
+	GetActiveSessionByBackendID(ctx context.Context, backendID string) (*db.Session, error)
 	DeleteSession(ctx context.Context, id string) error
 	GetActiveSessionCount(ctx context.Context, apiKeyID uuid.UUID) (int, error)
 	GetDailySessionCount(ctx context.Context, apiKeyID uuid.UUID) (int, error)
+	GetAccountActiveSessionCount(ctx context.Context, accountID uuid.UUID) (int, error)
+	GetAccountDailySessionCount(ctx context.Context, accountID uuid.UUID) (int, error)
 	CreateQuotaRequest(ctx context.Context, req *db.QuotaRequest) (*db.QuotaRequest, error)
 
+	// Image builds
+	CreateBuild(ctx context.Context, build *db.Build) error
+	GetBuild(ctx context.Context, id string) (*db.Build, error)
+	UpdateBuild(ctx context.Context, id string, update *db.BuildUpdate) error
+	FailStaleBuilds(ctx context.Context, startedBefore, queuedBefore time.Time, excluding []string, reason string) (int64, error)
+
+	// Accounts
+	GetAccount(ctx context.Context, id uuid.UUID) (*db.Account, error)
+	UpdateAccount(ctx context.Context, id uuid.UUID, update *db.AccountUpdate) (*db.Account, error)
+
+	// Account members and invitations
+	ListAccountMembers(ctx context.Context, accountID uuid.UUID) ([]db.AccountMember, error)
+	GetAccountMember(ctx context.Context, id uuid.UUID) (*db.AccountMember, error)
+	UpdateAccountMemberRole(ctx context.Context, id uuid.UUID, role string) (*db.AccountMember, error)
+	RemoveAccountMember(ctx context.Context, id uuid.UUID, performedBy string) error
+	CreateAccountInvitation(ctx context.Context, inv *db.AccountInvitation) error
+	ListAccountInvitations(ctx context.Context, accountID uuid.UUID) ([]db.AccountInvitation, error)
+	GetAccountInvitation(ctx context.Context, id uuid.UUID) (*db.AccountInvitation, error)
+	DeleteAccountInvitation(ctx context.Context, id uuid.UUID) error
+	AcceptAccountInvitation(ctx context.Context, tokenHash string, name *string) (*db.AccountMember, *db.APIKey, error)
+
+	// Account audit log
+	CreateAuditEntry(ctx context.Context, entry *db.AuditEntry) error
+	ListAuditEntries(ctx context.Context, accountID uuid.UUID, filter *db.AuditFilter) ([]db.AuditEntry, error)
+
 	// Account-level usage queries
 	GetAccountLimits(ctx context.Context, accountID uuid.UUID) (*db.AccountLimits, error)
 	UpsertAccountLimits(ctx context.Context, limits *db.AccountLimits) error
 	GetHourlyAccountUsage(ctx context.Context, accountID uuid.UUID, start, end time.Time) ([]db.HourlyAccountUsage, error)
 	GetDailyAccountUsage(ctx context.Context, accountID uuid.UUID, days int) ([]db.UsageMetric, error)
 	GetAccountCostTracking(ctx context.Context, accountID uuid.UUID, periodStart time.Time) ([]db.AccountCostTracking, error)
+	GetAccountSpend(ctx context.Context, accountID uuid.UUID, periodStart time.Time) (*db.AccountSpend, error)
+	CreateBudgetAlert(ctx context.Context, alert *db.BudgetAlert) (bool, error)
+	ClaimBudgetAlerts(ctx context.Context, limit int, leaseUntil time.Time) ([]db.BudgetAlert, error)
+	RecordBudgetAlertDelivery(ctx context.Context, id int64, attempts int, deliveredAt, nextDeliveryAt *time.Time) error
+
+	// Webhooks
+	CreateWebhook(ctx context.Context, hook *db.Webhook) error
+	GetWebhook(ctx context.Context, id uuid.UUID) (*db.Webhook, error)
+	ListWebhooks(ctx context.Context, accountID uuid.UUID) ([]db.Webhook, error)
+	ListWebhooksForEvent(ctx context.Context, accountID uuid.UUID, eventType string) ([]db.Webhook, error)
+	UpdateWebhook(ctx context.Context, id uuid.UUID, update *db.WebhookUpdate) error
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	CreateWebhookDelivery(ctx context.Context, delivery *db.WebhookDelivery) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, leaseUntil time.Time) ([]db.DueWebhookDelivery, error)
+	RecordWebhookDeliveryAttempt(ctx context.Context, id uuid.UUID, result *db.WebhookDeliveryResult) error
+	ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]db.WebhookDelivery, error)
+
+	// Session event log
+	CreateSessionEvent(ctx context.Context, event *db.SessionEvent) error
+	ListSessionEvents(ctx context.Context, accountID uuid.UUID, afterID int64, limit int) ([]db.SessionEvent, error)
+	GetLatestSessionEventID(ctx context.Context, accountID uuid.UUID) (int64, error)
+	PruneSessionEvents(ctx context.Context, before time.Time) (int64, error)
+
+	// Shared rate limit buckets
+	TakeRateLimitToken(ctx context.Context, key string, rate, burst float64) (bool, float64, error)
+	PruneRateLimitBuckets(ctx context.Context, before time.Time) (int64, error)
 
 	// Multi-key management
 	GetAPIKeysByAccount(ctx context.Context, accountID uuid.UUID) ([]db.APIKey, error)
-	CreateAPIKeyForAccount(ctx context.Context, accountID uuid.UUID, name, description string, parentKeyID uuid.UUID) (*db.APIKey, error)
+	CreateAPIKeyForAccount(ctx context.Context, accountID uuid.UUID, name, description string, parentKeyID uuid.UUID, scopes []string) (*db.APIKey, error)
 	UpdateAPIKey(ctx context.Context, keyID uuid.UUID, update *db.APIKeyUpdate) error
 	DeactivateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string) error
-	RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string) (*db.APIKey, error)
+	RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string, overlap time.Duration) (*db.APIKey, error)
 	IsPrimaryKey(ctx context.Context, keyID uuid.UUID) (bool, error)
+
+	// Key and tier expiry
+	ListAPIKeysExpiringBefore(ctx context.Context, before time.Time) ([]db.APIKey, error)
+	ClaimAPIKeyExpiryNotice(ctx context.Context, keyID uuid.UUID) (bool, error)
+	ReleaseAPIKeyExpiryNotice(ctx context.Context, keyID uuid.UUID) error
+	DeactivateExpiredAPIKeys(ctx context.Context, expiredBefore time.Time, performedBy string) (int64, error)
+	DowngradeExpiredTiers(ctx context.Context) (int64, error)
 }
 
 // Ensure *db.Client implements DBClient interface
@@ -80,6 +80,18 @@ func OpenAPIInfo() huma.OpenAPI {
 				Name:        "Sessions",
 				Description: "Create, manage, and monitor execution sessions",
 			},
+			{
+				Name:        "Builds",
+				Description: "Build custom images ahead of session creation",
+			},
+			{
+				Name:        "Webhooks",
+				Description: "Signed notifications of session and build events",
+			},
+			{
+				Name:        "Members",
+				Description: "Account members, their roles, and invitations to join",
+			},
 			{
 				Name:        "Quota",
 				Description: "Quota requests for increased limits",
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
 )
 
 // Standard API errors
@@ -14,6 +16,11 @@ var (
 	ErrConflict      = errors.New("session already stopped")
 	ErrInternal      = errors.New("internal server error")
 	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrFileNotFound  = errors.New("file not found")
+	ErrFileTooLarge  = errors.New("file too large")
+	ErrNoSessionURL  = errors.New("backend cannot address a single session")
+	ErrKeyExpired    = errors.New("API key has expired")
+	ErrKeyInactive   = errors.New("API key has been deactivated")
 )
 
 // ErrorResponse defines the standard error response format
@@ -26,11 +33,15 @@ type ErrorResponse struct {
 const (
 	CodeBadRequest     = "BAD_REQUEST"
 	CodeUnauthorized   = "UNAUTHORIZED"
+	CodeForbidden      = "FORBIDDEN"
 	CodeNotFound       = "NOT_FOUND"
 	CodeConflict       = "CONFLICT"
 	CodeInternal       = "INTERNAL"
 	CodeQuotaExceeded  = "QUOTA_EXCEEDED"
 	CodeNotImplemented = "NOT_IMPLEMENTED"
+	CodeTooLarge       = "TOO_LARGE"
+	CodeKeyExpired     = "KEY_EXPIRED"
+	CodeKeyInactive    = "KEY_INACTIVE"
 )
 
 // WriteError writes a JSON error response to the HTTP response writer
@@ -62,11 +73,51 @@ func WriteErrorFromStandard(w http.ResponseWriter, err error) {
 		WriteError(w, err, http.StatusNotFound, CodeNotFound)
 	case errors.Is(err, ErrUnauthorized):
 		WriteError(w, err, http.StatusUnauthorized, CodeUnauthorized)
+	case errors.Is(err, ErrKeyExpired):
+		WriteError(w, err, http.StatusUnauthorized, CodeKeyExpired)
+	case errors.Is(err, ErrKeyInactive):
+		WriteError(w, err, http.StatusUnauthorized, CodeKeyInactive)
 	case errors.Is(err, ErrBadRequest):
 		WriteError(w, err, http.StatusBadRequest, CodeBadRequest)
 	case errors.Is(err, ErrConflict):
 		WriteError(w, err, http.StatusConflict, CodeConflict)
+	case errors.Is(err, ErrFileNotFound):
+		WriteError(w, err, http.StatusNotFound, CodeNotFound)
+	case errors.Is(err, ErrFileTooLarge):
+		WriteError(w, err, http.StatusRequestEntityTooLarge, CodeTooLarge)
 	default:
 		WriteError(w, err, http.StatusInternalServerError, CodeInternal)
 	}
 }
+
+// WriteHumaError writes an error returned by a huma service method to a plain
+// http.ResponseWriter, preserving its status code. Used by chi handlers that
+// share logic with huma operations.
+func WriteHumaError(w http.ResponseWriter, err error) {
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) {
+		WriteErrorFromStandard(w, err)
+		return
+	}
+
+	status := statusErr.GetStatus()
+	code := CodeInternal
+	switch status {
+	case http.StatusBadRequest:
+		code = CodeBadRequest
+	case http.StatusUnauthorized:
+		code = CodeUnauthorized
+	case http.StatusForbidden:
+		code = CodeForbidden
+	case http.StatusNotFound:
+		code = CodeNotFound
+	case http.StatusConflict:
+		code = CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		code = CodeTooLarge
+	case http.StatusTooManyRequests:
+		code = CodeQuotaExceeded
+	}
+
+	WriteError(w, err, status, code)
+}
@@ -89,6 +89,18 @@ func TestWriteErrorFromStandard(t *testing.T) {
 			expectedStatus: http.StatusUnauthorized,
 			expectedCode:   CodeUnauthorized,
 		},
+		{
+			name:           "KeyExpired",
+			err:            ErrKeyExpired,
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   CodeKeyExpired,
+		},
+		{
+			name:           "KeyInactive",
+			err:            ErrKeyInactive,
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   CodeKeyInactive,
+		},
 		{
 			name:           "BadRequest",
 			err:            ErrBadRequest,
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/google/uuid"
+)
+
+const (
+	// eventRetention is how long session events are kept for streams to resume from.
+	eventRetention = 24 * time.Hour
+
+	// eventPruneInterval is how often events older than eventRetention are deleted.
+	eventPruneInterval = time.Hour
+
+	// eventPollInterval is how often a stream checks the database for events
+	// recorded by other replicas.
+	eventPollInterval = 2 * time.Second
+
+	// eventPageSize is the most events read from the database at once.
+	eventPageSize = 100
+)
+
+// EventLog records session status transitions per account and lets clients
+// follow them. Events are stored in the database, so a stream can resume from
+// the last event it saw, on any replica.
+type EventLog struct {
+	db DBClient
+
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced whenever an event is recorded in this process
+}
+
+// NewEventLog creates a new EventLog.
+func NewEventLog(db DBClient) *EventLog {
+	return &EventLog{
+		db:      db,
+		changed: make(chan struct{}),
+	}
+}
+
+// Record appends an event describing session to its account's log. Failures
+// are logged and never fail the operation that raised the event.
+func (l *EventLog) Record(ctx context.Context, session *db.Session, eventType string) {
+	if l == nil {
+		return
+	}
+
+	data, err := json.Marshal(buildSessionResponse(session))
+	if err != nil {
+		slog.Warn("failed to encode session event", "error", err, "session_id", session.ID)
+		return
+	}
+
+	event := &db.SessionEvent{
+		AccountID: session.AccountID,
+		SessionID: session.ID,
+		Type:      eventType,
+		Data:      data,
+	}
+	if err := l.db.CreateSessionEvent(ctx, event); err != nil {
+		slog.Warn("failed to record session event", "error", err, "session_id", session.ID, "event", eventType)
+		return
+	}
+
+	l.mu.Lock()
+	close(l.changed)
+	l.changed = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// RecordSessionUpdate records the event, if any, for a session moving from
+// status from to the status in update.
+func (l *EventLog) RecordSessionUpdate(ctx context.Context, session *db.Session, from string, update *db.SessionUpdate) {
+	if l == nil || update.Status == nil {
+		return
+	}
+	eventType := sessionEventType(from, *update.Status)
+	if eventType == "" {
+		return
+	}
+	l.Record(ctx, applySessionUpdate(session, update), eventType)
+}
+
+// Stream emits the events of an account recorded after afterID, then follows
+// new events until ctx is done or emit fails. emit is called with an empty
+// event type as a keepalive when nothing happened for a while.
+func (l *EventLog) Stream(ctx context.Context, accountID uuid.UUID, afterID int64, emit func(id int64, eventType, data string) error) error {
+	keepalive := time.NewTicker(buildLogKeepalive)
+	defer keepalive.Stop()
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+
+	for {
+		// Take the channel before reading, so events recorded meanwhile wake us
+		l.mu.Lock()
+		changed := l.changed
+		l.mu.Unlock()
+
+		for {
+			events, err := l.db.ListSessionEvents(ctx, accountID, afterID, eventPageSize)
+			if err != nil {
+				return fmt.Errorf("failed to list session events: %w", err)
+			}
+			for _, event := range events {
+				if err := emit(event.ID, event.Type, string(event.Data)); err != nil {
+					return err
+				}
+				afterID = event.ID
+			}
+			if len(events) < eventPageSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-keepalive.C:
+			if err := emit(0, "", ""); err != nil {
+				return err
+			}
+		case <-poll.C:
+		case <-changed:
+		}
+	}
+}
+
+// Run deletes events older than eventRetention now and then every
+// eventPruneInterval. It blocks until ctx is done.
+func (l *EventLog) Run(ctx context.Context) {
+	ticker := time.NewTicker(eventPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := l.db.PruneSessionEvents(ctx, time.Now().Add(-eventRetention))
+		if err != nil {
+			slog.Warn("failed to prune session events", "error", err)
+		} else if n > 0 {
+			slog.Info("pruned session events", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applySessionUpdate returns a copy of session with the status fields of update applied.
+func applySessionUpdate(session *db.Session, update *db.SessionUpdate) *db.Session {
+	updated := *session
+	if update.Status != nil {
+		updated.Status = *update.Status
+	}
+	if update.ExitCode != nil {
+		updated.ExitCode = update.ExitCode
+	}
+	if update.StartedAt != nil {
+		updated.StartedAt = update.StartedAt
+	}
+	if update.EndedAt != nil {
+		updated.EndedAt = update.EndedAt
+	}
+	return &updated
+}
+
+// handleEvents creates a handler that streams the status transitions of all
+// sessions of the caller's account as Server-Sent Events. Each event carries
+// its ID, its type (session.created, session.running, session.exited or
+// session.timeout) and the session as JSON. Clients that reconnect with a
+// Last-Event-ID header receive the events they missed, up to eventRetention back.
+// This needs special handling because huma handlers return a single response body.
+func handleEvents(events *EventLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		accountID, ok := callerAccountID(ctx)
+		if !ok {
+			WriteError(w, ErrUnauthorized, http.StatusUnauthorized, CodeUnauthorized)
+			return
+		}
+
+		var afterID int64
+		if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+			id, err := strconv.ParseInt(lastEventID, 10, 64)
+			if err != nil || id < 0 {
+				WriteError(w, fmt.Errorf("%w: invalid Last-Event-ID", ErrBadRequest), http.StatusBadRequest, CodeBadRequest)
+				return
+			}
+			afterID = id
+		} else {
+			// New streams only see what happens from now on
+			latest, err := events.db.GetLatestSessionEventID(ctx, accountID)
+			if err != nil {
+				WriteError(w, fmt.Errorf("failed to read event log: %w", err), http.StatusInternalServerError, CodeInternal)
+				return
+			}
+			afterID = latest
+		}
+
+		// Streams stay open far longer than the server's write timeout
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		_ = rc.Flush()
+
+		emit := func(id int64, eventType, data string) error {
+			var err error
+			if eventType == "" {
+				_, err = fmt.Fprint(w, ": keepalive\n\n")
+			} else {
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, eventType, data)
+			}
+			if err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		// The client going away is the usual way this ends; nothing left to report
+		if err := events.Stream(ctx, accountID, afterID, emit); err != nil && ctx.Err() == nil {
+			slog.Warn("session event stream ended", "error", err, "account_id", accountID)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/google/uuid"
+)
+
+func TestEventLog_RecordSessionUpdate(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	events := NewEventLog(mockDB)
+	accountID := uuid.New()
+	session := newExpiringSession("sess_a", SessionStatusPending, time.Now().Add(time.Hour))
+	session.AccountID = accountID
+
+	status := SessionStatusRunning
+	events.RecordSessionUpdate(context.Background(), session, SessionStatusPending, &db.SessionUpdate{Status: &status})
+	// Not a transition: nothing is recorded
+	events.RecordSessionUpdate(context.Background(), session, SessionStatusRunning, &db.SessionUpdate{Status: &status})
+
+	recorded, _ := mockDB.ListSessionEvents(context.Background(), accountID, 0, 10)
+	if len(recorded) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorded))
+	}
+	if recorded[0].Type != EventSessionRunning || recorded[0].SessionID != "sess_a" {
+		t.Errorf("unexpected event %+v", recorded[0])
+	}
+
+	var data SessionResponse
+	if err := json.Unmarshal(recorded[0].Data, &data); err != nil {
+		t.Fatalf("failed to decode event data: %v", err)
+	}
+	if data.Status != SessionStatusRunning {
+		t.Errorf("expected event data to carry the new status, got %s", data.Status)
+	}
+
+	// A nil log is a no-op
+	var none *EventLog
+	none.Record(context.Background(), session, EventSessionCreated)
+}
+
+func TestEventLog_StreamResumesAndFollows(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	events := NewEventLog(mockDB)
+	accountID := uuid.New()
+
+	first := newExpiringSession("sess_1", SessionStatusPending, time.Now().Add(time.Hour))
+	first.AccountID = accountID
+	events.Record(context.Background(), first, EventSessionCreated)
+	second := newExpiringSession("sess_2", SessionStatusPending, time.Now().Add(time.Hour))
+	second.AccountID = accountID
+	events.Record(context.Background(), second, EventSessionCreated)
+	other := newExpiringSession("sess_other", SessionStatusPending, time.Now().Add(time.Hour))
+	other.AccountID = uuid.New()
+	events.Record(context.Background(), other, EventSessionCreated)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var ids []int64
+	done := make(chan error, 1)
+	go func() {
+		done <- events.Stream(ctx, accountID, 1, func(id int64, eventType, data string) error {
+			if eventType == "" {
+				return nil
+			}
+			ids = append(ids, id)
+			if len(ids) == 2 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	// Recorded after the stream caught up, so it arrives through the wake-up
+	time.Sleep(50 * time.Millisecond)
+	third := newExpiringSession("sess_3", SessionStatusPending, time.Now().Add(time.Hour))
+	third.AccountID = accountID
+	events.Record(context.Background(), third, EventSessionCreated)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not end")
+	}
+
+	// Event 1 was already seen and event 3 belongs to another account
+	if len(ids) != 2 || ids[0] != 2 || ids[1] != 4 {
+		t.Errorf("expected events [2 4], got %v", ids)
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	events := NewEventLog(mockDB)
+	accountID := uuid.New()
+
+	session := newExpiringSession("sess_a", SessionStatusPending, time.Now().Add(time.Hour))
+	session.AccountID = accountID
+	events.Record(context.Background(), session, EventSessionCreated)
+	status := SessionStatusRunning
+	events.RecordSessionUpdate(context.Background(), session, SessionStatusPending, &db.SessionUpdate{Status: &status})
+
+	withAccount := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(WithAccountID(WithAPIKeyID(r.Context(), uuid.New()), accountID)))
+		})
+	}
+	server := httptest.NewServer(withAccount(handleEvents(events)))
+	defer server.Close()
+
+	t.Run("resumes after Last-Event-ID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Last-Event-ID", "1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("expected text/event-stream, got %s", ct)
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		var lines []string
+		for len(lines) < 3 {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read event: %v", err)
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+		if lines[0] != "id: 2" || lines[1] != "event: session.running" || !strings.HasPrefix(lines[2], "data: {") {
+			t.Errorf("unexpected event %q", lines)
+		}
+	})
+
+	t.Run("rejects invalid Last-Event-ID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Last-Event-ID", "abc")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("requires authentication", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handleEvents(events).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/events", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxPathLength is the longest path accepted by the file endpoints (Linux PATH_MAX).
+const maxPathLength = 4096
+
+// listDirScript prints one "<size> <raw-mode-hex> <name>" line per directory entry.
+// It uses only POSIX sh and `stat -c`, which both GNU coreutils and busybox provide.
+// Exits with status 2 if the directory cannot be entered.
+const listDirScript = `cd -- "$1" 2>/dev/null || exit 2
+for f in * .[!.]* ..?*; do
+	[ -e "$f" ] || [ -L "$f" ] || continue
+	stat -c '%s %f %n' -- "$f"
+done`
+
+// cleanSessionPath validates a user-supplied path inside a session container and
+// returns its cleaned absolute form. Any ".." segment is rejected outright rather
+// than resolved, so a path can never climb out of the directory it names.
+func cleanSessionPath(p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("%w: path is required", ErrBadRequest)
+	}
+	if len(p) > maxPathLength {
+		return "", fmt.Errorf("%w: path exceeds %d characters", ErrBadRequest, maxPathLength)
+	}
+	// Control characters would let a path add lines to a generated Dockerfile
+	if strings.ContainsFunc(p, unicode.IsControl) {
+		return "", fmt.Errorf("%w: path contains a control character", ErrBadRequest)
+	}
+
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("%w: path must not contain '..'", ErrBadRequest)
+		}
+	}
+
+	return path.Clean(p), nil
+}
+
+// getFileSession retrieves a session for a file operation, verifying ownership
+// and that the session is live with a backend to talk to.
+func (s *SessionService) getFileSession(ctx context.Context, sessionID string) (*db.Session, error) {
+	session, err := s.getAuthorizedSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isActiveStatus(session.Status) {
+		return nil, huma.Error409Conflict(fmt.Sprintf("session is not running (status: %s)", session.Status))
+	}
+
+	if session.GetBackendID() == "" || s.backend == nil {
+		return nil, huma.Error500InternalServerError("no backend configured")
+	}
+
+	return session, nil
+}
+
+// UploadFile writes content to filePath inside a session.
+func (s *SessionService) UploadFile(ctx context.Context, sessionID, filePath string, content []byte) (*UploadFileResponse, error) {
+	cleaned, err := cleanSessionPath(filePath)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	if cleaned == "/" {
+		return nil, huma.Error400BadRequest("path must name a file")
+	}
+
+	if int64(len(content)) > MaxFileSize {
+		return nil, huma.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds maximum size of %d bytes", MaxFileSize))
+	}
+
+	session, err := s.getFileSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.backend.WriteFile(ctx, session.GetBackendID(), cleaned, content); err != nil {
+		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to upload file: %v", err))
+	}
+
+	return &UploadFileResponse{
+		Path: cleaned,
+		Size: int64(len(content)),
+	}, nil
+}
+
+// DownloadFile reads filePath from inside a session.
+// Returns the cleaned path alongside the content.
+func (s *SessionService) DownloadFile(ctx context.Context, sessionID, filePath string) (string, []byte, error) {
+	cleaned, err := cleanSessionPath(filePath)
+	if err != nil {
+		return "", nil, huma.Error400BadRequest(err.Error())
+	}
+
+	session, err := s.getFileSession(ctx, sessionID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	content, err := s.backend.ReadFile(ctx, session.GetBackendID(), cleaned, MaxFileSize)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		return "", nil, huma.Error404NotFound("file not found")
+	case errors.Is(err, ErrFileTooLarge):
+		return "", nil, huma.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds maximum size of %d bytes", MaxFileSize))
+	case err != nil:
+		return "", nil, huma.Error500InternalServerError(fmt.Sprintf("failed to download file: %v", err))
+	}
+
+	return cleaned, content, nil
+}
+
+// ListFiles handles GET /v1/sessions/{id}/files
+// Lists the entries of a directory inside a running session.
+func (s *SessionService) ListFiles(ctx context.Context, input *ListFilesInput) (*ListFilesOutput, error) {
+	dir := input.Dir
+	if dir == "" {
+		dir = "/"
+	}
+	cleaned, err := cleanSessionPath(dir)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	session, err := s.getFileSession(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, exitCode, err := s.backend.Exec(ctx, session.GetBackendID(), []string{"sh", "-c", listDirScript, "sh", cleaned})
+	if err != nil {
+		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to list directory: %v", err))
+	}
+	switch exitCode {
+	case 0:
+	case 2:
+		return nil, huma.Error404NotFound("directory not found")
+	default:
+		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to list directory (exit %d): %s", exitCode, strings.TrimSpace(stderr)))
+	}
+
+	response := ListDirectoryResponse{
+		Path:    cleaned,
+		Entries: parseDirListing(stdout),
+	}
+
+	return &ListFilesOutput{Body: response}, nil
+}
+
+// parseDirListing parses the output of listDirScript into file entries.
+// Malformed lines are skipped.
+func parseDirListing(output string) []FileEntry {
+	entries := make([]FileEntry, 0)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		rawMode, err := strconv.ParseUint(fields[1], 16, 32)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, FileEntry{
+			Name:  fields[2],
+			Size:  size,
+			IsDir: rawMode&0o170000 == 0o040000, // S_IFMT == S_IFDIR
+			Mode:  uint32(rawMode & 0o7777),
+		})
+	}
+	return entries
+}
+
+// handleUploadFile creates a handler for PUT /v1/sessions/{id}/files/*.
+// Like attach, this is a plain chi handler: huma cannot route wildcard paths
+// and the request body is raw file content rather than JSON.
+func handleUploadFile(sessionSvc *SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filePath, err := url.PathUnescape(chi.URLParam(r, "*"))
+		if err != nil {
+			WriteError(w, fmt.Errorf("%w: invalid path encoding", ErrBadRequest), http.StatusBadRequest, CodeBadRequest)
+			return
+		}
+
+		// Read one byte past the limit so oversized uploads can be detected
+		content, err := io.ReadAll(io.LimitReader(r.Body, MaxFileSize+1))
+		if err != nil {
+			WriteError(w, fmt.Errorf("%w: failed to read request body", ErrBadRequest), http.StatusBadRequest, CodeBadRequest)
+			return
+		}
+
+		response, err := sessionSvc.UploadFile(r.Context(), chi.URLParam(r, "id"), filePath, content)
+		if err != nil {
+			WriteHumaError(w, err)
+			return
+		}
+
+		_ = WriteJSON(w, response, http.StatusCreated)
+	}
+}
+
+// handleDownloadFile creates a handler for GET /v1/sessions/{id}/files/*.
+// The file is returned as application/octet-stream.
+func handleDownloadFile(sessionSvc *SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filePath, err := url.PathUnescape(chi.URLParam(r, "*"))
+		if err != nil {
+			WriteError(w, fmt.Errorf("%w: invalid path encoding", ErrBadRequest), http.StatusBadRequest, CodeBadRequest)
+			return
+		}
+
+		cleaned, content, err := sessionSvc.DownloadFile(r.Context(), chi.URLParam(r, "id"), filePath)
+		if err != nil {
+			WriteHumaError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(cleaned)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(content)
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanSessionPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "absolute path", input: "/app/data.csv", want: "/app/data.csv"},
+		{name: "relative path gets leading slash", input: "app/data.csv", want: "/app/data.csv"},
+		{name: "redundant separators cleaned", input: "/app//sub/./file", want: "/app/sub/file"},
+		{name: "root", input: "/", want: "/"},
+		{name: "empty", input: "", wantErr: true},
+		{name: "parent traversal", input: "/app/../etc/passwd", wantErr: true},
+		{name: "leading traversal", input: "../etc/passwd", wantErr: true},
+		{name: "NUL byte", input: "/app/a\x00b", wantErr: true},
+		{name: "newline", input: "/app/a\nRUN id", wantErr: true},
+		{name: "carriage return", input: "/app/a\rb", wantErr: true},
+		{name: "spaces allowed", input: "/app/my file.txt", want: "/app/my file.txt"},
+		{name: "too long", input: "/" + strings.Repeat("a", maxPathLength), wantErr: true},
+		{name: "dots in name allowed", input: "/app/..hidden", want: "/app/..hidden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanSessionPath(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseDirListing(t *testing.T) {
+	output := "1234 81a4 main.py\n4096 41ed data\n12 81ed run script.sh\ngarbage\n"
+
+	entries := parseDirListing(output)
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, FileEntry{Name: "main.py", Size: 1234, IsDir: false, Mode: 0o644}, entries[0])
+	assert.Equal(t, FileEntry{Name: "data", Size: 4096, IsDir: true, Mode: 0o755}, entries[1])
+	assert.Equal(t, "run script.sh", entries[2].Name)
+}
+
+func TestParseDirListing_Empty(t *testing.T) {
+	entries := parseDirListing("")
+
+	assert.NotNil(t, entries)
+	assert.Empty(t, entries)
+}
+
+// newFileTestRouter wires the raw file handlers behind a stub auth middleware.
+func newFileTestRouter(sessionSvc *SessionService, apiKeyID uuid.UUID) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithAPIKeyID(r.Context(), apiKeyID)))
+		})
+	})
+	router.Put("/v1/sessions/{id}/files/*", handleUploadFile(sessionSvc))
+	router.Get("/v1/sessions/{id}/files/*", handleDownloadFile(sessionSvc))
+	return router
+}
+
+func newRunningFileSession(mockDB *mockHandlerDB, apiKeyID uuid.UUID) {
+	backendID := "backend_123"
+	mockDB.sessions["sess_files"] = &db.Session{
+		ID:        "sess_files",
+		APIKeyID:  apiKeyID,
+		BackendID: &backendID,
+		Status:    "running",
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func TestFileHandlers_UploadThenDownload(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+	apiKeyID := uuid.New()
+	newRunningFileSession(mockDB, apiKeyID)
+	router := newFileTestRouter(sessionSvc, apiKeyID)
+
+	// Upload
+	req := httptest.NewRequest(http.MethodPut, "/v1/sessions/sess_files/files/app/data.csv", bytes.NewReader([]byte("a,b\n1,2\n")))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var uploaded UploadFileResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&uploaded))
+	assert.Equal(t, "/app/data.csv", uploaded.Path)
+	assert.Equal(t, int64(8), uploaded.Size)
+
+	// Download
+	req = httptest.NewRequest(http.MethodGet, "/v1/sessions/sess_files/files/app/data.csv", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "a,b\n1,2\n", rec.Body.String())
+}
+
+func TestFileHandlers_DownloadNotFound(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+	apiKeyID := uuid.New()
+	newRunningFileSession(mockDB, apiKeyID)
+	router := newFileTestRouter(sessionSvc, apiKeyID)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/sessions/sess_files/files/missing.txt", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestFileHandlers_RejectsEncodedTraversal(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+	apiKeyID := uuid.New()
+	newRunningFileSession(mockDB, apiKeyID)
+	router := newFileTestRouter(sessionSvc, apiKeyID)
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/sessions/sess_files/files/app/%2e%2e/etc/passwd", bytes.NewReader([]byte("x")))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, mockBackend.files)
+}
+
+func TestFileHandlers_UploadTooLarge(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+	apiKeyID := uuid.New()
+	newRunningFileSession(mockDB, apiKeyID)
+	router := newFileTestRouter(sessionSvc, apiKeyID)
+
+	body := bytes.NewReader(make([]byte, MaxFileSize+1))
+	req := httptest.NewRequest(http.MethodPut, "/v1/sessions/sess_files/files/big.bin", body)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Empty(t, mockBackend.files)
+}
+
+func TestFileHandlers_SessionNotRunning(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+	apiKeyID := uuid.New()
+	newRunningFileSession(mockDB, apiKeyID)
+	mockDB.sessions["sess_files"].Status = "stopped"
+	router := newFileTestRouter(sessionSvc, apiKeyID)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/sessions/sess_files/files/app/data.csv", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestSessionService_ListFiles(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{
+		execStdout: "1234 81a4 main.py\n4096 41ed data\n",
+	}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+	apiKeyID := uuid.New()
+	newRunningFileSession(mockDB, apiKeyID)
+
+	ctx := WithAPIKeyID(context.Background(), apiKeyID)
+	output, err := sessionSvc.ListFiles(ctx, &ListFilesInput{ID: "sess_files", Dir: "/app"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "/app", output.Body.Path)
+	require.Len(t, output.Body.Entries, 2)
+	assert.True(t, output.Body.Entries[1].IsDir)
+	assert.Equal(t, "/app", mockBackend.execCmd[len(mockBackend.execCmd)-1])
+}
+
+func TestSessionService_ListFiles_DirectoryNotFound(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{execExitCode: 2}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+	apiKeyID := uuid.New()
+	newRunningFileSession(mockDB, apiKeyID)
+
+	ctx := WithAPIKeyID(context.Background(), apiKeyID)
+	_, err := sessionSvc.ListFiles(ctx, &ListFilesInput{ID: "sess_files", Dir: "/nope"})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
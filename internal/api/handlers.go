@@ -3,8 +3,10 @@ package api
 import (
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/burka/execbox-cloud/internal/backend/fly"
@@ -15,8 +17,15 @@ import (
 // Deprecated: Use Backend interface instead for new code.
 type FlyClient interface {
 	CreateMachine(ctx context.Context, config *fly.MachineConfig) (*fly.Machine, error)
+	GetMachine(ctx context.Context, machineID string) (*fly.Machine, error)
+	ListMachines(ctx context.Context) ([]fly.Machine, error)
 	StopMachine(ctx context.Context, machineID string) error
 	DestroyMachine(ctx context.Context, machineID string) error
+	Exec(ctx context.Context, machineID string, req *fly.ExecRequest) (*fly.ExecResponse, error)
+	WriteFile(ctx context.Context, machineID, path string, content []byte) error
+	ReadFile(ctx context.Context, machineID, path string, maxSize int64) ([]byte, error)
+	MachineUsage(ctx context.Context, machineID string) (*fly.MachineUsage, error)
+	AppName() string
 }
 
 // ImageBuilder defines the image building operations.
@@ -125,6 +134,7 @@ func buildMachineConfig(req *CreateSessionRequest) *fly.MachineConfig {
 }
 
 // buildCreateSessionConfig converts a CreateSessionRequest to a generic CreateSessionConfig.
+// Setup commands and files are not carried over: they are already baked into resolvedImage.
 func buildCreateSessionConfig(req *CreateSessionRequest, resolvedImage string) *CreateSessionConfig {
 	config := &CreateSessionConfig{
 		Image:   resolvedImage,
@@ -132,7 +142,6 @@ func buildCreateSessionConfig(req *CreateSessionRequest, resolvedImage string) *
 		Env:     req.Env,
 		WorkDir: req.WorkDir,
 		Network: req.Network,
-		Setup:   req.Setup,
 	}
 
 	// Add resources
@@ -159,18 +168,58 @@ func buildCreateSessionConfig(req *CreateSessionRequest, resolvedImage string) *
 		}
 	}
 
-	// Add files
-	if len(req.Files) > 0 {
-		config.Files = make([]SessionFile, 0, len(req.Files))
-		for _, file := range req.Files {
-			config.Files = append(config.Files, SessionFile{
-				Path:    file.Path,
-				Content: []byte(file.Content),
-			})
+	return config
+}
+
+// buildSpecFromRequest converts a base image with setup commands and files from
+// a request into an image build spec, decoding base64 file content and validating paths.
+func buildSpecFromRequest(image string, setup []string, files []FileSpec) (*fly.BuildSpec, error) {
+	spec := &fly.BuildSpec{
+		BaseImage: image,
+		Setup:     setup,
+		Files:     make([]fly.BuildFile, 0, len(files)),
+	}
+
+	for _, f := range files {
+		filePath, err := cleanSessionPath(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file path %q: %w", f.Path, err)
+		}
+		if filePath == "/" {
+			return nil, fmt.Errorf("invalid file path %q: path must name a file", f.Path)
+		}
+
+		content, err := decodeFileContent(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content for %s: %w", filePath, err)
 		}
+		if int64(len(content)) > MaxFileSize {
+			return nil, fmt.Errorf("file %s exceeds maximum size of %d bytes", filePath, MaxFileSize)
+		}
+
+		spec.Files = append(spec.Files, fly.BuildFile{
+			Path:    filePath,
+			Content: content,
+		})
 	}
 
-	return config
+	return spec, nil
+}
+
+// decodeFileContent returns the raw bytes of a FileSpec according to its encoding.
+func decodeFileContent(f FileSpec) ([]byte, error) {
+	switch f.Encoding {
+	case "", "utf8":
+		return []byte(f.Content), nil
+	case "base64":
+		content, err := base64.StdEncoding.DecodeString(f.Content)
+		if err != nil {
+			return nil, fmt.Errorf("malformed base64: %w", err)
+		}
+		return content, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", f.Encoding)
+	}
 }
 
 // buildPorts converts API PortSpec to database Port models.
@@ -195,6 +244,49 @@ func buildPorts(specs []PortSpec) []db.Port {
 	return ports
 }
 
+// validateLabels checks session labels against the label limits. Keys cannot
+// contain "=", which separates them from values in list filters.
+func validateLabels(labels map[string]string) error {
+	if len(labels) > MaxSessionLabels {
+		return fmt.Errorf("at most %d labels are allowed", MaxSessionLabels)
+	}
+	for key, value := range labels {
+		if key == "" || len(key) > MaxLabelKeyLength || strings.Contains(key, "=") {
+			return fmt.Errorf("label key %q must be 1 to %d characters without '='", key, MaxLabelKeyLength)
+		}
+		if len(value) > MaxLabelValueLength {
+			return fmt.Errorf("label %q must be %d characters or less", key, MaxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// parseLabelFilters parses key=value label filters into the labels a session
+// must carry.
+func parseLabelFilters(filters []string) (map[string]string, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(filters))
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("label filter %q must be key=value", filter)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// keyPreview returns the masked preview of an API key. Keys read from the
+// database only carry the prefix they are looked up by.
+func keyPreview(k *db.APIKey) string {
+	if k.KeyPrefix != "" {
+		return k.KeyPrefix + "..."
+	}
+	return maskAPIKey(k.Key)
+}
+
 // maskAPIKey masks an API key to show only the first 7 and last 4 characters.
 func maskAPIKey(key string) string {
 	if len(key) < 12 {
@@ -211,6 +303,8 @@ func buildSessionResponse(session *db.Session) SessionResponse {
 		Image:     session.Image,
 		CreatedAt: session.CreatedAt.Format(time.RFC3339),
 		ExitCode:  session.ExitCode,
+		Labels:    session.Labels,
+		Backend:   session.Backend,
 	}
 
 	if session.StartedAt != nil {
@@ -223,6 +317,11 @@ func buildSessionResponse(session *db.Session) SessionResponse {
 		response.EndedAt = &endedAt
 	}
 
+	if session.ExpiresAt != nil {
+		expiresAt := session.ExpiresAt.Format(time.RFC3339)
+		response.ExpiresAt = &expiresAt
+	}
+
 	// Build network info from ports if available
 	if len(session.Ports) > 0 {
 		portMap := make(map[string]PortInfo)
@@ -237,8 +336,12 @@ func buildSessionResponse(session *db.Session) SessionResponse {
 			portMap[portKey] = info
 		}
 
+		mode := "exposed"
+		if session.Network != nil {
+			mode = *session.Network
+		}
 		response.Network = &NetworkInfo{
-			Mode:  "exposed", // Simplified - would track this in session
+			Mode:  mode,
 			Ports: portMap,
 		}
 	}
@@ -2,13 +2,24 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/burka/execbox-cloud/internal/backend/fly"
 	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
@@ -21,14 +32,48 @@ type mockHandlerDB struct {
 	updateErr       error
 	deleteErr       error
 	apiKeysByString map[string]*db.APIKey
+	accounts        map[uuid.UUID]*db.Account
 	lastUsedCalls   map[uuid.UUID]int
+
+	// Last update passed to UpdateSession
+	lastSessionUpdate *db.SessionUpdate
+
+	// Cost of ended sessions per account, and budget alerts recorded by CreateBudgetAlert
+	settledCents   map[uuid.UUID]int64
+	budgetAlertsMu sync.Mutex
+	budgetAlerts   []*db.BudgetAlert
+
+	// Builds are updated from background goroutines
+	buildsMu sync.Mutex
+	builds   map[string]*db.Build
+
+	// Webhooks and their deliveries, in creation order
+	webhooksMu sync.Mutex
+	webhooks   map[uuid.UUID]*db.Webhook
+	deliveries []*db.WebhookDelivery
+
+	// Audit entries recorded by CreateAuditEntry, in order
+	auditEntries []*db.AuditEntry
+
+	// Session event log, read by event streams while sessions change
+	eventsMu sync.Mutex
+	events   []db.SessionEvent
+
+	// Shared rate limit buckets by key; they do not refill
+	rateLimitMu     sync.Mutex
+	rateLimitTokens map[string]float64
+	rateLimitErr    error
 }
 
 func newMockHandlerDB() *mockHandlerDB {
 	return &mockHandlerDB{
 		sessions:        make(map[string]*db.Session),
 		apiKeysByString: make(map[string]*db.APIKey),
+		accounts:        make(map[uuid.UUID]*db.Account),
 		lastUsedCalls:   make(map[uuid.UUID]int),
+		builds:          make(map[string]*db.Build),
+		webhooks:        make(map[uuid.UUID]*db.Webhook),
+		rateLimitTokens: make(map[string]float64),
 	}
 }
 
@@ -51,20 +96,16 @@ func (m *mockHandlerDB) GetSession(ctx context.Context, id string) (*db.Session,
 	return session, nil
 }
 
-func (m *mockHandlerDB) ListSessions(ctx context.Context, apiKeyID uuid.UUID, status *string) ([]db.Session, error) {
+func (m *mockHandlerDB) ListSessions(ctx context.Context, filter *db.SessionFilter) ([]db.Session, error) {
 	if m.listErr != nil {
 		return nil, m.listErr
 	}
 
 	var sessions []db.Session
 	for _, session := range m.sessions {
-		if session.APIKeyID == apiKeyID {
-			if status == nil || session.Status == *status {
-				sessions = append(sessions, *session)
-			}
-		}
+		sessions = append(sessions, *session)
 	}
-	return sessions, nil
+	return filterSessions(sessions, filter), nil
 }
 
 func (m *mockHandlerDB) UpdateSession(ctx context.Context, id string, update *db.SessionUpdate) error {
@@ -76,6 +117,7 @@ func (m *mockHandlerDB) UpdateSession(ctx context.Context, id string, update *db
 	if !ok {
 		return fmt.Errorf("session not found")
 	}
+	m.lastSessionUpdate = update
 
 	if update.Status != nil {
 		session.Status = *update.Status
@@ -98,10 +140,105 @@ func (m *mockHandlerDB) UpdateSession(ctx context.Context, id string, update *db
 	if update.EndedAt != nil {
 		session.EndedAt = update.EndedAt
 	}
+	if update.CPUMillisUsed != nil {
+		session.CPUMillisUsed = update.CPUMillisUsed
+	}
+	if update.MemoryPeakMB != nil {
+		session.MemoryPeakMB = update.MemoryPeakMB
+	}
 
 	return nil
 }
 
+func (m *mockHandlerDB) EndActiveSession(ctx context.Context, id string, update *db.SessionUpdate) (bool, error) {
+	if session, ok := m.sessions[id]; !ok || !isActiveStatus(session.Status) {
+		return false, m.updateErr
+	}
+	if err := m.UpdateSession(ctx, id, update); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *mockHandlerDB) RecordSessionSample(ctx context.Context, id string, sample *db.SessionSample) (*db.SessionSampleResult, error) {
+	if m.updateErr != nil {
+		return nil, m.updateErr
+	}
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session not found")
+	}
+	return applySessionSample(session, sample), nil
+}
+
+func (m *mockHandlerDB) ListExpiringSessions(ctx context.Context) ([]db.Session, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+
+	var sessions []db.Session
+	for _, session := range m.sessions {
+		if session.ExpiresAt != nil && isActiveStatus(session.Status) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *mockHandlerDB) ListActiveSessions(ctx context.Context) ([]db.Session, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+
+	var sessions []db.Session
+	for _, session := range m.sessions {
+		if isActiveStatus(session.Status) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *mockHandlerDB) CountActiveSessionsByTier(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, session := range m.sessions {
+		if !isActiveStatus(session.Status) {
+			continue
+		}
+		tier := "free"
+		for _, key := range m.apiKeysByString {
+			if key.ID == session.APIKeyID {
+				tier = key.Tier
+			}
+		}
+		counts[tier]++
+	}
+	return counts, nil
+}
+
+func (m *mockHandlerDB) GetActiveSessionByBackendID(ctx context.Context, backendID string) (*db.Session, error) {
+	for _, session := range m.sessions {
+		if session.GetBackendID() == backendID && isActiveStatus(session.Status) {
+			return session, nil
+		}
+	}
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockHandlerDB) FilterKnownBackendIDs(ctx context.Context, backendIDs []string) ([]string, error) {
+	var known []string
+	for _, id := range backendIDs {
+		for _, session := range m.sessions {
+			if session.GetBackendID() == id {
+				known = append(known, id)
+				break
+			}
+		}
+	}
+	return known, nil
+}
+
 func (m *mockHandlerDB) DeleteSession(ctx context.Context, id string) error {
 	if m.deleteErr != nil {
 		return m.deleteErr
@@ -146,6 +283,26 @@ func (m *mockHandlerDB) GetDailySessionCount(ctx context.Context, apiKeyID uuid.
 	return count, nil
 }
 
+func (m *mockHandlerDB) GetAccountActiveSessionCount(ctx context.Context, accountID uuid.UUID) (int, error) {
+	count := 0
+	for _, session := range m.sessions {
+		if session.AccountID == accountID && (session.Status == "running" || session.Status == "pending") {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockHandlerDB) GetAccountDailySessionCount(ctx context.Context, accountID uuid.UUID) (int, error) {
+	count := 0
+	for _, session := range m.sessions {
+		if session.AccountID == accountID {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (m *mockHandlerDB) CreateQuotaRequest(ctx context.Context, req *db.QuotaRequest) (*db.QuotaRequest, error) {
 	req.ID = 1
 	req.Status = "pending"
@@ -153,6 +310,257 @@ func (m *mockHandlerDB) CreateQuotaRequest(ctx context.Context, req *db.QuotaReq
 	return req, nil
 }
 
+func (m *mockHandlerDB) CreateBuild(ctx context.Context, build *db.Build) error {
+	m.buildsMu.Lock()
+	defer m.buildsMu.Unlock()
+	b := *build
+	m.builds[build.ID] = &b
+	return nil
+}
+
+func (m *mockHandlerDB) GetBuild(ctx context.Context, id string) (*db.Build, error) {
+	m.buildsMu.Lock()
+	defer m.buildsMu.Unlock()
+	build, ok := m.builds[id]
+	if !ok {
+		return nil, fmt.Errorf("build not found")
+	}
+	b := *build
+	return &b, nil
+}
+
+func (m *mockHandlerDB) UpdateBuild(ctx context.Context, id string, update *db.BuildUpdate) error {
+	m.buildsMu.Lock()
+	defer m.buildsMu.Unlock()
+	build, ok := m.builds[id]
+	if !ok || build.Phase == BuildPhaseFailed {
+		return fmt.Errorf("build not found or already failed")
+	}
+	if update.Phase != nil {
+		build.Phase = *update.Phase
+	}
+	if update.RegistryTag != nil {
+		build.RegistryTag = update.RegistryTag
+	}
+	if update.Error != nil {
+		build.Error = update.Error
+	}
+	if update.LogTail != nil {
+		build.LogTail = update.LogTail
+	}
+	if update.StartedAt != nil {
+		build.StartedAt = update.StartedAt
+	}
+	if update.CompletedAt != nil {
+		build.CompletedAt = update.CompletedAt
+	}
+	return nil
+}
+
+func (m *mockHandlerDB) FailStaleBuilds(ctx context.Context, startedBefore, queuedBefore time.Time, excluding []string, reason string) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockHandlerDB) CreateWebhook(ctx context.Context, hook *db.Webhook) error {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	hook.CreatedAt = time.Now().UTC()
+	hook.UpdatedAt = hook.CreatedAt
+	h := *hook
+	m.webhooks[hook.ID] = &h
+	return nil
+}
+
+func (m *mockHandlerDB) GetWebhook(ctx context.Context, id uuid.UUID) (*db.Webhook, error) {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	hook, ok := m.webhooks[id]
+	if !ok {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	h := *hook
+	return &h, nil
+}
+
+func (m *mockHandlerDB) ListWebhooks(ctx context.Context, accountID uuid.UUID) ([]db.Webhook, error) {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	var hooks []db.Webhook
+	for _, hook := range m.webhooks {
+		if hook.AccountID == accountID {
+			hooks = append(hooks, *hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+	return hooks, nil
+}
+
+func (m *mockHandlerDB) ListWebhooksForEvent(ctx context.Context, accountID uuid.UUID, eventType string) ([]db.Webhook, error) {
+	hooks, _ := m.ListWebhooks(ctx, accountID)
+	var subscribed []db.Webhook
+	for _, hook := range hooks {
+		if hook.IsActive && slices.Contains(hook.Events, eventType) {
+			subscribed = append(subscribed, hook)
+		}
+	}
+	return subscribed, nil
+}
+
+func (m *mockHandlerDB) UpdateWebhook(ctx context.Context, id uuid.UUID, update *db.WebhookUpdate) error {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	hook, ok := m.webhooks[id]
+	if !ok {
+		return fmt.Errorf("webhook not found")
+	}
+	if update.URL != nil {
+		hook.URL = *update.URL
+	}
+	if update.Events != nil {
+		hook.Events = update.Events
+	}
+	if update.Description != nil {
+		hook.Description = update.Description
+	}
+	if update.IsActive != nil {
+		hook.IsActive = *update.IsActive
+	}
+	hook.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (m *mockHandlerDB) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	if _, ok := m.webhooks[id]; !ok {
+		return fmt.Errorf("webhook not found")
+	}
+	delete(m.webhooks, id)
+	return nil
+}
+
+func (m *mockHandlerDB) CreateWebhookDelivery(ctx context.Context, delivery *db.WebhookDelivery) error {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	delivery.Status = WebhookDeliveryPending
+	delivery.CreatedAt = time.Now().UTC()
+	d := *delivery
+	m.deliveries = append(m.deliveries, &d)
+	return nil
+}
+
+func (m *mockHandlerDB) ClaimWebhookDeliveries(ctx context.Context, limit int, leaseUntil time.Time) ([]db.DueWebhookDelivery, error) {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	var due []db.DueWebhookDelivery
+	for _, d := range m.deliveries {
+		hook, ok := m.webhooks[d.WebhookID]
+		if !ok || d.Status != WebhookDeliveryPending || d.NextAttemptAt.After(time.Now()) || len(due) == limit {
+			continue
+		}
+		d.NextAttemptAt = leaseUntil
+		due = append(due, db.DueWebhookDelivery{WebhookDelivery: *d, URL: hook.URL, Secret: hook.Secret})
+	}
+	return due, nil
+}
+
+func (m *mockHandlerDB) RecordWebhookDeliveryAttempt(ctx context.Context, id uuid.UUID, result *db.WebhookDeliveryResult) error {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	for _, d := range m.deliveries {
+		if d.ID == id {
+			d.Status = result.Status
+			d.Attempts = result.Attempts
+			d.ResponseStatus = result.ResponseStatus
+			d.Error = result.Error
+			d.NextAttemptAt = result.NextAttemptAt
+			d.CompletedAt = result.CompletedAt
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook delivery not found")
+}
+
+func (m *mockHandlerDB) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]db.WebhookDelivery, error) {
+	m.webhooksMu.Lock()
+	defer m.webhooksMu.Unlock()
+	var deliveries []db.WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if m.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, *m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockHandlerDB) CreateSessionEvent(ctx context.Context, event *db.SessionEvent) error {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	event.ID = int64(len(m.events) + 1)
+	event.CreatedAt = time.Now().UTC()
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *mockHandlerDB) ListSessionEvents(ctx context.Context, accountID uuid.UUID, afterID int64, limit int) ([]db.SessionEvent, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	var events []db.SessionEvent
+	for _, event := range m.events {
+		if event.AccountID == accountID && event.ID > afterID && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockHandlerDB) GetLatestSessionEventID(ctx context.Context, accountID uuid.UUID) (int64, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	var latest int64
+	for _, event := range m.events {
+		if event.AccountID == accountID {
+			latest = event.ID
+		}
+	}
+	return latest, nil
+}
+
+func (m *mockHandlerDB) PruneSessionEvents(ctx context.Context, before time.Time) (int64, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	var kept []db.SessionEvent
+	for _, event := range m.events {
+		if !event.CreatedAt.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	pruned := int64(len(m.events) - len(kept))
+	m.events = kept
+	return pruned, nil
+}
+
+func (m *mockHandlerDB) TakeRateLimitToken(ctx context.Context, key string, rate, burst float64) (bool, float64, error) {
+	if m.rateLimitErr != nil {
+		return false, 0, m.rateLimitErr
+	}
+	m.rateLimitMu.Lock()
+	defer m.rateLimitMu.Unlock()
+	tokens, ok := m.rateLimitTokens[key]
+	if !ok {
+		tokens = burst
+	}
+	if tokens < 1 {
+		return false, tokens, nil
+	}
+	m.rateLimitTokens[key] = tokens - 1
+	return true, tokens - 1, nil
+}
+
+func (m *mockHandlerDB) PruneRateLimitBuckets(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
 func (m *mockHandlerDB) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*db.APIKey, error) {
 	for _, apiKey := range m.apiKeysByString {
 		if apiKey.ID == id {
@@ -163,6 +571,15 @@ func (m *mockHandlerDB) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*db.AP
 }
 
 func (m *mockHandlerDB) CreateAPIKey(ctx context.Context, email string, name *string) (*db.APIKey, error) {
+	account := &db.Account{
+		ID:        uuid.New(),
+		Name:      name,
+		Email:     &email,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+	m.accounts[account.ID] = account
+
 	key := fmt.Sprintf("sk_test_%s", randHex(32))
 	apiKey := &db.APIKey{
 		ID:           uuid.New(),
@@ -171,11 +588,140 @@ func (m *mockHandlerDB) CreateAPIKey(ctx context.Context, email string, name *st
 		Tier:         "free",
 		RateLimitRPS: 10,
 		CreatedAt:    time.Now().UTC(),
+		IsActive:     true,
+		AccountID:    account.ID,
 	}
 	m.apiKeysByString[key] = apiKey
 	return apiKey, nil
 }
 
+func (m *mockHandlerDB) GetAccount(ctx context.Context, id uuid.UUID) (*db.Account, error) {
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("account not found")
+	}
+	return account, nil
+}
+
+func (m *mockHandlerDB) UpdateAccount(ctx context.Context, id uuid.UUID, update *db.AccountUpdate) (*db.Account, error) {
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("account not found")
+	}
+	if update.Name != nil {
+		account.Name = update.Name
+	}
+	if update.Email != nil {
+		account.Email = update.Email
+	}
+	account.UpdatedAt = time.Now().UTC()
+	return account, nil
+}
+
+func (m *mockHandlerDB) ListAccountMembers(ctx context.Context, accountID uuid.UUID) ([]db.AccountMember, error) {
+	return nil, nil
+}
+
+func (m *mockHandlerDB) GetAccountMember(ctx context.Context, id uuid.UUID) (*db.AccountMember, error) {
+	return nil, fmt.Errorf("member not found")
+}
+
+func (m *mockHandlerDB) UpdateAccountMemberRole(ctx context.Context, id uuid.UUID, role string) (*db.AccountMember, error) {
+	return nil, fmt.Errorf("member not found")
+}
+
+func (m *mockHandlerDB) RemoveAccountMember(ctx context.Context, id uuid.UUID, performedBy string) error {
+	return fmt.Errorf("member not found")
+}
+
+func (m *mockHandlerDB) CreateAccountInvitation(ctx context.Context, inv *db.AccountInvitation) error {
+	return nil
+}
+
+func (m *mockHandlerDB) ListAccountInvitations(ctx context.Context, accountID uuid.UUID) ([]db.AccountInvitation, error) {
+	return nil, nil
+}
+
+func (m *mockHandlerDB) GetAccountInvitation(ctx context.Context, id uuid.UUID) (*db.AccountInvitation, error) {
+	return nil, fmt.Errorf("invitation not found")
+}
+
+func (m *mockHandlerDB) DeleteAccountInvitation(ctx context.Context, id uuid.UUID) error {
+	return fmt.Errorf("invitation not found")
+}
+
+func (m *mockHandlerDB) AcceptAccountInvitation(ctx context.Context, tokenHash string, name *string) (*db.AccountMember, *db.APIKey, error) {
+	return nil, nil, fmt.Errorf("invitation not found")
+}
+
+func (m *mockHandlerDB) CreateAuditEntry(ctx context.Context, entry *db.AuditEntry) error {
+	m.auditEntries = append(m.auditEntries, entry)
+	return nil
+}
+
+func (m *mockHandlerDB) ListAuditEntries(ctx context.Context, accountID uuid.UUID, filter *db.AuditFilter) ([]db.AuditEntry, error) {
+	return nil, nil
+}
+
+func (m *mockHandlerDB) GetAccountSpend(ctx context.Context, accountID uuid.UUID, periodStart time.Time) (*db.AccountSpend, error) {
+	spend := &db.AccountSpend{SettledCents: m.settledCents[accountID]}
+	for _, session := range m.sessions {
+		if session.AccountID == accountID && isActiveStatus(session.Status) && !session.CreatedAt.Before(periodStart) {
+			spend.ActiveSessionStarts = append(spend.ActiveSessionStarts, session.CreatedAt)
+		}
+	}
+	return spend, nil
+}
+
+func (m *mockHandlerDB) CreateBudgetAlert(ctx context.Context, alert *db.BudgetAlert) (bool, error) {
+	m.budgetAlertsMu.Lock()
+	defer m.budgetAlertsMu.Unlock()
+	for _, existing := range m.budgetAlerts {
+		if existing.AccountID == alert.AccountID && existing.BillingPeriodStart.Equal(alert.BillingPeriodStart) {
+			return false, nil
+		}
+	}
+	alert.ID = int64(len(m.budgetAlerts) + 1)
+	alert.CreatedAt = time.Now().UTC()
+	a := *alert
+	m.budgetAlerts = append(m.budgetAlerts, &a)
+	return true, nil
+}
+
+func (m *mockHandlerDB) ClaimBudgetAlerts(ctx context.Context, limit int, leaseUntil time.Time) ([]db.BudgetAlert, error) {
+	m.budgetAlertsMu.Lock()
+	defer m.budgetAlertsMu.Unlock()
+	var due []db.BudgetAlert
+	for _, alert := range m.budgetAlerts {
+		if alert.NextDeliveryAt != nil && !alert.NextDeliveryAt.After(time.Now()) && len(due) < limit {
+			alert.NextDeliveryAt = &leaseUntil
+			due = append(due, *alert)
+		}
+	}
+	return due, nil
+}
+
+func (m *mockHandlerDB) RecordBudgetAlertDelivery(ctx context.Context, id int64, attempts int, deliveredAt, nextDeliveryAt *time.Time) error {
+	m.budgetAlertsMu.Lock()
+	defer m.budgetAlertsMu.Unlock()
+	for _, alert := range m.budgetAlerts {
+		if alert.ID == id {
+			alert.DeliveryAttempts = attempts
+			alert.DeliveredAt = deliveredAt
+			alert.NextDeliveryAt = nextDeliveryAt
+			return nil
+		}
+	}
+	return fmt.Errorf("budget alert not found")
+}
+
+// budgetAlert returns a copy of the budget alert recorded at index i.
+func (m *mockHandlerDB) budgetAlert(i int) db.BudgetAlert {
+	m.budgetAlertsMu.Lock()
+	defer m.budgetAlertsMu.Unlock()
+	return *m.budgetAlerts[i]
+}
+
 func (m *mockHandlerDB) GetAccountLimits(ctx context.Context, accountID uuid.UUID) (*db.AccountLimits, error) {
 	return nil, nil
 }
@@ -208,7 +754,7 @@ func (m *mockHandlerDB) GetAPIKeysByAccount(ctx context.Context, accountID uuid.
 	return keys, nil
 }
 
-func (m *mockHandlerDB) CreateAPIKeyForAccount(ctx context.Context, accountID uuid.UUID, name, description string, parentKeyID uuid.UUID) (*db.APIKey, error) {
+func (m *mockHandlerDB) CreateAPIKeyForAccount(ctx context.Context, accountID uuid.UUID, name, description string, parentKeyID uuid.UUID, scopes []string) (*db.APIKey, error) {
 	key := fmt.Sprintf("sk_test_%s", randHex(32))
 	apiKey := &db.APIKey{
 		ID:           uuid.New(),
@@ -221,6 +767,7 @@ func (m *mockHandlerDB) CreateAPIKeyForAccount(ctx context.Context, accountID uu
 		ParentKeyID:  &parentKeyID,
 		Name:         &name,
 		Description:  &description,
+		Scopes:       scopes,
 	}
 	m.apiKeysByString[key] = apiKey
 	return apiKey, nil
@@ -267,7 +814,7 @@ func (m *mockHandlerDB) DeactivateAPIKey(ctx context.Context, keyID uuid.UUID, p
 	return fmt.Errorf("API key not found")
 }
 
-func (m *mockHandlerDB) RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string) (*db.APIKey, error) {
+func (m *mockHandlerDB) RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string, overlap time.Duration) (*db.APIKey, error) {
 	for oldKey, apiKey := range m.apiKeysByString {
 		if apiKey.ID == keyID {
 			// Remove old key mapping
@@ -288,6 +835,26 @@ func (m *mockHandlerDB) RotateAPIKey(ctx context.Context, keyID uuid.UUID, perfo
 	return nil, fmt.Errorf("API key not found")
 }
 
+func (m *mockHandlerDB) ListAPIKeysExpiringBefore(ctx context.Context, before time.Time) ([]db.APIKey, error) {
+	return nil, nil
+}
+
+func (m *mockHandlerDB) ClaimAPIKeyExpiryNotice(ctx context.Context, keyID uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (m *mockHandlerDB) ReleaseAPIKeyExpiryNotice(ctx context.Context, keyID uuid.UUID) error {
+	return nil
+}
+
+func (m *mockHandlerDB) DeactivateExpiredAPIKeys(ctx context.Context, expiredBefore time.Time, performedBy string) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockHandlerDB) DowngradeExpiredTiers(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
 func (m *mockHandlerDB) IsPrimaryKey(ctx context.Context, keyID uuid.UUID) (bool, error) {
 	for _, apiKey := range m.apiKeysByString {
 		if apiKey.ID == keyID {
@@ -411,6 +978,107 @@ func TestSessionService_CreateSession_Success(t *testing.T) {
 	if output.Body.Status != "pending" {
 		t.Errorf("Expected status 'pending', got '%s'", output.Body.Status)
 	}
+	if len(mockDB.auditEntries) != 1 || mockDB.auditEntries[0].Action != AuditSessionCreated {
+		t.Fatalf("Expected a %s audit entry, got %v", AuditSessionCreated, mockDB.auditEntries)
+	}
+	if target := mockDB.auditEntries[0].Target; target == nil || *target != output.Body.ID {
+		t.Errorf("Expected audit target %s, got %v", output.Body.ID, target)
+	}
+}
+
+// mockImageBuilder records the spec it was asked to resolve and returns a fixed image.
+type mockImageBuilder struct {
+	image string
+	err   error
+	spec  *fly.BuildSpec
+}
+
+func (m *mockImageBuilder) Resolve(ctx context.Context, spec *fly.BuildSpec, cache fly.BuildCache) (string, error) {
+	m.spec = spec
+	if m.err != nil {
+		return "", m.err
+	}
+	return m.image, nil
+}
+
+func TestSessionService_CreateSession_WithSetup(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{}
+	builder := &mockImageBuilder{image: "ttl.sh/execbox-abc:4h"}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+	sessionSvc.SetBuilder(builder, nil)
+
+	input := &CreateSessionInput{
+		Body: CreateSessionRequest{
+			Image: "python:3.12",
+			Setup: []string{"pip install requests"},
+			Files: []FileSpec{
+				{Path: "/app/main.py", Content: "print('hi')"},
+				{Path: "/app/data.bin", Content: "AAEC", Encoding: "base64"},
+			},
+		},
+	}
+
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+	output, err := sessionSvc.CreateSession(ctx, input)
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	if builder.spec == nil {
+		t.Fatal("expected image builder to be called")
+	}
+	if got := string(builder.spec.Files[1].Content); got != "\x00\x01\x02" {
+		t.Errorf("expected base64 content to be decoded, got %q", got)
+	}
+	if mockBackend.createConfig.Image != builder.image {
+		t.Errorf("expected backend to run %s, got %s", builder.image, mockBackend.createConfig.Image)
+	}
+	if len(mockBackend.createConfig.Setup) != 0 || len(mockBackend.createConfig.Files) != 0 {
+		t.Error("expected setup and files to be baked into the image, not passed to the backend")
+	}
+
+	session := mockDB.sessions[output.Body.ID]
+	if session.SetupHash == nil || *session.SetupHash != fly.ComputeHash(builder.spec) {
+		t.Errorf("expected setup hash to be stored, got %v", session.SetupHash)
+	}
+}
+
+func TestSessionService_CreateSession_InvalidFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		file FileSpec
+	}{
+		{name: "malformed base64", file: FileSpec{Path: "/app/data.bin", Content: "not base64!", Encoding: "base64"}},
+		{name: "missing path", file: FileSpec{Path: "", Content: "x"}},
+		{name: "path escapes root", file: FileSpec{Path: "/app/../../etc/passwd", Content: "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &mockImageBuilder{image: "ttl.sh/execbox-abc:4h"}
+			sessionSvc := NewSessionService(newMockHandlerDB(), &mockBackendHandler{})
+			sessionSvc.SetBuilder(builder, nil)
+
+			input := &CreateSessionInput{
+				Body: CreateSessionRequest{
+					Image: "alpine",
+					Files: []FileSpec{tt.file},
+				},
+			}
+
+			ctx := WithAPIKeyID(context.Background(), uuid.New())
+			_, err := sessionSvc.CreateSession(ctx, input)
+
+			var statusErr huma.StatusError
+			if !errors.As(err, &statusErr) || statusErr.GetStatus() != 400 {
+				t.Fatalf("expected 400 error, got %v", err)
+			}
+			if builder.spec != nil {
+				t.Error("expected no build for invalid files")
+			}
+		})
+	}
 }
 
 func TestSessionService_GetSession_Success(t *testing.T) {
@@ -447,6 +1115,217 @@ func TestSessionService_GetSession_Success(t *testing.T) {
 	}
 }
 
+func TestSessionService_CreateSession_Labels(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+
+	output, err := sessionSvc.CreateSession(ctx, &CreateSessionInput{
+		Body: CreateSessionRequest{Image: "alpine", Labels: map[string]string{"team": "ml"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	session := mockDB.sessions[output.Body.ID]
+	if session.Labels["team"] != "ml" {
+		t.Errorf("Expected label team=ml, got %v", session.Labels)
+	}
+	if session.Backend == nil || *session.Backend != "mock" {
+		t.Errorf("Expected backend 'mock', got %v", session.Backend)
+	}
+
+	for name, labels := range map[string]map[string]string{
+		"empty key":  {"": "x"},
+		"key with =": {"a=b": "x"},
+		"long value": {"team": strings.Repeat("x", MaxLabelValueLength+1)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sessionSvc := NewSessionService(newMockHandlerDB(), &mockBackendHandler{})
+			_, err := sessionSvc.CreateSession(ctx, &CreateSessionInput{
+				Body: CreateSessionRequest{Image: "alpine", Labels: labels},
+			})
+			var statusErr huma.StatusError
+			if !errors.As(err, &statusErr) || statusErr.GetStatus() != 400 {
+				t.Fatalf("expected 400 error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionService_ListSessions_Filters(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+
+	apiKeyID := uuid.New()
+	fly, k8s := "fly", "kubernetes"
+	zero, one := 0, 1
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	for i, session := range []*db.Session{
+		{ID: "sess_a", Image: "alpine", Status: "stopped", Backend: &fly, ExitCode: &zero, Labels: map[string]string{"team": "ml", "ci": "true"}},
+		{ID: "sess_b", Image: "python:3.12", Status: "failed", Backend: &k8s, ExitCode: &one, Labels: map[string]string{"team": "web"}},
+		{ID: "sess_c", Image: "alpine", Status: "running", Backend: &fly, Labels: map[string]string{"team": "ml"}},
+	} {
+		session.APIKeyID = apiKeyID
+		session.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		mockDB.sessions[session.ID] = session
+	}
+	// Sessions of other keys are never listed
+	mockDB.sessions["sess_other"] = &db.Session{ID: "sess_other", APIKeyID: uuid.New(), Image: "alpine", CreatedAt: base}
+
+	ctx := WithAPIKeyID(context.Background(), apiKeyID)
+	tests := []struct {
+		name  string
+		input ListSessionsInput
+		want  []string
+	}{
+		{"newest first", ListSessionsInput{}, []string{"sess_c", "sess_b", "sess_a"}},
+		{"oldest first", ListSessionsInput{Order: "asc"}, []string{"sess_a", "sess_b", "sess_c"}},
+		{"status", ListSessionsInput{Status: "failed"}, []string{"sess_b"}},
+		{"image", ListSessionsInput{Image: "alpine"}, []string{"sess_c", "sess_a"}},
+		{"backend", ListSessionsInput{Backend: "kubernetes"}, []string{"sess_b"}},
+		{"exit code", ListSessionsInput{ExitCode: "0"}, []string{"sess_a"}},
+		{"labels", ListSessionsInput{Label: []string{"team=ml", "ci=true"}}, []string{"sess_a"}},
+		{"time range", ListSessionsInput{Since: base.Add(time.Minute).Format(time.RFC3339), Until: base.Add(2 * time.Minute).Format(time.RFC3339)}, []string{"sess_b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.Limit = 50
+			output, err := sessionSvc.ListSessions(ctx, &tt.input)
+			if err != nil {
+				t.Fatalf("ListSessions failed: %v", err)
+			}
+			var got []string
+			for _, session := range output.Body.Sessions {
+				got = append(got, session.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			if output.Body.NextCursor != nil {
+				t.Errorf("Expected no next cursor, got %s", *output.Body.NextCursor)
+			}
+		})
+	}
+}
+
+func TestSessionService_ListSessions_Pagination(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+
+	apiKeyID := uuid.New()
+	createdAt := time.Now().UTC()
+	for i := range 5 {
+		// Sessions created at the same time are paged by ID
+		id := fmt.Sprintf("sess_%d", i)
+		mockDB.sessions[id] = &db.Session{ID: id, APIKeyID: apiKeyID, Image: "alpine", CreatedAt: createdAt}
+	}
+	ctx := WithAPIKeyID(context.Background(), apiKeyID)
+
+	for _, order := range []string{"desc", "asc"} {
+		var got []string
+		cursor := ""
+		for pages := 1; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("Expected 3 pages in %s order", order)
+			}
+			output, err := sessionSvc.ListSessions(ctx, &ListSessionsInput{Order: order, Cursor: cursor, Limit: 2})
+			if err != nil {
+				t.Fatalf("ListSessions failed: %v", err)
+			}
+			for _, session := range output.Body.Sessions {
+				got = append(got, session.ID)
+			}
+			if output.Body.NextCursor == nil {
+				break
+			}
+			cursor = *output.Body.NextCursor
+		}
+
+		want := []string{"sess_4", "sess_3", "sess_2", "sess_1", "sess_0"}
+		if order == "asc" {
+			slices.Reverse(want)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Expected %v in %s order, got %v", want, order, got)
+		}
+	}
+}
+
+func TestSessionService_ListSessions_InvalidInput(t *testing.T) {
+	sessionSvc := NewSessionService(newMockHandlerDB(), &mockBackendHandler{})
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+
+	tests := []struct {
+		name  string
+		input ListSessionsInput
+	}{
+		{"cursor", ListSessionsInput{Cursor: "not-a-cursor"}},
+		{"exit code", ListSessionsInput{ExitCode: "zero"}},
+		{"label", ListSessionsInput{Label: []string{"team"}}},
+		{"since", ListSessionsInput{Since: "yesterday"}},
+		{"api key", ListSessionsInput{APIKeyID: "key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.Limit = 50
+			_, err := sessionSvc.ListSessions(ctx, &tt.input)
+			var statusErr huma.StatusError
+			if !errors.As(err, &statusErr) || statusErr.GetStatus() != 400 {
+				t.Fatalf("expected 400 error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionService_ListSessions_OtherKey(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := inviteMember(t, mock, owner, "dev@example.com", RoleDeveloper)
+	other, err := mock.CreateAPIKey(context.Background(), "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionSvc := NewSessionService(mock, &mockBackendHandler{})
+
+	if err := mock.CreateSession(context.Background(), &db.Session{
+		ID: "sess_dev", APIKeyID: dev.ID, Image: "alpine", CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(caller *db.APIKey, keyID uuid.UUID) (*ListSessionsOutput, error) {
+		return sessionSvc.ListSessions(memberCtx(caller), &ListSessionsInput{APIKeyID: keyID.String(), Limit: 50})
+	}
+
+	// Owners list the sessions of any key of the account
+	output, err := list(owner, dev.ID)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(output.Body.Sessions) != 1 || output.Body.Sessions[0].ID != "sess_dev" {
+		t.Errorf("Expected sess_dev, got %v", output.Body.Sessions)
+	}
+
+	// Developers cannot list other members' keys
+	_, err = list(dev, owner.ID)
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != 403 {
+		t.Errorf("expected 403 error, got %v", err)
+	}
+
+	// Keys of other accounts are not found
+	_, err = list(owner, other.ID)
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != 404 {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+}
+
 func TestAccountService_GetAccount_Success(t *testing.T) {
 	mockDB := newMockHandlerDB()
 	accountSvc := NewAccountService(mockDB)
@@ -466,6 +1345,9 @@ func TestAccountService_GetAccount_Success(t *testing.T) {
 	}
 	mockDB.apiKeysByString[testKey.Key] = testKey
 
+	// Accounts created before keys had their own account share the key's ID
+	mockDB.accounts[apiKeyID] = &db.Account{ID: apiKeyID, Email: &email, CreatedAt: createdAt}
+
 	input := &GetAccountInput{}
 	ctx := WithAPIKeyID(context.Background(), apiKeyID)
 
@@ -486,6 +1368,9 @@ func TestAccountService_GetAccount_Success(t *testing.T) {
 	if output.Body.APIKeyPreview != "sk_test...9012" {
 		t.Errorf("Expected masked key 'sk_test...9012', got '%s'", output.Body.APIKeyPreview)
 	}
+	if output.Body.ID != apiKeyID.String() {
+		t.Errorf("Expected account ID '%s', got '%s'", apiKeyID.String(), output.Body.ID)
+	}
 }
 
 func TestAccountService_GetUsage_Success(t *testing.T) {
@@ -500,6 +1385,7 @@ func TestAccountService_GetUsage_Success(t *testing.T) {
 		mockDB.sessions[sessionID] = &db.Session{
 			ID:        sessionID,
 			APIKeyID:  apiKeyID,
+			AccountID: apiKeyID,
 			Status:    "running",
 			CreatedAt: time.Now().UTC(),
 		}
@@ -582,6 +1468,34 @@ type mockBackendHandler struct {
 	stopErr    error
 	destroyErr error
 	backendID  string
+
+	// Backend IDs passed to DestroySession
+	destroyed []string
+
+	// Sessions returned by ListSessions
+	listed  []*Session
+	listErr error
+
+	// Last config passed to CreateSession
+	createConfig *CreateSessionConfig
+
+	// Exec behaviour
+	execStdout   string
+	execStderr   string
+	execExitCode int
+	execErr      error
+	execDelay    time.Duration
+	execCmd      []string
+
+	// In-memory file system for WriteFile/ReadFile
+	files map[string][]byte
+
+	// URL behaviour
+	urlErr error
+
+	// Usage behaviour
+	usage    *ResourceUsage
+	usageErr error
 }
 
 func (m *mockBackendHandler) Name() string {
@@ -589,6 +1503,7 @@ func (m *mockBackendHandler) Name() string {
 }
 
 func (m *mockBackendHandler) CreateSession(ctx context.Context, config *CreateSessionConfig) (*Session, *SessionNetwork, error) {
+	m.createConfig = config
 	if m.createErr != nil {
 		return nil, nil, m.createErr
 	}
@@ -617,9 +1532,316 @@ func (m *mockBackendHandler) StopSession(ctx context.Context, backendID string)
 }
 
 func (m *mockBackendHandler) DestroySession(ctx context.Context, backendID string) error {
-	return m.destroyErr
+	if m.destroyErr != nil {
+		return m.destroyErr
+	}
+	m.destroyed = append(m.destroyed, backendID)
+	return nil
+}
+
+func (m *mockBackendHandler) ListSessions(ctx context.Context) ([]*Session, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	return m.listed, nil
 }
 
 func (m *mockBackendHandler) Attach(ctx context.Context, sessionID string) (stdin io.WriteCloser, stdout io.Reader, stderr io.Reader, wait func() int, err error) {
 	return nil, nil, nil, nil, fmt.Errorf("attach not implemented in mock backend")
 }
+
+func (m *mockBackendHandler) Exec(ctx context.Context, sessionID string, cmd []string) (stdout, stderr string, exitCode int, err error) {
+	m.execCmd = cmd
+	if m.execDelay > 0 {
+		select {
+		case <-time.After(m.execDelay):
+		case <-ctx.Done():
+			return "", "", -1, ctx.Err()
+		}
+	}
+	if m.execErr != nil {
+		return "", "", -1, m.execErr
+	}
+	return m.execStdout, m.execStderr, m.execExitCode, nil
+}
+
+func (m *mockBackendHandler) WriteFile(ctx context.Context, sessionID, path string, content []byte) error {
+	if m.files == nil {
+		m.files = make(map[string][]byte)
+	}
+	m.files[path] = content
+	return nil
+}
+
+func (m *mockBackendHandler) ReadFile(ctx context.Context, sessionID, path string, maxSize int64) ([]byte, error) {
+	content, ok := m.files[path]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	if int64(len(content)) > maxSize {
+		return nil, ErrFileTooLarge
+	}
+	return content, nil
+}
+
+func (m *mockBackendHandler) Usage(ctx context.Context, sessionID string) (*ResourceUsage, error) {
+	if m.usageErr != nil {
+		return nil, m.usageErr
+	}
+	if m.usage == nil {
+		return nil, fmt.Errorf("no usage for session %s", sessionID)
+	}
+	return m.usage, nil
+}
+
+func (m *mockBackendHandler) URL(ctx context.Context, sessionID string, port int) (string, error) {
+	if m.urlErr != nil {
+		return "", m.urlErr
+	}
+	return fmt.Sprintf("http://localhost:%d", 30000+port), nil
+}
+
+func TestSessionService_ExecSession_Success(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{
+		execStdout:   "file.txt\n",
+		execStderr:   "warning\n",
+		execExitCode: 3,
+	}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+
+	apiKeyID := uuid.New()
+	backendID := "backend_123"
+	mockDB.sessions["sess_exec"] = &db.Session{
+		ID:        "sess_exec",
+		APIKeyID:  apiKeyID,
+		BackendID: &backendID,
+		Status:    "running",
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ctx := WithAPIKeyID(context.Background(), apiKeyID)
+	output, err := sessionSvc.ExecSession(ctx, &ExecSessionInput{
+		ID:   "sess_exec",
+		Body: ExecRequest{Command: []string{"ls", "-la"}},
+	})
+	if err != nil {
+		t.Fatalf("ExecSession failed: %v", err)
+	}
+
+	if output.Body.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", output.Body.ExitCode)
+	}
+	if output.Body.Stdout != "file.txt\n" {
+		t.Errorf("Expected stdout 'file.txt\\n', got %q", output.Body.Stdout)
+	}
+	if output.Body.Stderr != "warning\n" {
+		t.Errorf("Expected stderr 'warning\\n', got %q", output.Body.Stderr)
+	}
+	if len(mockBackend.execCmd) != 2 || mockBackend.execCmd[0] != "ls" {
+		t.Errorf("Expected command [ls -la], got %v", mockBackend.execCmd)
+	}
+	if len(mockDB.auditEntries) != 1 || mockDB.auditEntries[0].Action != AuditSessionExec {
+		t.Fatalf("Expected a %s audit entry, got %v", AuditSessionExec, mockDB.auditEntries)
+	}
+	if details := string(mockDB.auditEntries[0].Details); details != `{"command":["ls","-la"]}` {
+		t.Errorf("Expected the command in the audit details, got %s", details)
+	}
+}
+
+func TestSessionService_ExecSession_NotOwner(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+
+	backendID := "backend_123"
+	mockDB.sessions["sess_exec"] = &db.Session{
+		ID:        "sess_exec",
+		APIKeyID:  uuid.New(),
+		BackendID: &backendID,
+		Status:    "running",
+	}
+
+	ctx := WithAPIKeyID(context.Background(), uuid.New())
+	_, err := sessionSvc.ExecSession(ctx, &ExecSessionInput{
+		ID:   "sess_exec",
+		Body: ExecRequest{Command: []string{"ls"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error for session owned by another key")
+	}
+}
+
+func TestSessionService_ExecSession_NotRunning(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+
+	apiKeyID := uuid.New()
+	backendID := "backend_123"
+	mockDB.sessions["sess_exec"] = &db.Session{
+		ID:        "sess_exec",
+		APIKeyID:  apiKeyID,
+		BackendID: &backendID,
+		Status:    "stopped",
+	}
+
+	ctx := WithAPIKeyID(context.Background(), apiKeyID)
+	_, err := sessionSvc.ExecSession(ctx, &ExecSessionInput{
+		ID:   "sess_exec",
+		Body: ExecRequest{Command: []string{"ls"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error for stopped session")
+	}
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != 409 {
+		t.Errorf("Expected 409 Conflict, got %v", err)
+	}
+}
+
+func TestSessionService_ExecSession_Timeout(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{execDelay: time.Second}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+
+	apiKeyID := uuid.New()
+	backendID := "backend_123"
+	mockDB.sessions["sess_exec"] = &db.Session{
+		ID:        "sess_exec",
+		APIKeyID:  apiKeyID,
+		BackendID: &backendID,
+		Status:    "running",
+	}
+
+	ctx := WithAPIKeyID(context.Background(), apiKeyID)
+	_, err := sessionSvc.ExecSession(ctx, &ExecSessionInput{
+		ID:   "sess_exec",
+		Body: ExecRequest{Command: []string{"sleep", "10"}, TimeoutMs: 100},
+	})
+	if err == nil {
+		t.Fatal("Expected timeout error")
+	}
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != 504 {
+		t.Errorf("Expected 504 Gateway Timeout, got %v", err)
+	}
+}
+
+func TestSessionService_ExecSession_OutlastsWriteTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a command longer than the server's write timeout")
+	}
+	// As configured for the HTTP server in cmd/server
+	const writeTimeout = 15 * time.Second
+
+	mockDB := newMockHandlerDB()
+	mockBackend := &mockBackendHandler{execStdout: "done\n", execDelay: writeTimeout + time.Second}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+
+	apiKeyID := uuid.New()
+	backendID := "backend_123"
+	mockDB.sessions["sess_slow"] = &db.Session{
+		ID:        "sess_slow",
+		APIKeyID:  apiKeyID,
+		BackendID: &backendID,
+		Status:    "running",
+		CreatedAt: time.Now().UTC(),
+	}
+
+	router := chi.NewMux()
+	humaAPI := humachi.New(router, huma.DefaultConfig("test", "1.0.0"))
+	authenticated := func(ctx huma.Context, next func(huma.Context)) {
+		next(huma.WithContext(ctx, WithAPIKeyID(ctx.Context(), apiKeyID)))
+	}
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "execSession",
+		Method:      http.MethodPost,
+		Path:        "/v1/sessions/{id}/exec",
+		Middlewares: huma.Middlewares{authenticated, writeDeadlineMiddleware},
+	}, sessionSvc.ExecSession)
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = writeTimeout
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/v1/sessions/sess_slow/exec", "application/json",
+		strings.NewReader(`{"command": ["sleep", "16"], "timeoutMs": 30000}`))
+	if err != nil {
+		t.Fatalf("exec request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var body ExecResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode exec response: %v", err)
+	}
+	if body.Stdout != "done\n" {
+		t.Errorf("Expected stdout 'done\\n', got %q", body.Stdout)
+	}
+}
+
+func TestSessionService_GetSessionURL(t *testing.T) {
+	apiKeyID := uuid.New()
+	backendID := "backend_123"
+	exposed := "exposed"
+	outgoing := "outgoing"
+
+	tests := []struct {
+		name       string
+		network    *string
+		status     string
+		port       int
+		urlErr     error
+		wantStatus int
+	}{
+		{name: "declared port", network: &exposed, status: "running", port: 8080},
+		{name: "backend without session URLs", network: &exposed, status: "running", port: 8080, urlErr: ErrNoSessionURL, wantStatus: 501},
+		{name: "undeclared port", network: &exposed, status: "running", port: 9090, wantStatus: 409},
+		{name: "not exposed", network: &outgoing, status: "running", port: 8080, wantStatus: 409},
+		{name: "legacy session without network", network: nil, status: "running", port: 8080, wantStatus: 409},
+		{name: "stopped session", network: &exposed, status: "stopped", port: 8080, wantStatus: 409},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := newMockHandlerDB()
+			sessionSvc := NewSessionService(mockDB, &mockBackendHandler{urlErr: tt.urlErr})
+
+			mockDB.sessions["sess_url"] = &db.Session{
+				ID:        "sess_url",
+				APIKeyID:  apiKeyID,
+				BackendID: &backendID,
+				Status:    tt.status,
+				Network:   tt.network,
+				Ports:     []db.Port{{Container: 8080, Protocol: "tcp"}},
+			}
+
+			ctx := WithAPIKeyID(context.Background(), apiKeyID)
+			output, err := sessionSvc.GetSessionURL(ctx, &GetURLInput{ID: "sess_url", Port: tt.port})
+
+			if tt.wantStatus != 0 {
+				var statusErr huma.StatusError
+				if !errors.As(err, &statusErr) || statusErr.GetStatus() != tt.wantStatus {
+					t.Fatalf("Expected status %d, got %v", tt.wantStatus, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("GetSessionURL failed: %v", err)
+			}
+			if output.Body.URL != "http://localhost:38080" {
+				t.Errorf("Expected URL 'http://localhost:38080', got %q", output.Body.URL)
+			}
+			if output.Body.HostPort != 38080 {
+				t.Errorf("Expected host port 38080, got %d", output.Body.HostPort)
+			}
+			if output.Body.ContainerPort != 8080 || output.Body.Protocol != "tcp" {
+				t.Errorf("Unexpected response: %+v", output.Body)
+			}
+		})
+	}
+}
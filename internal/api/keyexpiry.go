@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+)
+
+const (
+	// keyExpiryInterval is how often API key and tier expirations are checked.
+	keyExpiryInterval = time.Hour
+
+	// keyExpiryNotice is how long before an API key expires its account's
+	// owners are notified.
+	keyExpiryNotice = 7 * 24 * time.Hour
+
+	// keyExpirySweepAge is how long after expiring an API key is deactivated.
+	// Until then, requests with it are told it expired rather than that it was
+	// deactivated, and extending its expiration brings it back.
+	keyExpirySweepAge = 30 * 24 * time.Hour
+
+	// keyExpiryActor is recorded in last_updated_by of keys the sweep deactivates.
+	keyExpiryActor = "system:key-expiry"
+)
+
+// KeyExpiryNotifier tells the owners of an account that one of its API keys
+// is about to expire.
+type KeyExpiryNotifier interface {
+	NotifyKeyExpiring(ctx context.Context, key *db.APIKey, owners []string) error
+}
+
+// KeyExpiryResult describes what a single expiry pass did.
+type KeyExpiryResult struct {
+	Notified    int   // Keys whose owners were notified of their upcoming expiration
+	Deactivated int64 // Keys deactivated keyExpirySweepAge after expiring
+	Downgraded  int64 // Keys moved back to the free tier after their tier expired
+}
+
+// KeyExpiryMonitor periodically notifies owners of API keys that are about to
+// expire, deactivates keys that expired long ago, and moves keys whose tier
+// expired back to the free tier. Expired keys and tiers take effect at once
+// regardless; the monitor only makes it show in the database.
+type KeyExpiryMonitor struct {
+	db       DBClient
+	webhooks *WebhookDispatcher
+	notifier KeyExpiryNotifier
+}
+
+// NewKeyExpiryMonitor creates a new KeyExpiryMonitor.
+func NewKeyExpiryMonitor(db DBClient) *KeyExpiryMonitor {
+	return &KeyExpiryMonitor{db: db}
+}
+
+// SetWebhooks sets the dispatcher that publishes api_key.expiring events.
+func (m *KeyExpiryMonitor) SetWebhooks(webhooks *WebhookDispatcher) {
+	m.webhooks = webhooks
+}
+
+// SetNotifier sets the notifier that tells owners about expiring keys.
+func (m *KeyExpiryMonitor) SetNotifier(notifier KeyExpiryNotifier) {
+	m.notifier = notifier
+}
+
+// Run checks now and then every keyExpiryInterval. It blocks until ctx is done.
+func (m *KeyExpiryMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		result, err := m.Check(ctx)
+		if err != nil {
+			slog.Warn("failed to check API key expiry", "error", err)
+		}
+		if result.Notified > 0 || result.Deactivated > 0 || result.Downgraded > 0 {
+			slog.Info("checked API key expiry",
+				"notified", result.Notified,
+				"deactivated", result.Deactivated,
+				"downgraded", result.Downgraded,
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs a single pass. Each key is notified once per expiration, by
+// whichever replica claims it first; a key whose notice fails is tried again
+// on the next pass.
+func (m *KeyExpiryMonitor) Check(ctx context.Context) (KeyExpiryResult, error) {
+	var result KeyExpiryResult
+	now := time.Now()
+
+	keys, err := m.db.ListAPIKeysExpiringBefore(ctx, now.Add(keyExpiryNotice))
+	if err != nil {
+		return result, fmt.Errorf("failed to list expiring API keys: %w", err)
+	}
+	for i := range keys {
+		notified, err := m.notify(ctx, &keys[i])
+		if err != nil {
+			slog.Warn("failed to notify API key expiry", "error", err, "api_key_id", keys[i].ID)
+			continue
+		}
+		if notified {
+			result.Notified++
+		}
+	}
+
+	result.Deactivated, err = m.db.DeactivateExpiredAPIKeys(ctx, now.Add(-keyExpirySweepAge), keyExpiryActor)
+	if err != nil {
+		return result, err
+	}
+
+	result.Downgraded, err = m.db.DowngradeExpiredTiers(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// notify claims the key's notice, then tells the owners of the key's account
+// and its webhooks that the key is about to expire. Returns false if another
+// replica claimed the notice first. A failed notice releases the claim.
+func (m *KeyExpiryMonitor) notify(ctx context.Context, key *db.APIKey) (bool, error) {
+	claimed, err := m.db.ClaimAPIKeyExpiryNotice(ctx, key.ID)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	if err := m.notifyOwners(ctx, key); err != nil {
+		if releaseErr := m.db.ReleaseAPIKeyExpiryNotice(ctx, key.ID); releaseErr != nil {
+			slog.Warn("failed to release API key expiry notice", "error", releaseErr, "api_key_id", key.ID)
+		}
+		return false, err
+	}
+
+	m.webhooks.Publish(ctx, key.AccountID, EventAPIKeyExpiring, apiKeyToResponse(key))
+	return true, nil
+}
+
+// notifyOwners tells the owners of the key's account that the key is about to expire.
+func (m *KeyExpiryMonitor) notifyOwners(ctx context.Context, key *db.APIKey) error {
+	if m.notifier == nil {
+		return nil
+	}
+	members, err := m.db.ListAccountMembers(ctx, key.AccountID)
+	if err != nil {
+		return fmt.Errorf("failed to list members: %w", err)
+	}
+	var owners []string
+	for _, member := range members {
+		if member.Role == RoleOwner {
+			owners = append(owners, member.Email)
+		}
+	}
+	return m.notifier.NotifyKeyExpiring(ctx, key, owners)
+}
+
+// EmailKeyExpiryNotifier mails expiry notices to the owners of an account over SMTP.
+// Accounts without owners are skipped.
+type EmailKeyExpiryNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+
+	// sendMail is smtp.SendMail, replaced in tests
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmailKeyExpiryNotifier creates a notifier sending through the SMTP server
+// at addr (host:port). Username and password may be empty for servers without auth.
+func NewEmailKeyExpiryNotifier(addr, username, password, from string) *EmailKeyExpiryNotifier {
+	return &EmailKeyExpiryNotifier{
+		addr:     addr,
+		from:     from,
+		auth:     smtpAuth(addr, username, password),
+		sendMail: smtp.SendMail,
+	}
+}
+
+// NotifyKeyExpiring sends the expiry notice email.
+func (n *EmailKeyExpiryNotifier) NotifyKeyExpiring(ctx context.Context, key *db.APIKey, owners []string) error {
+	if len(owners) == 0 || key.ExpiresAt == nil {
+		return nil
+	}
+
+	name := key.KeyPrefix + "..."
+	if key.Name != nil && *key.Name != "" {
+		name = fmt.Sprintf("%s (%s...)", *key.Name, key.KeyPrefix)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: execbox: API key %s expires %s\r\n\r\n"+
+		"The API key %s of your account expires at %s.\r\n"+
+		"Requests with it are refused from then on. Extend its expiration or rotate it before then.\r\n",
+		n.from, strings.Join(owners, ", "), name, key.ExpiresAt.UTC().Format(time.DateOnly),
+		name, key.ExpiresAt.UTC().Format(time.RFC3339))
+
+	if err := n.sendMail(n.addr, n.auth, n.from, owners, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send key expiry email: %w", err)
+	}
+	return nil
+}
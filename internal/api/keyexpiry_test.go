@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+)
+
+// recordingKeyExpiryNotifier records the keys it is told about and fails while err is set.
+type recordingKeyExpiryNotifier struct {
+	err    error
+	keys   []*db.APIKey
+	owners [][]string
+}
+
+func (n *recordingKeyExpiryNotifier) NotifyKeyExpiring(ctx context.Context, key *db.APIKey, owners []string) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.keys = append(n.keys, key)
+	n.owners = append(n.owners, owners)
+	return nil
+}
+
+// setKeyExpiry sets when a mock key expires.
+func setKeyExpiry(t *testing.T, mock *mockDB, key *db.APIKey, expiresAt time.Time) {
+	t.Helper()
+	if err := mock.UpdateAPIKey(context.Background(), key.ID, &db.APIKeyUpdate{ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("failed to set expiration: %v", err)
+	}
+}
+
+func TestKeyExpiryMonitor_NotifiesOnce(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	later, err := mock.CreateAPIKey(context.Background(), "later@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	setKeyExpiry(t, mock, owner, time.Now().Add(time.Hour))
+	setKeyExpiry(t, mock, later, time.Now().Add(keyExpiryNotice+time.Hour))
+
+	notifier := &recordingKeyExpiryNotifier{err: errors.New("smtp down")}
+	monitor := NewKeyExpiryMonitor(mock)
+	monitor.SetNotifier(notifier)
+
+	// A failed notice is tried again on the next pass
+	result, err := monitor.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if result.Notified != 0 {
+		t.Errorf("expected no notices while the notifier fails, got %d", result.Notified)
+	}
+
+	notifier.err = nil
+	result, err = monitor.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if result.Notified != 1 || len(notifier.keys) != 1 || notifier.keys[0].ID != owner.ID {
+		t.Fatalf("expected a notice for the key expiring within the notice period, got %d", result.Notified)
+	}
+	if len(notifier.owners[0]) != 1 || notifier.owners[0][0] != "owner@example.com" {
+		t.Errorf("expected the notice to go to the account owner, got %v", notifier.owners[0])
+	}
+
+	// Each expiration is notified once
+	if result, _ = monitor.Check(context.Background()); result.Notified != 0 {
+		t.Errorf("expected no second notice, got %d", result.Notified)
+	}
+
+	// A new expiration is notified again
+	setKeyExpiry(t, mock, owner, time.Now().Add(2*time.Hour))
+	if result, _ = monitor.Check(context.Background()); result.Notified != 1 {
+		t.Errorf("expected a notice for the new expiration, got %d", result.Notified)
+	}
+}
+
+func TestKeyExpiryMonitor_NotifiesOnceAcrossReplicas(t *testing.T) {
+	mock := newMockDB()
+	key, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	setKeyExpiry(t, mock, key, time.Now().Add(time.Hour))
+
+	// Both replicas list the key before either has claimed it
+	keys, err := mock.ListAPIKeysExpiringBefore(context.Background(), time.Now().Add(keyExpiryNotice))
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 expiring key, got %d (%v)", len(keys), err)
+	}
+
+	notifier := &recordingKeyExpiryNotifier{}
+	var notified int
+	for range 2 {
+		monitor := NewKeyExpiryMonitor(mock)
+		monitor.SetNotifier(notifier)
+		ok, err := monitor.notify(context.Background(), &keys[0])
+		if err != nil {
+			t.Fatalf("notify failed: %v", err)
+		}
+		if ok {
+			notified++
+		}
+	}
+	if notified != 1 || len(notifier.keys) != 1 {
+		t.Errorf("expected the owners notified once, got %d notices", len(notifier.keys))
+	}
+}
+
+func TestKeyExpiryMonitor_SweepsExpiredKeysAndTiers(t *testing.T) {
+	mock := newMockDB()
+	recent, err := mock.CreateAPIKey(context.Background(), "recent@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	old, err := mock.CreateAPIKey(context.Background(), "old@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	setKeyExpiry(t, mock, recent, time.Now().Add(-time.Hour))
+	setKeyExpiry(t, mock, old, time.Now().Add(-keyExpirySweepAge-time.Hour))
+
+	// The tier reads as free as soon as it expires
+	tierExpiresAt := time.Now().Add(-time.Minute)
+	mock.apiKeys[recent.Key].Tier = TierPro
+	mock.apiKeys[recent.Key].RateLimitRPS = 100
+	mock.apiKeys[recent.Key].TierExpiresAt = &tierExpiresAt
+	if key, _ := mock.GetAPIKeyByID(context.Background(), recent.ID); key.Tier != TierFree || key.RateLimitRPS != 10 {
+		t.Errorf("expected an expired tier to read as free at 10 rps, got %s at %d", key.Tier, key.RateLimitRPS)
+	}
+
+	result, err := NewKeyExpiryMonitor(mock).Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if result.Deactivated != 1 || result.Downgraded != 1 {
+		t.Errorf("expected 1 key deactivated and 1 downgraded, got %+v", result)
+	}
+
+	swept, _ := mock.GetAPIKeyByID(context.Background(), old.ID)
+	if swept.IsActive || swept.LastUpdatedBy == nil || *swept.LastUpdatedBy != keyExpiryActor {
+		t.Errorf("expected the long-expired key deactivated by %s, got active=%v", keyExpiryActor, swept.IsActive)
+	}
+	kept, _ := mock.GetAPIKeyByID(context.Background(), recent.ID)
+	if !kept.IsActive {
+		t.Error("expected the recently expired key to stay active")
+	}
+	if stored := mock.apiKeys[recent.Key]; stored.Tier != TierFree || stored.RateLimitRPS != 10 || stored.TierExpiresAt != nil {
+		t.Errorf("expected the tier stored as free at 10 rps, got %s at %d expiring %v", stored.Tier, stored.RateLimitRPS, stored.TierExpiresAt)
+	}
+}
+
+func TestEmailKeyExpiryNotifier(t *testing.T) {
+	var sentTo []string
+	var sentMsg string
+	notifier := NewEmailKeyExpiryNotifier("smtp.example.com:587", "user", "secret", "billing@execbox.dev")
+	notifier.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sentTo, sentMsg = to, string(msg)
+		return nil
+	}
+
+	name := "ci"
+	expiresAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := &db.APIKey{KeyPrefix: "sk_0123456789", Name: &name, ExpiresAt: &expiresAt}
+	owners := []string{"a@example.com", "b@example.com"}
+	if err := notifier.NotifyKeyExpiring(context.Background(), key, owners); err != nil {
+		t.Fatalf("NotifyKeyExpiring failed: %v", err)
+	}
+	if len(sentTo) != 2 {
+		t.Errorf("expected mail to both owners, got %v", sentTo)
+	}
+	if !strings.Contains(sentMsg, "Subject: execbox: API key ci (sk_0123456789...) expires 2025-03-01") {
+		t.Errorf("expected the key and date in the subject, got %q", sentMsg)
+	}
+
+	// Accounts without owners get no mail
+	sentTo = nil
+	if err := notifier.NotifyKeyExpiring(context.Background(), key, nil); err != nil {
+		t.Fatalf("NotifyKeyExpiring failed: %v", err)
+	}
+	if sentTo != nil {
+		t.Errorf("expected no mail, got one to %v", sentTo)
+	}
+}
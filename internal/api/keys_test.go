@@ -774,6 +774,102 @@ func TestGetAPIKey_WrongAccount_Variation(t *testing.T) {
 }
 
 // Helper functions for pointer creation
+func TestAccountService_APIKeys_MemberRoles(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	admin := inviteMember(t, mock, owner, "admin@example.com", RoleAdmin)
+	dev := inviteMember(t, mock, owner, "dev@example.com", RoleDeveloper)
+	service := NewAccountService(mock)
+
+	// Developers only see and manage their own keys
+	listed, err := service.ListAPIKeys(memberCtx(dev), &ListAPIKeysInput{})
+	require.NoError(t, err)
+	require.Len(t, listed.Body.Keys, 1)
+	assert.Equal(t, dev.ID.String(), listed.Body.Keys[0].ID)
+
+	_, err = service.GetAPIKey(memberCtx(dev), &GetAPIKeyInput{ID: admin.ID.String()})
+	requireStatus(t, err, 404)
+	_, err = service.RotateAPIKey(memberCtx(dev), &RotateAPIKeyInput{ID: owner.ID.String()})
+	requireStatus(t, err, 404)
+
+	_, err = service.RotateAPIKey(memberCtx(dev), &RotateAPIKeyInput{ID: dev.ID.String()})
+	require.NoError(t, err)
+
+	// Admins see every key but only owners change the primary key
+	listed, err = service.ListAPIKeys(memberCtx(admin), &ListAPIKeysInput{})
+	require.NoError(t, err)
+	assert.Len(t, listed.Body.Keys, 3)
+
+	_, err = service.RotateAPIKey(memberCtx(admin), &RotateAPIKeyInput{ID: owner.ID.String()})
+	requireStatus(t, err, 403)
+	_, err = service.RotateAPIKey(memberCtx(owner), &RotateAPIKeyInput{ID: owner.ID.String()})
+	require.NoError(t, err)
+
+	// Keys created by a member belong to them
+	created, err := service.CreateAPIKey(memberCtx(dev), &CreateAPIKeyInput{Body: CreateAPIKeyRequest{Name: "CI"}})
+	require.NoError(t, err)
+	require.NotNil(t, created.Body.MemberID)
+	assert.Equal(t, dev.MemberID.String(), *created.Body.MemberID)
+
+	actions := auditActions(mock)
+	assert.Contains(t, actions, AuditAPIKeyRotated)
+	assert.Equal(t, AuditAPIKeyCreated, actions[len(actions)-1])
+}
+
+func TestAccountService_CreateAPIKey_Scopes(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	service := NewAccountService(mock)
+
+	create := func(caller *db.APIKey, scopes []string) (*CreateAPIKeyOutput, error) {
+		ctx := memberCtx(caller)
+		if caller.Scopes != nil {
+			ctx = WithScopes(ctx, caller.Scopes)
+		}
+		return service.CreateAPIKey(ctx, &CreateAPIKeyInput{Body: CreateAPIKeyRequest{Name: "key", Scopes: scopes}})
+	}
+
+	_, err = create(owner, []string{"sessions:delete"})
+	requireStatus(t, err, 400)
+	_, err = create(owner, []string{})
+	requireStatus(t, err, 400)
+
+	// Keys without scopes are unrestricted
+	output, err := create(owner, nil)
+	require.NoError(t, err)
+	assert.Nil(t, output.Body.Scopes)
+
+	output, err = create(owner, []string{ScopeSessionsCreate, ScopeSessionsRead, ScopeKeysManage})
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeSessionsCreate, ScopeSessionsRead, ScopeKeysManage}, output.Body.Scopes)
+	ci, err := mock.GetAPIKeyByKey(context.Background(), output.Body.Key)
+	require.NoError(t, err)
+
+	// A scoped key cannot hand out more than it has, and passes its scopes on by default
+	_, err = create(ci, []string{ScopeSessionsRead, ScopeUsageRead})
+	requireStatus(t, err, 403)
+
+	output, err = create(ci, nil)
+	require.NoError(t, err)
+	assert.Equal(t, ci.Scopes, output.Body.Scopes)
+
+	output, err = create(ci, []string{ScopeSessionsRead})
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeSessionsRead}, output.Body.Scopes)
+
+	// A scoped key cannot see or rotate keys with more access
+	ctx := WithScopes(memberCtx(ci), ci.Scopes)
+	listed, err := service.ListAPIKeys(ctx, &ListAPIKeysInput{})
+	require.NoError(t, err)
+	for _, k := range listed.Body.Keys {
+		assert.NotNil(t, k.Scopes, "unrestricted key %s listed to a scoped key", k.ID)
+	}
+	_, err = service.RotateAPIKey(ctx, &RotateAPIKeyInput{ID: owner.ID.String()})
+	requireStatus(t, err, 404)
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
@@ -781,3 +877,61 @@ func stringPtr(s string) *string {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestAccountService_RotateAPIKey_Overlap(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	oldKey := owner.Key
+	service := NewAccountService(mock)
+	ctx := memberCtx(owner)
+
+	for _, overlap := range []int{-1, int(MaxRotationOverlap.Seconds()) + 1} {
+		_, err := service.RotateAPIKey(ctx, &RotateAPIKeyInput{ID: owner.ID.String(), OverlapSeconds: overlap})
+		requireStatus(t, err, 400)
+	}
+
+	output, err := service.RotateAPIKey(ctx, &RotateAPIKeyInput{ID: owner.ID.String(), OverlapSeconds: 3600})
+	require.NoError(t, err)
+	require.NotNil(t, output.Body.RotatingKeyExpiresAt)
+	expiresAt, err := time.Parse(time.RFC3339, *output.Body.RotatingKeyExpiresAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+	// Both values authenticate during the overlap
+	old, err := mock.GetAPIKeyByKey(context.Background(), oldKey)
+	require.NoError(t, err)
+	assert.True(t, old.UsedRotatingKey)
+	current, err := mock.GetAPIKeyByKey(context.Background(), output.Body.Key)
+	require.NoError(t, err)
+	assert.False(t, current.UsedRotatingKey)
+
+	// The pending expiration shows in the key listing
+	listed, err := service.ListAPIKeys(ctx, &ListAPIKeysInput{})
+	require.NoError(t, err)
+	require.Len(t, listed.Body.Keys, 1)
+	assert.Equal(t, output.Body.RotatingKeyExpiresAt, listed.Body.Keys[0].RotatingKeyExpiresAt)
+
+	// Rotating without an overlap invalidates the previous value at once
+	output, err = service.RotateAPIKey(ctx, &RotateAPIKeyInput{ID: owner.ID.String()})
+	require.NoError(t, err)
+	assert.Nil(t, output.Body.RotatingKeyExpiresAt)
+	_, err = mock.GetAPIKeyByKey(context.Background(), oldKey)
+	assert.Error(t, err)
+}
+
+func TestKeyPreview(t *testing.T) {
+	// Keys read from the database only carry their prefix
+	assert.Equal(t, "sk_3f9a1c2b4...", keyPreview(&db.APIKey{KeyPrefix: "sk_3f9a1c2b4"}))
+	assert.Equal(t, "sk_test...9012", keyPreview(&db.APIKey{Key: "sk_test_123456789012"}))
+}
+
+func TestCheckAPIKeyPepper(t *testing.T) {
+	for _, environment := range []string{"development", "test"} {
+		assert.NoError(t, checkAPIKeyPepper(&Config{Environment: environment}), environment)
+	}
+	for _, environment := range []string{"production", "staging", ""} {
+		assert.Error(t, checkAPIKeyPepper(&Config{Environment: environment}), environment)
+		assert.NoError(t, checkAPIKeyPepper(&Config{Environment: environment, APIKeyPepper: "secret"}), environment)
+	}
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// MemberService handles the members of the authenticated account and
+// invitations to join it.
+type MemberService struct {
+	db DBClient
+}
+
+// NewMemberService creates a new MemberService.
+func NewMemberService(db DBClient) *MemberService {
+	return &MemberService{db: db}
+}
+
+// ListMembers handles GET /v1/account/members
+// Returns all members of the authenticated account.
+func (s *MemberService) ListMembers(ctx context.Context, input *ListMembersInput) (*ListMembersOutput, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	members, err := s.db.ListAccountMembers(ctx, accountID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to list members", err)
+	}
+
+	responses := make([]MemberResponse, 0, len(members))
+	for i := range members {
+		responses = append(responses, memberToResponse(&members[i]))
+	}
+
+	return &ListMembersOutput{Body: ListMembersResponse{Members: responses}}, nil
+}
+
+// UpdateMember handles PUT /v1/account/members/{id}
+// Changes a member's role. Only owners grant or take away the owner role, and
+// the account always keeps at least one owner.
+func (s *MemberService) UpdateMember(ctx context.Context, input *UpdateMemberInput) (*UpdateMemberOutput, error) {
+	role := input.Body.Role
+	if !isValidRole(role) {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("unknown role %q", role))
+	}
+
+	member, err := s.getAuthorizedMember(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if (member.Role == RoleOwner || role == RoleOwner) && callerRole(ctx) != RoleOwner {
+		return nil, huma.Error403Forbidden("only owners can grant or change the owner role")
+	}
+	if member.Role == RoleOwner && role != RoleOwner {
+		if err := s.requireAnotherOwner(ctx, member); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := s.db.UpdateAccountMemberRole(ctx, member.ID, role)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to update member", err)
+	}
+
+	recordAudit(ctx, s.db, AuditMemberRoleChanged, member.ID.String(), map[string]string{
+		"email":    member.Email,
+		"old_role": member.Role,
+		"new_role": role,
+	})
+
+	return &UpdateMemberOutput{Body: memberToResponse(updated)}, nil
+}
+
+// RemoveMember handles DELETE /v1/account/members/{id}
+// Removes a member from the account and deactivates their API keys. Only
+// owners remove owners, and the last owner cannot be removed.
+func (s *MemberService) RemoveMember(ctx context.Context, input *RemoveMemberInput) (*RemoveMemberOutput, error) {
+	member, err := s.getAuthorizedMember(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if member.Role == RoleOwner {
+		if callerRole(ctx) != RoleOwner {
+			return nil, huma.Error403Forbidden("only owners can remove an owner")
+		}
+		if err := s.requireAnotherOwner(ctx, member); err != nil {
+			return nil, err
+		}
+	}
+
+	apiKeyID, _ := GetAPIKeyID(ctx)
+	if err := s.db.RemoveAccountMember(ctx, member.ID, apiKeyID.String()); err != nil {
+		return nil, huma.Error500InternalServerError("failed to remove member", err)
+	}
+
+	recordAudit(ctx, s.db, AuditMemberRemoved, member.ID.String(), map[string]string{
+		"email": member.Email,
+		"role":  member.Role,
+	})
+
+	return &RemoveMemberOutput{}, nil
+}
+
+// ListInvitations handles GET /v1/account/invitations
+// Returns the pending invitations of the authenticated account.
+func (s *MemberService) ListInvitations(ctx context.Context, input *ListInvitationsInput) (*ListInvitationsOutput, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	invitations, err := s.db.ListAccountInvitations(ctx, accountID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to list invitations", err)
+	}
+
+	responses := make([]InvitationResponse, 0, len(invitations))
+	for i := range invitations {
+		responses = append(responses, invitationToResponse(&invitations[i]))
+	}
+
+	return &ListInvitationsOutput{Body: ListInvitationsResponse{Invitations: responses}}, nil
+}
+
+// CreateInvitation handles POST /v1/account/invitations
+// Invites an email address to join the account with a role. The token is only
+// returned here; the invitee accepts it at POST /v1/invitations/accept.
+func (s *MemberService) CreateInvitation(ctx context.Context, input *CreateInvitationInput) (*CreateInvitationOutput, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	req := input.Body
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return nil, huma.Error400BadRequest("email is required")
+	}
+	if !isValidRole(req.Role) {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("unknown role %q", req.Role))
+	}
+	if req.Role == RoleOwner && callerRole(ctx) != RoleOwner {
+		return nil, huma.Error403Forbidden("only owners can invite owners")
+	}
+
+	members, err := s.db.ListAccountMembers(ctx, accountID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to list members", err)
+	}
+	for _, member := range members {
+		if strings.EqualFold(member.Email, email) {
+			return nil, huma.Error409Conflict("email already belongs to a member of the account")
+		}
+	}
+
+	token := generateInvitationToken()
+	invitation := &db.AccountInvitation{
+		ID:        uuid.New(),
+		AccountID: accountID,
+		Email:     email,
+		Role:      req.Role,
+		TokenHash: hashInvitationToken(token),
+		ExpiresAt: time.Now().UTC().Add(InvitationTTL),
+	}
+	if memberID, ok := GetMemberID(ctx); ok {
+		invitation.InvitedBy = &memberID
+	}
+	if err := s.db.CreateAccountInvitation(ctx, invitation); err != nil {
+		return nil, huma.Error500InternalServerError("failed to create invitation", err)
+	}
+
+	recordAudit(ctx, s.db, AuditMemberInvited, invitation.ID.String(), map[string]string{
+		"email": invitation.Email,
+		"role":  invitation.Role,
+	})
+
+	return &CreateInvitationOutput{
+		Body: CreateInvitationResponse{
+			InvitationResponse: invitationToResponse(invitation),
+			Token:              token, // Only shown once
+		},
+	}, nil
+}
+
+// DeleteInvitation handles DELETE /v1/account/invitations/{id}
+// Revokes an invitation so its token can no longer be accepted.
+func (s *MemberService) DeleteInvitation(ctx context.Context, input *DeleteInvitationInput) (*DeleteInvitationOutput, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	invitationID, err := parseUUID(input.ID)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid invitation ID format")
+	}
+
+	invitation, err := s.db.GetAccountInvitation(ctx, invitationID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, huma.Error404NotFound("invitation not found")
+		}
+		return nil, huma.Error500InternalServerError("failed to get invitation", err)
+	}
+	if invitation.AccountID != accountID {
+		return nil, huma.Error404NotFound("invitation not found")
+	}
+
+	if err := s.db.DeleteAccountInvitation(ctx, invitation.ID); err != nil {
+		return nil, huma.Error500InternalServerError("failed to delete invitation", err)
+	}
+
+	recordAudit(ctx, s.db, AuditInvitationRevoked, invitation.ID.String(), map[string]string{
+		"email": invitation.Email,
+		"role":  invitation.Role,
+	})
+
+	return &DeleteInvitationOutput{}, nil
+}
+
+// AcceptInvitation handles POST /v1/invitations/accept
+// Redeems an invitation token: the invitee becomes a member of the account
+// and receives their first API key, which is only shown here.
+func (s *MemberService) AcceptInvitation(ctx context.Context, input *AcceptInvitationInput) (*AcceptInvitationOutput, error) {
+	req := input.Body
+	if req.Name != nil && len(*req.Name) > 100 {
+		return nil, huma.Error400BadRequest("name must be 100 characters or less")
+	}
+
+	member, apiKey, err := s.db.AcceptAccountInvitation(ctx, hashInvitationToken(req.Token), req.Name)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "invitation not found"):
+			return nil, huma.Error404NotFound("invitation not found, expired or already accepted")
+		case strings.Contains(err.Error(), "already a member"):
+			return nil, huma.Error409Conflict("email already belongs to a member of the account")
+		}
+		return nil, huma.Error500InternalServerError("failed to accept invitation", err)
+	}
+
+	// The new member is the actor of their own joining
+	auditCtx := WithMemberID(WithAccountID(WithAPIKeyID(ctx, apiKey.ID), member.AccountID), member.ID)
+	recordAudit(auditCtx, s.db, AuditMemberJoined, member.ID.String(), map[string]string{
+		"email": member.Email,
+		"role":  member.Role,
+	})
+
+	return &AcceptInvitationOutput{
+		Body: AcceptInvitationResponse{
+			AccountID: member.AccountID.String(),
+			Member:    memberToResponse(member),
+			APIKey:    apiKeyToResponse(apiKey),
+			Key:       apiKey.Key, // Only shown once
+		},
+	}, nil
+}
+
+// getAuthorizedMember retrieves a member and verifies it belongs to the caller's account.
+// Members of other accounts are reported as not found.
+func (s *MemberService) getAuthorizedMember(ctx context.Context, id string) (*db.AccountMember, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	memberID, err := parseUUID(id)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid member ID format")
+	}
+
+	member, err := s.db.GetAccountMember(ctx, memberID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, huma.Error404NotFound("member not found")
+		}
+		return nil, huma.Error500InternalServerError("failed to get member", err)
+	}
+	if member.AccountID != accountID {
+		return nil, huma.Error404NotFound("member not found")
+	}
+
+	return member, nil
+}
+
+// requireAnotherOwner fails with 409 Conflict unless the account has an owner
+// other than member.
+func (s *MemberService) requireAnotherOwner(ctx context.Context, member *db.AccountMember) error {
+	members, err := s.db.ListAccountMembers(ctx, member.AccountID)
+	if err != nil {
+		return huma.Error500InternalServerError("failed to list members", err)
+	}
+	for _, m := range members {
+		if m.Role == RoleOwner && m.ID != member.ID {
+			return nil
+		}
+	}
+	return huma.Error409Conflict("the account must keep at least one owner")
+}
+
+// generateInvitationToken generates an invitation token
+func generateInvitationToken() string {
+	return fmt.Sprintf("inv_%s", randHex(32))
+}
+
+// hashInvitationToken returns the SHA-256 of an invitation token, which is
+// what the database stores and looks tokens up by.
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// memberToResponse converts a db.AccountMember to a MemberResponse.
+func memberToResponse(member *db.AccountMember) MemberResponse {
+	return MemberResponse{
+		ID:        member.ID.String(),
+		Email:     member.Email,
+		Name:      member.Name,
+		Role:      member.Role,
+		CreatedAt: member.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// invitationToResponse converts a db.AccountInvitation to an InvitationResponse.
+func invitationToResponse(invitation *db.AccountInvitation) InvitationResponse {
+	return InvitationResponse{
+		ID:        invitation.ID.String(),
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt.Format(time.RFC3339),
+		CreatedAt: invitation.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memberCtx returns the context an authenticated request with key carries.
+func memberCtx(key *db.APIKey) context.Context {
+	ctx := WithAPIKeyID(context.Background(), key.ID)
+	ctx = WithAccountID(ctx, key.AccountID)
+	ctx = WithRole(ctx, keyRole(key))
+	if key.MemberID != nil {
+		ctx = WithMemberID(ctx, *key.MemberID)
+	}
+	return ctx
+}
+
+// inviteMember invites email with role on behalf of inviter and accepts the
+// invitation, returning the new member's key as the database reads it.
+func inviteMember(t *testing.T, mock *mockDB, inviter *db.APIKey, email, role string) *db.APIKey {
+	t.Helper()
+	service := NewMemberService(mock)
+
+	created, err := service.CreateInvitation(memberCtx(inviter), &CreateInvitationInput{
+		Body: CreateInvitationRequest{Email: email, Role: role},
+	})
+	require.NoError(t, err)
+
+	accepted, err := service.AcceptInvitation(context.Background(), &AcceptInvitationInput{
+		Body: AcceptInvitationRequest{Token: created.Body.Token},
+	})
+	require.NoError(t, err)
+
+	key, err := mock.GetAPIKeyByKey(context.Background(), accepted.Body.Key)
+	require.NoError(t, err)
+	return key
+}
+
+// requireStatus asserts err is a huma error with the given status.
+func requireStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	var statusErr huma.StatusError
+	require.True(t, errors.As(err, &statusErr), "expected huma error, got %v", err)
+	assert.Equal(t, status, statusErr.GetStatus(), err.Error())
+}
+
+// auditActions returns the actions recorded in the mock's audit log, in order.
+func auditActions(mock *mockDB) []string {
+	mock.mu.RLock()
+	defer mock.mu.RUnlock()
+
+	actions := make([]string, 0, len(mock.auditEntries))
+	for _, entry := range mock.auditEntries {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
+
+func TestMemberService_InviteAndAccept(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	service := NewMemberService(mock)
+	ctx := memberCtx(owner)
+
+	created, err := service.CreateInvitation(ctx, &CreateInvitationInput{
+		Body: CreateInvitationRequest{Email: " dev@example.com ", Role: RoleDeveloper},
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(created.Body.Token, "inv_"))
+	assert.Equal(t, "dev@example.com", created.Body.Email)
+
+	// Only the hash of the token is stored
+	stored, err := mock.GetAccountInvitation(ctx, uuid.MustParse(created.Body.ID))
+	require.NoError(t, err)
+	assert.Equal(t, hashInvitationToken(created.Body.Token), stored.TokenHash)
+	assert.Equal(t, *owner.MemberID, *stored.InvitedBy)
+
+	pending, err := service.ListInvitations(ctx, &ListInvitationsInput{})
+	require.NoError(t, err)
+	require.Len(t, pending.Body.Invitations, 1)
+
+	name := "Dev"
+	accepted, err := service.AcceptInvitation(context.Background(), &AcceptInvitationInput{
+		Body: AcceptInvitationRequest{Token: created.Body.Token, Name: &name},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, owner.AccountID.String(), accepted.Body.AccountID)
+	assert.Equal(t, RoleDeveloper, accepted.Body.Member.Role)
+	assert.NotEmpty(t, accepted.Body.Key)
+	require.NotNil(t, accepted.Body.APIKey.MemberID)
+	assert.Equal(t, accepted.Body.Member.ID, *accepted.Body.APIKey.MemberID)
+
+	// The new key acts with the member's role
+	key, err := mock.GetAPIKeyByKey(context.Background(), accepted.Body.Key)
+	require.NoError(t, err)
+	assert.Equal(t, RoleDeveloper, keyRole(key))
+
+	// Tokens are single use
+	_, err = service.AcceptInvitation(context.Background(), &AcceptInvitationInput{
+		Body: AcceptInvitationRequest{Token: created.Body.Token},
+	})
+	requireStatus(t, err, 404)
+
+	members, err := service.ListMembers(ctx, &ListMembersInput{})
+	require.NoError(t, err)
+	assert.Len(t, members.Body.Members, 2)
+
+	pending, err = service.ListInvitations(ctx, &ListInvitationsInput{})
+	require.NoError(t, err)
+	assert.Empty(t, pending.Body.Invitations)
+
+	assert.Equal(t, []string{AuditMemberInvited, AuditMemberJoined}, auditActions(mock))
+}
+
+func TestMemberService_CreateInvitation_Validation(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	admin := inviteMember(t, mock, owner, "admin@example.com", RoleAdmin)
+	service := NewMemberService(mock)
+
+	tests := []struct {
+		name   string
+		caller *db.APIKey
+		body   CreateInvitationRequest
+		status int
+	}{
+		{"missing email", owner, CreateInvitationRequest{Email: " ", Role: RoleDeveloper}, 400},
+		{"unknown role", owner, CreateInvitationRequest{Email: "x@example.com", Role: "superuser"}, 400},
+		{"existing member", owner, CreateInvitationRequest{Email: "ADMIN@example.com", Role: RoleDeveloper}, 409},
+		{"admin invites owner", admin, CreateInvitationRequest{Email: "x@example.com", Role: RoleOwner}, 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateInvitation(memberCtx(tt.caller), &CreateInvitationInput{Body: tt.body})
+			requireStatus(t, err, tt.status)
+		})
+	}
+}
+
+func TestMemberService_DeleteInvitation(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	other, err := mock.CreateAPIKey(context.Background(), "other@example.com", nil)
+	require.NoError(t, err)
+	service := NewMemberService(mock)
+
+	created, err := service.CreateInvitation(memberCtx(owner), &CreateInvitationInput{
+		Body: CreateInvitationRequest{Email: "dev@example.com", Role: RoleDeveloper},
+	})
+	require.NoError(t, err)
+
+	// Another account cannot see the invitation
+	_, err = service.DeleteInvitation(memberCtx(other), &DeleteInvitationInput{ID: created.Body.ID})
+	requireStatus(t, err, 404)
+
+	_, err = service.DeleteInvitation(memberCtx(owner), &DeleteInvitationInput{ID: created.Body.ID})
+	require.NoError(t, err)
+
+	// A revoked invitation cannot be accepted
+	_, err = service.AcceptInvitation(context.Background(), &AcceptInvitationInput{
+		Body: AcceptInvitationRequest{Token: created.Body.Token},
+	})
+	requireStatus(t, err, 404)
+
+	assert.Equal(t, []string{AuditMemberInvited, AuditInvitationRevoked}, auditActions(mock))
+}
+
+func TestMemberService_UpdateMember(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	admin := inviteMember(t, mock, owner, "admin@example.com", RoleAdmin)
+	dev := inviteMember(t, mock, owner, "dev@example.com", RoleDeveloper)
+	service := NewMemberService(mock)
+
+	update := func(caller, target *db.APIKey, role string) (*UpdateMemberOutput, error) {
+		return service.UpdateMember(memberCtx(caller), &UpdateMemberInput{
+			ID:   target.MemberID.String(),
+			Body: UpdateMemberRequest{Role: role},
+		})
+	}
+
+	// The last owner cannot step down
+	_, err = update(owner, owner, RoleAdmin)
+	requireStatus(t, err, 409)
+
+	// Admins manage non-owners but cannot touch the owner role
+	_, err = update(admin, dev, RoleOwner)
+	requireStatus(t, err, 403)
+	_, err = update(admin, owner, RoleDeveloper)
+	requireStatus(t, err, 403)
+
+	output, err := update(admin, dev, RoleBillingViewer)
+	require.NoError(t, err)
+	assert.Equal(t, RoleBillingViewer, output.Body.Role)
+
+	// The key follows its member's role
+	devKey, err := mock.GetAPIKeyByID(context.Background(), dev.ID)
+	require.NoError(t, err)
+	assert.Equal(t, RoleBillingViewer, keyRole(devKey))
+
+	_, err = update(owner, dev, "superuser")
+	requireStatus(t, err, 400)
+
+	// With a second owner the first may step down
+	_, err = update(owner, admin, RoleOwner)
+	require.NoError(t, err)
+	_, err = update(owner, owner, RoleAdmin)
+	require.NoError(t, err)
+
+	// Members of other accounts are not found
+	other, err := mock.CreateAPIKey(context.Background(), "other@example.com", nil)
+	require.NoError(t, err)
+	_, err = update(other, dev, RoleDeveloper)
+	requireStatus(t, err, 404)
+}
+
+func TestMemberService_RemoveMember(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	require.NoError(t, err)
+	admin := inviteMember(t, mock, owner, "admin@example.com", RoleAdmin)
+	dev := inviteMember(t, mock, owner, "dev@example.com", RoleDeveloper)
+	service := NewMemberService(mock)
+
+	remove := func(caller, target *db.APIKey) error {
+		_, err := service.RemoveMember(memberCtx(caller), &RemoveMemberInput{ID: target.MemberID.String()})
+		return err
+	}
+
+	requireStatus(t, remove(admin, owner), 403)
+	requireStatus(t, remove(owner, owner), 409)
+
+	require.NoError(t, remove(admin, dev))
+
+	// The removed member's keys no longer work
+	devKey, err := mock.GetAPIKeyByID(context.Background(), dev.ID)
+	require.NoError(t, err)
+	assert.False(t, devKey.IsActive)
+
+	members, err := service.ListMembers(memberCtx(owner), &ListMembersInput{})
+	require.NoError(t, err)
+	assert.Len(t, members.Body.Members, 2)
+
+	actions := auditActions(mock)
+	assert.Equal(t, AuditMemberRemoved, actions[len(actions)-1])
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/google/uuid"
+)
+
+const (
+	// meterInterval is how often running sessions are sampled.
+	meterInterval = 15 * time.Second
+
+	// meterSampleTimeout bounds reading the usage of a single session.
+	meterSampleTimeout = 10 * time.Second
+)
+
+// bytesToMB converts bytes to whole megabytes, rounding up so any use counts.
+func bytesToMB(b int64) int64 {
+	return (b + 1<<20 - 1) >> 20
+}
+
+// Meter samples the CPU time and peak memory of running sessions and stores
+// them on the session record. Costs and hourly usage are computed from these
+// samples when the session ends. Samples come from the backend's own
+// accounting, never from inside the session's container.
+//
+// Every replica runs a meter. Each sample records the time it was taken and
+// is only stored if the session was not sampled since the figures it builds
+// on were read, so an interval is metered once however many replicas sample.
+type Meter struct {
+	db      DBClient
+	backend Backend
+	budget  *BudgetMonitor
+}
+
+// NewMeter creates a new Meter.
+func NewMeter(db DBClient, backend Backend) *Meter {
+	return &Meter{
+		db:      db,
+		backend: backend,
+	}
+}
+
+// SetBudgetMonitor sets the monitor that re-checks accounts' spend after
+// their sessions are sampled.
+func (m *Meter) SetBudgetMonitor(budget *BudgetMonitor) {
+	m.budget = budget
+}
+
+// Run samples all running sessions now and then every meterInterval. It blocks until ctx is done.
+func (m *Meter) Run(ctx context.Context) {
+	ticker := time.NewTicker(meterInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.sweep(ctx); err != nil {
+			slog.Warn("failed to meter sessions", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep samples every running session, then re-checks the budget of each
+// account that has one.
+func (m *Meter) sweep(ctx context.Context) error {
+	sessions, err := m.db.ListActiveSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	accounts := make(map[uuid.UUID]bool)
+	for i := range sessions {
+		if sessions[i].Status == SessionStatusRunning {
+			accounts[sessions[i].AccountID] = true
+			m.Sample(ctx, &sessions[i])
+		}
+	}
+	for accountID := range accounts {
+		m.budget.CheckAccount(ctx, accountID)
+	}
+	return nil
+}
+
+// Sample reads a session's usage from the backend and records it, keeping the
+// highest CPU time and memory seen so far. The session is updated in place
+// with the stored figures so callers about to end it can use them. Sessions
+// that cannot be sampled, e.g. before the backend has metrics for them, keep
+// their previous figures.
+func (m *Meter) Sample(ctx context.Context, session *db.Session) {
+	if m == nil {
+		return
+	}
+	backendID := session.GetBackendID()
+	if backendID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, meterSampleTimeout)
+	defer cancel()
+
+	usage, err := m.backend.Usage(ctx, backendID)
+	if err != nil {
+		slog.Debug("failed to sample session usage", "error", err, "session_id", session.ID)
+		return
+	}
+
+	// Postgres keeps microseconds; the stored time must compare equal next time
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	sample := &db.SessionSample{
+		PreviousSampledAt: session.LastSampledAt,
+		SampledAt:         now,
+		MemoryPeakMB:      usage.MemoryPeakMB,
+	}
+	if usage.CPURateMillicores > 0 {
+		// Millicores over seconds are CPU milliseconds
+		sample.CPUMillisAdded = usage.CPURateMillicores * sinceLastSample(session, now).Milliseconds() / 1000
+	} else {
+		sample.CPUMillis = usage.CPUMillis
+	}
+
+	result, err := m.db.RecordSessionSample(ctx, session.ID, sample)
+	if err != nil {
+		slog.Warn("failed to record session usage", "error", err, "session_id", session.ID)
+		return
+	}
+	if !result.Recorded {
+		slog.Debug("session sampled concurrently, keeping stored usage", "session_id", session.ID)
+	}
+	session.CPUMillisUsed = result.CPUMillisUsed
+	session.MemoryPeakMB = result.MemoryPeakMB
+	session.LastSampledAt = result.LastSampledAt
+}
+
+// sinceLastSample returns how long ago a session was last sampled. A session
+// never sampled is assumed to have been sampled one interval ago, or when it
+// was created if that is later.
+func sinceLastSample(session *db.Session, now time.Time) time.Duration {
+	if session.LastSampledAt != nil {
+		return now.Sub(*session.LastSampledAt)
+	}
+	last := now.Add(-meterInterval)
+	if session.CreatedAt.After(last) {
+		last = session.CreatedAt
+	}
+	return now.Sub(last)
+}
+
+// meteredUsage returns the CPU time and peak memory recorded for a session.
+// Returns false if the session was never sampled; a sampled session always
+// has some memory in use.
+func meteredUsage(session *db.Session) (cpuMillis, memoryMB int64, ok bool) {
+	if session.MemoryPeakMB == nil || *session.MemoryPeakMB <= 0 {
+		return 0, 0, false
+	}
+	if session.CPUMillisUsed != nil {
+		cpuMillis = *session.CPUMillisUsed
+	}
+	return cpuMillis, *session.MemoryPeakMB, true
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+)
+
+func TestMeter_Sample(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	session := newExpiringSession("sess_metered", SessionStatusRunning, time.Now().Add(time.Hour))
+	stored := *session
+	mockDB.sessions[session.ID] = &stored
+	mockBackend := &mockBackendHandler{usage: &ResourceUsage{CPUMillis: 1500, MemoryPeakMB: 300}}
+	meter := NewMeter(mockDB, mockBackend)
+
+	meter.Sample(context.Background(), session)
+	if cpu, memory, ok := meteredUsage(session); !ok || cpu != 1500 || memory != 300 {
+		t.Fatalf("expected 1500ms CPU and 300MB, got %d, %d, %v", cpu, memory, ok)
+	}
+
+	// A lower memory reading does not lower the recorded peak
+	mockBackend.usage = &ResourceUsage{CPUMillis: 2000, MemoryPeakMB: 120}
+	meter.Sample(context.Background(), session)
+	if cpu, memory, _ := meteredUsage(session); cpu != 2000 || memory != 300 {
+		t.Errorf("expected 2000ms CPU and a 300MB peak, got %d, %d", cpu, memory)
+	}
+	if cpu, memory, _ := meteredUsage(&stored); cpu != 2000 || memory != 300 || stored.LastSampledAt == nil {
+		t.Errorf("expected usage to be persisted, got %d, %d", cpu, memory)
+	}
+
+	// Failed samples keep the previous figures
+	mockBackend.usageErr = errors.New("no metrics yet")
+	meter.Sample(context.Background(), session)
+	if cpu, memory, _ := meteredUsage(session); cpu != 2000 || memory != 300 {
+		t.Errorf("expected usage to be kept, got %d, %d", cpu, memory)
+	}
+}
+
+func TestMeter_Sample_IntegratesRate(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	session := newExpiringSession("sess_rate", SessionStatusRunning, time.Now().Add(time.Hour))
+	mockDB.sessions[session.ID] = session
+	mockBackend := &mockBackendHandler{usage: &ResourceUsage{CPURateMillicores: 500, MemoryPeakMB: 64}}
+	meter := NewMeter(mockDB, mockBackend)
+
+	// Half a core over the one interval assumed for a session never sampled
+	meter.Sample(context.Background(), session)
+	cpu, _, _ := meteredUsage(session)
+	if want := 500 * meterInterval.Milliseconds() / 1000; cpu < want || cpu > want+50 {
+		t.Fatalf("expected about %dms CPU, got %d", want, cpu)
+	}
+
+	// Later samples add the time since the stored sample
+	lastSampledAt := time.Now().UTC().Truncate(time.Microsecond).Add(-10 * time.Second)
+	session.LastSampledAt = &lastSampledAt
+	meter.Sample(context.Background(), session)
+	next, _, _ := meteredUsage(session)
+	if next < cpu+5000 || next > cpu+5050 {
+		t.Errorf("expected about %dms CPU, got %d", cpu+5000, next)
+	}
+}
+
+func TestMeter_Sample_ConcurrentReplicas(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	session := newExpiringSession("sess_replicas", SessionStatusRunning, time.Now().Add(time.Hour))
+	lastSampledAt := time.Now().UTC().Truncate(time.Microsecond).Add(-10 * time.Second)
+	session.LastSampledAt = &lastSampledAt
+	session.CPUMillisUsed = int64Ptr(1000)
+	session.MemoryPeakMB = int64Ptr(64)
+	stored := *session
+	mockDB.sessions[session.ID] = &stored
+	mockBackend := &mockBackendHandler{usage: &ResourceUsage{CPURateMillicores: 1000, MemoryPeakMB: 64}}
+
+	// Two replicas read the session before either samples it
+	first, second := *session, *session
+	NewMeter(mockDB, mockBackend).Sample(context.Background(), &first)
+	NewMeter(mockDB, mockBackend).Sample(context.Background(), &second)
+
+	// The interval is metered once, and the late replica adopts the stored figures
+	cpu, _, _ := meteredUsage(&stored)
+	if cpu < 11000 || cpu > 11050 {
+		t.Fatalf("expected about 11000ms CPU, got %d", cpu)
+	}
+	if got, _, _ := meteredUsage(&second); got != cpu {
+		t.Errorf("expected the late replica to see %dms CPU, got %d", cpu, got)
+	}
+}
+
+func TestEndSessionUpdate_Usage(t *testing.T) {
+	endedAt := time.Now().UTC()
+	session := &db.Session{ID: "sess_1", CreatedAt: endedAt.Add(-10 * time.Second)}
+
+	// Sessions that were never sampled are estimated
+	update := endSessionUpdate(session, SessionStatusStopped, endedAt)
+	if *update.CPUMillisUsed != 10000 || *update.MemoryPeakMB != DefaultSessionMemoryMB {
+		t.Errorf("expected estimated usage, got %d ms, %d MB", *update.CPUMillisUsed, *update.MemoryPeakMB)
+	}
+	if *update.CostEstimateCents != DefaultCostCalculator.EstimateSessionCost(10000) {
+		t.Errorf("expected estimated cost, got %d", *update.CostEstimateCents)
+	}
+
+	// Sampled sessions are billed for what they used
+	session.CPUMillisUsed = int64Ptr(400000)
+	session.MemoryPeakMB = int64Ptr(640)
+	update = endSessionUpdate(session, SessionStatusStopped, endedAt)
+	if *update.CPUMillisUsed != 400000 || *update.MemoryPeakMB != 640 {
+		t.Errorf("expected metered usage, got %d ms, %d MB", *update.CPUMillisUsed, *update.MemoryPeakMB)
+	}
+	if want := DefaultCostCalculator.CalculateSessionCost(10000, 400000, 640); *update.CostEstimateCents != want {
+		t.Errorf("expected cost %d, got %d", want, *update.CostEstimateCents)
+	}
+
+	// Samples below the smallest allocation are billed at the wall-clock floor
+	session.CPUMillisUsed = int64Ptr(0)
+	session.MemoryPeakMB = int64Ptr(1)
+	update = endSessionUpdate(session, SessionStatusStopped, endedAt)
+	if *update.CPUMillisUsed != 1000 || *update.MemoryPeakMB != MinBilledMemoryMB {
+		t.Errorf("expected floor usage, got %d ms, %d MB", *update.CPUMillisUsed, *update.MemoryPeakMB)
+	}
+	if want := DefaultCostCalculator.CalculateSessionCost(10000, 1000, MinBilledMemoryMB); *update.CostEstimateCents != want {
+		t.Errorf("expected cost %d, got %d", want, *update.CostEstimateCents)
+	}
+}
+
+func TestSessionService_StopSession_RecordsUsage(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	session := newExpiringSession("sess_stop", SessionStatusRunning, time.Now().Add(time.Hour))
+	mockDB.sessions[session.ID] = session
+	mockBackend := &mockBackendHandler{usage: &ResourceUsage{CPUMillis: 7500, MemoryPeakMB: 480}}
+	sessionSvc := NewSessionService(mockDB, mockBackend)
+	sessionSvc.SetMeter(NewMeter(mockDB, mockBackend))
+
+	ctx := WithAPIKeyID(context.Background(), session.APIKeyID)
+	if _, err := sessionSvc.StopSession(ctx, &StopSessionInput{ID: session.ID}); err != nil {
+		t.Fatalf("StopSession failed: %v", err)
+	}
+
+	update := mockDB.lastSessionUpdate
+	if update == nil || update.Status == nil || *update.Status != SessionStatusStopped {
+		t.Fatalf("expected status %s, got %+v", SessionStatusStopped, update)
+	}
+	if *update.CPUMillisUsed != 7500 || *update.MemoryPeakMB != 480 || update.DurationMs == nil {
+		t.Errorf("expected final sample and duration to be recorded, got %+v", update)
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/backend/fly"
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// metricsRegistry holds the metrics recorded as requests are handled, along
+// with Go runtime and process metrics.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	metricsFactory = promauto.With(metricsRegistry)
+
+	httpRequestsTotal = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "execbox_http_requests_total",
+		Help: "API requests handled, by operation and status code.",
+	}, []string{"operation", "status"})
+	httpRequestDuration = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "execbox_http_request_duration_seconds",
+		Help:    "API request latency, by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	sessionsCreatedTotal = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "execbox_sessions_created_total",
+		Help: "Session create requests, by outcome: created, rejected (client errors and limits) or failed.",
+	}, []string{"outcome"})
+	sessionsExitedTotal = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "execbox_sessions_exited_total",
+		Help: "Sessions that ended, by final status.",
+	}, []string{"status"})
+
+	imageResolveDuration = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "execbox_image_resolve_duration_seconds",
+		Help:    "Time to resolve a build spec to an image, by outcome: cached, built or failed.",
+		Buckets: []float64{0.1, 1, 5, 15, 30, 60, 120, 300, 600, 1200},
+	}, []string{"outcome"})
+	imageCacheLookupsTotal = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "execbox_image_cache_lookups_total",
+		Help: "Image cache lookups, by result: hit or miss.",
+	}, []string{"result"})
+
+	rateLimitRejectionsTotal = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "execbox_rate_limit_rejections_total",
+		Help: "Requests rejected by the rate limiter, by scope: api_key or ip.",
+	}, []string{"scope"})
+
+	attachDuration = metricsFactory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "execbox_attach_duration_seconds",
+		Help:    "Duration of WebSocket attach connections.",
+		Buckets: []float64{1, 10, 60, 300, 900, 1800, 3600, 7200},
+	})
+	attachBytesTotal = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "execbox_attach_bytes_total",
+		Help: "Bytes transferred over WebSocket attach connections, by stream: stdin, stdout or stderr.",
+	}, []string{"stream"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// metricsScrapeTimeout bounds the database query run when /metrics is scraped.
+const metricsScrapeTimeout = 5 * time.Second
+
+var (
+	activeSessionsDesc = prometheus.NewDesc("execbox_active_sessions",
+		"Pending or running sessions, by backend and tier.", []string{"backend", "tier"}, nil)
+	reconcilerRunsDesc = prometheus.NewDesc("execbox_reconciler_runs_total",
+		"Reconciliation passes run.", nil, nil)
+	reconcilerFailuresDesc = prometheus.NewDesc("execbox_reconciler_failures_total",
+		"Reconciliation passes that failed.", nil, nil)
+	reconcilerStartedDesc = prometheus.NewDesc("execbox_reconciler_sessions_started_total",
+		"Pending sessions the reconciler found running.", nil, nil)
+	reconcilerEndedDesc = prometheus.NewDesc("execbox_reconciler_sessions_ended_total",
+		"Active sessions the reconciler found exited or gone.", nil, nil)
+	reconcilerOrphansDesc = prometheus.NewDesc("execbox_reconciler_orphans_destroyed_total",
+		"Backend sessions without a database row that were destroyed.", nil, nil)
+	reconcilerLastRunDesc = prometheus.NewDesc("execbox_reconciler_last_run_timestamp_seconds",
+		"Unix time of the last reconciliation pass.", nil, nil)
+)
+
+// stateCollector reads metrics kept elsewhere when /metrics is scraped: active
+// sessions per tier from the database, and the reconciler's counters.
+type stateCollector struct {
+	db          DBClient
+	backendName string
+	reconciler  *Reconciler
+}
+
+// newStateCollector creates a stateCollector.
+func newStateCollector(db DBClient, backendName string, reconciler *Reconciler) *stateCollector {
+	return &stateCollector{
+		db:          db,
+		backendName: backendName,
+		reconciler:  reconciler,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+	ch <- reconcilerRunsDesc
+	ch <- reconcilerFailuresDesc
+	ch <- reconcilerStartedDesc
+	ch <- reconcilerEndedDesc
+	ch <- reconcilerOrphansDesc
+	ch <- reconcilerLastRunDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsScrapeTimeout)
+	defer cancel()
+
+	counts, err := c.db.CountActiveSessionsByTier(ctx)
+	if err != nil {
+		slog.Warn("failed to count active sessions for metrics", "error", err)
+	}
+	for tier, count := range counts {
+		ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(count), c.backendName, tier)
+	}
+
+	stats := c.reconciler.Stats()
+	ch <- prometheus.MustNewConstMetric(reconcilerRunsDesc, prometheus.CounterValue, float64(stats.Runs))
+	ch <- prometheus.MustNewConstMetric(reconcilerFailuresDesc, prometheus.CounterValue, float64(stats.Failures))
+	ch <- prometheus.MustNewConstMetric(reconcilerStartedDesc, prometheus.CounterValue, float64(stats.Started))
+	ch <- prometheus.MustNewConstMetric(reconcilerEndedDesc, prometheus.CounterValue, float64(stats.Ended))
+	ch <- prometheus.MustNewConstMetric(reconcilerOrphansDesc, prometheus.CounterValue, float64(stats.OrphansDestroyed))
+	if !stats.LastRunAt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(reconcilerLastRunDesc, prometheus.GaugeValue, float64(stats.LastRunAt.Unix()))
+	}
+}
+
+// metricsMiddleware counts huma requests and records their latency per operation.
+func metricsMiddleware(ctx huma.Context, next func(huma.Context)) {
+	start := time.Now()
+	next(ctx)
+
+	operation := ctx.Operation().OperationID
+	status := ctx.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	httpRequestsTotal.WithLabelValues(operation, strconv.Itoa(status)).Inc()
+	httpRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// handleMetrics serves the recorded metrics together with those read by state.
+// If token is set, scrapers must send it as a bearer token.
+func handleMetrics(token string, state prometheus.Collector) http.HandlerFunc {
+	stateRegistry := prometheus.NewRegistry()
+	stateRegistry.MustRegister(state)
+	handler := promhttp.HandlerFor(prometheus.Gatherers{metricsRegistry, stateRegistry}, promhttp.HandlerOpts{})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			want := "Bearer " + token
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+				WriteError(w, ErrUnauthorized, http.StatusUnauthorized, CodeUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// observeSessionCreate counts a CreateSession call by its outcome.
+func observeSessionCreate(err error) {
+	outcome := "created"
+	if err != nil {
+		outcome = "failed"
+		var statusErr huma.StatusError
+		if errors.As(err, &statusErr) && statusErr.GetStatus() < http.StatusInternalServerError {
+			outcome = "rejected"
+		}
+	}
+	sessionsCreatedTotal.WithLabelValues(outcome).Inc()
+}
+
+// observeSessionUpdate counts sessions that end through update.
+func observeSessionUpdate(from string, update *db.SessionUpdate) {
+	if update.Status == nil || !isActiveStatus(from) || isActiveStatus(*update.Status) {
+		return
+	}
+	sessionsExitedTotal.WithLabelValues(*update.Status).Inc()
+}
+
+// observedCache wraps a build cache to learn whether a Resolve call was served from it.
+type observedCache struct {
+	fly.BuildCache
+	hit bool
+}
+
+// Get looks up hash and counts the lookup as a hit or miss.
+func (c *observedCache) Get(ctx context.Context, hash string) (string, bool, error) {
+	registryTag, ok, err := c.BuildCache.Get(ctx, hash)
+	if err == nil {
+		observeCacheLookup(ok)
+	}
+	c.hit = c.hit || ok
+	return registryTag, ok, err
+}
+
+// observeCacheLookup counts an image cache lookup.
+func observeCacheLookup(hit bool) {
+	if hit {
+		imageCacheLookupsTotal.WithLabelValues("hit").Inc()
+	} else {
+		imageCacheLookupsTotal.WithLabelValues("miss").Inc()
+	}
+}
+
+// resolveImage resolves spec with builder, recording how long it took and
+// whether the image came from the cache or was built. The resolve and each
+// build phase are traced as spans.
+func resolveImage(ctx context.Context, builder ImageBuilder, spec *fly.BuildSpec, cache fly.BuildCache) (string, error) {
+	ctx, span := tracer.Start(ctx, "image.resolve", trace.WithAttributes(
+		attribute.String("image.base", spec.BaseImage),
+	))
+	defer span.End()
+
+	var observed *observedCache
+	if cache != nil {
+		observed = &observedCache{BuildCache: cache}
+		cache = observed
+	}
+
+	buildCtx, endPhases := fly.TraceBuildPhases(ctx)
+	start := time.Now()
+	registryTag, err := builder.Resolve(buildCtx, spec, cache)
+	endPhases()
+
+	outcome := "built"
+	switch {
+	case err != nil:
+		outcome = "failed"
+	case observed != nil && observed.hit:
+		outcome = "cached"
+	}
+	imageResolveDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+
+	span.SetAttributes(attribute.String("image.resolve.outcome", outcome))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return registryTag, err
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/burka/execbox-cloud/internal/backend/fly"
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// histogramCount returns how many values a histogram recorded for the given label values.
+func histogramCount(t *testing.T, histogram *prometheus.HistogramVec, labelValues ...string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := histogram.WithLabelValues(labelValues...).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// cachingImageBuilder serves specs from the cache and builds the rest.
+type cachingImageBuilder struct{}
+
+func (cachingImageBuilder) Resolve(ctx context.Context, spec *fly.BuildSpec, cache fly.BuildCache) (string, error) {
+	if registryTag, ok, _ := cache.Get(ctx, fly.ComputeHash(spec)); ok {
+		return registryTag, nil
+	}
+	return "ttl.sh/execbox-built:4h", nil
+}
+
+func TestResolveImage_RecordsOutcome(t *testing.T) {
+	cached := &fly.BuildSpec{BaseImage: "alpine", Setup: []string{"apk add git"}}
+	fresh := &fly.BuildSpec{BaseImage: "alpine", Setup: []string{"apk add curl"}}
+	cache := mapBuildCache{fly.ComputeHash(cached): "ttl.sh/execbox-cached:4h"}
+
+	cachedBefore, builtBefore := histogramCount(t, imageResolveDuration, "cached"), histogramCount(t, imageResolveDuration, "built")
+	hitsBefore, missesBefore := testutil.ToFloat64(imageCacheLookupsTotal.WithLabelValues("hit")), testutil.ToFloat64(imageCacheLookupsTotal.WithLabelValues("miss"))
+
+	if tag, err := resolveImage(context.Background(), cachingImageBuilder{}, cached, cache); err != nil || tag != "ttl.sh/execbox-cached:4h" {
+		t.Fatalf("expected cached image, got %s, %v", tag, err)
+	}
+	if tag, err := resolveImage(context.Background(), cachingImageBuilder{}, fresh, cache); err != nil || tag != "ttl.sh/execbox-built:4h" {
+		t.Fatalf("expected built image, got %s, %v", tag, err)
+	}
+
+	if n := histogramCount(t, imageResolveDuration, "cached") - cachedBefore; n != 1 {
+		t.Errorf("expected 1 cached resolve, got %d", n)
+	}
+	if n := histogramCount(t, imageResolveDuration, "built") - builtBefore; n != 1 {
+		t.Errorf("expected 1 built resolve, got %d", n)
+	}
+	if hits := testutil.ToFloat64(imageCacheLookupsTotal.WithLabelValues("hit")) - hitsBefore; hits != 1 {
+		t.Errorf("expected 1 cache hit, got %v", hits)
+	}
+	if misses := testutil.ToFloat64(imageCacheLookupsTotal.WithLabelValues("miss")) - missesBefore; misses != 1 {
+		t.Errorf("expected 1 cache miss, got %v", misses)
+	}
+}
+
+func TestObserveSessionCreate(t *testing.T) {
+	created, rejected, failed := testutil.ToFloat64(sessionsCreatedTotal.WithLabelValues("created")), testutil.ToFloat64(sessionsCreatedTotal.WithLabelValues("rejected")), testutil.ToFloat64(sessionsCreatedTotal.WithLabelValues("failed"))
+
+	observeSessionCreate(nil)
+	observeSessionCreate(huma.Error429TooManyRequests("concurrent session limit reached"))
+	observeSessionCreate(huma.Error500InternalServerError("failed to create session"))
+	observeSessionCreate(errors.New("unexpected"))
+
+	if d := testutil.ToFloat64(sessionsCreatedTotal.WithLabelValues("created")) - created; d != 1 {
+		t.Errorf("expected 1 created, got %v", d)
+	}
+	if d := testutil.ToFloat64(sessionsCreatedTotal.WithLabelValues("rejected")) - rejected; d != 1 {
+		t.Errorf("expected 1 rejected, got %v", d)
+	}
+	if d := testutil.ToFloat64(sessionsCreatedTotal.WithLabelValues("failed")) - failed; d != 2 {
+		t.Errorf("expected 2 failed, got %v", d)
+	}
+}
+
+func TestObserveSessionUpdate(t *testing.T) {
+	killed := testutil.ToFloat64(sessionsExitedTotal.WithLabelValues(SessionStatusKilled))
+
+	status := SessionStatusKilled
+	observeSessionUpdate(SessionStatusRunning, &db.SessionUpdate{Status: &status})
+	// Already ended: not counted again
+	observeSessionUpdate(SessionStatusStopped, &db.SessionUpdate{Status: &status})
+	running := SessionStatusRunning
+	observeSessionUpdate(SessionStatusPending, &db.SessionUpdate{Status: &running})
+
+	if d := testutil.ToFloat64(sessionsExitedTotal.WithLabelValues(SessionStatusKilled)) - killed; d != 1 {
+		t.Errorf("expected 1 killed session, got %v", d)
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	_, api := humatest.New(t)
+	api.UseMiddleware(metricsMiddleware)
+	huma.Register(api, huma.Operation{
+		OperationID: "metricsCheck",
+		Method:      http.MethodGet,
+		Path:        "/check",
+	}, func(ctx context.Context, input *struct{}) (*struct{}, error) {
+		return nil, huma.Error404NotFound("not here")
+	})
+
+	before := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("metricsCheck", "404"))
+	api.Get("/check")
+
+	if d := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("metricsCheck", "404")) - before; d != 1 {
+		t.Errorf("expected 1 request counted with status 404, got %v", d)
+	}
+	if n := histogramCount(t, httpRequestDuration, "metricsCheck"); n < 1 {
+		t.Error("expected request latency to be recorded")
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	newReconcileSession(mockDB, "sess_running", "pod_running", SessionStatusRunning)
+	mockBackend := &mockBackendHandler{listed: []*Session{{BackendID: "pod_running", Status: SessionStatusRunning}}}
+	reconciler := NewReconciler(mockDB, mockBackend)
+	if _, err := reconciler.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	handler := handleMetrics("secret", newStateCollector(mockDB, "kubernetes", reconciler))
+
+	t.Run("requires token when configured", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("serves metrics", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		body := rec.Body.String()
+		for _, want := range []string{
+			`execbox_active_sessions{backend="kubernetes",tier="free"} 1`,
+			"execbox_reconciler_runs_total 1",
+			"# TYPE execbox_http_requests_total counter",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected %q in metrics:\n%s", want, body)
+			}
+		}
+	})
+}
@@ -9,9 +9,11 @@ import (
 	"net"
 	"net/http"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/burka/execbox-cloud/internal/db"
 	"github.com/jackc/pgx/v5"
 )
 
@@ -40,11 +42,11 @@ func AuthMiddleware(dbClient DBClient) func(http.Handler) http.Handler {
 			}
 
 			// 3. Look up key in database
-			apiKey, err := dbClient.GetAPIKeyByKey(r.Context(), key)
+			apiKey, err := authenticateAPIKey(r.Context(), dbClient, key)
 			if err != nil {
-				// 4. If invalid: return 401 Unauthorized
-				if errors.Is(err, pgx.ErrNoRows) || strings.Contains(err.Error(), "not found") {
-					WriteError(w, ErrUnauthorized, http.StatusUnauthorized, CodeUnauthorized)
+				// 4. If unknown, deactivated or expired: return 401 Unauthorized
+				if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrKeyInactive) || errors.Is(err, ErrKeyExpired) {
+					WriteErrorFromStandard(w, err)
 					return
 				}
 				// Database error
@@ -53,10 +55,26 @@ func AuthMiddleware(dbClient DBClient) func(http.Handler) http.Handler {
 				return
 			}
 
-			// 5. Set API key ID, rate limit, and tier in context
+			// 5. Set API key ID, rate limit, tier, limit overrides, account, client IP, role and scopes in context
 			ctx := WithAPIKeyID(r.Context(), apiKey.ID)
 			ctx = WithAPIKeyRateLimit(ctx, apiKey.RateLimitRPS)
 			ctx = WithAPIKeyTier(ctx, apiKey.Tier)
+			ctx = WithAPIKeyLimits(ctx, APIKeyLimits{
+				DailySessions:      apiKey.CustomDailyLimit,
+				ConcurrentSessions: apiKey.CustomConcurrentLimit,
+			})
+			ctx = WithAccountID(ctx, apiKey.AccountID)
+			ctx = WithClientIP(ctx, clientIP(r.RemoteAddr))
+			ctx = WithRole(ctx, keyRole(apiKey))
+			if apiKey.MemberID != nil {
+				ctx = WithMemberID(ctx, *apiKey.MemberID)
+			}
+			if apiKey.Scopes != nil {
+				ctx = WithScopes(ctx, apiKey.Scopes)
+			}
+			if apiKey.UsedRotatingKey {
+				recordRotatingKeyUse(ctx, dbClient, apiKey)
+			}
 
 			// 6. Update last_used_at async (don't block the request)
 			go func() {
@@ -77,6 +95,63 @@ func AuthMiddleware(dbClient DBClient) func(http.Handler) http.Handler {
 	}
 }
 
+// authenticateAPIKey looks up the key a request authenticates with. Unknown
+// keys fail with ErrUnauthorized, and keys that were deactivated or have
+// expired with ErrKeyInactive or ErrKeyExpired; other errors are lookup failures.
+func authenticateAPIKey(ctx context.Context, dbClient DBClient, key string) (*db.APIKey, error) {
+	apiKey, err := dbClient.GetAPIKeyByKey(ctx, key)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows) || strings.Contains(err.Error(), "not found"):
+			return nil, ErrUnauthorized
+		case strings.Contains(err.Error(), "inactive"):
+			return nil, ErrKeyInactive
+		case strings.Contains(err.Error(), "expired"):
+			return nil, ErrKeyExpired
+		}
+		return nil, err
+	}
+
+	// Checked here as well, so a key is never used past its expiration
+	if !apiKey.IsActive {
+		return nil, ErrKeyInactive
+	}
+	if apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(time.Now()) {
+		return nil, ErrKeyExpired
+	}
+	return apiKey, nil
+}
+
+// RequireRoles rejects requests whose API key acts with a role not in roles.
+// It must run after AuthMiddleware.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := callerRole(r.Context())
+			if !slices.Contains(roles, role) {
+				WriteError(w, fmt.Errorf("role %s is not allowed to access this endpoint", role), http.StatusForbidden, CodeForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope rejects requests whose API key is scoped without scope.
+// It must run after AuthMiddleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, _ := GetScopes(r.Context())
+			if !scopeAllowed(scopes, scope) {
+				WriteError(w, fmt.Errorf("API key lacks the %s scope", scope), http.StatusForbidden, CodeForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // LoggingMiddleware logs requests with slog
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -124,6 +199,18 @@ func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, fmt.Errorf("underlying ResponseWriter does not support hijacking")
 }
 
+// Flush implements http.Flusher for streamed responses such as Server-Sent Events.
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for use by http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // RecoveryMiddleware recovers from panics
 func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
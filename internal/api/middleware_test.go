@@ -2,12 +2,16 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
 	"github.com/google/uuid"
 )
 
@@ -28,6 +32,7 @@ func TestAuthMiddleware_ValidKey(t *testing.T) {
 		Key:          "valid-key",
 		Tier:         "free",
 		RateLimitRPS: 10,
+		IsActive:     true,
 		CreatedAt:    time.Now(),
 	}
 
@@ -125,6 +130,7 @@ func TestAuthMiddleware_ContextValues(t *testing.T) {
 		Key:          "valid-key",
 		Tier:         "pro",
 		RateLimitRPS: 100,
+		IsActive:     true,
 		CreatedAt:    time.Now(),
 	}
 
@@ -166,6 +172,271 @@ func TestAuthMiddleware_ContextValues(t *testing.T) {
 	}
 }
 
+// TestHumaAuthMiddleware_ContextValues tests that huma routes see the key's limits and account
+func TestHumaAuthMiddleware_ContextValues(t *testing.T) {
+	mock := newMockDB()
+	keyID := uuid.New()
+	accountID := uuid.New()
+	dailyLimit := 25
+	mock.apiKeys["valid-key"] = &db.APIKey{
+		ID:               keyID,
+		AccountID:        accountID,
+		Key:              "valid-key",
+		Tier:             "pro",
+		CustomDailyLimit: &dailyLimit,
+		IsActive:         true,
+		CreatedAt:        time.Now(),
+	}
+
+	_, api := humatest.New(t)
+	huma.Register(api, huma.Operation{
+		OperationID: "check",
+		Method:      http.MethodGet,
+		Path:        "/check",
+		Middlewares: huma.Middlewares{humaAuthMiddleware(mock)},
+	}, func(ctx context.Context, input *struct{}) (*struct{}, error) {
+		if id, ok := GetAccountID(ctx); !ok || id != accountID {
+			t.Errorf("expected account ID %v, got %v", accountID, id)
+		}
+		if limits, ok := GetAPIKeyLimits(ctx); !ok || limits.DailySessions == nil || *limits.DailySessions != dailyLimit {
+			t.Errorf("expected daily session limit %d, got %+v", dailyLimit, limits)
+		}
+		return nil, nil
+	})
+
+	resp := api.Get("/check", "Authorization: Bearer valid-key")
+	if resp.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.Code)
+	}
+}
+
+// TestHumaAuthMiddleware_RoleDenied tests that an operation outside the key's role is rejected and audited
+func TestHumaAuthMiddleware_RoleDenied(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	viewer := inviteMember(t, mock, owner, "billing@example.com", RoleBillingViewer)
+
+	_, api := humatest.New(t)
+	huma.Register(api, huma.Operation{
+		OperationID: "createSession",
+		Method:      http.MethodPost,
+		Path:        "/sessions",
+		Middlewares: huma.Middlewares{humaAuthMiddleware(mock)},
+	}, func(ctx context.Context, input *struct{}) (*struct{}, error) {
+		return nil, nil
+	})
+
+	resp := api.Post("/sessions", "Authorization: Bearer "+viewer.Key)
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", resp.Code)
+	}
+
+	resp = api.Post("/sessions", "Authorization: Bearer "+owner.Key)
+	if resp.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.Code)
+	}
+
+	actions := auditActions(mock)
+	if len(actions) == 0 || actions[len(actions)-1] != AuditAccessDenied {
+		t.Errorf("expected %s to be audited, got %v", AuditAccessDenied, actions)
+	}
+}
+
+// TestHumaAuthMiddleware_ScopeDenied tests that a scoped key can only call operations its scopes cover
+func TestHumaAuthMiddleware_ScopeDenied(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	ci, err := mock.CreateAPIKeyForAccount(context.Background(), owner.AccountID, "ci", "", owner.ID, []string{ScopeSessionsCreate})
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+
+	_, api := humatest.New(t)
+	for _, op := range []struct{ id, path string }{{"createSession", "/sessions"}, {"createAPIKey", "/keys"}} {
+		huma.Register(api, huma.Operation{
+			OperationID: op.id,
+			Method:      http.MethodPost,
+			Path:        op.path,
+			Middlewares: huma.Middlewares{humaAuthMiddleware(mock)},
+		}, func(ctx context.Context, input *struct{}) (*struct{}, error) {
+			return nil, nil
+		})
+	}
+
+	if resp := api.Post("/sessions", "Authorization: Bearer "+ci.Key); resp.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.Code)
+	}
+	if resp := api.Post("/keys", "Authorization: Bearer "+ci.Key); resp.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", resp.Code)
+	}
+	if resp := api.Post("/keys", "Authorization: Bearer "+owner.Key); resp.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.Code)
+	}
+}
+
+// TestRequireScope tests the scope check on raw routes
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(ScopeFilesWrite)(testHandler())
+
+	tests := []struct {
+		name   string
+		scopes []string
+		want   int
+	}{
+		{"unrestricted", nil, http.StatusOK},
+		{"has scope", []string{ScopeFilesWrite}, http.StatusOK},
+		{"lacks scope", []string{ScopeSessionsRead}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("PUT", "/test", nil)
+		if tt.scopes != nil {
+			req = req.WithContext(WithScopes(req.Context(), tt.scopes))
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
+
+// TestAuthMiddleware_ExpiredOrInactiveKey tests that both auth middlewares reject
+// deactivated and expired keys with their own error codes
+func TestAuthMiddleware_ExpiredOrInactiveKey(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name string
+		key  *db.APIKey
+		code string
+	}{
+		{"inactive", &db.APIKey{ID: uuid.New(), Tier: "free"}, CodeKeyInactive},
+		{"expired", &db.APIKey{ID: uuid.New(), Tier: "free", IsActive: true, ExpiresAt: &expired}, CodeKeyExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDB()
+			mock.apiKeys["some-key"] = tt.key
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.Header.Set("Authorization", "Bearer some-key")
+			w := httptest.NewRecorder()
+			AuthMiddleware(mock)(testHandler()).ServeHTTP(w, req)
+
+			var resp ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if w.Code != http.StatusUnauthorized || resp.Code != tt.code {
+				t.Errorf("expected 401 %s, got %d %s", tt.code, w.Code, resp.Code)
+			}
+
+			_, api := humatest.New(t)
+			huma.Register(api, huma.Operation{
+				OperationID: "check",
+				Method:      http.MethodGet,
+				Path:        "/check",
+				Middlewares: huma.Middlewares{humaAuthMiddleware(mock)},
+			}, func(ctx context.Context, input *struct{}) (*struct{}, error) {
+				return nil, nil
+			})
+
+			humaResp := api.Get("/check", "Authorization: Bearer some-key")
+			resp = ErrorResponse{}
+			if err := json.NewDecoder(humaResp.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if humaResp.Code != http.StatusUnauthorized || resp.Code != tt.code {
+				t.Errorf("expected 401 %s from huma, got %d %s", tt.code, humaResp.Code, resp.Code)
+			}
+		})
+	}
+}
+
+// TestAuthMiddleware_RotatingKeyAudited tests that every use of a rotated key's previous value is audit-logged
+func TestAuthMiddleware_RotatingKeyAudited(t *testing.T) {
+	mock := newMockDB()
+	owner, err := mock.CreateAPIKey(context.Background(), "owner@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	oldKey := owner.Key
+	rotated, err := mock.RotateAPIKey(context.Background(), owner.ID, "test", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to rotate key: %v", err)
+	}
+
+	_, api := humatest.New(t)
+	huma.Register(api, huma.Operation{
+		OperationID: "check",
+		Method:      http.MethodGet,
+		Path:        "/check",
+		Middlewares: huma.Middlewares{humaAuthMiddleware(mock)},
+	}, func(ctx context.Context, input *struct{}) (*struct{}, error) {
+		return nil, nil
+	})
+	handler := AuthMiddleware(mock)(testHandler())
+
+	for _, key := range []string{oldKey, rotated.Key} {
+		if resp := api.Get("/check", "Authorization: Bearer "+key); resp.Code != http.StatusNoContent {
+			t.Errorf("expected status 204, got %d", resp.Code)
+		}
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	// Only the two uses of the old key are recorded
+	var uses int
+	for _, action := range auditActions(mock) {
+		if action == AuditRotatingKeyUsed {
+			uses++
+		}
+	}
+	if uses != 2 {
+		t.Errorf("expected 2 %s entries, got %d", AuditRotatingKeyUsed, uses)
+	}
+}
+
+// TestRequireRoles tests the role check on raw routes
+func TestRequireRoles(t *testing.T) {
+	handler := RequireRoles(developerRoles...)(testHandler())
+
+	tests := []struct {
+		role string
+		want int
+	}{
+		{RoleOwner, http.StatusOK},
+		{RoleDeveloper, http.StatusOK},
+		{RoleBillingViewer, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req = req.WithContext(WithRole(req.Context(), tt.role))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("role %s: expected status %d, got %d", tt.role, tt.want, w.Code)
+		}
+	}
+}
+
 // TestLoggingMiddleware tests that requests are logged
 func TestLoggingMiddleware(t *testing.T) {
 	handler := LoggingMiddleware(testHandler())
@@ -218,12 +489,12 @@ func TestRateLimiter_Allow(t *testing.T) {
 	apiKeyID := uuid.New()
 
 	// First request should be allowed
-	if !rl.allow(apiKeyID, 10.0) {
+	if !rl.allow(context.Background(), apiKeyID, 10.0) {
 		t.Error("first request should be allowed")
 	}
 
 	// Immediate second request should be allowed (bucket has capacity)
-	if !rl.allow(apiKeyID, 10.0) {
+	if !rl.allow(context.Background(), apiKeyID, 10.0) {
 		t.Error("second request should be allowed")
 	}
 }
@@ -236,13 +507,13 @@ func TestRateLimiter_Exceeded(t *testing.T) {
 
 	// Consume all tokens
 	for i := 0; i < int(rateLimit); i++ {
-		if !rl.allow(apiKeyID, rateLimit) {
+		if !rl.allow(context.Background(), apiKeyID, rateLimit) {
 			t.Errorf("request %d should be allowed", i+1)
 		}
 	}
 
 	// Next request should be rate limited
-	if rl.allow(apiKeyID, rateLimit) {
+	if rl.allow(context.Background(), apiKeyID, rateLimit) {
 		t.Error("request should be rate limited")
 	}
 
@@ -250,7 +521,7 @@ func TestRateLimiter_Exceeded(t *testing.T) {
 	time.Sleep(time.Second)
 
 	// Should be allowed again
-	if !rl.allow(apiKeyID, rateLimit) {
+	if !rl.allow(context.Background(), apiKeyID, rateLimit) {
 		t.Error("request should be allowed after waiting")
 	}
 }
@@ -263,16 +534,16 @@ func TestRateLimiter_DifferentKeys(t *testing.T) {
 	rateLimit := 2.0
 
 	// Exhaust key1's bucket
-	rl.allow(key1, rateLimit)
-	rl.allow(key1, rateLimit)
+	rl.allow(context.Background(), key1, rateLimit)
+	rl.allow(context.Background(), key1, rateLimit)
 
 	// key1 should be rate limited
-	if rl.allow(key1, rateLimit) {
+	if rl.allow(context.Background(), key1, rateLimit) {
 		t.Error("key1 should be rate limited")
 	}
 
 	// key2 should still work
-	if !rl.allow(key2, rateLimit) {
+	if !rl.allow(context.Background(), key2, rateLimit) {
 		t.Error("key2 should be allowed")
 	}
 }
@@ -352,6 +623,7 @@ func TestMiddlewareChain(t *testing.T) {
 		Key:          "valid-key",
 		Tier:         "free",
 		RateLimitRPS: 10,
+		IsActive:     true,
 		CreatedAt:    time.Now(),
 	}
 
@@ -414,3 +686,135 @@ func TestContextHelpers(t *testing.T) {
 		t.Errorf("expected 100, got %d", rateLimit)
 	}
 }
+
+// TestRateLimiter_Headers tests that responses describe the caller's bucket
+func TestRateLimiter_Headers(t *testing.T) {
+	rl := NewRateLimiter()
+	ctx := WithAPIKeyRateLimit(WithAPIKeyID(context.Background(), uuid.New()), 2)
+	handler := rl.Middleware()(testHandler())
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+		return w
+	}
+
+	w := serve()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset":     "1",
+		"RateLimit-Policy":    "2;w=1",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	serve()
+	w = serve()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("expected RateLimit-Remaining 0, got %q", got)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+}
+
+// TestRateLimiter_SharedStore tests that replicas sharing a store share the limit
+func TestRateLimiter_SharedStore(t *testing.T) {
+	mock := newMockHandlerDB()
+	store := NewPostgresRateLimitStore(mock)
+	replica1 := NewRateLimiterWithStore(store)
+	replica2 := NewRateLimiterWithStore(store)
+	apiKeyID := uuid.New()
+
+	if !replica1.allow(context.Background(), apiKeyID, 2) || !replica2.allow(context.Background(), apiKeyID, 2) {
+		t.Fatal("expected the first two requests to be allowed")
+	}
+	if replica1.allow(context.Background(), apiKeyID, 2) || replica2.allow(context.Background(), apiKeyID, 2) {
+		t.Error("expected the limit to apply across replicas")
+	}
+}
+
+// TestRateLimiter_StoreUnavailable tests that requests pass when the store fails
+func TestRateLimiter_StoreUnavailable(t *testing.T) {
+	mock := newMockHandlerDB()
+	mock.rateLimitErr = errors.New("connection refused")
+	rl := NewRateLimiterWithStore(NewPostgresRateLimitStore(mock))
+
+	ctx := WithAPIKeyRateLimit(WithAPIKeyID(context.Background(), uuid.New()), 1)
+	w := httptest.NewRecorder()
+	rl.Middleware()(testHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "" {
+		t.Errorf("expected no rate limit headers, got RateLimit-Remaining %q", got)
+	}
+}
+
+// blockingRateLimitStore never answers; it returns once the lookup's context
+// is done and records the context it was given.
+type blockingRateLimitStore struct {
+	ctx context.Context
+}
+
+func (s *blockingRateLimitStore) Take(ctx context.Context, key string, rate, burst float64) (bool, float64, error) {
+	s.ctx = ctx
+	<-ctx.Done()
+	return false, 0, ctx.Err()
+}
+
+// TestRateLimiter_StoreTimeout tests that a hanging store is given the request
+// context and a short timeout, after which the request passes
+func TestRateLimiter_StoreTimeout(t *testing.T) {
+	store := &blockingRateLimitStore{}
+	rl := NewRateLimiterWithStore(store)
+
+	ctx := WithAPIKeyRateLimit(WithAPIKeyID(context.Background(), uuid.New()), 1)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	rl.Middleware()(testHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the lookup to give up after %v, took %v", rateLimitStoreTimeout, elapsed)
+	}
+	if _, ok := GetAPIKeyID(store.ctx); !ok {
+		t.Error("expected the store to get the request context")
+	}
+	if _, ok := store.ctx.Deadline(); !ok {
+		t.Error("expected the store lookup to have a deadline")
+	}
+}
+
+// TestRateLimiter_IPMiddleware tests per-IP limiting and its headers
+func TestRateLimiter_IPMiddleware(t *testing.T) {
+	rl := NewRateLimiter()
+	handler := rl.IPMiddleware()(testHandler())
+
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 11; i++ {
+		last = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+		handler.ServeHTTP(last, req)
+	}
+
+	if last.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 after 11 requests, got %d", last.Code)
+	}
+	if got := last.Header().Get("RateLimit-Limit"); got != "10" {
+		t.Errorf("expected RateLimit-Limit 10, got %q", got)
+	}
+}
@@ -57,7 +57,11 @@ func GenerateOpenAPISpec() ([]byte, error) {
 	// huma only needs the function signatures to extract request/response types.
 	stubServices := &Services{
 		Session: NewSessionService(nil, nil),
+		Build:   NewBuildService(nil),
 		Account: NewAccountService(nil),
+		Webhook: NewWebhookService(nil),
+		Member:  NewMemberService(nil),
+		Audit:   NewAuditService(nil),
 		Quota:   NewQuotaService(nil),
 		DB:      nil, // nil DB signals spec-generation mode to RegisterRoutes
 	}
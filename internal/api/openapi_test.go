@@ -127,6 +127,8 @@ func TestOpenAPIHasAllEndpoints(t *testing.T) {
 		"/v1/sessions",
 		"/v1/sessions/{id}",
 		"/v1/sessions/{id}/stop",
+		"/v1/builds",
+		"/v1/builds/{id}",
 		"/v1/quota-requests",
 	}
 
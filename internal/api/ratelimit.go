@@ -1,64 +1,95 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// rateLimitStoreTimeout bounds a bucket lookup. A store slower than this lets
+// the request through rather than holding up every API call.
+const rateLimitStoreTimeout = 200 * time.Millisecond
+
+// RateLimitStore keeps the token buckets behind a RateLimiter. Buckets are
+// identified by key, refill at rate tokens per second and hold at most burst
+// tokens.
+type RateLimitStore interface {
+	// Take takes a token from the bucket identified by key. It reports whether a
+	// token was available and how many tokens are left.
+	Take(ctx context.Context, key string, rate, burst float64) (bool, float64, error)
+}
+
 // RateLimiter manages rate limiting using token bucket algorithm
 type RateLimiter struct {
-	mu        sync.RWMutex
-	buckets   map[uuid.UUID]*tokenBucket
-	ipBuckets map[string]*tokenBucket
+	store RateLimitStore
 }
 
-// tokenBucket implements the token bucket algorithm for rate limiting
-type tokenBucket struct {
-	tokens    float64
-	lastTime  time.Time
-	rateLimit float64 // tokens per second
+// NewRateLimiter creates a new RateLimiter instance that keeps its buckets in
+// process memory. Each replica then enforces the limits on its own.
+func NewRateLimiter() *RateLimiter {
+	return NewRateLimiterWithStore(NewMemoryRateLimitStore())
 }
 
-// NewRateLimiter creates a new RateLimiter instance
-func NewRateLimiter() *RateLimiter {
-	rl := &RateLimiter{
-		buckets:   make(map[uuid.UUID]*tokenBucket),
-		ipBuckets: make(map[string]*tokenBucket),
-	}
+// NewRateLimiterWithStore creates a RateLimiter that keeps its buckets in store.
+func NewRateLimiterWithStore(store RateLimitStore) *RateLimiter {
+	return &RateLimiter{store: store}
+}
+
+// rateLimitDecision is the outcome of taking a token for a request.
+type rateLimitDecision struct {
+	allowed   bool
+	known     bool    // False if the store failed and the request was let through
+	rate      float64 // Tokens per second
+	burst     float64 // Bucket capacity
+	remaining float64 // Tokens left after the request
+}
 
-	// Start cleanup goroutine to remove stale buckets
-	go rl.cleanup()
+// take takes a token from the bucket of id within scope ("api_key" or "ip").
+// The bucket holds one second worth of requests. If the store fails or does
+// not answer within rateLimitStoreTimeout, the request is allowed rather than
+// failing the API along with the store.
+func (rl *RateLimiter) take(ctx context.Context, scope, id string, rateLimit float64) rateLimitDecision {
+	decision := rateLimitDecision{rate: rateLimit, burst: rateLimit}
+
+	ctx, cancel := context.WithTimeout(ctx, rateLimitStoreTimeout)
+	defer cancel()
+
+	allowed, remaining, err := rl.store.Take(ctx, scope+":"+id, rateLimit, rateLimit)
+	if err != nil {
+		slog.Warn("rate limit store unavailable, allowing request", "scope", scope, "error", err)
+		decision.allowed = true
+		return decision
+	}
 
-	return rl
+	decision.allowed = allowed
+	decision.known = true
+	decision.remaining = remaining
+	if !allowed {
+		rateLimitRejectionsTotal.WithLabelValues(scope).Inc()
+	}
+	return decision
 }
 
-// cleanup periodically removes stale buckets to prevent memory leaks
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for id, bucket := range rl.buckets {
-			// Remove buckets that haven't been used in the last hour
-			if now.Sub(bucket.lastTime) > time.Hour {
-				delete(rl.buckets, id)
-			}
-		}
-		for ip, bucket := range rl.ipBuckets {
-			// Remove buckets that haven't been used in the last hour
-			if now.Sub(bucket.lastTime) > time.Hour {
-				delete(rl.ipBuckets, ip)
-			}
-		}
-		rl.mu.Unlock()
+// writeHeaders sets the RateLimit-* headers describing the client's bucket, and
+// Retry-After when the request was rejected.
+func (d rateLimitDecision) writeHeaders(w http.ResponseWriter) {
+	if !d.known || d.rate <= 0 {
+		return
+	}
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(int(d.burst)))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(d.remaining)))))
+	h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil((d.burst-d.remaining)/d.rate))))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=1", int(d.burst)))
+	if !d.allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil((1-d.remaining)/d.rate)))))
 	}
 }
 
@@ -84,12 +115,12 @@ func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 				return
 			}
 
-			// 2. Check token bucket
-			allowed := rl.allow(apiKeyID, float64(rateLimit))
+			// 2. Take a token from the key's bucket
+			decision := rl.take(r.Context(), "api_key", apiKeyID.String(), float64(rateLimit))
+			decision.writeHeaders(w)
 
 			// 3. If rate limited: return 429 Too Many Requests
-			if !allowed {
-				w.Header().Set("Retry-After", "1")
+			if !decision.allowed {
 				WriteError(w,
 					fmt.Errorf("rate limit exceeded: %d requests per second", rateLimit),
 					http.StatusTooManyRequests,
@@ -98,7 +129,7 @@ func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 				return
 			}
 
-			// 5. Call next handler (token already consumed in allow method)
+			// 4. Call next handler (token already taken)
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -106,92 +137,8 @@ func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 
 // allow checks if a request is allowed based on the token bucket algorithm
 // Returns true if the request is allowed, false if rate limited
-func (rl *RateLimiter) allow(apiKeyID uuid.UUID, rateLimit float64) bool {
-	now := time.Now()
-
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	bucket, exists := rl.buckets[apiKeyID]
-	if !exists {
-		// Create new bucket with full capacity
-		bucket = &tokenBucket{
-			tokens:    rateLimit, // Start with full bucket
-			lastTime:  now,
-			rateLimit: rateLimit,
-		}
-		rl.buckets[apiKeyID] = bucket
-	}
-
-	// Update rate limit if changed
-	if bucket.rateLimit != rateLimit {
-		bucket.rateLimit = rateLimit
-	}
-
-	// Calculate tokens to add based on time elapsed
-	elapsed := now.Sub(bucket.lastTime).Seconds()
-	bucket.tokens += elapsed * bucket.rateLimit
-
-	// Cap at rate limit (bucket capacity = 1 second worth of requests)
-	if bucket.tokens > bucket.rateLimit {
-		bucket.tokens = bucket.rateLimit
-	}
-
-	bucket.lastTime = now
-
-	// Check if we have at least one token
-	if bucket.tokens >= 1.0 {
-		// 4. Consume token
-		bucket.tokens -= 1.0
-		return true
-	}
-
-	return false
-}
-
-// allowIP checks if a request from an IP is allowed based on the token bucket algorithm
-// Returns true if the request is allowed, false if rate limited
-func (rl *RateLimiter) allowIP(ip string, rateLimit float64) bool {
-	now := time.Now()
-
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	bucket, exists := rl.ipBuckets[ip]
-	if !exists {
-		// Create new bucket with full capacity
-		bucket = &tokenBucket{
-			tokens:    rateLimit, // Start with full bucket
-			lastTime:  now,
-			rateLimit: rateLimit,
-		}
-		rl.ipBuckets[ip] = bucket
-	}
-
-	// Update rate limit if changed
-	if bucket.rateLimit != rateLimit {
-		bucket.rateLimit = rateLimit
-	}
-
-	// Calculate tokens to add based on time elapsed
-	elapsed := now.Sub(bucket.lastTime).Seconds()
-	bucket.tokens += elapsed * bucket.rateLimit
-
-	// Cap at rate limit (bucket capacity = 1 second worth of requests)
-	if bucket.tokens > bucket.rateLimit {
-		bucket.tokens = bucket.rateLimit
-	}
-
-	bucket.lastTime = now
-
-	// Check if we have at least one token
-	if bucket.tokens >= 1.0 {
-		// Consume token
-		bucket.tokens -= 1.0
-		return true
-	}
-
-	return false
+func (rl *RateLimiter) allow(ctx context.Context, apiKeyID uuid.UUID, rateLimit float64) bool {
+	return rl.take(ctx, "api_key", apiKeyID.String(), rateLimit).allowed
 }
 
 // IPMiddleware creates rate limiting middleware based on client IP
@@ -205,7 +152,9 @@ func (rl *RateLimiter) IPMiddleware() func(http.Handler) http.Handler {
 			}
 
 			// Check rate limit (10 requests per second per IP)
-			if !rl.allowIP(ip, 10) {
+			decision := rl.take(r.Context(), "ip", ip, 10)
+			decision.writeHeaders(w)
+			if !decision.allowed {
 				WriteError(w, fmt.Errorf("rate limit exceeded"), http.StatusTooManyRequests, "RATE_LIMIT_EXCEEDED")
 				return
 			}
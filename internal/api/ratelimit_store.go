@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Buckets unused for rateLimitBucketIdle are removed every rateLimitPruneInterval.
+// A bucket idle that long has refilled, so removing it changes no decision.
+const (
+	rateLimitBucketIdle    = time.Hour
+	rateLimitPruneInterval = 5 * time.Minute
+)
+
+// MemoryRateLimitStore keeps token buckets in process memory.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket implements the token bucket algorithm for rate limiting
+type tokenBucket struct {
+	tokens   float64
+	lastTime time.Time
+}
+
+// NewMemoryRateLimitStore creates a MemoryRateLimitStore and starts removing
+// idle buckets in the background.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	s := &MemoryRateLimitStore{
+		buckets: make(map[string]*tokenBucket),
+	}
+
+	// Start cleanup goroutine to remove stale buckets
+	go s.cleanup()
+
+	return s
+}
+
+// cleanup periodically removes stale buckets to prevent memory leaks
+func (s *MemoryRateLimitStore) cleanup() {
+	ticker := time.NewTicker(rateLimitPruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		for key, bucket := range s.buckets {
+			if now.Sub(bucket.lastTime) > rateLimitBucketIdle {
+				delete(s.buckets, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, rate, burst float64) (bool, float64, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, exists := s.buckets[key]
+	if !exists {
+		// Create new bucket with full capacity
+		bucket = &tokenBucket{
+			tokens:   burst,
+			lastTime: now,
+		}
+		s.buckets[key] = bucket
+	}
+
+	// Refill based on time elapsed, capped at the bucket capacity
+	elapsed := now.Sub(bucket.lastTime).Seconds()
+	bucket.tokens = min(burst, bucket.tokens+elapsed*rate)
+	bucket.lastTime = now
+
+	// Check if we have at least one token
+	if bucket.tokens >= 1.0 {
+		bucket.tokens -= 1.0
+		return true, bucket.tokens, nil
+	}
+
+	return false, bucket.tokens, nil
+}
+
+// PostgresRateLimitStore keeps token buckets in the rate_limit_buckets table,
+// so all replicas sharing the database enforce the same limits.
+type PostgresRateLimitStore struct {
+	db DBClient
+}
+
+// NewPostgresRateLimitStore creates a PostgresRateLimitStore.
+func NewPostgresRateLimitStore(db DBClient) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+// Take implements RateLimitStore.
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, rate, burst float64) (bool, float64, error) {
+	return s.db.TakeRateLimitToken(ctx, key, rate, burst)
+}
+
+// Run removes idle buckets periodically until ctx is cancelled.
+func (s *PostgresRateLimitStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(rateLimitPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.db.PruneRateLimitBuckets(ctx, time.Now().Add(-rateLimitBucketIdle))
+		if err != nil {
+			slog.Warn("failed to prune rate limit buckets", "error", err)
+		} else if n > 0 {
+			slog.Debug("pruned rate limit buckets", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
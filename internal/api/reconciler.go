@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+)
+
+const (
+	// reconcileInterval is how often the database is compared against the backend.
+	reconcileInterval = time.Minute
+
+	// orphanGracePeriod is how old a backend session without a database row must be
+	// before it is destroyed. Sessions are created on the backend before their row
+	// is written, so younger ones may still be in the middle of CreateSession.
+	orphanGracePeriod = 5 * time.Minute
+)
+
+// ReconcileResult describes what a single reconciliation pass fixed.
+type ReconcileResult struct {
+	Checked          int // Active sessions compared against the backend
+	Started          int // Pending sessions the backend reports running
+	Ended            int // Active sessions whose pod or machine exited or disappeared
+	OrphansDestroyed int // Backend sessions without a database row that were destroyed
+}
+
+// ReconcilerStats are cumulative counters over all reconciliation passes.
+type ReconcilerStats struct {
+	Runs             int64
+	Failures         int64
+	Started          int64
+	Ended            int64
+	OrphansDestroyed int64
+	LastRunAt        time.Time
+}
+
+// Reconciler periodically brings session rows in line with the backend, so
+// sessions whose pod or machine dies are noticed without anyone calling
+// GetSession, and destroys backend sessions the database knows nothing about.
+type Reconciler struct {
+	db         DBClient
+	backend    Backend
+	supervisor *SessionSupervisor
+	budget     *BudgetMonitor
+	webhooks   *WebhookDispatcher
+	events     *EventLog
+
+	mu    sync.Mutex
+	stats ReconcilerStats
+}
+
+// NewReconciler creates a new Reconciler.
+func NewReconciler(db DBClient, backend Backend) *Reconciler {
+	return &Reconciler{
+		db:      db,
+		backend: backend,
+	}
+}
+
+// SetSupervisor sets the supervisor whose deadlines are dropped for sessions
+// the reconciler ends.
+func (r *Reconciler) SetSupervisor(supervisor *SessionSupervisor) {
+	r.supervisor = supervisor
+}
+
+// SetBudgetMonitor sets the monitor that re-checks an account's spend when the
+// reconciler ends one of its sessions.
+func (r *Reconciler) SetBudgetMonitor(budget *BudgetMonitor) {
+	r.budget = budget
+}
+
+// SetWebhooks sets the dispatcher that publishes events for sessions the
+// reconciler sees start or end.
+func (r *Reconciler) SetWebhooks(webhooks *WebhookDispatcher) {
+	r.webhooks = webhooks
+}
+
+// SetEvents sets the log that status transitions the reconciler sees are
+// recorded in.
+func (r *Reconciler) SetEvents(events *EventLog) {
+	r.events = events
+}
+
+// Stats returns the counters accumulated so far.
+func (r *Reconciler) Stats() ReconcilerStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// Run reconciles now and then every reconcileInterval. It blocks until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		result, err := r.Reconcile(ctx)
+		if err != nil {
+			slog.Warn("failed to reconcile sessions", "error", err)
+		} else if result.Started > 0 || result.Ended > 0 || result.OrphansDestroyed > 0 {
+			slog.Info("reconciled sessions",
+				"checked", result.Checked,
+				"started", result.Started,
+				"ended", result.Ended,
+				"orphans_destroyed", result.OrphansDestroyed,
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile runs a single pass: active sessions take the status the backend
+// reports, and sessions missing from the backend are marked failed. Backend
+// sessions older than orphanGracePeriod with no database row are destroyed.
+// Failures on individual sessions are logged and do not stop the pass.
+func (r *Reconciler) Reconcile(ctx context.Context) (ReconcileResult, error) {
+	result, err := r.reconcile(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats.Runs++
+	r.stats.LastRunAt = time.Now().UTC()
+	if err != nil {
+		r.stats.Failures++
+		return result, err
+	}
+	r.stats.Started += int64(result.Started)
+	r.stats.Ended += int64(result.Ended)
+	r.stats.OrphansDestroyed += int64(result.OrphansDestroyed)
+	return result, nil
+}
+
+func (r *Reconciler) reconcile(ctx context.Context) (ReconcileResult, error) {
+	var result ReconcileResult
+
+	// Read rows before listing the backend: every row read here had its backend
+	// session created first, so one missing from the listing is really gone
+	sessions, err := r.db.ListActiveSessions(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	backendSessions, err := r.backend.ListSessions(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	live := make(map[string]*Session, len(backendSessions))
+	for _, bs := range backendSessions {
+		live[bs.BackendID] = bs
+	}
+
+	now := time.Now().UTC()
+	tracked := make(map[string]bool, len(sessions))
+	for i := range sessions {
+		session := &sessions[i]
+		backendID := session.GetBackendID()
+		if backendID == "" {
+			continue
+		}
+		tracked[backendID] = true
+		result.Checked++
+
+		update := r.sessionUpdate(session, live[backendID], now)
+		if update == nil || !r.apply(ctx, session, update) {
+			continue
+		}
+		if *update.Status == SessionStatusRunning {
+			result.Started++
+		} else {
+			result.Ended++
+		}
+	}
+
+	// Backend sessions whose row is no longer active may still have one
+	var candidates []string
+	for _, bs := range backendSessions {
+		if !tracked[bs.BackendID] && now.Sub(bs.CreatedAt) > orphanGracePeriod {
+			candidates = append(candidates, bs.BackendID)
+		}
+	}
+	known, err := r.db.FilterKnownBackendIDs(ctx, candidates)
+	if err != nil {
+		return result, fmt.Errorf("failed to look up backend sessions: %w", err)
+	}
+	for _, id := range known {
+		tracked[id] = true
+	}
+
+	for _, backendID := range candidates {
+		if tracked[backendID] {
+			continue
+		}
+		if err := r.backend.DestroySession(ctx, backendID); err != nil {
+			slog.Warn("failed to destroy orphaned session", "error", err, "backend_id", backendID)
+			continue
+		}
+		slog.Info("destroyed orphaned session", "backend_id", backendID)
+		result.OrphansDestroyed++
+	}
+
+	return result, nil
+}
+
+// Observe applies a status change reported by the backend as it happens, so
+// session events do not wait for the next pass. Backends that can watch their
+// sessions call it with the backend ID, the new status and, for sessions that
+// ended, the exit code. Changes for sessions that are no longer active are ignored.
+func (r *Reconciler) Observe(backendID, status string, exitCode *int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	session, err := r.db.GetActiveSessionByBackendID(ctx, backendID)
+	if err != nil {
+		// Not written yet, or already ended by whoever stopped it
+		return
+	}
+
+	bs := &Session{BackendID: backendID, Status: status, ExitCode: exitCode}
+	update := r.sessionUpdate(session, bs, time.Now().UTC())
+	if update == nil {
+		return
+	}
+	r.apply(ctx, session, update)
+}
+
+// apply writes update to an active session and publishes the transition.
+// It reports whether the update was written.
+func (r *Reconciler) apply(ctx context.Context, session *db.Session, update *db.SessionUpdate) bool {
+	from := session.Status
+	if err := r.db.UpdateSession(ctx, session.ID, update); err != nil {
+		slog.Warn("failed to update reconciled session", "error", err, "session_id", session.ID)
+		return false
+	}
+	observeSessionUpdate(from, update)
+	r.events.RecordSessionUpdate(ctx, session, from, update)
+	r.webhooks.PublishSessionUpdate(ctx, session, from, update)
+	r.budget.SessionUpdated(ctx, session, update)
+
+	if *update.Status != SessionStatusRunning && r.supervisor != nil {
+		r.supervisor.Forget(session.ID)
+	}
+	return true
+}
+
+// sessionUpdate returns the update that brings an active session in line with
+// its backend session, or nil if nothing changed. A nil backend session means
+// the pod or machine is gone.
+func (r *Reconciler) sessionUpdate(session *db.Session, bs *Session, now time.Time) *db.SessionUpdate {
+	if bs == nil {
+		return endSessionUpdate(session, SessionStatusFailed, now)
+	}
+
+	switch bs.Status {
+	case SessionStatusRunning:
+		if session.Status != SessionStatusPending {
+			return nil
+		}
+		status := SessionStatusRunning
+		return &db.SessionUpdate{Status: &status, StartedAt: &now}
+
+	case SessionStatusStopped, SessionStatusFailed, SessionStatusKilled:
+		update := endSessionUpdate(session, bs.Status, now)
+		update.ExitCode = bs.ExitCode
+		return update
+
+	default:
+		// Still starting or shutting down
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/google/uuid"
+)
+
+func newReconcileSession(mockDB *mockHandlerDB, id, backendID, status string) {
+	mockDB.sessions[id] = &db.Session{
+		ID:        id,
+		APIKeyID:  uuid.New(),
+		BackendID: &backendID,
+		Status:    status,
+		CreatedAt: time.Now().UTC().Add(-10 * time.Minute),
+	}
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	newReconcileSession(mockDB, "sess_pending", "pod_pending", SessionStatusPending)
+	newReconcileSession(mockDB, "sess_running", "pod_running", SessionStatusRunning)
+	newReconcileSession(mockDB, "sess_exited", "pod_exited", SessionStatusRunning)
+	newReconcileSession(mockDB, "sess_gone", "pod_gone", SessionStatusRunning)
+	newReconcileSession(mockDB, "sess_stopped", "pod_stopped", SessionStatusStopped)
+
+	exitCode := 2
+	old := time.Now().Add(-time.Hour)
+	mockBackend := &mockBackendHandler{listed: []*Session{
+		{BackendID: "pod_pending", Status: SessionStatusRunning, CreatedAt: old},
+		{BackendID: "pod_running", Status: SessionStatusRunning, CreatedAt: old},
+		{BackendID: "pod_exited", Status: SessionStatusStopped, ExitCode: &exitCode, CreatedAt: old},
+		{BackendID: "pod_stopped", Status: SessionStatusStopped, CreatedAt: old},
+		{BackendID: "pod_orphan", Status: SessionStatusRunning, CreatedAt: old},
+		{BackendID: "pod_creating", Status: SessionStatusPending, CreatedAt: time.Now()},
+	}}
+	reconciler := NewReconciler(mockDB, mockBackend)
+
+	result, err := reconciler.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+
+	want := ReconcileResult{Checked: 4, Started: 1, Ended: 2, OrphansDestroyed: 1}
+	if result != want {
+		t.Errorf("expected result %+v, got %+v", want, result)
+	}
+
+	if s := mockDB.sessions["sess_pending"]; s.Status != SessionStatusRunning || s.StartedAt == nil {
+		t.Errorf("expected pending session to be running with started_at, got %s", s.Status)
+	}
+	if s := mockDB.sessions["sess_running"]; s.Status != SessionStatusRunning {
+		t.Errorf("expected running session to be unchanged, got %s", s.Status)
+	}
+	if s := mockDB.sessions["sess_exited"]; s.Status != SessionStatusStopped || s.ExitCode == nil || *s.ExitCode != 2 || s.EndedAt == nil {
+		t.Errorf("expected exited session stopped with exit code 2, got %s %v", s.Status, s.ExitCode)
+	}
+	if s := mockDB.sessions["sess_gone"]; s.Status != SessionStatusFailed || s.EndedAt == nil {
+		t.Errorf("expected vanished session to be failed, got %s", s.Status)
+	}
+
+	// Only the old untracked pod goes; the stopped session's pod still has a row
+	if len(mockBackend.destroyed) != 1 || mockBackend.destroyed[0] != "pod_orphan" {
+		t.Errorf("expected only pod_orphan to be destroyed, got %v", mockBackend.destroyed)
+	}
+
+	stats := reconciler.Stats()
+	if stats.Runs != 1 || stats.Started != 1 || stats.Ended != 2 || stats.OrphansDestroyed != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestReconciler_Reconcile_BackendListFails(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	newReconcileSession(mockDB, "sess_running", "pod_running", SessionStatusRunning)
+	reconciler := NewReconciler(mockDB, &mockBackendHandler{listErr: errors.New("api server unavailable")})
+
+	if _, err := reconciler.Reconcile(context.Background()); err == nil {
+		t.Fatal("expected error when the backend cannot be listed")
+	}
+
+	// Without a listing nothing may be marked as gone
+	if s := mockDB.sessions["sess_running"]; s.Status != SessionStatusRunning {
+		t.Errorf("expected session to be left running, got %s", s.Status)
+	}
+	if stats := reconciler.Stats(); stats.Runs != 1 || stats.Failures != 1 {
+		t.Errorf("expected one failed run, got %+v", stats)
+	}
+}
+
+func TestReconciler_Observe(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	newReconcileSession(mockDB, "sess_pending", "pod_pending", SessionStatusPending)
+	newReconcileSession(mockDB, "sess_stopped", "pod_stopped", SessionStatusStopped)
+	reconciler := NewReconciler(mockDB, &mockBackendHandler{})
+	events := NewEventLog(mockDB)
+	reconciler.SetEvents(events)
+
+	reconciler.Observe("pod_pending", SessionStatusRunning, nil)
+	if s := mockDB.sessions["sess_pending"]; s.Status != SessionStatusRunning || s.StartedAt == nil {
+		t.Fatalf("expected session to be running with started_at, got %s", s.Status)
+	}
+
+	exitCode := 1
+	reconciler.Observe("pod_pending", SessionStatusFailed, &exitCode)
+	if s := mockDB.sessions["sess_pending"]; s.Status != SessionStatusFailed || s.ExitCode == nil || *s.ExitCode != 1 {
+		t.Fatalf("expected session to be failed with exit code 1, got %s %v", s.Status, s.ExitCode)
+	}
+
+	// Ended sessions and unknown pods are left alone
+	reconciler.Observe("pod_stopped", SessionStatusRunning, nil)
+	reconciler.Observe("pod_unknown", SessionStatusRunning, nil)
+	if s := mockDB.sessions["sess_stopped"]; s.Status != SessionStatusStopped {
+		t.Errorf("expected stopped session to be unchanged, got %s", s.Status)
+	}
+
+	recorded, _ := mockDB.ListSessionEvents(context.Background(), uuid.Nil, 0, 10)
+	if len(recorded) != 2 || recorded[0].Type != EventSessionRunning || recorded[1].Type != EventSessionExited {
+		t.Errorf("expected running and exited events, got %+v", recorded)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"slices"
+
+	"github.com/burka/execbox-cloud/internal/db"
+)
+
+// Sets of roles allowed to call an operation.
+var (
+	allRoles       = []string{RoleOwner, RoleAdmin, RoleDeveloper, RoleBillingViewer}
+	developerRoles = []string{RoleOwner, RoleAdmin, RoleDeveloper}
+	managerRoles   = []string{RoleOwner, RoleAdmin}
+	ownerRoles     = []string{RoleOwner}
+)
+
+// operationRoles lists the roles allowed to call each authenticated huma
+// operation, by operation ID. Operations not listed, such as sessions and
+// builds, are open to developerRoles.
+var operationRoles = map[string][]string{
+	// Account, usage and limits
+	"getAccount":          allRoles,
+	"updateAccount":       managerRoles,
+	"getUsage":            allRoles,
+	"getEnhancedUsage":    allRoles,
+	"getAccountLimits":    allRoles,
+	"updateAccountLimits": ownerRoles,
+	"exportUsage":         allRoles,
+
+	// Every member manages their own keys; the handlers check which keys
+	"listAPIKeys":  allRoles,
+	"createAPIKey": allRoles,
+	"getAPIKey":    allRoles,
+	"updateAPIKey": allRoles,
+	"deleteAPIKey": allRoles,
+	"rotateAPIKey": allRoles,
+
+	// Webhooks are read by developers but only changed by managers
+	"createWebhook": managerRoles,
+	"updateWebhook": managerRoles,
+	"deleteWebhook": managerRoles,
+
+	// Members and invitations
+	"listMembers":      allRoles,
+	"updateMember":     managerRoles,
+	"removeMember":     managerRoles,
+	"listInvitations":  managerRoles,
+	"createInvitation": managerRoles,
+	"deleteInvitation": managerRoles,
+
+	// The audit log shows every member's actions
+	"listAuditLog":   managerRoles,
+	"exportAuditLog": managerRoles,
+}
+
+// roleAllowed reports whether a role may call the operation with the given ID.
+func roleAllowed(role, operationID string) bool {
+	roles, ok := operationRoles[operationID]
+	if !ok {
+		roles = developerRoles
+	}
+	return slices.Contains(roles, role)
+}
+
+// isValidRole reports whether role is a known member role.
+func isValidRole(role string) bool {
+	return slices.Contains(allRoles, role)
+}
+
+// isManager reports whether a role may manage the account's members and all of its keys.
+func isManager(role string) bool {
+	return slices.Contains(managerRoles, role)
+}
+
+// keyRole returns the role an API key acts with: the role of the member it was
+// issued to. Keys without a member predate members; the primary key acts as
+// owner and other keys as developer.
+func keyRole(key *db.APIKey) string {
+	if key.MemberRole != nil {
+		return *key.MemberRole
+	}
+	if key.ParentKeyID == nil {
+		return RoleOwner
+	}
+	return RoleDeveloper
+}
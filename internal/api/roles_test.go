@@ -0,0 +1,58 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/google/uuid"
+)
+
+func TestRoleAllowed(t *testing.T) {
+	tests := []struct {
+		role        string
+		operationID string
+		want        bool
+	}{
+		{RoleBillingViewer, "getUsage", true},
+		{RoleBillingViewer, "createSession", false},
+		{RoleDeveloper, "createSession", true},
+		{RoleDeveloper, "updateAccount", false},
+		{RoleAdmin, "updateAccount", true},
+		{RoleAdmin, "updateAccountLimits", false},
+		{RoleOwner, "updateAccountLimits", true},
+		{RoleDeveloper, "listWebhooks", true},
+		{RoleDeveloper, "createWebhook", false},
+		{RoleDeveloper, "createInvitation", false},
+		{RoleAdmin, "createInvitation", true},
+		{"", "createSession", false},
+	}
+
+	for _, tt := range tests {
+		if got := roleAllowed(tt.role, tt.operationID); got != tt.want {
+			t.Errorf("roleAllowed(%q, %q) = %v, want %v", tt.role, tt.operationID, got, tt.want)
+		}
+	}
+}
+
+func TestKeyRole(t *testing.T) {
+	parentID := uuid.New()
+	admin := RoleAdmin
+
+	tests := []struct {
+		name string
+		key  *db.APIKey
+		want string
+	}{
+		{"member role", &db.APIKey{ParentKeyID: &parentID, MemberRole: &admin}, RoleAdmin},
+		{"primary key without member", &db.APIKey{}, RoleOwner},
+		{"sub-key without member", &db.APIKey{ParentKeyID: &parentID}, RoleDeveloper},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyRole(tt.key); got != tt.want {
+				t.Errorf("keyRole() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
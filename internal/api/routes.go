@@ -3,6 +3,7 @@ package api
 import (
 	gocontext "context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -14,12 +15,19 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
 	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Services holds all the service instances used by the API.
 type Services struct {
 	Session *SessionService
+	Build   *BuildService
 	Account *AccountService
+	Webhook *WebhookService
+	Member  *MemberService
+	Audit   *AuditService
 	Quota   *QuotaService
 	DB      *db.Client
 }
@@ -36,6 +44,9 @@ func RegisterRoutes(router *chi.Mux, services *Services, rateLimiter *RateLimite
 
 	humaAPI := humachi.New(router, config)
 
+	// Count requests and record latency per operation
+	humaAPI.UseMiddleware(metricsMiddleware)
+
 	// Initialize security schemes
 	if humaAPI.OpenAPI().Components.SecuritySchemes == nil {
 		humaAPI.OpenAPI().Components.SecuritySchemes = make(map[string]*huma.SecurityScheme)
@@ -111,6 +122,18 @@ func registerPublicRoutes(humaAPI huma.API, router *chi.Mux, services *Services,
 		DefaultStatus: 201,
 		Middlewares:   huma.Middlewares{ipLimitedMiddleware},
 	}, services.Quota.CreateQuotaRequest)
+
+	// POST /v1/invitations/accept - Accept an invitation to an account (public, the token authenticates)
+	huma.Register(humaAPI, huma.Operation{
+		OperationID:   "acceptInvitation",
+		Method:        "POST",
+		Path:          "/v1/invitations/accept",
+		Summary:       "Accept invitation",
+		Description:   "Joins an account with an invitation token. Returns the new member and their first API key, which is only shown once.",
+		Tags:          []string{"Members"},
+		DefaultStatus: 201,
+		Middlewares:   huma.Middlewares{ipLimitedMiddleware},
+	}, services.Member.AcceptInvitation)
 }
 
 // registerAuthenticatedRoutes registers endpoints that require authentication.
@@ -126,12 +149,23 @@ func registerAuthenticatedRoutes(humaAPI huma.API, router *chi.Mux, services *Se
 		Method:      "GET",
 		Path:        "/v1/account",
 		Summary:     "Get account information",
-		Description: "Returns account information including tier, email, and API key details.",
+		Description: "Returns the account owning the API key, with its name, email and tier, and details of the key.",
 		Tags:        []string{"Account"},
 		Security:    securityRequirement,
 		Middlewares: huma.Middlewares{authMiddleware},
 	}, services.Account.GetAccount)
 
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "updateAccount",
+		Method:      "PATCH",
+		Path:        "/v1/account",
+		Summary:     "Update account",
+		Description: "Updates the account name and email. Only provided fields are changed. Requires the owner or admin role.",
+		Tags:        []string{"Account"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Account.UpdateAccount)
+
 	huma.Register(humaAPI, huma.Operation{
 		OperationID: "getUsage",
 		Method:      "GET",
@@ -170,7 +204,7 @@ func registerAuthenticatedRoutes(humaAPI huma.API, router *chi.Mux, services *Se
 		Method:      "PUT",
 		Path:        "/v1/account/limits",
 		Summary:     "Update account limits",
-		Description: "Updates account-level limits. Only specified fields will be modified.",
+		Description: "Updates account-level limits. Only specified fields will be modified. Requires the owner role.",
 		Tags:        []string{"Account"},
 		Security:    securityRequirement,
 		Middlewares: huma.Middlewares{authMiddleware},
@@ -245,6 +279,63 @@ func registerAuthenticatedRoutes(humaAPI huma.API, router *chi.Mux, services *Se
 		Middlewares:   huma.Middlewares{authMiddleware},
 	}, services.Session.KillSession)
 
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "execSession",
+		Method:      "POST",
+		Path:        "/v1/sessions/{id}/exec",
+		Summary:     "Run a command in a session",
+		Description: "Runs a one-shot command inside a running session and returns stdout, stderr and the exit code. The call is bounded by a per-call timeout (default 30s, max 5m).",
+		Tags:        []string{"Sessions"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware, writeDeadlineMiddleware},
+	}, services.Session.ExecSession)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "getSessionURL",
+		Method:      "GET",
+		Path:        "/v1/sessions/{id}/url",
+		Summary:     "Get URL for an exposed port",
+		Description: "Returns a reachable URL for a container port of a running session created with network mode 'exposed'. The port must have been declared in the session's ports. On Kubernetes the URL is a port forward bound to the API server's loopback interface, so it is only reachable from that host; Fly returns 501.",
+		Tags:        []string{"Sessions"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Session.GetSessionURL)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "listFiles",
+		Method:      "GET",
+		Path:        "/v1/sessions/{id}/files",
+		Summary:     "List files in a session",
+		Description: "Lists the entries of a directory inside a running session.",
+		Tags:        []string{"Sessions"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Session.ListFiles)
+
+	// Image build operations
+	huma.Register(humaAPI, huma.Operation{
+		OperationID:   "createBuild",
+		Method:        "POST",
+		Path:          "/v1/builds",
+		Summary:       "Start an image build",
+		Description:   "Starts building a custom image from a base image, setup commands and files. Returns immediately with a build ID; poll the build until it is ready, then pass its ID as buildId when creating sessions.",
+		Tags:          []string{"Builds"},
+		Security:      securityRequirement,
+		DefaultStatus: 202,
+		Middlewares:   huma.Middlewares{authMiddleware},
+	}, services.Build.CreateBuild)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "getBuild",
+		Method:      "GET",
+		Path:        "/v1/builds/{id}",
+		Summary:     "Get build status",
+		Description: "Returns the build phase (queued, building, pushing, ready or failed), the image reference once ready, and the tail of the builder log.",
+		Tags:        []string{"Builds"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Build.GetBuild)
+
 	// API Key management operations
 	huma.Register(humaAPI, huma.Operation{
 		OperationID: "listAPIKeys",
@@ -285,7 +376,7 @@ func registerAuthenticatedRoutes(humaAPI huma.API, router *chi.Mux, services *Se
 		Method:      "PUT",
 		Path:        "/v1/account/keys/{id}",
 		Summary:     "Update API key",
-		Description: "Updates an API key's name, description, limits, or expiration. Only specified fields are modified.",
+		Description: "Updates an API key's name, description, limits, or expiration. Only specified fields are modified. Owners and admins manage every key, other members only their own; only owners change the primary key.",
 		Tags:        []string{"API Keys"},
 		Security:    securityRequirement,
 		Middlewares: huma.Middlewares{authMiddleware},
@@ -308,60 +399,294 @@ func registerAuthenticatedRoutes(humaAPI huma.API, router *chi.Mux, services *Se
 		Method:        "POST",
 		Path:          "/v1/account/keys/{id}/rotate",
 		Summary:       "Rotate API key",
-		Description:   "Generates a new key value for an API key while preserving its settings. The old key immediately becomes invalid.",
+		Description:   "Generates a new key value for an API key while preserving its settings. The old value becomes invalid immediately, or after overlap_seconds when given; every use of it during the overlap is audit-logged. Only owners rotate the primary key.",
 		Tags:          []string{"API Keys"},
 		Security:      securityRequirement,
 		DefaultStatus: 200,
 		Middlewares:   huma.Middlewares{authMiddleware},
 	}, services.Account.RotateAPIKey)
 
-	// Note: WebSocket attach endpoint (/v1/sessions/{id}/attach) is registered
-	// via chi directly in server.go because WebSocket upgrades don't work well
-	// with huma's response handling. OpenAPI docs for it should be added manually
+	// Webhook operations
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "listWebhooks",
+		Method:      "GET",
+		Path:        "/v1/account/webhooks",
+		Summary:     "List webhooks",
+		Description: "Returns all webhooks of the authenticated account.",
+		Tags:        []string{"Webhooks"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Webhook.ListWebhooks)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID:   "createWebhook",
+		Method:        "POST",
+		Path:          "/v1/account/webhooks",
+		Summary:       "Create webhook",
+		Description:   "Subscribes a URL to session and build events. Deliveries are signed with a secret that is only shown once in the response.",
+		Tags:          []string{"Webhooks"},
+		Security:      securityRequirement,
+		DefaultStatus: 201,
+		Middlewares:   huma.Middlewares{authMiddleware},
+	}, services.Webhook.CreateWebhook)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "getWebhook",
+		Method:      "GET",
+		Path:        "/v1/account/webhooks/{id}",
+		Summary:     "Get webhook",
+		Description: "Returns details for a specific webhook.",
+		Tags:        []string{"Webhooks"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Webhook.GetWebhook)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "updateWebhook",
+		Method:      "PUT",
+		Path:        "/v1/account/webhooks/{id}",
+		Summary:     "Update webhook",
+		Description: "Updates a webhook's URL, events, description, or active state. Only specified fields are modified.",
+		Tags:        []string{"Webhooks"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Webhook.UpdateWebhook)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID:   "deleteWebhook",
+		Method:        "DELETE",
+		Path:          "/v1/account/webhooks/{id}",
+		Summary:       "Delete webhook",
+		Description:   "Deletes a webhook and its delivery log. Pending deliveries are dropped.",
+		Tags:          []string{"Webhooks"},
+		Security:      securityRequirement,
+		DefaultStatus: 204,
+		Middlewares:   huma.Middlewares{authMiddleware},
+	}, services.Webhook.DeleteWebhook)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "listWebhookDeliveries",
+		Method:      "GET",
+		Path:        "/v1/account/webhooks/{id}/deliveries",
+		Summary:     "List webhook deliveries",
+		Description: "Returns the most recent deliveries of a webhook, newest first, with the status, attempts, and HTTP response of each.",
+		Tags:        []string{"Webhooks"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Webhook.ListWebhookDeliveries)
+
+	// Member operations
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "listMembers",
+		Method:      "GET",
+		Path:        "/v1/account/members",
+		Summary:     "List members",
+		Description: "Returns the members of the authenticated account with their roles.",
+		Tags:        []string{"Members"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Member.ListMembers)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "updateMember",
+		Method:      "PUT",
+		Path:        "/v1/account/members/{id}",
+		Summary:     "Change member role",
+		Description: "Changes a member's role. Requires the owner or admin role; only owners grant or change the owner role, and the account keeps at least one owner.",
+		Tags:        []string{"Members"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Member.UpdateMember)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID:   "removeMember",
+		Method:        "DELETE",
+		Path:          "/v1/account/members/{id}",
+		Summary:       "Remove member",
+		Description:   "Removes a member from the account and deactivates their API keys. Requires the owner or admin role; only owners remove owners.",
+		Tags:          []string{"Members"},
+		Security:      securityRequirement,
+		DefaultStatus: 204,
+		Middlewares:   huma.Middlewares{authMiddleware},
+	}, services.Member.RemoveMember)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "listInvitations",
+		Method:      "GET",
+		Path:        "/v1/account/invitations",
+		Summary:     "List invitations",
+		Description: "Returns the pending invitations to join the account. Requires the owner or admin role.",
+		Tags:        []string{"Members"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Member.ListInvitations)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID:   "createInvitation",
+		Method:        "POST",
+		Path:          "/v1/account/invitations",
+		Summary:       "Invite member",
+		Description:   "Invites an email address to join the account with a role. The invitation token is only shown once in the response and expires after 7 days. Requires the owner or admin role; only owners invite owners.",
+		Tags:          []string{"Members"},
+		Security:      securityRequirement,
+		DefaultStatus: 201,
+		Middlewares:   huma.Middlewares{authMiddleware},
+	}, services.Member.CreateInvitation)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID:   "deleteInvitation",
+		Method:        "DELETE",
+		Path:          "/v1/account/invitations/{id}",
+		Summary:       "Revoke invitation",
+		Description:   "Revokes a pending invitation. Requires the owner or admin role.",
+		Tags:          []string{"Members"},
+		Security:      securityRequirement,
+		DefaultStatus: 204,
+		Middlewares:   huma.Middlewares{authMiddleware},
+	}, services.Member.DeleteInvitation)
+
+	// Audit log operations
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "listAuditLog",
+		Method:      "GET",
+		Path:        "/v1/account/audit",
+		Summary:     "List audit log",
+		Description: "Returns the account's audit log newest first, filtered by actor, action and time range. Pass next_cursor from a response as cursor to get the next page. Requires the owner or admin role.",
+		Tags:        []string{"Audit"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Audit.ListAuditLog)
+
+	huma.Register(humaAPI, huma.Operation{
+		OperationID: "exportAuditLog",
+		Method:      "GET",
+		Path:        "/v1/account/audit/export",
+		Summary:     "Export audit log",
+		Description: "Returns every audit log entry matching the filters as a JSON or CSV download, up to 10000 entries. Requires the owner or admin role.",
+		Tags:        []string{"Audit"},
+		Security:    securityRequirement,
+		Middlewares: huma.Middlewares{authMiddleware},
+	}, services.Audit.ExportAuditLog)
+
+	// Note: WebSocket attach endpoint (/v1/sessions/{id}/attach) and raw file
+	// transfer endpoints (PUT/GET /v1/sessions/{id}/files/*) and the build log
+	// stream (/v1/builds/{id}/logs) are registered via chi directly in server.go
+	// because WebSocket upgrades, raw bodies and event streams
+	// don't work well with huma's response handling. OpenAPI docs for it should be added manually
 	// or via a separate schema definition.
 }
 
-// humaAuthMiddleware creates a huma middleware that validates the API key
-// and sets the API key ID and tier in the context.
+// humaAuthMiddleware creates a huma middleware that validates the API key,
+// sets the API key ID, tier, account and role in the context, and rejects
+// callers whose role may not call the operation (see operationRoles).
 func humaAuthMiddleware(dbClient DBClient) func(ctx huma.Context, next func(huma.Context)) {
 	return func(ctx huma.Context, next func(huma.Context)) {
+		authCtx, span := tracer.Start(ctx.Context(), "auth")
+		reject := func(msg, code string) {
+			span.SetStatus(codes.Error, msg)
+			span.End()
+			writeHumaUnauthorized(ctx, msg, code)
+		}
+
 		// Get the Authorization header
 		authHeader := ctx.Header("Authorization")
 		if authHeader == "" {
-			writeHumaUnauthorized(ctx, "missing authorization header")
+			reject("missing authorization header", CodeUnauthorized)
 			return
 		}
 
 		// Extract the API key from "Bearer <key>" format
 		if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
-			writeHumaUnauthorized(ctx, "invalid authorization header format")
+			reject("invalid authorization header format", CodeUnauthorized)
 			return
 		}
 		apiKey := authHeader[7:]
 
 		// Validate the API key
-		key, err := dbClient.GetAPIKeyByKey(ctx.Context(), apiKey)
+		key, err := authenticateAPIKey(authCtx, dbClient, apiKey)
 		if err != nil {
-			writeHumaUnauthorized(ctx, "invalid API key")
+			switch {
+			case errors.Is(err, ErrKeyExpired):
+				reject(err.Error(), CodeKeyExpired)
+			case errors.Is(err, ErrKeyInactive):
+				reject(err.Error(), CodeKeyInactive)
+			default:
+				reject("invalid API key", CodeUnauthorized)
+			}
 			return
 		}
 
-		// Set API key info in context
+		// Tag the auth span and the request span with the caller
+		callerAttrs := []attribute.KeyValue{
+			attribute.String("execbox.api_key_id", key.ID.String()),
+			attribute.String("execbox.tier", key.Tier),
+		}
+		span.SetAttributes(callerAttrs...)
+		span.End()
+		trace.SpanFromContext(ctx.Context()).SetAttributes(callerAttrs...)
+
+		// Set API key info, limit overrides, account, client IP, role and scopes in context
+		role := keyRole(key)
 		newCtx := WithAPIKeyID(ctx.Context(), key.ID)
 		newCtx = WithAPIKeyTier(newCtx, key.Tier)
+		newCtx = WithAPIKeyLimits(newCtx, APIKeyLimits{
+			DailySessions:      key.CustomDailyLimit,
+			ConcurrentSessions: key.CustomConcurrentLimit,
+		})
+		newCtx = WithAccountID(newCtx, key.AccountID)
+		newCtx = WithClientIP(newCtx, clientIP(ctx.RemoteAddr()))
+		newCtx = WithRole(newCtx, role)
+		if key.MemberID != nil {
+			newCtx = WithMemberID(newCtx, *key.MemberID)
+		}
+		if key.Scopes != nil {
+			newCtx = WithScopes(newCtx, key.Scopes)
+		}
+		if key.UsedRotatingKey {
+			recordRotatingKeyUse(newCtx, dbClient, key)
+		}
+
+		// Check the member's role and the key's scopes allow the operation
+		if op := ctx.Operation(); op != nil {
+			if !roleAllowed(role, op.OperationID) {
+				recordAudit(newCtx, dbClient, AuditAccessDenied, op.OperationID, map[string]string{"role": role})
+				writeHumaForbidden(ctx, fmt.Sprintf("role %s is not allowed to call %s", role, op.OperationID))
+				return
+			}
+			if scope, ok := operationScopes[op.OperationID]; ok && !scopeAllowed(key.Scopes, scope) {
+				recordAudit(newCtx, dbClient, AuditAccessDenied, op.OperationID, map[string]string{"scope": scope})
+				writeHumaForbidden(ctx, fmt.Sprintf("API key lacks the %s scope", scope))
+				return
+			}
+		}
 
 		// Create a new context wrapper with the updated context
 		next(&humaContextWrapper{inner: ctx, overrideCtx: newCtx})
 	}
 }
 
-// writeHumaUnauthorized writes a 401 Unauthorized response for huma middleware.
-func writeHumaUnauthorized(ctx huma.Context, msg string) {
+// writeHumaUnauthorized writes a 401 Unauthorized response with an error code for huma middleware.
+func writeHumaUnauthorized(ctx huma.Context, msg, code string) {
 	ctx.SetStatus(http.StatusUnauthorized)
 	ctx.SetHeader("Content-Type", "application/json")
+	_, _ = ctx.BodyWriter().Write([]byte(fmt.Sprintf(`{"error":"%s","code":"%s"}`, msg, code)))
+}
+
+// writeHumaForbidden writes a 403 Forbidden response for huma middleware.
+func writeHumaForbidden(ctx huma.Context, msg string) {
+	ctx.SetStatus(http.StatusForbidden)
+	ctx.SetHeader("Content-Type", "application/json")
 	_, _ = ctx.BodyWriter().Write([]byte(fmt.Sprintf(`{"error":"%s"}`, msg)))
 }
 
+// writeDeadlineMiddleware lets the handler extend the response's write
+// deadline past the server's write timeout (see extendWriteDeadline).
+func writeDeadlineMiddleware(ctx huma.Context, next func(huma.Context)) {
+	_, w := humachi.Unwrap(ctx)
+	rc := http.NewResponseController(w)
+	next(huma.WithContext(ctx, WithWriteDeadline(ctx.Context(), rc.SetWriteDeadline)))
+}
+
 // humaContextWrapper wraps a huma.Context with a custom gocontext.Context.
 type humaContextWrapper struct {
 	inner       huma.Context
@@ -369,23 +694,26 @@ type humaContextWrapper struct {
 }
 
 // Implement all huma.Context methods by delegating to inner, except Context()
-func (c *humaContextWrapper) Context() gocontext.Context              { return c.overrideCtx }
-func (c *humaContextWrapper) Operation() *huma.Operation              { return c.inner.Operation() }
-func (c *humaContextWrapper) TLS() *tls.ConnectionState               { return c.inner.TLS() }
-func (c *humaContextWrapper) Version() huma.ProtoVersion              { return c.inner.Version() }
-func (c *humaContextWrapper) Method() string                          { return c.inner.Method() }
-func (c *humaContextWrapper) Host() string                            { return c.inner.Host() }
-func (c *humaContextWrapper) RemoteAddr() string                      { return c.inner.RemoteAddr() }
-func (c *humaContextWrapper) URL() url.URL                            { return c.inner.URL() }
-func (c *humaContextWrapper) Param(name string) string                { return c.inner.Param(name) }
-func (c *humaContextWrapper) Query(name string) string                { return c.inner.Query(name) }
-func (c *humaContextWrapper) Header(name string) string               { return c.inner.Header(name) }
-func (c *humaContextWrapper) EachHeader(cb func(name, value string))  { c.inner.EachHeader(cb) }
-func (c *humaContextWrapper) BodyReader() io.Reader                   { return c.inner.BodyReader() }
-func (c *humaContextWrapper) GetMultipartForm() (*multipart.Form, error) { return c.inner.GetMultipartForm() }
-func (c *humaContextWrapper) SetReadDeadline(t time.Time) error       { return c.inner.SetReadDeadline(t) }
-func (c *humaContextWrapper) SetStatus(code int)                      { c.inner.SetStatus(code) }
-func (c *humaContextWrapper) Status() int                             { return c.inner.Status() }
-func (c *humaContextWrapper) SetHeader(name, value string)            { c.inner.SetHeader(name, value) }
-func (c *humaContextWrapper) AppendHeader(name, value string)         { c.inner.AppendHeader(name, value) }
-func (c *humaContextWrapper) BodyWriter() io.Writer                   { return c.inner.BodyWriter() }
+func (c *humaContextWrapper) Context() gocontext.Context             { return c.overrideCtx }
+func (c *humaContextWrapper) Unwrap() huma.Context                   { return c.inner }
+func (c *humaContextWrapper) Operation() *huma.Operation             { return c.inner.Operation() }
+func (c *humaContextWrapper) TLS() *tls.ConnectionState              { return c.inner.TLS() }
+func (c *humaContextWrapper) Version() huma.ProtoVersion             { return c.inner.Version() }
+func (c *humaContextWrapper) Method() string                         { return c.inner.Method() }
+func (c *humaContextWrapper) Host() string                           { return c.inner.Host() }
+func (c *humaContextWrapper) RemoteAddr() string                     { return c.inner.RemoteAddr() }
+func (c *humaContextWrapper) URL() url.URL                           { return c.inner.URL() }
+func (c *humaContextWrapper) Param(name string) string               { return c.inner.Param(name) }
+func (c *humaContextWrapper) Query(name string) string               { return c.inner.Query(name) }
+func (c *humaContextWrapper) Header(name string) string              { return c.inner.Header(name) }
+func (c *humaContextWrapper) EachHeader(cb func(name, value string)) { c.inner.EachHeader(cb) }
+func (c *humaContextWrapper) BodyReader() io.Reader                  { return c.inner.BodyReader() }
+func (c *humaContextWrapper) GetMultipartForm() (*multipart.Form, error) {
+	return c.inner.GetMultipartForm()
+}
+func (c *humaContextWrapper) SetReadDeadline(t time.Time) error { return c.inner.SetReadDeadline(t) }
+func (c *humaContextWrapper) SetStatus(code int)                { c.inner.SetStatus(code) }
+func (c *humaContextWrapper) Status() int                       { return c.inner.Status() }
+func (c *humaContextWrapper) SetHeader(name, value string)      { c.inner.SetHeader(name, value) }
+func (c *humaContextWrapper) AppendHeader(name, value string)   { c.inner.AppendHeader(name, value) }
+func (c *humaContextWrapper) BodyWriter() io.Writer             { return c.inner.BodyWriter() }
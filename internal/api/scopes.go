@@ -0,0 +1,92 @@
+package api
+
+import "slices"
+
+// allScopes lists every API key scope.
+var allScopes = []string{
+	ScopeSessionsCreate,
+	ScopeSessionsRead,
+	ScopeSessionsExec,
+	ScopeFilesWrite,
+	ScopeKeysManage,
+	ScopeUsageRead,
+	ScopeAccountManage,
+}
+
+// operationScopes maps each authenticated huma operation, by operation ID, to
+// the scope a scoped key needs to call it. Operations not listed, such as
+// getAccount, are open to every key.
+var operationScopes = map[string]string{
+	// Account, usage and limits
+	"updateAccount":       ScopeAccountManage,
+	"getUsage":            ScopeUsageRead,
+	"getEnhancedUsage":    ScopeUsageRead,
+	"getAccountLimits":    ScopeUsageRead,
+	"updateAccountLimits": ScopeAccountManage,
+	"exportUsage":         ScopeUsageRead,
+
+	// Sessions and builds
+	"createSession": ScopeSessionsCreate,
+	"listSessions":  ScopeSessionsRead,
+	"getSession":    ScopeSessionsRead,
+	"stopSession":   ScopeSessionsCreate,
+	"killSession":   ScopeSessionsCreate,
+	"execSession":   ScopeSessionsExec,
+	"getSessionURL": ScopeSessionsRead,
+	"listFiles":     ScopeSessionsRead,
+	"createBuild":   ScopeSessionsCreate,
+	"getBuild":      ScopeSessionsRead,
+
+	// API keys
+	"listAPIKeys":  ScopeKeysManage,
+	"createAPIKey": ScopeKeysManage,
+	"getAPIKey":    ScopeKeysManage,
+	"updateAPIKey": ScopeKeysManage,
+	"deleteAPIKey": ScopeKeysManage,
+	"rotateAPIKey": ScopeKeysManage,
+
+	// Webhooks, members and invitations
+	"listWebhooks":          ScopeAccountManage,
+	"createWebhook":         ScopeAccountManage,
+	"getWebhook":            ScopeAccountManage,
+	"updateWebhook":         ScopeAccountManage,
+	"deleteWebhook":         ScopeAccountManage,
+	"listWebhookDeliveries": ScopeAccountManage,
+	"listMembers":           ScopeAccountManage,
+	"updateMember":          ScopeAccountManage,
+	"removeMember":          ScopeAccountManage,
+	"listInvitations":       ScopeAccountManage,
+	"createInvitation":      ScopeAccountManage,
+	"deleteInvitation":      ScopeAccountManage,
+	"listAuditLog":          ScopeAccountManage,
+	"exportAuditLog":        ScopeAccountManage,
+}
+
+// isValidScope reports whether scope is a known API key scope.
+func isValidScope(scope string) bool {
+	return slices.Contains(allScopes, scope)
+}
+
+// scopeAllowed reports whether a key limited to scopes may use scope. A nil
+// list is an unrestricted key.
+func scopeAllowed(scopes []string, scope string) bool {
+	return scopes == nil || slices.Contains(scopes, scope)
+}
+
+// scopesCovered reports whether a key limited to held may hand out a key
+// limited to wanted: every wanted scope must be held. Only unrestricted keys
+// cover unrestricted ones.
+func scopesCovered(held, wanted []string) bool {
+	if held == nil {
+		return true
+	}
+	if wanted == nil {
+		return false
+	}
+	for _, scope := range wanted {
+		if !slices.Contains(held, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package api
+
+import "testing"
+
+func TestScopeAllowed(t *testing.T) {
+	if !scopeAllowed(nil, ScopeKeysManage) {
+		t.Error("expected an unrestricted key to have every scope")
+	}
+	scopes := []string{ScopeSessionsCreate, ScopeSessionsRead}
+	if !scopeAllowed(scopes, ScopeSessionsRead) {
+		t.Error("expected a held scope to be allowed")
+	}
+	if scopeAllowed(scopes, ScopeKeysManage) {
+		t.Error("expected a missing scope to be denied")
+	}
+}
+
+func TestScopesCovered(t *testing.T) {
+	ci := []string{ScopeSessionsCreate, ScopeSessionsRead, ScopeKeysManage}
+
+	tests := []struct {
+		name   string
+		held   []string
+		wanted []string
+		want   bool
+	}{
+		{"unrestricted hands out anything", nil, ci, true},
+		{"unrestricted hands out unrestricted", nil, nil, true},
+		{"subset", ci, []string{ScopeSessionsRead}, true},
+		{"same scopes", ci, ci, true},
+		{"extra scope", ci, []string{ScopeSessionsRead, ScopeUsageRead}, false},
+		{"scoped cannot hand out unrestricted", ci, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopesCovered(tt.held, tt.wanted); got != tt.want {
+				t.Errorf("scopesCovered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperationScopesAreValid(t *testing.T) {
+	for operationID, scope := range operationScopes {
+		if !isValidScope(scope) {
+			t.Errorf("operation %s requires unknown scope %q", operationID, scope)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/burka/execbox-cloud/internal/backend/fly"
 	"github.com/burka/execbox-cloud/internal/backend/k8s"
@@ -23,6 +25,8 @@ type Server struct {
 	backend     Backend
 	rateLimiter *RateLimiter
 	config      *Config
+
+	shutdownTracing func(context.Context) error
 }
 
 // Config holds all configuration for the server.
@@ -35,9 +39,10 @@ type Config struct {
 	Backend string // "fly" or "kubernetes"
 
 	// Fly.io config (used when Backend="fly")
-	FlyToken   string
-	FlyOrg     string
-	FlyAppName string
+	FlyToken       string
+	FlyOrg         string
+	FlyAppName     string
+	FlyBuildRegion string // region for image build machines (default: iad)
 
 	// Kubernetes config (used when Backend="kubernetes")
 	K8sKubeconfig     string
@@ -45,6 +50,50 @@ type Config struct {
 	K8sServiceAccount string
 	K8sRegistry       string
 	K8sImageTTL       string
+
+	// Budget alert and key expiry notice delivery (both optional)
+	SMTPAddr              string // host:port of the SMTP server mailing billing and key expiry emails
+	SMTPUsername          string
+	SMTPPassword          string
+	SMTPFrom              string
+	BudgetAlertWebhookURL string // Receives every budget alert as JSON
+
+	// Bearer token required to scrape /metrics (optional; open when empty)
+	MetricsToken string
+
+	// OTLP/HTTP endpoint traces are exported to (optional; tracing is off when empty)
+	OTLPEndpoint string
+
+	// Apply pending migrations on startup. When off, startup fails while
+	// migrations are pending
+	AutoMigrate bool
+
+	// Where rate limit buckets are kept: "memory" (per replica, the default) or
+	// "postgres" (shared by all replicas)
+	RateLimitStore string
+
+	// Secret API keys are hashed with. Changing it invalidates every key.
+	// Required outside development and test
+	APIKeyPepper string
+
+	// Deployment environment: "development", "test" or "production"
+	Environment string
+}
+
+// checkAPIKeyPepper fails when API keys would be hashed without a pepper
+// outside development and test, where a leaked database would expose them to
+// offline guessing.
+func checkAPIKeyPepper(cfg *Config) error {
+	if cfg.APIKeyPepper != "" {
+		return nil
+	}
+	switch cfg.Environment {
+	case "development", "test":
+		slog.Warn("API_KEY_PEPPER is not set; API keys are hashed without a server-side secret")
+		return nil
+	default:
+		return fmt.Errorf("API_KEY_PEPPER is required when ENVIRONMENT=%s", cfg.Environment)
+	}
 }
 
 // NewServer creates and configures a new server instance.
@@ -54,27 +103,49 @@ func NewServer(cfg *Config) (*Server, error) {
 		return nil, fmt.Errorf("config is required")
 	}
 
+	if err := checkAPIKeyPepper(cfg); err != nil {
+		return nil, err
+	}
+
+	// 0. Set up trace export before anything records spans
+	shutdownTracing, err := SetupTracing(context.Background(), cfg.OTLPEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
 	// 1. Create database client
 	dbClient, err := db.New(context.Background(), cfg.DatabaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create database client: %w", err)
 	}
+	dbClient.SetAPIKeyPepper(cfg.APIKeyPepper)
 
-	// 2. Run migrations
-	slog.Info("running database migrations")
-	if err := dbClient.RunMigrations(context.Background()); err != nil {
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	// 2. Run migrations, or make sure they were run by "migrate up"
+	if cfg.AutoMigrate {
+		slog.Info("running database migrations")
+		if _, err := dbClient.RunMigrations(context.Background()); err != nil {
+			return nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+	} else if err := checkMigrations(context.Background(), dbClient); err != nil {
+		return nil, err
 	}
 
 	// 3. Create backend based on configuration
 	var backend Backend
 	var flyClient *fly.Client
+	var builder ImageBuilder
+	cache := fly.NewDBBuildCache(
+		dbClient.GetImageCache,
+		dbClient.PutImageCache,
+		dbClient.TouchImageCache,
+	)
 
 	switch cfg.Backend {
 	case "fly":
 		slog.Info("initializing Fly.io backend")
 		flyClient = fly.New(cfg.FlyToken, cfg.FlyOrg, cfg.FlyAppName)
 		backend = NewFlyBackend(flyClient)
+		builder = fly.NewBuilder(flyClient, cfg.FlyAppName).WithRegion(cfg.FlyBuildRegion)
 
 	case "kubernetes":
 		slog.Info("initializing Kubernetes backend",
@@ -91,6 +162,24 @@ func NewServer(cfg *Config) (*Server, error) {
 		}
 		backend = NewK8sBackend(k8sBackend)
 
+		k8sBuilder := k8sBackend.Builder(k8s.BuilderConfig{
+			Registry: cfg.K8sRegistry,
+			ImageTTL: cfg.K8sImageTTL,
+		})
+		builder = NewK8sImageBuilder(k8sBuilder)
+
+		// Images on expiring registries must drop out of the cache well before they vanish,
+		// so sessions created from a cache hit still have time to pull them
+		if lifetime, ok := k8sBuilder.ImageLifetime(); ok {
+			cache = fly.NewDBBuildCache(
+				dbClient.GetImageCache,
+				func(ctx context.Context, hash, baseImage, registryTag string) error {
+					return dbClient.PutExpiringImageCache(ctx, hash, baseImage, registryTag, time.Now().Add(lifetime/2))
+				},
+				dbClient.TouchImageCache,
+			)
+		}
+
 	default:
 		return nil, fmt.Errorf("unknown backend: %s", cfg.Backend)
 	}
@@ -98,34 +187,106 @@ func NewServer(cfg *Config) (*Server, error) {
 	// 4. Create services with backend
 	sessionService := NewSessionService(dbClient, backend)
 	accountService := NewAccountService(dbClient)
+	webhookService := NewWebhookService(dbClient)
+	memberService := NewMemberService(dbClient)
+	auditService := NewAuditService(dbClient)
 	quotaService := NewQuotaService(dbClient)
 
-	// 5. Set up image builder and cache (Fly-specific for now)
-	if flyClient != nil {
-		builder := fly.NewBuilder(flyClient, cfg.FlyAppName)
-		cache := fly.NewDBBuildCache(
-			dbClient.GetImageCache,
-			dbClient.PutImageCache,
-			dbClient.TouchImageCache,
-		)
-		sessionService.SetBuilder(builder, cache)
+	// Deliver session and build events to account webhooks, retrying failures
+	webhooks := NewWebhookDispatcher(dbClient)
+	sessionService.SetWebhooks(webhooks)
+	go webhooks.Run(context.Background())
+
+	// Keep a log of session status transitions for GET /v1/events
+	events := NewEventLog(dbClient)
+	sessionService.SetEvents(events)
+	go events.Run(context.Background())
+
+	// Enforce session deadlines, including those of sessions started before a restart
+	supervisor := NewSessionSupervisor(dbClient, backend)
+	sessionService.SetSupervisor(supervisor)
+	supervisor.SetWebhooks(webhooks)
+	supervisor.SetEvents(events)
+	go supervisor.Run(context.Background())
+
+	// Check monthly cost limits and deliver alerts by email and/or webhook
+	budget := NewBudgetMonitor(dbClient)
+	var budgetNotifiers BudgetNotifiers
+	if cfg.SMTPAddr != "" {
+		budgetNotifiers = append(budgetNotifiers, NewEmailBudgetNotifier(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom))
+	}
+	if cfg.BudgetAlertWebhookURL != "" {
+		budgetNotifiers = append(budgetNotifiers, NewWebhookBudgetNotifier(cfg.BudgetAlertWebhookURL))
 	}
+	if len(budgetNotifiers) > 0 {
+		budget.SetNotifier(budgetNotifiers)
+		go budget.Run(context.Background())
+	}
+	sessionService.SetBudgetMonitor(budget)
+	supervisor.SetBudgetMonitor(budget)
+
+	// Sample CPU time and peak memory of running sessions for usage and cost
+	meter := NewMeter(dbClient, backend)
+	meter.SetBudgetMonitor(budget)
+	sessionService.SetMeter(meter)
+	supervisor.SetMeter(meter)
+	go meter.Run(context.Background())
+
+	// Catch sessions whose pod or machine died, and backend sessions nobody tracks
+	reconciler := NewReconciler(dbClient, backend)
+	reconciler.SetSupervisor(supervisor)
+	reconciler.SetBudgetMonitor(budget)
+	reconciler.SetWebhooks(webhooks)
+	reconciler.SetEvents(events)
+	if watcher, ok := backend.(StatusWatcher); ok {
+		// Apply status changes the backend sees as they happen, not only once a minute
+		watcher.WatchStatus(reconciler.Observe)
+	}
+	go reconciler.Run(context.Background())
+
+	// Warn owners before API keys expire, deactivate long-expired keys and end expired tiers
+	keyExpiry := NewKeyExpiryMonitor(dbClient)
+	keyExpiry.SetWebhooks(webhooks)
+	if cfg.SMTPAddr != "" {
+		keyExpiry.SetNotifier(NewEmailKeyExpiryNotifier(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom))
+	}
+	go keyExpiry.Run(context.Background())
+
+	// 5. Set up image builder and cache
+	sessionService.SetBuilder(builder, cache)
+	buildService := NewBuildService(dbClient)
+	buildService.SetBuilder(builder, cache)
+	buildService.SetWebhooks(webhooks)
+	go buildService.SweepStaleBuilds(context.Background())
 
 	services := &Services{
 		Session: sessionService,
+		Build:   buildService,
 		Account: accountService,
+		Webhook: webhookService,
+		Member:  memberService,
+		Audit:   auditService,
 		Quota:   quotaService,
 		DB:      dbClient,
 	}
 
 	// 6. Create rate limiter
-	rateLimiter := NewRateLimiter()
+	var rateLimiter *RateLimiter
+	switch cfg.RateLimitStore {
+	case "postgres":
+		store := NewPostgresRateLimitStore(dbClient)
+		go store.Run(context.Background())
+		rateLimiter = NewRateLimiterWithStore(store)
+	default:
+		rateLimiter = NewRateLimiter()
+	}
 
 	// 7. Set up chi router with middleware
 	router := chi.NewRouter()
 
 	// Global middleware
 	router.Use(middleware.RequestID)
+	router.Use(TracingMiddleware)
 	router.Use(middleware.RealIP)
 	router.Use(RecoveryMiddleware)
 	router.Use(LoggingMiddleware)
@@ -133,12 +294,20 @@ func NewServer(cfg *Config) (*Server, error) {
 	// 8. Register huma routes (replaces chi routes)
 	RegisterRoutes(router, services, rateLimiter)
 
-	// 9. Register WebSocket attach endpoint (special handling - not a huma handler)
+	// Prometheus metrics (not rate limited, optionally token protected)
+	router.Get("/metrics", handleMetrics(cfg.MetricsToken, newStateCollector(dbClient, backend.Name(), reconciler)))
+
+	// 9. Register WebSocket attach, raw file transfer, log and event streaming endpoints (special handling - not huma handlers)
 	router.Route("/v1", func(r chi.Router) {
 		r.Group(func(r chi.Router) {
 			r.Use(AuthMiddleware(dbClient))
+			r.Use(RequireRoles(developerRoles...))
 			r.Use(rateLimiter.Middleware())
-			r.Get("/sessions/{id}/attach", handleAttach(services.Session, dbClient))
+			r.With(RequireScope(ScopeSessionsExec)).Get("/sessions/{id}/attach", handleAttach(services.Session, dbClient))
+			r.With(RequireScope(ScopeFilesWrite)).Put("/sessions/{id}/files/*", handleUploadFile(services.Session))
+			r.With(RequireScope(ScopeSessionsRead)).Get("/sessions/{id}/files/*", handleDownloadFile(services.Session))
+			r.With(RequireScope(ScopeSessionsRead)).Get("/builds/{id}/logs", handleBuildLogs(services.Build))
+			r.With(RequireScope(ScopeSessionsRead)).Get("/events", handleEvents(events))
 		})
 	})
 
@@ -160,11 +329,37 @@ func NewServer(cfg *Config) (*Server, error) {
 		backend:     backend,
 		rateLimiter: rateLimiter,
 		config:      cfg,
+
+		shutdownTracing: shutdownTracing,
 	}
 
 	return s, nil
 }
 
+// checkMigrations returns an error if the schema is behind the embedded migrations
+// or an applied migration was modified.
+func checkMigrations(ctx context.Context, dbClient *db.Client) error {
+	statuses, err := dbClient.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		if status.Modified {
+			return fmt.Errorf("migration %s was modified after it was applied", status.Name)
+		}
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Name)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations (%s): run \"migrate up\" or set AUTO_MIGRATE=true", len(pending), strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
 // handleAttach creates a handler that wraps WebSocket attach for session I/O streaming.
 // This needs special handling because WebSocket upgrades don't fit the standard huma pattern.
 func handleAttach(sessionSvc *SessionService, dbClient DBClient) http.HandlerFunc {
@@ -200,10 +395,18 @@ func (s *Server) Router() *chi.Mux {
 	return s.router
 }
 
-// Close gracefully shuts down the server by closing the database connection.
+// Close gracefully shuts down the server by closing the database connection
+// and flushing any spans not yet exported.
 func (s *Server) Close() error {
 	if s.db != nil {
 		s.db.Close()
 	}
+	if s.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.shutdownTracing(ctx); err != nil {
+			return fmt.Errorf("failed to flush traces: %w", err)
+		}
+	}
 	return nil
 }
@@ -2,13 +2,16 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/burka/execbox-cloud/internal/backend/fly"
 	"github.com/burka/execbox-cloud/internal/db"
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
 )
 
 // SessionService handles session-related operations.
@@ -18,6 +21,12 @@ type SessionService struct {
 	backend Backend
 	builder ImageBuilder
 	cache   fly.BuildCache
+
+	supervisor *SessionSupervisor
+	meter      *Meter
+	budget     *BudgetMonitor
+	webhooks   *WebhookDispatcher
+	events     *EventLog
 }
 
 // NewSessionService creates a new SessionService.
@@ -25,6 +34,7 @@ func NewSessionService(db DBClient, backend Backend) *SessionService {
 	return &SessionService{
 		db:      db,
 		backend: backend,
+		budget:  NewBudgetMonitor(db),
 	}
 }
 
@@ -34,6 +44,32 @@ func (s *SessionService) SetBuilder(builder ImageBuilder, cache fly.BuildCache)
 	s.cache = cache
 }
 
+// SetSupervisor sets the supervisor that enforces session deadlines.
+func (s *SessionService) SetSupervisor(supervisor *SessionSupervisor) {
+	s.supervisor = supervisor
+}
+
+// SetMeter sets the meter used to take a final usage sample before a session ends.
+func (s *SessionService) SetMeter(meter *Meter) {
+	s.meter = meter
+}
+
+// SetWebhooks sets the dispatcher that publishes session events.
+func (s *SessionService) SetWebhooks(webhooks *WebhookDispatcher) {
+	s.webhooks = webhooks
+}
+
+// SetEvents sets the log that session status transitions are recorded in.
+func (s *SessionService) SetEvents(events *EventLog) {
+	s.events = events
+}
+
+// SetBudgetMonitor sets the monitor that checks accounts against their monthly
+// cost limit on admission and when sessions end.
+func (s *SessionService) SetBudgetMonitor(budget *BudgetMonitor) {
+	s.budget = budget
+}
+
 // getAuthorizedSession retrieves a session and verifies the caller owns it.
 // Returns the session or an error if not found or unauthorized.
 func (s *SessionService) getAuthorizedSession(ctx context.Context, sessionID string) (*db.Session, error) {
@@ -61,6 +97,12 @@ func (s *SessionService) getAuthorizedSession(ctx context.Context, sessionID str
 // CreateSession handles POST /v1/sessions
 // Creates a new execution session with a backend and stores it in the database.
 func (s *SessionService) CreateSession(ctx context.Context, input *CreateSessionInput) (*CreateSessionOutput, error) {
+	out, err := s.createSession(ctx, input)
+	observeSessionCreate(err)
+	return out, err
+}
+
+func (s *SessionService) createSession(ctx context.Context, input *CreateSessionInput) (*CreateSessionOutput, error) {
 	// Get API key ID from context (set by auth middleware)
 	apiKeyID, ok := GetAPIKeyID(ctx)
 	if !ok {
@@ -74,78 +116,58 @@ func (s *SessionService) CreateSession(ctx context.Context, input *CreateSession
 		tier = TierAnonymous
 	}
 
-	// Check quota limits before creating session
-	limits := GetTierLimits(tier)
-
-	// Check concurrent session limit
-	if !IsUnlimited(limits.ConcurrentSessions) {
-		activeCount, err := s.db.GetActiveSessionCount(ctx, apiKeyID)
-		if err != nil {
-			return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to check concurrent sessions: %v", err))
-		}
-
-		if activeCount >= limits.ConcurrentSessions {
-			return nil, huma.NewError(http.StatusTooManyRequests, fmt.Sprintf("concurrent session limit reached (%d/%d)", activeCount, limits.ConcurrentSessions))
-		}
+	// Check per-key, account and tier limits before creating session
+	if err := s.admitSession(ctx, apiKeyID, tier); err != nil {
+		return nil, err
 	}
 
-	// Check daily session limit
-	if !IsUnlimited(limits.SessionsPerDay) {
-		dailyCount, err := s.db.GetDailySessionCount(ctx, apiKeyID)
-		if err != nil {
-			return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to check daily sessions: %v", err))
-		}
-
-		if dailyCount >= limits.SessionsPerDay {
-			return nil, huma.NewError(http.StatusTooManyRequests, fmt.Sprintf("daily session limit reached (%d/%d)", dailyCount, limits.SessionsPerDay))
-		}
-	}
+	// Sessions are attributed to the account owning the key
+	accountID, _ := callerAccountID(ctx)
 
 	req := input.Body
 
 	// Validate required fields
-	if req.Image == "" {
+	if req.Image == "" && req.BuildID == "" {
 		return nil, huma.Error400BadRequest("image is required")
 	}
-
-	// Reject setup/files until image building is fully implemented
-	if len(req.Setup) > 0 || len(req.Files) > 0 {
-		return nil, huma.Error400BadRequest("custom image building (setup/files) not yet available")
+	if req.BuildID != "" && (len(req.Setup) > 0 || len(req.Files) > 0) {
+		return nil, huma.Error400BadRequest("buildId cannot be combined with setup or files")
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
 	}
 
 	// Generate session ID
 	sessionID := generateSessionID()
 
-	// Resolve image (build if setup/files provided)
+	// Resolve image (prebuilt, or build if setup/files provided)
 	resolvedImage := req.Image
 	var setupHash string
-	if len(req.Setup) > 0 || len(req.Files) > 0 {
+	if req.BuildID != "" {
+		build, err := getAuthorizedBuild(ctx, s.db, req.BuildID)
+		if err != nil {
+			return nil, err
+		}
+		if build.Phase != BuildPhaseReady || build.RegistryTag == nil {
+			return nil, huma.Error409Conflict(fmt.Sprintf("build %s is %s, not ready", build.ID, build.Phase))
+		}
+		resolvedImage = *build.RegistryTag
+		setupHash = build.Hash
+	} else if len(req.Setup) > 0 || len(req.Files) > 0 {
 		if s.builder == nil {
 			return nil, huma.Error500InternalServerError("image building not configured")
 		}
 
-		// Build the spec
-		spec := &fly.BuildSpec{
-			BaseImage: req.Image,
-			Setup:     req.Setup,
-			Files:     make([]fly.BuildFile, 0, len(req.Files)),
-		}
-
-		for _, f := range req.Files {
-			content := []byte(f.Content)
-			// TODO: Handle base64 encoding if f.Encoding == "base64"
-			spec.Files = append(spec.Files, fly.BuildFile{
-				Path:    f.Path,
-				Content: content,
-			})
+		spec, err := buildSpecFromRequest(req.Image, req.Setup, req.Files)
+		if err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
 		}
 
 		// Compute hash for tracking
 		setupHash = fly.ComputeHash(spec)
 
-		// Resolve to registry tag
-		var err error
-		resolvedImage, err = s.builder.Resolve(ctx, spec, s.cache)
+		// Resolve to registry tag (cache hit or fresh build)
+		resolvedImage, err = resolveImage(ctx, s.builder, spec, s.cache)
 		if err != nil {
 			return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to resolve image: %v", err))
 		}
@@ -160,6 +182,7 @@ func (s *SessionService) CreateSession(ctx context.Context, input *CreateSession
 	}
 
 	config := buildCreateSessionConfig(&req, resolvedImage)
+	config.SessionID = sessionID
 	backendSession, backendNetwork, err := s.backend.CreateSession(ctx, config)
 	if err != nil {
 		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to create session: %v", err))
@@ -188,7 +211,7 @@ func (s *SessionService) CreateSession(ctx context.Context, input *CreateSession
 	session := &db.Session{
 		ID:           sessionID,
 		APIKeyID:     apiKeyID,
-		AccountID:    apiKeyID, // For now, account_id = api_key_id (single-key-per-account)
+		AccountID:    accountID,
 		BackendID:    &backendID,
 		FlyMachineID: &backendID, // Also set for DB compatibility
 		Image:        resolvedImage,
@@ -196,22 +219,42 @@ func (s *SessionService) CreateSession(ctx context.Context, input *CreateSession
 		Env:          req.Env,
 		Status:       SessionStatusPending,
 		Ports:        ports,
+		Labels:       req.Labels,
 		CreatedAt:    time.Now().UTC(),
 	}
+	if name := s.backend.Name(); name != "" {
+		session.Backend = &name
+	}
 	if setupHash != "" {
 		session.SetupHash = &setupHash
 	}
+	if req.Network != "" {
+		session.Network = &req.Network
+	}
+	session.ExpiresAt = sessionDeadline(session.CreatedAt, GetTierLimits(tier), req.Resources)
 
 	if err := s.db.CreateSession(ctx, session); err != nil {
 		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to create session: %v", err))
 	}
 
+	if s.supervisor != nil && session.ExpiresAt != nil {
+		s.supervisor.Watch(session.ID, *session.ExpiresAt)
+	}
+
+	s.events.Record(ctx, session, EventSessionCreated)
+	s.webhooks.Publish(ctx, accountID, EventSessionCreated, buildSessionResponse(session))
+	recordAudit(ctx, s.db, AuditSessionCreated, session.ID, map[string]string{"image": session.Image})
+
 	// Build response
 	response := CreateSessionResponse{
 		ID:        sessionID,
 		Status:    SessionStatusPending,
 		CreatedAt: session.CreatedAt.Format(time.RFC3339),
 	}
+	if session.ExpiresAt != nil {
+		expiresAt := session.ExpiresAt.Format(time.RFC3339)
+		response.ExpiresAt = &expiresAt
+	}
 
 	// Add network info if available
 	if networkInfo != nil {
@@ -241,7 +284,9 @@ func (s *SessionService) GetSession(ctx context.Context, input *GetSessionInput)
 }
 
 // ListSessions handles GET /v1/sessions
-// Lists all sessions for the authenticated API key, with optional status filter.
+// Lists the sessions of the authenticated API key, or of another key of the
+// account for managers, a page at a time. The response carries next_cursor
+// while more sessions match.
 func (s *SessionService) ListSessions(ctx context.Context, input *ListSessionsInput) (*ListSessionsOutput, error) {
 	// Get API key ID from context
 	apiKeyID, ok := GetAPIKeyID(ctx)
@@ -249,12 +294,15 @@ func (s *SessionService) ListSessions(ctx context.Context, input *ListSessionsIn
 		return nil, huma.Error401Unauthorized("unauthorized")
 	}
 
-	// Get optional status filter from query params
-	// TODO: Add status query parameter to ListSessionsInput when needed
-	var statusFilter *string
+	filter, err := s.sessionFilter(ctx, apiKeyID, input)
+	if err != nil {
+		return nil, err
+	}
+	// One more than a page tells whether another page follows
+	filter.Limit = input.Limit + 1
 
 	// List sessions from database
-	sessions, err := s.db.ListSessions(ctx, apiKeyID, statusFilter)
+	sessions, err := s.db.ListSessions(ctx, filter)
 	if err != nil {
 		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to list sessions: %v", err))
 	}
@@ -263,6 +311,12 @@ func (s *SessionService) ListSessions(ctx context.Context, input *ListSessionsIn
 	response := ListSessionsResponse{
 		Sessions: make([]SessionResponse, 0, len(sessions)),
 	}
+	if len(sessions) > input.Limit {
+		sessions = sessions[:input.Limit]
+		last := sessions[len(sessions)-1]
+		cursor := encodeCursor(last.CreatedAt, last.ID)
+		response.NextCursor = &cursor
+	}
 
 	for _, session := range sessions {
 		response.Sessions = append(response.Sessions, buildSessionResponse(&session))
@@ -271,6 +325,85 @@ func (s *SessionService) ListSessions(ctx context.Context, input *ListSessionsIn
 	return &ListSessionsOutput{Body: response}, nil
 }
 
+// sessionFilter parses the query parameters of ListSessions. Listing another
+// key's sessions requires the key to belong to the caller's account, and a
+// manager role unless the key is the caller's own member's.
+func (s *SessionService) sessionFilter(ctx context.Context, apiKeyID uuid.UUID, input *ListSessionsInput) (*db.SessionFilter, error) {
+	filter := &db.SessionFilter{
+		APIKeyID:  apiKeyID,
+		Ascending: input.Order == "asc",
+	}
+
+	if input.APIKeyID != "" {
+		keyID, err := parseUUID(input.APIKeyID)
+		if err != nil {
+			return nil, huma.Error400BadRequest("invalid api_key_id format")
+		}
+		if keyID != apiKeyID {
+			key, err := s.db.GetAPIKeyByID(ctx, keyID)
+			accountID, _ := callerAccountID(ctx)
+			if err != nil || key.AccountID != accountID {
+				return nil, huma.Error404NotFound("API key not found")
+			}
+			memberID, isMember := GetMemberID(ctx)
+			ownKey := isMember && key.MemberID != nil && *key.MemberID == memberID
+			if !ownKey && !isManager(callerRole(ctx)) {
+				return nil, huma.Error403Forbidden("listing the sessions of other members' keys requires the owner or admin role")
+			}
+		}
+		filter.APIKeyID = keyID
+	}
+
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+	if input.Image != "" {
+		filter.Image = &input.Image
+	}
+	if input.Backend != "" {
+		filter.Backend = &input.Backend
+	}
+	if input.ExitCode != "" {
+		exitCode, err := strconv.Atoi(input.ExitCode)
+		if err != nil {
+			return nil, huma.Error400BadRequest("exit_code must be an integer")
+		}
+		filter.ExitCode = &exitCode
+	}
+
+	labels, err := parseLabelFilters(input.Label)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	filter.Labels = labels
+
+	if input.Since != "" {
+		since, err := time.Parse(time.RFC3339, input.Since)
+		if err != nil {
+			return nil, huma.Error400BadRequest("since must be an RFC3339 timestamp")
+		}
+		filter.CreatedAfter = &since
+	}
+	if input.Until != "" {
+		until, err := time.Parse(time.RFC3339, input.Until)
+		if err != nil {
+			return nil, huma.Error400BadRequest("until must be an RFC3339 timestamp")
+		}
+		filter.CreatedBefore = &until
+	}
+
+	if input.Cursor != "" {
+		createdAt, id, err := decodeCursor(input.Cursor)
+		if err != nil {
+			return nil, huma.Error400BadRequest("invalid cursor")
+		}
+		filter.AfterCreatedAt = &createdAt
+		filter.AfterID = id
+	}
+
+	return filter, nil
+}
+
 // StopSession handles POST /v1/sessions/{id}/stop
 // Stops a running session by stopping the backend session and updating the database.
 func (s *SessionService) StopSession(ctx context.Context, input *StopSessionInput) (*StopSessionOutput, error) {
@@ -280,10 +413,13 @@ func (s *SessionService) StopSession(ctx context.Context, input *StopSessionInpu
 	}
 
 	// Check if already stopped
-	if session.Status == SessionStatusStopped || session.Status == SessionStatusKilled || session.Status == SessionStatusFailed {
+	if session.Status == SessionStatusStopped || session.Status == SessionStatusKilled || session.Status == SessionStatusFailed || session.Status == SessionStatusTimeout {
 		return nil, huma.Error409Conflict("session already stopped")
 	}
 
+	// Record final usage while the backend session still exists
+	s.meter.Sample(ctx, session)
+
 	// Stop the backend session
 	backendID := session.GetBackendID()
 	if backendID != "" && s.backend != nil {
@@ -293,16 +429,20 @@ func (s *SessionService) StopSession(ctx context.Context, input *StopSessionInpu
 	}
 
 	// Update session status in database
-	now := time.Now().UTC()
-	status := SessionStatusStopped
-	update := &db.SessionUpdate{
-		Status:  &status,
-		EndedAt: &now,
-	}
+	from := session.Status
+	update := endSessionUpdate(session, SessionStatusStopped, time.Now().UTC())
 
 	if err := s.db.UpdateSession(ctx, session.ID, update); err != nil {
 		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to update session: %v", err))
 	}
+	observeSessionUpdate(from, update)
+	s.events.RecordSessionUpdate(ctx, session, from, update)
+	s.webhooks.PublishSessionUpdate(ctx, session, from, update)
+	s.budget.SessionUpdated(ctx, session, update)
+
+	if s.supervisor != nil {
+		s.supervisor.Forget(session.ID)
+	}
 
 	// Build response
 	response := StopSessionResponse{
@@ -320,6 +460,12 @@ func (s *SessionService) KillSession(ctx context.Context, input *KillSessionInpu
 		return nil, err
 	}
 
+	// Record final usage while the backend session still exists
+	active := isActiveStatus(session.Status)
+	if active {
+		s.meter.Sample(ctx, session)
+	}
+
 	// Destroy the backend session
 	backendID := session.GetBackendID()
 	if backendID != "" && s.backend != nil {
@@ -328,21 +474,159 @@ func (s *SessionService) KillSession(ctx context.Context, input *KillSessionInpu
 		}
 	}
 
-	// Update session status in database
+	// Update session status in database; sessions that already ended keep their usage
 	now := time.Now().UTC()
+	from := session.Status
 	status := SessionStatusKilled
 	update := &db.SessionUpdate{
 		Status:  &status,
 		EndedAt: &now,
 	}
+	if active {
+		update = endSessionUpdate(session, status, now)
+	}
 
 	if err := s.db.UpdateSession(ctx, session.ID, update); err != nil {
 		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to update session: %v", err))
 	}
+	observeSessionUpdate(from, update)
+	s.events.RecordSessionUpdate(ctx, session, from, update)
+	s.webhooks.PublishSessionUpdate(ctx, session, from, update)
+	s.budget.SessionUpdated(ctx, session, update)
+
+	if s.supervisor != nil {
+		s.supervisor.Forget(session.ID)
+	}
 
 	return &KillSessionOutput{}, nil
 }
 
+// ExecSession handles POST /v1/sessions/{id}/exec
+// Runs a one-shot command inside a live session and returns its output and exit code.
+func (s *SessionService) ExecSession(ctx context.Context, input *ExecSessionInput) (*ExecSessionOutput, error) {
+	session, err := s.getAuthorizedSession(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(input.Body.Command) == 0 {
+		return nil, huma.Error400BadRequest("command is required")
+	}
+
+	if !isActiveStatus(session.Status) {
+		return nil, huma.Error409Conflict(fmt.Sprintf("session is not running (status: %s)", session.Status))
+	}
+
+	backendID := session.GetBackendID()
+	if backendID == "" || s.backend == nil {
+		return nil, huma.Error500InternalServerError("no backend configured")
+	}
+
+	// Apply the per-call timeout, clamped to the allowed range
+	timeout := DefaultExecTimeout
+	if input.Body.TimeoutMs > 0 {
+		timeout = time.Duration(input.Body.TimeoutMs) * time.Millisecond
+	}
+	if timeout > MaxExecTimeout {
+		timeout = MaxExecTimeout
+	}
+
+	recordAudit(ctx, s.db, AuditSessionExec, session.ID, map[string][]string{"command": input.Body.Command})
+
+	// The command may outlast the server's write timeout
+	extendWriteDeadline(ctx, time.Now().Add(timeout+ExecWriteGrace))
+
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	stdout, stderr, exitCode, err := s.backend.Exec(execCtx, backendID, input.Body.Command)
+	if err != nil {
+		if errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+			return nil, huma.Error504GatewayTimeout(fmt.Sprintf("exec timed out after %s", timeout))
+		}
+		return nil, huma.Error500InternalServerError(fmt.Sprintf("failed to exec in session: %v", err))
+	}
+
+	response := ExecResponse{
+		ExitCode:   exitCode,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+
+	return &ExecSessionOutput{Body: response}, nil
+}
+
+// GetSessionURL handles GET /v1/sessions/{id}/url
+// Returns a reachable URL for a declared container port of an exposed session.
+func (s *SessionService) GetSessionURL(ctx context.Context, input *GetURLInput) (*GetURLOutput, error) {
+	session, err := s.getAuthorizedSession(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Network == nil || *session.Network != "exposed" {
+		return nil, huma.Error409Conflict("session was not created with network mode 'exposed'")
+	}
+
+	var declared *db.Port
+	for i := range session.Ports {
+		if session.Ports[i].Container == input.Port {
+			declared = &session.Ports[i]
+			break
+		}
+	}
+	if declared == nil {
+		return nil, huma.Error409Conflict(fmt.Sprintf("port %d was not declared when the session was created", input.Port))
+	}
+
+	if !isActiveStatus(session.Status) {
+		return nil, huma.Error409Conflict(fmt.Sprintf("session is not running (status: %s)", session.Status))
+	}
+
+	backendID := session.GetBackendID()
+	if backendID == "" || s.backend == nil {
+		return nil, huma.Error500InternalServerError("no backend configured")
+	}
+
+	rawURL, err := s.backend.URL(ctx, backendID, input.Port)
+	if errors.Is(err, ErrNoSessionURL) {
+		return nil, huma.Error501NotImplemented(fmt.Sprintf("%s backend does not provide per-session URLs", s.backend.Name()))
+	}
+	if err != nil {
+		return nil, huma.Error502BadGateway(fmt.Sprintf("failed to get port URL: %v", err))
+	}
+
+	protocol := declared.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+
+	response := GetURLResponse{
+		ContainerPort: input.Port,
+		HostPort:      urlPort(rawURL, input.Port),
+		URL:           rawURL,
+		Protocol:      protocol,
+	}
+
+	return &GetURLOutput{Body: response}, nil
+}
+
+// urlPort extracts the port a URL points at, falling back to def when the URL
+// carries no explicit port.
+func urlPort(rawURL string, def int) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return def
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return def
+	}
+	return port
+}
+
 // isActiveStatus checks if a status requires backend synchronization.
 // Active statuses are those where the session may still be transitioning.
 func isActiveStatus(status string) bool {
@@ -370,38 +654,29 @@ func (s *SessionService) syncSessionStatus(ctx context.Context, session *db.Sess
 
 	// Update DB if status changed
 	if backendSession.Status != session.Status {
+		from := session.Status
 		update := &db.SessionUpdate{Status: &backendSession.Status}
 
+		// Record end time, duration and cost if transitioning to terminal state
+		if backendSession.Status == SessionStatusStopped || backendSession.Status == SessionStatusFailed {
+			update = endSessionUpdate(session, backendSession.Status, time.Now().UTC())
+			if s.supervisor != nil {
+				s.supervisor.Forget(session.ID)
+			}
+		}
+
 		// Copy exit code if available
 		if backendSession.ExitCode != nil {
 			update.ExitCode = backendSession.ExitCode
 		}
 
-		// Update timestamps if transitioning to terminal state
-		if backendSession.Status == SessionStatusStopped || backendSession.Status == SessionStatusFailed {
-			now := time.Now().UTC()
-			update.EndedAt = &now
-
-			// Calculate duration from CreatedAt to now
-			durationMs := now.Sub(session.CreatedAt).Milliseconds()
-			update.DurationMs = &durationMs
-
-			// Calculate cost using default values since we don't have real metrics yet
-			// cpuMillis = durationMs (assumes 1 core)
-			// memoryMB = 256 (default container memory)
-			cpuMillis := durationMs
-			memoryMB := int64(256)
-
-			update.CPUMillisUsed = &cpuMillis
-			update.MemoryPeakMB = &memoryMB
-
-			// Calculate cost using DefaultCostCalculator
-			costEstimateCents := DefaultCostCalculator.CalculateSessionCost(durationMs, cpuMillis, memoryMB)
-			update.CostEstimateCents = &costEstimateCents
-		}
-
 		// Update the database
 		if err := s.db.UpdateSession(ctx, session.ID, update); err == nil {
+			observeSessionUpdate(from, update)
+			s.events.RecordSessionUpdate(ctx, session, from, update)
+			s.webhooks.PublishSessionUpdate(ctx, session, from, update)
+			s.budget.SessionUpdated(ctx, session, update)
+
 			// Update local session object for response
 			session.Status = backendSession.Status
 			session.ExitCode = backendSession.ExitCode
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+)
+
+// supervisorSweepInterval is how often the supervisor reloads deadlines from the
+// database, picking up sessions it has no timer for: those that were running
+// before a restart or that were created by another replica.
+const supervisorSweepInterval = 30 * time.Second
+
+// SessionSupervisor destroys sessions that run past their deadline and records
+// them with status timeout. Deadlines are stored on the session record, so they
+// survive restarts; the supervisor only keeps a timer per live session.
+type SessionSupervisor struct {
+	db       DBClient
+	backend  Backend
+	meter    *Meter
+	budget   *BudgetMonitor
+	webhooks *WebhookDispatcher
+	events   *EventLog
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer // session ID -> pending expiry
+}
+
+// NewSessionSupervisor creates a new SessionSupervisor.
+func NewSessionSupervisor(db DBClient, backend Backend) *SessionSupervisor {
+	return &SessionSupervisor{
+		db:      db,
+		backend: backend,
+		timers:  make(map[string]*time.Timer),
+	}
+}
+
+// SetMeter sets the meter used to take a final usage sample before a session is destroyed.
+func (s *SessionSupervisor) SetMeter(meter *Meter) {
+	s.meter = meter
+}
+
+// SetBudgetMonitor sets the monitor that re-checks an account's spend when one
+// of its sessions times out.
+func (s *SessionSupervisor) SetBudgetMonitor(budget *BudgetMonitor) {
+	s.budget = budget
+}
+
+// SetWebhooks sets the dispatcher that publishes session.timeout events.
+func (s *SessionSupervisor) SetWebhooks(webhooks *WebhookDispatcher) {
+	s.webhooks = webhooks
+}
+
+// SetEvents sets the log that session.timeout events are recorded in.
+func (s *SessionSupervisor) SetEvents(events *EventLog) {
+	s.events = events
+}
+
+// Watch schedules a session to be destroyed at deadline. A deadline in the past
+// expires the session right away. Sessions that are already watched are left alone.
+func (s *SessionSupervisor) Watch(sessionID string, deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.timers[sessionID]; ok {
+		return
+	}
+	s.timers[sessionID] = time.AfterFunc(time.Until(deadline), func() {
+		// Deadlines outlive the request that created the session
+		if err := s.expire(context.Background(), sessionID); err != nil {
+			slog.Warn("failed to expire session", "error", err, "session_id", sessionID)
+		}
+
+		// A failed expiry is retried by the next sweep
+		s.mu.Lock()
+		delete(s.timers, sessionID)
+		s.mu.Unlock()
+	})
+}
+
+// Forget cancels the deadline of a session that ended on its own.
+func (s *SessionSupervisor) Forget(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if timer, ok := s.timers[sessionID]; ok {
+		timer.Stop()
+		delete(s.timers, sessionID)
+	}
+}
+
+// Run reloads session deadlines from the database now and then periodically,
+// so sessions are enforced after a restart. It blocks until ctx is done.
+func (s *SessionSupervisor) Run(ctx context.Context) {
+	ticker := time.NewTicker(supervisorSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sweep(ctx); err != nil {
+			slog.Warn("failed to load session deadlines", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep watches every live session that has a deadline.
+func (s *SessionSupervisor) sweep(ctx context.Context) error {
+	sessions, err := s.db.ListExpiringSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ExpiresAt != nil {
+			s.Watch(session.ID, *session.ExpiresAt)
+		}
+	}
+	return nil
+}
+
+// expire marks a session timed out and destroys its backend resources.
+// Sessions that ended in the meantime, or that another replica expired first,
+// are left untouched.
+func (s *SessionSupervisor) expire(ctx context.Context, sessionID string) error {
+	session, err := s.db.GetSession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if !isActiveStatus(session.Status) {
+		return nil
+	}
+
+	s.meter.Sample(ctx, session)
+
+	// Claim the session before destroying it, so exactly one replica ends it
+	from := session.Status
+	update := endSessionUpdate(session, SessionStatusTimeout, time.Now().UTC())
+	claimed, err := s.db.EndActiveSession(ctx, sessionID, update)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	if !claimed {
+		return nil
+	}
+
+	if backendID := session.GetBackendID(); backendID != "" && s.backend != nil {
+		if err := s.backend.DestroySession(ctx, backendID); err != nil {
+			slog.Warn("failed to destroy timed out session", "error", err, "session_id", sessionID, "backend_id", backendID)
+		}
+	}
+
+	observeSessionUpdate(from, update)
+	s.events.RecordSessionUpdate(ctx, session, from, update)
+	s.webhooks.PublishSessionUpdate(ctx, session, from, update)
+	s.budget.SessionUpdated(ctx, session, update)
+
+	slog.Info("session timed out", "session_id", sessionID, "duration_ms", *update.DurationMs)
+	return nil
+}
+
+// sessionDeadline returns when a session created at createdAt must be destroyed:
+// after the shorter of the tier's maximum duration and the requested timeout.
+// Returns nil if neither limits the session.
+func sessionDeadline(createdAt time.Time, limits TierLimits, resources *Resources) *time.Time {
+	var timeout time.Duration
+	if !IsUnlimited(limits.MaxDurationSec) {
+		timeout = time.Duration(limits.MaxDurationSec) * time.Second
+	}
+	if resources != nil && resources.TimeoutMs > 0 {
+		requested := time.Duration(resources.TimeoutMs) * time.Millisecond
+		if timeout == 0 || requested < timeout {
+			timeout = requested
+		}
+	}
+
+	if timeout == 0 {
+		return nil
+	}
+	deadline := createdAt.Add(timeout)
+	return &deadline
+}
+
+// endSessionUpdate builds the update that moves a session into a terminal status
+// at endedAt, with its duration, resource usage and cost. Usage comes from the
+// meter's samples, never billed below the wall-clock floor; sessions that were
+// never sampled are assumed to have used one core and DefaultSessionMemoryMB.
+func endSessionUpdate(session *db.Session, status string, endedAt time.Time) *db.SessionUpdate {
+	durationMs := endedAt.Sub(session.CreatedAt).Milliseconds()
+
+	cpuMillis, memoryMB, ok := meteredUsage(session)
+	if ok {
+		cpuMillis, memoryMB = BillableUsage(durationMs, cpuMillis, memoryMB)
+	} else {
+		cpuMillis = durationMs
+		memoryMB = DefaultSessionMemoryMB
+	}
+	costEstimateCents := DefaultCostCalculator.CalculateSessionCost(durationMs, cpuMillis, memoryMB)
+
+	return &db.SessionUpdate{
+		Status:            &status,
+		EndedAt:           &endedAt,
+		DurationMs:        &durationMs,
+		CPUMillisUsed:     &cpuMillis,
+		MemoryPeakMB:      &memoryMB,
+		CostEstimateCents: &costEstimateCents,
+	}
+}
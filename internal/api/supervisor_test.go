@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/google/uuid"
+)
+
+func TestSessionDeadline(t *testing.T) {
+	createdAt := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		tier      string
+		resources *Resources
+		want      time.Duration // 0 means no deadline
+	}{
+		{name: "tier maximum", tier: TierFree, want: 60 * time.Second},
+		{name: "shorter requested timeout", tier: TierFree, resources: &Resources{TimeoutMs: 5000}, want: 5 * time.Second},
+		{name: "longer requested timeout is capped", tier: TierFree, resources: &Resources{TimeoutMs: 300000}, want: 60 * time.Second},
+		{name: "unlimited tier", tier: TierEnterprise},
+		{name: "unlimited tier with requested timeout", tier: TierEnterprise, resources: &Resources{TimeoutMs: 120000}, want: 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sessionDeadline(createdAt, GetTierLimits(tt.tier), tt.resources)
+			if tt.want == 0 {
+				if got != nil {
+					t.Errorf("expected no deadline, got %v", got)
+				}
+				return
+			}
+			if got == nil || !got.Equal(createdAt.Add(tt.want)) {
+				t.Errorf("expected deadline %v, got %v", createdAt.Add(tt.want), got)
+			}
+		})
+	}
+}
+
+func newExpiringSession(id string, status string, expiresAt time.Time) *db.Session {
+	backendID := "backend_" + id
+	return &db.Session{
+		ID:        id,
+		APIKeyID:  uuid.New(),
+		BackendID: &backendID,
+		Status:    status,
+		CreatedAt: time.Now().UTC().Add(-time.Minute),
+		ExpiresAt: &expiresAt,
+	}
+}
+
+// watching reports whether the supervisor still holds a deadline for a session.
+func (s *SessionSupervisor) watching(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.timers[sessionID]
+	return ok
+}
+
+func TestSessionSupervisor_RehydratesAndExpires(t *testing.T) {
+	mockDB := newMockDB()
+	mockDB.sessions["sess_overdue"] = newExpiringSession("sess_overdue", SessionStatusRunning, time.Now().Add(-time.Second))
+	mockDB.sessions["sess_later"] = newExpiringSession("sess_later", SessionStatusRunning, time.Now().Add(time.Hour))
+	mockBackend := &mockBackendHandler{}
+	supervisor := NewSessionSupervisor(mockDB, mockBackend)
+
+	// A freshly started supervisor picks up deadlines from the database
+	if err := supervisor.sweep(context.Background()); err != nil {
+		t.Fatalf("sweep failed: %v", err)
+	}
+	defer supervisor.Forget("sess_later")
+
+	// The watch is dropped once the session is expired and destroyed
+	deadline := time.Now().Add(2 * time.Second)
+	for supervisor.watching("sess_overdue") {
+		if time.Now().After(deadline) {
+			t.Fatal("overdue session was not expired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	session, _ := mockDB.GetSession(context.Background(), "sess_overdue")
+	if session.Status != SessionStatusTimeout {
+		t.Fatalf("session in status %s, want %s", session.Status, SessionStatusTimeout)
+	}
+	if session.EndedAt == nil {
+		t.Error("expected ended_at to be set")
+	}
+
+	if len(mockBackend.destroyed) != 1 || mockBackend.destroyed[0] != "backend_sess_overdue" {
+		t.Errorf("expected only the overdue session to be destroyed, got %v", mockBackend.destroyed)
+	}
+	if session, _ := mockDB.GetSession(context.Background(), "sess_later"); session.Status != SessionStatusRunning {
+		t.Errorf("expected session with a later deadline to keep running, got %s", session.Status)
+	}
+}
+
+func TestSessionSupervisor_Forget(t *testing.T) {
+	mockDB := newMockDB()
+	mockDB.sessions["sess_stopped"] = newExpiringSession("sess_stopped", SessionStatusRunning, time.Now().Add(20*time.Millisecond))
+	supervisor := NewSessionSupervisor(mockDB, &mockBackendHandler{})
+
+	supervisor.Watch("sess_stopped", time.Now().Add(20*time.Millisecond))
+	supervisor.Forget("sess_stopped")
+	time.Sleep(50 * time.Millisecond)
+
+	if session, _ := mockDB.GetSession(context.Background(), "sess_stopped"); session.Status != SessionStatusRunning {
+		t.Errorf("expected forgotten session to be left alone, got %s", session.Status)
+	}
+}
+
+func TestSessionSupervisor_Expire(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockDB.sessions["sess_timeout"] = newExpiringSession("sess_timeout", SessionStatusRunning, time.Now())
+	mockBackend := &mockBackendHandler{}
+	supervisor := NewSessionSupervisor(mockDB, mockBackend)
+
+	if err := supervisor.expire(context.Background(), "sess_timeout"); err != nil {
+		t.Fatalf("expire failed: %v", err)
+	}
+
+	update := mockDB.lastSessionUpdate
+	if update == nil || update.Status == nil || *update.Status != SessionStatusTimeout {
+		t.Fatalf("expected status %s, got %+v", SessionStatusTimeout, update)
+	}
+	if update.EndedAt == nil || update.DurationMs == nil || *update.DurationMs < time.Minute.Milliseconds() {
+		t.Errorf("expected ended_at and a duration of at least a minute, got %+v", update)
+	}
+	if len(mockBackend.destroyed) != 1 {
+		t.Errorf("expected backend session to be destroyed, got %v", mockBackend.destroyed)
+	}
+}
+
+func TestSessionSupervisor_Expire_Skipped(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockDB.sessions["sess_1"] = newExpiringSession("sess_1", SessionStatusStopped, time.Now())
+	mockBackend := &mockBackendHandler{}
+	supervisor := NewSessionSupervisor(mockDB, mockBackend)
+
+	if err := supervisor.expire(context.Background(), "sess_1"); err != nil {
+		t.Fatalf("expire failed: %v", err)
+	}
+	if mockDB.sessions["sess_1"].Status != SessionStatusStopped {
+		t.Errorf("expected status %s to be kept, got %s", SessionStatusStopped, mockDB.sessions["sess_1"].Status)
+	}
+	if len(mockBackend.destroyed) != 0 {
+		t.Errorf("expected no backend session to be destroyed, got %v", mockBackend.destroyed)
+	}
+}
+
+// claimLostDB reports every session as already ended by someone else when
+// the supervisor tries to claim it.
+type claimLostDB struct {
+	*mockHandlerDB
+}
+
+func (m *claimLostDB) EndActiveSession(ctx context.Context, id string, update *db.SessionUpdate) (bool, error) {
+	return false, nil
+}
+
+func TestSessionSupervisor_Expire_ClaimedElsewhere(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockDB.sessions["sess_1"] = newExpiringSession("sess_1", SessionStatusRunning, time.Now())
+	mockBackend := &mockBackendHandler{}
+	supervisor := NewSessionSupervisor(&claimLostDB{mockDB}, mockBackend)
+
+	if err := supervisor.expire(context.Background(), "sess_1"); err != nil {
+		t.Fatalf("expire failed: %v", err)
+	}
+	if len(mockBackend.destroyed) != 0 {
+		t.Errorf("expected the replica that claimed the session to destroy it, got %v", mockBackend.destroyed)
+	}
+}
+
+func TestSessionSupervisor_Expire_DestroyFails(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	mockDB.sessions["sess_1"] = newExpiringSession("sess_1", SessionStatusRunning, time.Now())
+	supervisor := NewSessionSupervisor(mockDB, &mockBackendHandler{destroyErr: errors.New("machine busy")})
+
+	// The session is claimed first, so a failed destroy is not retried forever
+	if err := supervisor.expire(context.Background(), "sess_1"); err != nil {
+		t.Fatalf("expire failed: %v", err)
+	}
+	if mockDB.sessions["sess_1"].Status != SessionStatusTimeout {
+		t.Errorf("expected status %s, got %s", SessionStatusTimeout, mockDB.sessions["sess_1"].Status)
+	}
+}
+
+func TestSessionService_CreateSession_SetsDeadline(t *testing.T) {
+	mockDB := newMockHandlerDB()
+	sessionSvc := NewSessionService(mockDB, &mockBackendHandler{})
+	supervisor := NewSessionSupervisor(mockDB, &mockBackendHandler{})
+	sessionSvc.SetSupervisor(supervisor)
+
+	ctx := WithAPIKeyTier(WithAPIKeyID(context.Background(), uuid.New()), TierFree)
+	output, err := sessionSvc.CreateSession(ctx, &CreateSessionInput{
+		Body: CreateSessionRequest{
+			Image:     "python:3.12",
+			Resources: &Resources{TimeoutMs: 5000},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	defer supervisor.Forget(output.Body.ID)
+
+	session := mockDB.sessions[output.Body.ID]
+	if session.ExpiresAt == nil || !session.ExpiresAt.Equal(session.CreatedAt.Add(5*time.Second)) {
+		t.Errorf("expected deadline 5s after creation, got %v", session.ExpiresAt)
+	}
+	if output.Body.ExpiresAt == nil {
+		t.Error("expected expiresAt in response")
+	}
+
+	supervisor.mu.Lock()
+	_, watched := supervisor.timers[output.Body.ID]
+	supervisor.mu.Unlock()
+	if !watched {
+		t.Error("expected new session to be watched")
+	}
+}
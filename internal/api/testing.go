@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,29 +16,66 @@ import (
 type mockDB struct {
 	mu            sync.RWMutex
 	apiKeys       map[string]*db.APIKey
+	rotatingKeys  map[string]*db.APIKey // Previous values of keys rotated with an overlap
+	notifiedKeys  map[uuid.UUID]bool    // Keys whose owners were notified of their expiration
 	lastUsedCalls map[uuid.UUID]int
 	sessions      map[string]*db.Session
+	accounts      map[uuid.UUID]*db.Account
+	members       map[uuid.UUID]*db.AccountMember
+	invitations   map[uuid.UUID]*db.AccountInvitation
+	auditEntries  []*db.AuditEntry
+	budgetAlerts  []*db.BudgetAlert
 }
 
 func newMockDB() *mockDB {
 	return &mockDB{
 		apiKeys:       make(map[string]*db.APIKey),
+		rotatingKeys:  make(map[string]*db.APIKey),
+		notifiedKeys:  make(map[uuid.UUID]bool),
 		lastUsedCalls: make(map[uuid.UUID]int),
 		sessions:      make(map[string]*db.Session),
+		accounts:      make(map[uuid.UUID]*db.Account),
+		members:       make(map[uuid.UUID]*db.AccountMember),
+		invitations:   make(map[uuid.UUID]*db.AccountInvitation),
 	}
 }
 
+// keyCopy returns a copy of an API key with its member's role, and the free
+// tier and its rate limit once its tier expired, as the database reads it.
+// Callers hold m.mu.
+func (m *mockDB) keyCopy(apiKey *db.APIKey) *db.APIKey {
+	keyCopy := *apiKey
+	keyCopy.MemberRole = nil
+	if apiKey.TierExpiresAt != nil && !apiKey.TierExpiresAt.After(time.Now()) {
+		keyCopy.Tier = TierFree
+		keyCopy.RateLimitRPS = 10
+	}
+	if apiKey.MemberID != nil {
+		if member, ok := m.members[*apiKey.MemberID]; ok {
+			role := member.Role
+			keyCopy.MemberRole = &role
+		}
+	}
+	return &keyCopy
+}
+
 func (m *mockDB) GetAPIKeyByKey(ctx context.Context, key string) (*db.APIKey, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	apiKey, ok := m.apiKeys[key]
 	if !ok {
-		return nil, fmt.Errorf("API key not found")
+		// The previous value of a rotated key works until the overlap ends
+		apiKey, ok = m.rotatingKeys[key]
+		if !ok || apiKey.RotatingExpiresAt == nil || !apiKey.RotatingExpiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("API key not found")
+		}
+		keyCopy := m.keyCopy(apiKey)
+		keyCopy.UsedRotatingKey = true
+		return keyCopy, nil
 	}
 	// Return a copy to avoid race conditions
-	keyCopy := *apiKey
-	return &keyCopy, nil
+	return m.keyCopy(apiKey), nil
 }
 
 func (m *mockDB) UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID) error {
@@ -99,27 +138,222 @@ func (m *mockDB) UpdateSession(ctx context.Context, id string, update *db.Sessio
 	if update.Ports != nil {
 		session.Ports = update.Ports
 	}
+	if update.CPUMillisUsed != nil {
+		session.CPUMillisUsed = update.CPUMillisUsed
+	}
+	if update.MemoryPeakMB != nil {
+		session.MemoryPeakMB = update.MemoryPeakMB
+	}
 
 	return nil
 }
 
-func (m *mockDB) ListSessions(ctx context.Context, apiKeyID uuid.UUID, status *string) ([]db.Session, error) {
+func (m *mockDB) EndActiveSession(ctx context.Context, id string, update *db.SessionUpdate) (bool, error) {
+	m.mu.RLock()
+	session, ok := m.sessions[id]
+	active := ok && isActiveStatus(session.Status)
+	m.mu.RUnlock()
+	if !active {
+		return false, nil
+	}
+	if err := m.UpdateSession(ctx, id, update); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *mockDB) RecordSessionSample(ctx context.Context, id string, sample *db.SessionSample) (*db.SessionSampleResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session not found")
+	}
+	return applySessionSample(session, sample), nil
+}
+
+// applySessionSample records a usage sample on a session the way
+// db.Client.RecordSessionSample does.
+func applySessionSample(session *db.Session, sample *db.SessionSample) *db.SessionSampleResult {
+	previous, stored := sample.PreviousSampledAt, session.LastSampledAt
+	recorded := (previous == nil && stored == nil) || (previous != nil && stored != nil && previous.Equal(*stored))
+	if recorded {
+		var cpuMillis, memoryMB int64
+		if session.CPUMillisUsed != nil {
+			cpuMillis = *session.CPUMillisUsed
+		}
+		if session.MemoryPeakMB != nil {
+			memoryMB = *session.MemoryPeakMB
+		}
+		cpuMillis = max(cpuMillis+sample.CPUMillisAdded, sample.CPUMillis)
+		memoryMB = max(memoryMB, sample.MemoryPeakMB)
+		sampledAt := sample.SampledAt
+		session.CPUMillisUsed = &cpuMillis
+		session.MemoryPeakMB = &memoryMB
+		session.LastSampledAt = &sampledAt
+	}
+	return &db.SessionSampleResult{
+		CPUMillisUsed: session.CPUMillisUsed,
+		MemoryPeakMB:  session.MemoryPeakMB,
+		LastSampledAt: session.LastSampledAt,
+		Recorded:      recorded,
+	}
+}
+
+func (m *mockDB) ListSessions(ctx context.Context, filter *db.SessionFilter) ([]db.Session, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	var sessions []db.Session
 	for _, session := range m.sessions {
-		if session.APIKeyID == apiKeyID {
-			if status == nil || session.Status == *status {
-				sessCopy := *session
-				sessions = append(sessions, sessCopy)
+		sessions = append(sessions, *session)
+	}
+
+	return filterSessions(sessions, filter), nil
+}
+
+// filterSessions applies a session filter the way db.Client.ListSessions does:
+// matching sessions ordered by (created_at, id), from the page key on, up to
+// the limit.
+func filterSessions(sessions []db.Session, filter *db.SessionFilter) []db.Session {
+	less := func(a, b *db.Session) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	}
+	var cursor *db.Session
+	if filter.AfterCreatedAt != nil {
+		cursor = &db.Session{ID: filter.AfterID, CreatedAt: *filter.AfterCreatedAt}
+	}
+
+	var matched []db.Session
+	for i := range sessions {
+		session := &sessions[i]
+		switch {
+		case session.APIKeyID != filter.APIKeyID:
+			continue
+		case filter.Status != nil && session.Status != *filter.Status:
+			continue
+		case filter.Image != nil && session.Image != *filter.Image:
+			continue
+		case filter.Backend != nil && (session.Backend == nil || *session.Backend != *filter.Backend):
+			continue
+		case filter.ExitCode != nil && (session.ExitCode == nil || *session.ExitCode != *filter.ExitCode):
+			continue
+		case filter.CreatedAfter != nil && session.CreatedAt.Before(*filter.CreatedAfter):
+			continue
+		case filter.CreatedBefore != nil && !session.CreatedAt.Before(*filter.CreatedBefore):
+			continue
+		case cursor != nil && filter.Ascending && !less(cursor, session):
+			continue
+		case cursor != nil && !filter.Ascending && !less(session, cursor):
+			continue
+		}
+		hasLabels := true
+		for key, value := range filter.Labels {
+			if v, ok := session.Labels[key]; !ok || v != value {
+				hasLabels = false
 			}
 		}
+		if hasLabels {
+			matched = append(matched, *session)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if filter.Ascending {
+			return less(&matched[i], &matched[j])
+		}
+		return less(&matched[j], &matched[i])
+	})
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched
+}
+
+func (m *mockDB) ListExpiringSessions(ctx context.Context) ([]db.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []db.Session
+	for _, session := range m.sessions {
+		if session.ExpiresAt != nil && isActiveStatus(session.Status) {
+			sessCopy := *session
+			sessions = append(sessions, sessCopy)
+		}
 	}
 
 	return sessions, nil
 }
 
+func (m *mockDB) ListActiveSessions(ctx context.Context) ([]db.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []db.Session
+	for _, session := range m.sessions {
+		if isActiveStatus(session.Status) {
+			sessCopy := *session
+			sessions = append(sessions, sessCopy)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (m *mockDB) CountActiveSessionsByTier(ctx context.Context) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, session := range m.sessions {
+		if !isActiveStatus(session.Status) {
+			continue
+		}
+		for _, key := range m.apiKeys {
+			if key.ID == session.APIKeyID {
+				counts[key.Tier]++
+			}
+		}
+	}
+
+	return counts, nil
+}
+
+func (m *mockDB) GetActiveSessionByBackendID(ctx context.Context, backendID string) (*db.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, session := range m.sessions {
+		if session.GetBackendID() == backendID && isActiveStatus(session.Status) {
+			sessCopy := *session
+			return &sessCopy, nil
+		}
+	}
+
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockDB) FilterKnownBackendIDs(ctx context.Context, backendIDs []string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var known []string
+	for _, id := range backendIDs {
+		for _, session := range m.sessions {
+			if session.GetBackendID() == id {
+				known = append(known, id)
+				break
+			}
+		}
+	}
+
+	return known, nil
+}
+
 func (m *mockDB) DeleteSession(ctx context.Context, id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -158,6 +392,32 @@ func (m *mockDB) GetDailySessionCount(ctx context.Context, apiKeyID uuid.UUID) (
 	return count, nil
 }
 
+func (m *mockDB) GetAccountActiveSessionCount(ctx context.Context, accountID uuid.UUID) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, session := range m.sessions {
+		if session.AccountID == accountID && (session.Status == "running" || session.Status == "pending") {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockDB) GetAccountDailySessionCount(ctx context.Context, accountID uuid.UUID) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, session := range m.sessions {
+		if session.AccountID == accountID {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (m *mockDB) CreateQuotaRequest(ctx context.Context, req *db.QuotaRequest) (*db.QuotaRequest, error) {
 	req.ID = 1
 	req.Status = "pending"
@@ -165,6 +425,86 @@ func (m *mockDB) CreateQuotaRequest(ctx context.Context, req *db.QuotaRequest) (
 	return req, nil
 }
 
+func (m *mockDB) CreateBuild(ctx context.Context, build *db.Build) error {
+	return nil
+}
+
+func (m *mockDB) GetBuild(ctx context.Context, id string) (*db.Build, error) {
+	return nil, fmt.Errorf("build not found")
+}
+
+func (m *mockDB) UpdateBuild(ctx context.Context, id string, update *db.BuildUpdate) error {
+	return nil
+}
+
+func (m *mockDB) FailStaleBuilds(ctx context.Context, startedBefore, queuedBefore time.Time, excluding []string, reason string) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockDB) CreateWebhook(ctx context.Context, hook *db.Webhook) error {
+	return nil
+}
+
+func (m *mockDB) GetWebhook(ctx context.Context, id uuid.UUID) (*db.Webhook, error) {
+	return nil, fmt.Errorf("webhook not found")
+}
+
+func (m *mockDB) ListWebhooks(ctx context.Context, accountID uuid.UUID) ([]db.Webhook, error) {
+	return nil, nil
+}
+
+func (m *mockDB) ListWebhooksForEvent(ctx context.Context, accountID uuid.UUID, eventType string) ([]db.Webhook, error) {
+	return nil, nil
+}
+
+func (m *mockDB) UpdateWebhook(ctx context.Context, id uuid.UUID, update *db.WebhookUpdate) error {
+	return fmt.Errorf("webhook not found")
+}
+
+func (m *mockDB) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return fmt.Errorf("webhook not found")
+}
+
+func (m *mockDB) CreateWebhookDelivery(ctx context.Context, delivery *db.WebhookDelivery) error {
+	return nil
+}
+
+func (m *mockDB) ClaimWebhookDeliveries(ctx context.Context, limit int, leaseUntil time.Time) ([]db.DueWebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *mockDB) RecordWebhookDeliveryAttempt(ctx context.Context, id uuid.UUID, result *db.WebhookDeliveryResult) error {
+	return nil
+}
+
+func (m *mockDB) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]db.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *mockDB) CreateSessionEvent(ctx context.Context, event *db.SessionEvent) error {
+	return nil
+}
+
+func (m *mockDB) ListSessionEvents(ctx context.Context, accountID uuid.UUID, afterID int64, limit int) ([]db.SessionEvent, error) {
+	return nil, nil
+}
+
+func (m *mockDB) GetLatestSessionEventID(ctx context.Context, accountID uuid.UUID) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockDB) PruneSessionEvents(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockDB) TakeRateLimitToken(ctx context.Context, key string, rate, burst float64) (bool, float64, error) {
+	return true, burst - 1, nil
+}
+
+func (m *mockDB) PruneRateLimitBuckets(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
 func (m *mockDB) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*db.APIKey, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -172,8 +512,7 @@ func (m *mockDB) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*db.APIKey, e
 	for _, apiKey := range m.apiKeys {
 		if apiKey.ID == id {
 			// Return a copy to avoid race conditions
-			keyCopy := *apiKey
-			return &keyCopy, nil
+			return m.keyCopy(apiKey), nil
 		}
 	}
 	return nil, fmt.Errorf("API key not found")
@@ -183,6 +522,26 @@ func (m *mockDB) CreateAPIKey(ctx context.Context, email string, name *string) (
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	account := &db.Account{
+		ID:        uuid.New(),
+		Name:      name,
+		Email:     &email,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+	m.accounts[account.ID] = account
+
+	owner := &db.AccountMember{
+		ID:        uuid.New(),
+		AccountID: account.ID,
+		Email:     email,
+		Name:      name,
+		Role:      RoleOwner,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+	m.members[owner.ID] = owner
+
 	key := fmt.Sprintf("sk_test_%s", randHex(32))
 	apiKey := &db.APIKey{
 		ID:           uuid.New(),
@@ -191,13 +550,303 @@ func (m *mockDB) CreateAPIKey(ctx context.Context, email string, name *string) (
 		Tier:         "free",
 		RateLimitRPS: 10,
 		CreatedAt:    time.Now().UTC(),
+		IsActive:     true,
+		AccountID:    account.ID,
+		MemberID:     &owner.ID,
+		MemberRole:   &owner.Role,
 	}
 	m.apiKeys[key] = apiKey
 	return apiKey, nil
 }
 
+// Account stubs
+
+func (m *mockDB) GetAccount(ctx context.Context, id uuid.UUID) (*db.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("account not found")
+	}
+	accountCopy := *account
+	return &accountCopy, nil
+}
+
+func (m *mockDB) UpdateAccount(ctx context.Context, id uuid.UUID, update *db.AccountUpdate) (*db.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("account not found")
+	}
+	if update.Name != nil {
+		account.Name = update.Name
+	}
+	if update.Email != nil {
+		account.Email = update.Email
+	}
+	account.UpdatedAt = time.Now().UTC()
+	accountCopy := *account
+	return &accountCopy, nil
+}
+
+// Account member stubs
+
+func (m *mockDB) ListAccountMembers(ctx context.Context, accountID uuid.UUID) ([]db.AccountMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var members []db.AccountMember
+	for _, member := range m.members {
+		if member.AccountID == accountID {
+			members = append(members, *member)
+		}
+	}
+	return members, nil
+}
+
+func (m *mockDB) GetAccountMember(ctx context.Context, id uuid.UUID) (*db.AccountMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	member, ok := m.members[id]
+	if !ok {
+		return nil, fmt.Errorf("member not found")
+	}
+	memberCopy := *member
+	return &memberCopy, nil
+}
+
+func (m *mockDB) UpdateAccountMemberRole(ctx context.Context, id uuid.UUID, role string) (*db.AccountMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.members[id]
+	if !ok {
+		return nil, fmt.Errorf("member not found")
+	}
+	member.Role = role
+	member.UpdatedAt = time.Now().UTC()
+	memberCopy := *member
+	return &memberCopy, nil
+}
+
+func (m *mockDB) RemoveAccountMember(ctx context.Context, id uuid.UUID, performedBy string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[id]; !ok {
+		return fmt.Errorf("member not found")
+	}
+	for _, apiKey := range m.apiKeys {
+		if apiKey.MemberID != nil && *apiKey.MemberID == id {
+			apiKey.IsActive = false
+			apiKey.LastUpdatedBy = &performedBy
+			apiKey.MemberID = nil
+		}
+	}
+	delete(m.members, id)
+	return nil
+}
+
+func (m *mockDB) CreateAccountInvitation(ctx context.Context, inv *db.AccountInvitation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inv.CreatedAt = time.Now().UTC()
+	invCopy := *inv
+	m.invitations[inv.ID] = &invCopy
+	return nil
+}
+
+func (m *mockDB) ListAccountInvitations(ctx context.Context, accountID uuid.UUID) ([]db.AccountInvitation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var invitations []db.AccountInvitation
+	for _, inv := range m.invitations {
+		if inv.AccountID == accountID && inv.AcceptedAt == nil && inv.ExpiresAt.After(time.Now()) {
+			invitations = append(invitations, *inv)
+		}
+	}
+	return invitations, nil
+}
+
+func (m *mockDB) GetAccountInvitation(ctx context.Context, id uuid.UUID) (*db.AccountInvitation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	inv, ok := m.invitations[id]
+	if !ok {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	invCopy := *inv
+	return &invCopy, nil
+}
+
+func (m *mockDB) DeleteAccountInvitation(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.invitations[id]; !ok {
+		return fmt.Errorf("invitation not found")
+	}
+	delete(m.invitations, id)
+	return nil
+}
+
+func (m *mockDB) AcceptAccountInvitation(ctx context.Context, tokenHash string, name *string) (*db.AccountMember, *db.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var inv *db.AccountInvitation
+	for _, candidate := range m.invitations {
+		if candidate.TokenHash == tokenHash && candidate.AcceptedAt == nil && candidate.ExpiresAt.After(time.Now()) {
+			inv = candidate
+		}
+	}
+	if inv == nil {
+		return nil, nil, fmt.Errorf("invitation not found")
+	}
+	for _, member := range m.members {
+		if member.AccountID == inv.AccountID && member.Email == inv.Email {
+			return nil, nil, fmt.Errorf("already a member")
+		}
+	}
+
+	var primary *db.APIKey
+	for _, apiKey := range m.apiKeys {
+		if apiKey.AccountID == inv.AccountID && apiKey.ParentKeyID == nil {
+			primary = apiKey
+		}
+	}
+	if primary == nil {
+		return nil, nil, fmt.Errorf("failed to accept invitation: account has no primary key")
+	}
+
+	now := time.Now().UTC()
+	inv.AcceptedAt = &now
+	member := &db.AccountMember{
+		ID:        uuid.New(),
+		AccountID: inv.AccountID,
+		Email:     inv.Email,
+		Name:      name,
+		Role:      inv.Role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.members[member.ID] = member
+
+	key := fmt.Sprintf("sk_test_%s", randHex(32))
+	apiKey := &db.APIKey{
+		ID:           uuid.New(),
+		Key:          key,
+		Email:        &inv.Email,
+		Tier:         primary.Tier,
+		RateLimitRPS: primary.RateLimitRPS,
+		CreatedAt:    now,
+		IsActive:     true,
+		AccountID:    inv.AccountID,
+		ParentKeyID:  &primary.ID,
+		MemberID:     &member.ID,
+	}
+	m.apiKeys[key] = apiKey
+
+	memberCopy := *member
+	return &memberCopy, m.keyCopy(apiKey), nil
+}
+
+// Account audit log stubs
+
+func (m *mockDB) CreateAuditEntry(ctx context.Context, entry *db.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = int64(len(m.auditEntries) + 1)
+	entry.CreatedAt = time.Now().UTC()
+	entryCopy := *entry
+	m.auditEntries = append(m.auditEntries, &entryCopy)
+	return nil
+}
+
+func (m *mockDB) ListAuditEntries(ctx context.Context, accountID uuid.UUID, filter *db.AuditFilter) ([]db.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Entries are appended in order, so newest first is the reverse
+	var entries []db.AuditEntry
+	for i := len(m.auditEntries) - 1; i >= 0; i-- {
+		entry := m.auditEntries[i]
+		switch {
+		case entry.AccountID != accountID:
+			continue
+		case filter.ActorKeyID != nil && (entry.ActorKeyID == nil || *entry.ActorKeyID != *filter.ActorKeyID):
+			continue
+		case filter.ActorMemberID != nil && (entry.ActorMemberID == nil || *entry.ActorMemberID != *filter.ActorMemberID):
+			continue
+		case filter.Since != nil && entry.CreatedAt.Before(*filter.Since):
+			continue
+		case filter.Until != nil && !entry.CreatedAt.Before(*filter.Until):
+			continue
+		case filter.BeforeCreatedAt != nil && !entry.CreatedAt.Before(*filter.BeforeCreatedAt) &&
+			!(entry.CreatedAt.Equal(*filter.BeforeCreatedAt) && entry.ID < filter.BeforeID):
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+			if !strings.HasPrefix(entry.Action, prefix) {
+				continue
+			}
+		} else if filter.Action != "" && entry.Action != filter.Action {
+			continue
+		}
+		entries = append(entries, *entry)
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
 // Account-level usage query stubs
 
+func (m *mockDB) GetAccountSpend(ctx context.Context, accountID uuid.UUID, periodStart time.Time) (*db.AccountSpend, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	spend := &db.AccountSpend{}
+	for _, session := range m.sessions {
+		if session.AccountID == accountID && isActiveStatus(session.Status) && !session.CreatedAt.Before(periodStart) {
+			spend.ActiveSessionStarts = append(spend.ActiveSessionStarts, session.CreatedAt)
+		}
+	}
+	return spend, nil
+}
+
+func (m *mockDB) CreateBudgetAlert(ctx context.Context, alert *db.BudgetAlert) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.budgetAlerts {
+		if existing.AccountID == alert.AccountID && existing.BillingPeriodStart.Equal(alert.BillingPeriodStart) {
+			return false, nil
+		}
+	}
+	alert.ID = int64(len(m.budgetAlerts) + 1)
+	alert.CreatedAt = time.Now().UTC()
+	m.budgetAlerts = append(m.budgetAlerts, alert)
+	return true, nil
+}
+
+func (m *mockDB) ClaimBudgetAlerts(ctx context.Context, limit int, leaseUntil time.Time) ([]db.BudgetAlert, error) {
+	return nil, nil
+}
+
+func (m *mockDB) RecordBudgetAlertDelivery(ctx context.Context, id int64, attempts int, deliveredAt, nextDeliveryAt *time.Time) error {
+	return nil
+}
+
 func (m *mockDB) GetAccountLimits(ctx context.Context, accountID uuid.UUID) (*db.AccountLimits, error) {
 	return nil, fmt.Errorf("account limits not found")
 }
@@ -227,30 +876,40 @@ func (m *mockDB) GetAPIKeysByAccount(ctx context.Context, accountID uuid.UUID) (
 	var keys []db.APIKey
 	for _, apiKey := range m.apiKeys {
 		if apiKey.AccountID == accountID {
-			keyCopy := *apiKey
-			keys = append(keys, keyCopy)
+			keys = append(keys, *m.keyCopy(apiKey))
 		}
 	}
 	return keys, nil
 }
 
-func (m *mockDB) CreateAPIKeyForAccount(ctx context.Context, accountID uuid.UUID, name, description string, parentKeyID uuid.UUID) (*db.APIKey, error) {
+func (m *mockDB) CreateAPIKeyForAccount(ctx context.Context, accountID uuid.UUID, name, description string, parentKeyID uuid.UUID, scopes []string) (*db.APIKey, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// The new key belongs to the parent key's member
+	var memberID *uuid.UUID
+	for _, apiKey := range m.apiKeys {
+		if apiKey.ID == parentKeyID {
+			memberID = apiKey.MemberID
+		}
+	}
+
 	key := fmt.Sprintf("sk_test_%s", randHex(32))
 	apiKey := &db.APIKey{
-		ID:          uuid.New(),
-		Key:         key,
-		Tier:        "free",
+		ID:           uuid.New(),
+		Key:          key,
+		Tier:         "free",
 		RateLimitRPS: 10,
-		CreatedAt:   time.Now().UTC(),
-		IsActive:    true,
-		AccountID:   accountID,
-		ParentKeyID: &parentKeyID,
-		Name:        &name,
-		Description: &description,
+		CreatedAt:    time.Now().UTC(),
+		IsActive:     true,
+		AccountID:    accountID,
+		ParentKeyID:  &parentKeyID,
+		Name:         &name,
+		Description:  &description,
+		MemberID:     memberID,
+		Scopes:       scopes,
 	}
+	apiKey.MemberRole = m.keyCopy(apiKey).MemberRole
 	m.apiKeys[key] = apiKey
 	return apiKey, nil
 }
@@ -272,6 +931,7 @@ func (m *mockDB) UpdateAPIKey(ctx context.Context, keyID uuid.UUID, update *db.A
 			}
 			if update.ExpiresAt != nil {
 				apiKey.ExpiresAt = update.ExpiresAt
+				delete(m.notifiedKeys, apiKey.ID)
 			}
 			if update.CustomDailyLimit != nil {
 				apiKey.CustomDailyLimit = update.CustomDailyLimit
@@ -302,14 +962,25 @@ func (m *mockDB) DeactivateAPIKey(ctx context.Context, keyID uuid.UUID, performe
 	return fmt.Errorf("API key not found")
 }
 
-func (m *mockDB) RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string) (*db.APIKey, error) {
+func (m *mockDB) RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string, overlap time.Duration) (*db.APIKey, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for oldKey, apiKey := range m.apiKeys {
 		if apiKey.ID == keyID {
-			// Remove old key mapping
+			// Remove old key mapping, keeping it for the overlap if any
 			delete(m.apiKeys, oldKey)
+			for rotatingKey, rotating := range m.rotatingKeys {
+				if rotating.ID == keyID {
+					delete(m.rotatingKeys, rotatingKey)
+				}
+			}
+			apiKey.RotatingExpiresAt = nil
+			if overlap > 0 {
+				expiresAt := time.Now().UTC().Add(overlap)
+				apiKey.RotatingExpiresAt = &expiresAt
+				m.rotatingKeys[oldKey] = apiKey
+			}
 
 			// Generate new key
 			newKey := fmt.Sprintf("sk_test_%s", randHex(32))
@@ -319,13 +990,78 @@ func (m *mockDB) RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy
 			// Store with new key
 			m.apiKeys[newKey] = apiKey
 
-			keyCopy := *apiKey
-			return &keyCopy, nil
+			return m.keyCopy(apiKey), nil
 		}
 	}
 	return nil, fmt.Errorf("API key not found")
 }
 
+func (m *mockDB) ListAPIKeysExpiringBefore(ctx context.Context, before time.Time) ([]db.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var keys []db.APIKey
+	for _, apiKey := range m.apiKeys {
+		if apiKey.IsActive && apiKey.ExpiresAt != nil && apiKey.ExpiresAt.After(now) &&
+			!apiKey.ExpiresAt.After(before) && !m.notifiedKeys[apiKey.ID] {
+			keys = append(keys, *m.keyCopy(apiKey))
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockDB) ClaimAPIKeyExpiryNotice(ctx context.Context, keyID uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.notifiedKeys[keyID] {
+		return false, nil
+	}
+	m.notifiedKeys[keyID] = true
+	return true, nil
+}
+
+func (m *mockDB) ReleaseAPIKeyExpiryNotice(ctx context.Context, keyID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.notifiedKeys, keyID)
+	return nil
+}
+
+func (m *mockDB) DeactivateExpiredAPIKeys(ctx context.Context, expiredBefore time.Time, performedBy string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, apiKey := range m.apiKeys {
+		if apiKey.IsActive && apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(expiredBefore) {
+			apiKey.IsActive = false
+			apiKey.LastUpdatedBy = &performedBy
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockDB) DowngradeExpiredTiers(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	now := time.Now()
+	for _, apiKey := range m.apiKeys {
+		if apiKey.TierExpiresAt != nil && !apiKey.TierExpiresAt.After(now) {
+			apiKey.Tier = TierFree
+			apiKey.RateLimitRPS = 10
+			apiKey.TierExpiresAt = nil
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (m *mockDB) IsPrimaryKey(ctx context.Context, keyID uuid.UUID) (bool, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingServiceName identifies this service in exported traces.
+const tracingServiceName = "execbox-cloud"
+
+var tracer = otel.Tracer("github.com/burka/execbox-cloud/internal/api")
+
+// propagator reads and writes W3C trace context and baggage headers.
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// SetupTracing installs a tracer provider that exports spans over OTLP/HTTP to
+// the collector at endpoint, a base URL such as http://collector:4318, and
+// makes W3C trace context the global propagator. Sampling and resource
+// attributes follow the standard OTEL_* variables. With an empty endpoint,
+// tracing stays disabled and spans are dropped.
+//
+// The returned function flushes buffered spans and stops the exporter.
+func SetupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(strings.TrimSuffix(endpoint, "/")+"/v1/traces"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(tracingServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return provider.Shutdown, nil
+}
+
+// TracingMiddleware starts a server span for every request, continuing any trace
+// the caller propagated. The span carries the chi request ID, so traces can be
+// matched with request logs; it must run after middleware.RequestID.
+func TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("request.id", middleware.GetReqID(r.Context())),
+			))
+		defer span.End()
+
+		wrapped := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		// The route is only known once chi has matched it
+		if route := chi.RouteContext(r.Context()); route != nil && route.RoutePattern() != "" {
+			span.SetName(r.Method + " " + route.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", route.RoutePattern()))
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", wrapped.statusCode))
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
+	})
+}
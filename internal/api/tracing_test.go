@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/backend/fly"
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	testSpansOnce sync.Once
+	testSpans     *tracetest.InMemoryExporter
+)
+
+// recordSpans installs an in-memory exporter as the global tracer provider and
+// clears the spans recorded so far. Tracers created before the first provider is
+// installed stay bound to it, so all tests share the exporter.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	testSpansOnce.Do(func() {
+		testSpans = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(testSpans)))
+	})
+	testSpans.Reset()
+	return testSpans
+}
+
+// findSpan returns the recorded span with the given name.
+func findSpan(t *testing.T, spans *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q recorded", name)
+	return tracetest.SpanStub{}
+}
+
+// spanAttr returns the value of a span attribute as a string, or "" if unset.
+func spanAttr(span tracetest.SpanStub, key string) string {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	spans := recordSpans(t)
+
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(TracingMiddleware)
+	router.Get("/v1/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracer.Start(r.Context(), "handler")
+		span.End()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/sessions/sess_123", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	server := findSpan(t, spans, "GET /v1/sessions/{id}")
+	if got := server.SpanContext.TraceID().String(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("expected the propagated trace ID, got %s", got)
+	}
+	if spanAttr(server, "request.id") == "" {
+		t.Error("expected the chi request ID as a span attribute")
+	}
+	if got := spanAttr(server, "http.route"); got != "/v1/sessions/{id}" {
+		t.Errorf("expected http.route /v1/sessions/{id}, got %q", got)
+	}
+	if got := spanAttr(server, "http.response.status_code"); got != "500" {
+		t.Errorf("expected status code 500, got %q", got)
+	}
+	if server.Status.Code != codes.Error {
+		t.Errorf("expected error status, got %v", server.Status.Code)
+	}
+
+	handler := findSpan(t, spans, "handler")
+	if handler.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("expected handler span to be a child of the request span")
+	}
+}
+
+func TestHumaAuthMiddleware_RecordsSpan(t *testing.T) {
+	spans := recordSpans(t)
+
+	mock := newMockDB()
+	keyID := uuid.New()
+	mock.apiKeys["valid-key"] = &db.APIKey{
+		ID:        keyID,
+		Key:       "valid-key",
+		Tier:      "pro",
+		IsActive:  true,
+		CreatedAt: time.Now(),
+	}
+
+	_, api := humatest.New(t)
+	huma.Register(api, huma.Operation{
+		OperationID: "check",
+		Method:      http.MethodGet,
+		Path:        "/check",
+		Middlewares: huma.Middlewares{humaAuthMiddleware(mock)},
+	}, func(ctx context.Context, input *struct{}) (*struct{}, error) {
+		return nil, nil
+	})
+
+	api.Get("/check", "Authorization: Bearer valid-key")
+	auth := findSpan(t, spans, "auth")
+	if got := spanAttr(auth, "execbox.api_key_id"); got != keyID.String() {
+		t.Errorf("expected API key ID %s on auth span, got %q", keyID, got)
+	}
+	if got := spanAttr(auth, "execbox.tier"); got != "pro" {
+		t.Errorf("expected tier pro on auth span, got %q", got)
+	}
+
+	spans.Reset()
+	api.Get("/check", "Authorization: Bearer wrong-key")
+	if auth := findSpan(t, spans, "auth"); auth.Status.Code != codes.Error {
+		t.Errorf("expected error status for invalid key, got %v", auth.Status.Code)
+	}
+}
+
+// phasedImageBuilder reports both build phases before returning an image.
+type phasedImageBuilder struct{}
+
+func (phasedImageBuilder) Resolve(ctx context.Context, spec *fly.BuildSpec, cache fly.BuildCache) (string, error) {
+	fly.ReportBuildProgress(ctx, fly.BuildPhaseBuilding, "")
+	fly.ReportBuildProgress(ctx, fly.BuildPhasePushing, "")
+	return "ttl.sh/execbox-built:4h", nil
+}
+
+func TestResolveImage_RecordsSpans(t *testing.T) {
+	spans := recordSpans(t)
+
+	spec := &fly.BuildSpec{BaseImage: "alpine", Setup: []string{"apk add git"}}
+	if _, err := resolveImage(context.Background(), phasedImageBuilder{}, spec, mapBuildCache{}); err != nil {
+		t.Fatalf("resolveImage failed: %v", err)
+	}
+
+	resolve := findSpan(t, spans, "image.resolve")
+	if got := spanAttr(resolve, "image.resolve.outcome"); got != "built" {
+		t.Errorf("expected outcome built, got %q", got)
+	}
+	for _, name := range []string{"build.building", "build.pushing"} {
+		if phase := findSpan(t, spans, name); phase.Parent.SpanID() != resolve.SpanContext.SpanID() {
+			t.Errorf("expected %s to be a child of image.resolve", name)
+		}
+	}
+}
+
+func TestSetupTracing(t *testing.T) {
+	// Keep the shared in-memory provider bound to the package tracers
+	recordSpans(t)
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	t.Run("disabled without endpoint", func(t *testing.T) {
+		shutdown, err := SetupTracing(context.Background(), "")
+		if err != nil {
+			t.Fatalf("SetupTracing failed: %v", err)
+		}
+		if otel.GetTracerProvider() != previous {
+			t.Error("expected the tracer provider to be left alone")
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("shutdown failed: %v", err)
+		}
+	})
+
+	t.Run("exports to collector", func(t *testing.T) {
+		var exports atomic.Int32
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+				exports.Add(1)
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer collector.Close()
+
+		shutdown, err := SetupTracing(context.Background(), collector.URL)
+		if err != nil {
+			t.Fatalf("SetupTracing failed: %v", err)
+		}
+		_, span := otel.Tracer("test").Start(context.Background(), "exported")
+		span.End()
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown failed: %v", err)
+		}
+
+		if exports.Load() == 0 {
+			t.Error("expected spans to be exported to the collector")
+		}
+	})
+}
@@ -1,11 +1,14 @@
 // Package api provides HTTP API types for execbox-cloud
 package api
 
+import "encoding/json"
+
 // --- Core Request/Response Types ---
 
 // CreateSessionRequest defines the request body for POST /v1/sessions
 type CreateSessionRequest struct {
-	Image     string            `json:"image" doc:"Container image (e.g., python:3.11, node:20)" example:"python:3.11" minLength:"1"`
+	Image     string            `json:"image,omitempty" doc:"Container image (e.g., python:3.11, node:20); required unless buildId is set" example:"python:3.11"`
+	BuildID   string            `json:"buildId,omitempty" doc:"ID of a ready build to run instead of image, setup and files" example:"build_abc123"`
 	Setup     []string          `json:"setup,omitempty" doc:"RUN commands to bake into image" example:"pip install requests"`
 	Files     []FileSpec        `json:"files,omitempty" doc:"Files to include in image"`
 	Command   []string          `json:"command,omitempty" doc:"Command to run in container" example:"python"`
@@ -14,6 +17,7 @@ type CreateSessionRequest struct {
 	Resources *Resources        `json:"resources,omitempty" doc:"Resource limits"`
 	Network   string            `json:"network,omitempty" doc:"Network mode: none, outgoing, or exposed" enum:"none,outgoing,exposed" example:"outgoing" default:"outgoing"`
 	Ports     []PortSpec        `json:"ports,omitempty" doc:"Ports to expose from container"`
+	Labels    map[string]string `json:"labels,omitempty" doc:"Key/value labels to find the session by in session lists"`
 }
 
 // FileSpec defines a file to include in the built image.
@@ -51,6 +55,7 @@ type CreateSessionResponse struct {
 	ID        string       `json:"id" doc:"Unique session identifier" example:"sess_abc123"`
 	Status    string       `json:"status" doc:"Session status" enum:"pending,building,running,stopped,failed" example:"building"`
 	CreatedAt string       `json:"createdAt" doc:"Session creation timestamp (RFC3339)" example:"2024-01-15T10:30:00Z"`
+	ExpiresAt *string      `json:"expiresAt,omitempty" doc:"When the session is destroyed with status timeout (RFC3339); omitted if unlimited" example:"2024-01-15T10:31:00Z"`
 	Network   *NetworkInfo `json:"network,omitempty" doc:"Network configuration (if network mode is exposed)"`
 }
 
@@ -69,19 +74,23 @@ type PortInfo struct {
 
 // SessionResponse defines the response body for GET /v1/sessions/{id}
 type SessionResponse struct {
-	ID        string       `json:"id"`
-	Status    string       `json:"status"`
-	Image     string       `json:"image"`
-	CreatedAt string       `json:"createdAt"`
-	StartedAt *string      `json:"startedAt,omitempty"`
-	EndedAt   *string      `json:"endedAt,omitempty"`
-	ExitCode  *int         `json:"exitCode,omitempty"`
-	Network   *NetworkInfo `json:"network,omitempty"`
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	Image     string            `json:"image"`
+	CreatedAt string            `json:"createdAt"`
+	StartedAt *string           `json:"startedAt,omitempty"`
+	EndedAt   *string           `json:"endedAt,omitempty"`
+	ExpiresAt *string           `json:"expiresAt,omitempty"`
+	ExitCode  *int              `json:"exitCode,omitempty"`
+	Network   *NetworkInfo      `json:"network,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Backend   *string           `json:"backend,omitempty"`
 }
 
 // ListSessionsResponse defines the response body for GET /v1/sessions
 type ListSessionsResponse struct {
-	Sessions []SessionResponse `json:"sessions"`
+	Sessions   []SessionResponse `json:"sessions"`
+	NextCursor *string           `json:"next_cursor,omitempty" doc:"Pass as cursor to get the next page; absent on the last page"`
 }
 
 // StopSessionResponse defines the response body for POST /v1/sessions/{id}/stop
@@ -89,15 +98,29 @@ type StopSessionResponse struct {
 	Status string `json:"status"`
 }
 
+// ExecRequest defines the request body for POST /v1/sessions/{id}/exec
+type ExecRequest struct {
+	Command   []string `json:"command" doc:"Command to run inside the session" example:"ls,-la" minItems:"1"`
+	TimeoutMs int      `json:"timeoutMs,omitempty" doc:"Per-call timeout in milliseconds" example:"30000" minimum:"100" maximum:"300000" default:"30000"`
+}
+
+// ExecResponse defines the response body for POST /v1/sessions/{id}/exec
+type ExecResponse struct {
+	ExitCode   int    `json:"exitCode" doc:"Exit code of the command" example:"0"`
+	Stdout     string `json:"stdout" doc:"Captured standard output" example:"hello"`
+	Stderr     string `json:"stderr" doc:"Captured standard error" example:""`
+	DurationMs int64  `json:"durationMs" doc:"Wall-clock duration of the command in milliseconds" example:"42"`
+}
+
 // GetURLResponse defines the response body for GET /v1/sessions/{id}/url
 type GetURLResponse struct {
-	ContainerPort int    `json:"containerPort"`
-	HostPort      int    `json:"hostPort"`
-	URL           string `json:"url"`
-	Protocol      string `json:"protocol"`
+	ContainerPort int    `json:"containerPort" doc:"Container port number" example:"8080"`
+	HostPort      int    `json:"hostPort" doc:"Port the URL points at (may differ from the container port)" example:"32789"`
+	URL           string `json:"url" doc:"URL through which the port is reachable" example:"http://localhost:32789"`
+	Protocol      string `json:"protocol" doc:"Protocol: tcp or udp" example:"tcp"`
 }
 
-// UploadFileResponse defines the response body for POST /v1/sessions/{id}/files
+// UploadFileResponse defines the response body for PUT /v1/sessions/{id}/files/*path
 type UploadFileResponse struct {
 	Path string `json:"path"`
 	Size int64  `json:"size"`
@@ -105,16 +128,36 @@ type UploadFileResponse struct {
 
 // FileEntry represents a file or directory in a listing
 type FileEntry struct {
-	Name  string `json:"name"`
-	Size  int64  `json:"size"`
-	IsDir bool   `json:"isDir"`
-	Mode  uint32 `json:"mode"`
+	Name  string `json:"name" doc:"Entry name" example:"main.py"`
+	Size  int64  `json:"size" doc:"Size in bytes" example:"1234"`
+	IsDir bool   `json:"isDir" doc:"Whether the entry is a directory" example:"false"`
+	Mode  uint32 `json:"mode" doc:"Permission bits" example:"420"`
 }
 
-// ListDirectoryResponse defines the response body for GET /v1/sessions/{id}/files?list=true
+// ListDirectoryResponse defines the response body for GET /v1/sessions/{id}/files?dir=
 type ListDirectoryResponse struct {
-	Path    string      `json:"path"`
-	Entries []FileEntry `json:"entries"`
+	Path    string      `json:"path" doc:"Listed directory" example:"/app"`
+	Entries []FileEntry `json:"entries" doc:"Directory entries"`
+}
+
+// CreateBuildRequest defines the request body for POST /v1/builds
+type CreateBuildRequest struct {
+	Image string     `json:"image" doc:"Base image to build on" example:"python:3.12" minLength:"1"`
+	Setup []string   `json:"setup,omitempty" doc:"RUN commands to bake into image" example:"pip install requests"`
+	Files []FileSpec `json:"files,omitempty" doc:"Files to include in image"`
+}
+
+// BuildResponse defines the response body for /v1/builds endpoints
+type BuildResponse struct {
+	ID          string  `json:"id" doc:"Unique build identifier" example:"build_abc123"`
+	Phase       string  `json:"phase" doc:"Build phase" enum:"queued,building,pushing,ready,failed" example:"building"`
+	Image       string  `json:"image" doc:"Base image the build started from" example:"python:3.12"`
+	RegistryTag *string `json:"registryTag,omitempty" doc:"Built image reference, set once the build is ready" example:"ttl.sh/execbox-3f2a9c1d0e4b5a67:4h"`
+	Error       *string `json:"error,omitempty" doc:"Failure reason, set if the build failed"`
+	Logs        *string `json:"logs,omitempty" doc:"Tail of the builder log"`
+	CreatedAt   string  `json:"createdAt" doc:"Build creation timestamp (RFC3339)" example:"2024-01-15T10:30:00Z"`
+	StartedAt   *string `json:"startedAt,omitempty" doc:"When the builder started (RFC3339)"`
+	CompletedAt *string `json:"completedAt,omitempty" doc:"When the build became ready or failed (RFC3339)"`
 }
 
 // QuotaRequestRequest defines the request body for POST /v1/quota-requests
@@ -135,8 +178,10 @@ type QuotaRequestResponse struct {
 	CreatedAt string `json:"created_at"`
 }
 
-// AccountResponse defines the response body for GET /v1/account
+// AccountResponse defines the response body for GET and PATCH /v1/account
 type AccountResponse struct {
+	ID            string  `json:"id" doc:"Account identifier" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Name          *string `json:"name,omitempty" doc:"Account name" example:"Acme Inc"`
 	Tier          string  `json:"tier" doc:"Account tier (free, developer, enterprise)" example:"developer"`
 	Email         *string `json:"email,omitempty" doc:"Account email address" example:"user@example.com"`
 	APIKeyID      string  `json:"api_key_id" doc:"API key identifier" example:"uuid-here"`
@@ -187,6 +232,17 @@ type CreateSessionOutput struct {
 
 // ListSessionsInput is the input for GET /v1/sessions.
 type ListSessionsInput struct {
+	Status   string   `query:"status" doc:"Only sessions with this status" enum:"pending,running,stopped,killed,failed,timeout"`
+	Image    string   `query:"image" doc:"Only sessions running this image" example:"python:3.11"`
+	Backend  string   `query:"backend" doc:"Only sessions run by this backend" enum:"fly,kubernetes"`
+	ExitCode string   `query:"exit_code" doc:"Only sessions that exited with this code" example:"0"`
+	APIKeyID string   `query:"api_key_id" doc:"List the sessions of this key of the account instead of the calling key; other members' keys require the owner or admin role" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Label    []string `query:"label,explode" doc:"Only sessions carrying this label, as key=value; repeat to require several" example:"team=ml"`
+	Since    string   `query:"since" doc:"Only sessions created at or after this time (RFC3339)" example:"2024-01-01T00:00:00Z"`
+	Until    string   `query:"until" doc:"Only sessions created before this time (RFC3339)" example:"2024-02-01T00:00:00Z"`
+	Order    string   `query:"order" doc:"Newest (desc) or oldest (asc) first" enum:"desc,asc" default:"desc"`
+	Cursor   string   `query:"cursor" doc:"next_cursor of the previous page"`
+	Limit    int      `query:"limit" doc:"Maximum sessions to return" default:"50" minimum:"1" maximum:"500"`
 }
 
 // ListSessionsOutput is the output for GET /v1/sessions.
@@ -223,6 +279,59 @@ type KillSessionInput struct {
 type KillSessionOutput struct {
 }
 
+// ExecSessionInput is the input for POST /v1/sessions/{id}/exec.
+type ExecSessionInput struct {
+	ID   string `path:"id" doc:"Session ID" example:"sess_abc123" minLength:"1"`
+	Body ExecRequest
+}
+
+// ExecSessionOutput is the output for POST /v1/sessions/{id}/exec.
+type ExecSessionOutput struct {
+	Body ExecResponse
+}
+
+// ListFilesInput is the input for GET /v1/sessions/{id}/files.
+type ListFilesInput struct {
+	ID  string `path:"id" doc:"Session ID" example:"sess_abc123" minLength:"1"`
+	Dir string `query:"dir" doc:"Absolute directory path to list" example:"/app" default:"/"`
+}
+
+// ListFilesOutput is the output for GET /v1/sessions/{id}/files.
+type ListFilesOutput struct {
+	Body ListDirectoryResponse
+}
+
+// GetURLInput is the input for GET /v1/sessions/{id}/url.
+type GetURLInput struct {
+	ID   string `path:"id" doc:"Session ID" example:"sess_abc123" minLength:"1"`
+	Port int    `query:"port" doc:"Container port declared at session creation" example:"8080" minimum:"1" maximum:"65535" required:"true"`
+}
+
+// GetURLOutput is the output for GET /v1/sessions/{id}/url.
+type GetURLOutput struct {
+	Body GetURLResponse
+}
+
+// CreateBuildInput is the input for POST /v1/builds.
+type CreateBuildInput struct {
+	Body CreateBuildRequest
+}
+
+// CreateBuildOutput is the output for POST /v1/builds.
+type CreateBuildOutput struct {
+	Body BuildResponse
+}
+
+// GetBuildInput is the input for GET /v1/builds/{id}.
+type GetBuildInput struct {
+	ID string `path:"id" doc:"Build ID" example:"build_abc123" minLength:"1"`
+}
+
+// GetBuildOutput is the output for GET /v1/builds/{id}.
+type GetBuildOutput struct {
+	Body BuildResponse
+}
+
 // AttachSessionInput is the input for GET /v1/sessions/{id}/attach (WebSocket upgrade).
 type AttachSessionInput struct {
 	ID string `path:"id" doc:"Session ID" example:"sess_abc123" minLength:"1"`
@@ -247,6 +356,22 @@ type GetAccountOutput struct {
 	Body AccountResponse
 }
 
+// UpdateAccountRequest defines the request body for PATCH /v1/account
+type UpdateAccountRequest struct {
+	Name  *string `json:"name,omitempty" doc:"Account name" example:"Acme Inc"`
+	Email *string `json:"email,omitempty" doc:"Account email address" example:"team@example.com" format:"email"`
+}
+
+// UpdateAccountInput is the input for PATCH /v1/account.
+type UpdateAccountInput struct {
+	Body UpdateAccountRequest
+}
+
+// UpdateAccountOutput is the output for PATCH /v1/account.
+type UpdateAccountOutput struct {
+	Body AccountResponse
+}
+
 // GetUsageInput is the input for GET /v1/account/usage.
 type GetUsageInput struct {
 }
@@ -292,19 +417,23 @@ type EnhancedUsageResponse struct {
 
 // HourlyUsage defines usage metrics for a single hour
 type HourlyUsage struct {
-	Hour       string `json:"hour" doc:"Hour in ISO8601 format" example:"2024-01-15T10:00:00Z"`
-	Executions int    `json:"executions" doc:"Number of executions in this hour" example:"42"`
-	CostCents  int64  `json:"cost_cents" doc:"Cost in cents for this hour" example:"25"`
-	Errors     int    `json:"errors" doc:"Number of errors in this hour" example:"2"`
+	Hour            string `json:"hour" doc:"Hour in ISO8601 format" example:"2024-01-15T10:00:00Z"`
+	Executions      int    `json:"executions" doc:"Number of executions in this hour" example:"42"`
+	CostCents       int64  `json:"cost_cents" doc:"Cost in cents for this hour" example:"25"`
+	CPUMillis       int64  `json:"cpu_millis" doc:"CPU time used by sessions in this hour, in milliseconds" example:"84000"`
+	MemoryMBSeconds int64  `json:"memory_mb_seconds" doc:"Peak memory times duration of sessions in this hour, in MB-seconds" example:"21504"`
+	Errors          int    `json:"errors" doc:"Number of errors in this hour" example:"2"`
 }
 
 // DayUsage defines usage metrics for a single day
 type DayUsage struct {
-	Date       string `json:"date" doc:"Date in ISO8601 format" example:"2024-01-15"`
-	Executions int    `json:"executions" doc:"Number of executions on this day" example:"125"`
-	DurationMs int64  `json:"duration_ms" doc:"Total execution duration in milliseconds" example:"125000"`
-	CostCents  int64  `json:"cost_cents" doc:"Cost in cents for this day" example:"75"`
-	Errors     int    `json:"errors" doc:"Number of errors on this day" example:"5"`
+	Date            string `json:"date" doc:"Date in ISO8601 format" example:"2024-01-15"`
+	Executions      int    `json:"executions" doc:"Number of executions on this day" example:"125"`
+	DurationMs      int64  `json:"duration_ms" doc:"Total execution duration in milliseconds" example:"125000"`
+	CostCents       int64  `json:"cost_cents" doc:"Cost in cents for this day" example:"75"`
+	CPUMillis       int64  `json:"cpu_millis" doc:"CPU time used by sessions on this day, in milliseconds" example:"250000"`
+	MemoryMBSeconds int64  `json:"memory_mb_seconds" doc:"Peak memory times duration of sessions on this day, in MB-seconds" example:"64000"`
+	Errors          int    `json:"errors" doc:"Number of errors on this day" example:"5"`
 }
 
 // AccountLimitsResponse defines the response for account limits
@@ -371,25 +500,29 @@ type ExportUsageOutput struct {
 
 // APIKeyResponse represents an API key in responses (without the secret key).
 type APIKeyResponse struct {
-	ID                    string  `json:"id" doc:"API key identifier" example:"550e8400-e29b-41d4-a716-446655440000"`
-	Name                  *string `json:"name,omitempty" doc:"Key name" example:"Production API"`
-	Description           *string `json:"description,omitempty" doc:"Key description" example:"Used for CI/CD pipelines"`
-	KeyPreview            string  `json:"key_preview" doc:"Masked API key preview" example:"sk_...abcd"`
-	IsActive              bool    `json:"is_active" doc:"Whether key is active" example:"true"`
-	ExpiresAt             *string `json:"expires_at,omitempty" doc:"Expiration timestamp (RFC3339)" example:"2025-12-31T23:59:59Z"`
-	CustomDailyLimit      *int    `json:"custom_daily_limit,omitempty" doc:"Custom daily request limit" example:"1000"`
-	CustomConcurrentLimit *int    `json:"custom_concurrent_limit,omitempty" doc:"Custom concurrent request limit" example:"10"`
-	CreatedAt             string  `json:"created_at" doc:"Creation timestamp (RFC3339)" example:"2024-01-15T10:30:00Z"`
-	LastUsedAt            *string `json:"last_used_at,omitempty" doc:"Last used timestamp (RFC3339)" example:"2024-06-01T08:00:00Z"`
+	ID                    string   `json:"id" doc:"API key identifier" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Name                  *string  `json:"name,omitempty" doc:"Key name" example:"Production API"`
+	Description           *string  `json:"description,omitempty" doc:"Key description" example:"Used for CI/CD pipelines"`
+	KeyPreview            string   `json:"key_preview" doc:"Masked API key preview" example:"sk_...abcd"`
+	IsActive              bool     `json:"is_active" doc:"Whether key is active" example:"true"`
+	ExpiresAt             *string  `json:"expires_at,omitempty" doc:"Expiration timestamp (RFC3339)" example:"2025-12-31T23:59:59Z"`
+	CustomDailyLimit      *int     `json:"custom_daily_limit,omitempty" doc:"Custom daily request limit" example:"1000"`
+	CustomConcurrentLimit *int     `json:"custom_concurrent_limit,omitempty" doc:"Custom concurrent request limit" example:"10"`
+	CreatedAt             string   `json:"created_at" doc:"Creation timestamp (RFC3339)" example:"2024-01-15T10:30:00Z"`
+	LastUsedAt            *string  `json:"last_used_at,omitempty" doc:"Last used timestamp (RFC3339)" example:"2024-06-01T08:00:00Z"`
+	MemberID              *string  `json:"member_id,omitempty" doc:"Member the key was issued to; the key acts with their role" example:"9b2e7c1a-4f3d-4e8b-a1c2-3d4e5f6a7b8c"`
+	Scopes                []string `json:"scopes,omitempty" doc:"Scopes the key is limited to; absent for an unrestricted key" example:"[\"sessions:create\",\"sessions:read\"]"`
+	RotatingKeyExpiresAt  *string  `json:"rotating_key_expires_at,omitempty" doc:"When the key's previous value stops working, while a rotation overlap is pending (RFC3339)" example:"2024-06-02T08:00:00Z"`
 }
 
 // CreateAPIKeyRequest defines the request to create a new API key.
 type CreateAPIKeyRequest struct {
-	Name                  string  `json:"name" doc:"Key name" example:"Production API" minLength:"1" maxLength:"255"`
-	Description           *string `json:"description,omitempty" doc:"Key description" example:"Used for CI/CD pipelines" maxLength:"1000"`
-	ExpiresAt             *string `json:"expires_at,omitempty" doc:"Expiration time (RFC3339)" example:"2025-12-31T23:59:59Z"`
-	CustomDailyLimit      *int    `json:"custom_daily_limit,omitempty" doc:"Custom daily limit (must be <= account limit)" minimum:"1"`
-	CustomConcurrentLimit *int    `json:"custom_concurrent_limit,omitempty" doc:"Custom concurrent limit (must be <= account limit)" minimum:"1"`
+	Name                  string   `json:"name" doc:"Key name" example:"Production API" minLength:"1" maxLength:"255"`
+	Description           *string  `json:"description,omitempty" doc:"Key description" example:"Used for CI/CD pipelines" maxLength:"1000"`
+	ExpiresAt             *string  `json:"expires_at,omitempty" doc:"Expiration time (RFC3339)" example:"2025-12-31T23:59:59Z"`
+	CustomDailyLimit      *int     `json:"custom_daily_limit,omitempty" doc:"Custom daily limit (must be <= account limit)" minimum:"1"`
+	CustomConcurrentLimit *int     `json:"custom_concurrent_limit,omitempty" doc:"Custom concurrent limit (must be <= account limit)" minimum:"1"`
+	Scopes                []string `json:"scopes,omitempty" doc:"Scopes to limit the key to: sessions:create, sessions:read, sessions:exec, files:write, keys:manage, usage:read, account:manage. Defaults to the calling key's scopes" example:"[\"sessions:create\",\"sessions:read\"]"`
 }
 
 // CreateAPIKeyResponse returns the full key (only shown once).
@@ -471,10 +604,316 @@ type DeleteAPIKeyOutput struct {
 
 // RotateAPIKeyInput is the input for POST /v1/account/keys/{id}/rotate.
 type RotateAPIKeyInput struct {
-	ID string `path:"id" doc:"API key ID" example:"550e8400-e29b-41d4-a716-446655440000" minLength:"1"`
+	ID             string `path:"id" doc:"API key ID" example:"550e8400-e29b-41d4-a716-446655440000" minLength:"1"`
+	OverlapSeconds int    `query:"overlap_seconds" doc:"How long the previous value keeps working; 0 invalidates it at once" example:"86400" default:"0" minimum:"0" maximum:"604800"`
 }
 
 // RotateAPIKeyOutput is the output for POST /v1/account/keys/{id}/rotate.
 type RotateAPIKeyOutput struct {
 	Body RotateAPIKeyResponse
 }
+
+// --- Webhook Types ---
+
+// WebhookResponse represents a webhook subscription in responses (without the secret).
+type WebhookResponse struct {
+	ID          string   `json:"id" doc:"Webhook identifier" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	URL         string   `json:"url" doc:"Endpoint events are posted to" example:"https://example.com/hooks/execbox"`
+	Events      []string `json:"events" doc:"Subscribed event types" example:"[\"session.exited\",\"build.failed\"]"`
+	Description *string  `json:"description,omitempty" doc:"Webhook description" example:"Notify CI of finished sessions"`
+	IsActive    bool     `json:"is_active" doc:"Whether events are delivered" example:"true"`
+	CreatedAt   string   `json:"created_at" doc:"Creation timestamp (RFC3339)" example:"2024-01-15T10:30:00Z"`
+	UpdatedAt   string   `json:"updated_at" doc:"Last update timestamp (RFC3339)" example:"2024-01-15T10:30:00Z"`
+}
+
+// CreateWebhookRequest defines the request to create a webhook.
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" doc:"HTTP or HTTPS endpoint events are posted to" example:"https://example.com/hooks/execbox" minLength:"1" maxLength:"2048"`
+	Events      []string `json:"events" doc:"Event types to subscribe to: session.created, session.running, session.exited, session.timeout, build.ready, build.failed, api_key.expiring" minItems:"1"`
+	Description *string  `json:"description,omitempty" doc:"Webhook description" example:"Notify CI of finished sessions" maxLength:"500"`
+}
+
+// CreateWebhookResponse returns the webhook with its signing secret (only shown once).
+type CreateWebhookResponse struct {
+	WebhookResponse
+	Secret string `json:"secret" doc:"Secret that signs deliveries (save this - only shown once)" example:"whsec_3f9a..."`
+}
+
+// UpdateWebhookRequest defines the request to update a webhook.
+type UpdateWebhookRequest struct {
+	URL         *string  `json:"url,omitempty" doc:"HTTP or HTTPS endpoint events are posted to" example:"https://example.com/hooks/execbox" maxLength:"2048"`
+	Events      []string `json:"events,omitempty" doc:"Event types to subscribe to"`
+	Description *string  `json:"description,omitempty" doc:"Webhook description" maxLength:"500"`
+	IsActive    *bool    `json:"is_active,omitempty" doc:"Whether events are delivered" example:"false"`
+}
+
+// ListWebhooksResponse defines the response for listing webhooks.
+type ListWebhooksResponse struct {
+	Webhooks []WebhookResponse `json:"webhooks" doc:"List of webhooks"`
+}
+
+// WebhookDeliveryResponse represents one delivery in a webhook's delivery log.
+type WebhookDeliveryResponse struct {
+	ID             string  `json:"id" doc:"Delivery identifier, sent in the Execbox-Delivery header" example:"0e5f4a3b-2c1d-4e6f-8a9b-0c1d2e3f4a5b"`
+	EventID        string  `json:"event_id" doc:"Event identifier" example:"evt_6f1c2b..."`
+	EventType      string  `json:"event_type" doc:"Event type" example:"session.exited"`
+	Status         string  `json:"status" doc:"Delivery status" enum:"pending,succeeded,failed" example:"succeeded"`
+	Attempts       int     `json:"attempts" doc:"Attempts made so far" example:"1"`
+	ResponseStatus *int    `json:"response_status,omitempty" doc:"HTTP status of the last attempt" example:"200"`
+	Error          *string `json:"error,omitempty" doc:"Why the last attempt failed"`
+	NextAttemptAt  *string `json:"next_attempt_at,omitempty" doc:"When a pending delivery is retried (RFC3339)" example:"2024-01-15T10:31:00Z"`
+	CreatedAt      string  `json:"created_at" doc:"Creation timestamp (RFC3339)" example:"2024-01-15T10:30:00Z"`
+	CompletedAt    *string `json:"completed_at,omitempty" doc:"When the delivery succeeded or was given up (RFC3339)" example:"2024-01-15T10:30:01Z"`
+}
+
+// ListWebhookDeliveriesResponse defines the response for a webhook's delivery log.
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDeliveryResponse `json:"deliveries" doc:"Deliveries, newest first"`
+}
+
+// --- Webhook Huma Input/Output Types ---
+
+// ListWebhooksInput is the input for GET /v1/account/webhooks.
+type ListWebhooksInput struct {
+}
+
+// ListWebhooksOutput is the output for GET /v1/account/webhooks.
+type ListWebhooksOutput struct {
+	Body ListWebhooksResponse
+}
+
+// CreateWebhookInput is the input for POST /v1/account/webhooks.
+type CreateWebhookInput struct {
+	Body CreateWebhookRequest
+}
+
+// CreateWebhookOutput is the output for POST /v1/account/webhooks.
+type CreateWebhookOutput struct {
+	Body CreateWebhookResponse
+}
+
+// GetWebhookInput is the input for GET /v1/account/webhooks/{id}.
+type GetWebhookInput struct {
+	ID string `path:"id" doc:"Webhook ID" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7" minLength:"1"`
+}
+
+// GetWebhookOutput is the output for GET /v1/account/webhooks/{id}.
+type GetWebhookOutput struct {
+	Body WebhookResponse
+}
+
+// UpdateWebhookInput is the input for PUT /v1/account/webhooks/{id}.
+type UpdateWebhookInput struct {
+	ID   string `path:"id" doc:"Webhook ID" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7" minLength:"1"`
+	Body UpdateWebhookRequest
+}
+
+// UpdateWebhookOutput is the output for PUT /v1/account/webhooks/{id}.
+type UpdateWebhookOutput struct {
+	Body WebhookResponse
+}
+
+// DeleteWebhookInput is the input for DELETE /v1/account/webhooks/{id}.
+type DeleteWebhookInput struct {
+	ID string `path:"id" doc:"Webhook ID" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7" minLength:"1"`
+}
+
+// DeleteWebhookOutput is the output for DELETE /v1/account/webhooks/{id} (204 No Content).
+type DeleteWebhookOutput struct {
+}
+
+// ListWebhookDeliveriesInput is the input for GET /v1/account/webhooks/{id}/deliveries.
+type ListWebhookDeliveriesInput struct {
+	ID    string `path:"id" doc:"Webhook ID" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7" minLength:"1"`
+	Limit int    `query:"limit" doc:"Maximum deliveries to return" default:"50" minimum:"1" maximum:"100"`
+}
+
+// ListWebhookDeliveriesOutput is the output for GET /v1/account/webhooks/{id}/deliveries.
+type ListWebhookDeliveriesOutput struct {
+	Body ListWebhookDeliveriesResponse
+}
+
+// --- Member Types ---
+
+// MemberResponse represents a member of the account.
+type MemberResponse struct {
+	ID        string  `json:"id" doc:"Member identifier" example:"9b2e7c1a-4f3d-4e8b-a1c2-3d4e5f6a7b8c"`
+	Email     string  `json:"email" doc:"Member email address" example:"dev@example.com"`
+	Name      *string `json:"name,omitempty" doc:"Member name" example:"Jane Developer"`
+	Role      string  `json:"role" doc:"Member role" enum:"owner,admin,developer,billing-viewer" example:"developer"`
+	CreatedAt string  `json:"created_at" doc:"When the member joined (RFC3339)" example:"2024-01-15T10:30:00Z"`
+}
+
+// ListMembersResponse defines the response for listing members.
+type ListMembersResponse struct {
+	Members []MemberResponse `json:"members" doc:"Members of the account, oldest first"`
+}
+
+// UpdateMemberRequest defines the request to change a member's role.
+type UpdateMemberRequest struct {
+	Role string `json:"role" doc:"New role" enum:"owner,admin,developer,billing-viewer" example:"admin"`
+}
+
+// InvitationResponse represents a pending invitation to join the account.
+type InvitationResponse struct {
+	ID        string `json:"id" doc:"Invitation identifier" example:"3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f"`
+	Email     string `json:"email" doc:"Invited email address" example:"dev@example.com"`
+	Role      string `json:"role" doc:"Role the invitee joins with" enum:"owner,admin,developer,billing-viewer" example:"developer"`
+	ExpiresAt string `json:"expires_at" doc:"When the invitation expires (RFC3339)" example:"2024-01-22T10:30:00Z"`
+	CreatedAt string `json:"created_at" doc:"Creation timestamp (RFC3339)" example:"2024-01-15T10:30:00Z"`
+}
+
+// CreateInvitationRequest defines the request to invite someone to the account.
+type CreateInvitationRequest struct {
+	Email string `json:"email" doc:"Email address to invite" example:"dev@example.com" format:"email" minLength:"1"`
+	Role  string `json:"role" doc:"Role the invitee joins with" enum:"owner,admin,developer,billing-viewer" example:"developer"`
+}
+
+// CreateInvitationResponse returns the invitation with its token (only shown once).
+type CreateInvitationResponse struct {
+	InvitationResponse
+	Token string `json:"token" doc:"Token the invitee accepts the invitation with (send it to them - only shown once)" example:"inv_7d2f..."`
+}
+
+// ListInvitationsResponse defines the response for listing pending invitations.
+type ListInvitationsResponse struct {
+	Invitations []InvitationResponse `json:"invitations" doc:"Pending invitations, newest first"`
+}
+
+// AcceptInvitationRequest defines the request to accept an invitation.
+type AcceptInvitationRequest struct {
+	Token string  `json:"token" doc:"Invitation token" example:"inv_7d2f..." minLength:"1"`
+	Name  *string `json:"name,omitempty" doc:"Your name" example:"Jane Developer" maxLength:"100"`
+}
+
+// AcceptInvitationResponse returns the new member and their first API key (only shown once).
+type AcceptInvitationResponse struct {
+	AccountID string         `json:"account_id" doc:"Account joined" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Member    MemberResponse `json:"member" doc:"The new member"`
+	APIKey    APIKeyResponse `json:"api_key" doc:"API key issued to the new member"`
+	Key       string         `json:"key" doc:"Full API key (save this - only shown once)" example:"sk_abc123def456..."`
+}
+
+// --- Member Huma Input/Output Types ---
+
+// ListMembersInput is the input for GET /v1/account/members.
+type ListMembersInput struct {
+}
+
+// ListMembersOutput is the output for GET /v1/account/members.
+type ListMembersOutput struct {
+	Body ListMembersResponse
+}
+
+// UpdateMemberInput is the input for PUT /v1/account/members/{id}.
+type UpdateMemberInput struct {
+	ID   string `path:"id" doc:"Member ID" example:"9b2e7c1a-4f3d-4e8b-a1c2-3d4e5f6a7b8c" minLength:"1"`
+	Body UpdateMemberRequest
+}
+
+// UpdateMemberOutput is the output for PUT /v1/account/members/{id}.
+type UpdateMemberOutput struct {
+	Body MemberResponse
+}
+
+// RemoveMemberInput is the input for DELETE /v1/account/members/{id}.
+type RemoveMemberInput struct {
+	ID string `path:"id" doc:"Member ID" example:"9b2e7c1a-4f3d-4e8b-a1c2-3d4e5f6a7b8c" minLength:"1"`
+}
+
+// RemoveMemberOutput is the output for DELETE /v1/account/members/{id} (204 No Content).
+type RemoveMemberOutput struct {
+}
+
+// ListInvitationsInput is the input for GET /v1/account/invitations.
+type ListInvitationsInput struct {
+}
+
+// ListInvitationsOutput is the output for GET /v1/account/invitations.
+type ListInvitationsOutput struct {
+	Body ListInvitationsResponse
+}
+
+// CreateInvitationInput is the input for POST /v1/account/invitations.
+type CreateInvitationInput struct {
+	Body CreateInvitationRequest
+}
+
+// CreateInvitationOutput is the output for POST /v1/account/invitations.
+type CreateInvitationOutput struct {
+	Body CreateInvitationResponse
+}
+
+// DeleteInvitationInput is the input for DELETE /v1/account/invitations/{id}.
+type DeleteInvitationInput struct {
+	ID string `path:"id" doc:"Invitation ID" example:"3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f" minLength:"1"`
+}
+
+// DeleteInvitationOutput is the output for DELETE /v1/account/invitations/{id} (204 No Content).
+type DeleteInvitationOutput struct {
+}
+
+// AcceptInvitationInput is the input for POST /v1/invitations/accept.
+type AcceptInvitationInput struct {
+	Body AcceptInvitationRequest
+}
+
+// AcceptInvitationOutput is the output for POST /v1/invitations/accept.
+type AcceptInvitationOutput struct {
+	Body AcceptInvitationResponse
+}
+
+// --- Audit Log Types ---
+
+// AuditEntryResponse represents an entry of the account audit log.
+type AuditEntryResponse struct {
+	ID            int64           `json:"id" doc:"Entry identifier" example:"1042"`
+	Action        string          `json:"action" doc:"What was done" example:"api_key.rotated"`
+	Target        *string         `json:"target,omitempty" doc:"ID of the session, member, key or invitation acted on" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ActorKeyID    *string         `json:"actor_key_id,omitempty" doc:"API key the action was made with" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ActorMemberID *string         `json:"actor_member_id,omitempty" doc:"Member the API key was issued to" example:"9b2e7c1a-4f3d-4e8b-a1c2-3d4e5f6a7b8c"`
+	IPAddress     *string         `json:"ip_address,omitempty" doc:"Client IP address of the request" example:"203.0.113.7"`
+	Details       json.RawMessage `json:"details,omitempty" doc:"Action-specific details"`
+	CreatedAt     string          `json:"created_at" doc:"When the action was made (RFC3339)" example:"2024-01-15T10:30:00Z"`
+}
+
+// AuditLogFilter holds the query parameters selecting audit log entries.
+type AuditLogFilter struct {
+	ActorKeyID    string `query:"actor_key_id" doc:"Only entries made with this API key" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ActorMemberID string `query:"actor_member_id" doc:"Only entries made by this member" example:"9b2e7c1a-4f3d-4e8b-a1c2-3d4e5f6a7b8c"`
+	Action        string `query:"action" doc:"Only this action, or all actions of a kind with a trailing .*" example:"api_key.*"`
+	Since         string `query:"since" doc:"Only entries at or after this time (RFC3339)" example:"2024-01-01T00:00:00Z"`
+	Until         string `query:"until" doc:"Only entries before this time (RFC3339)" example:"2024-02-01T00:00:00Z"`
+}
+
+// ListAuditLogResponse defines the response for listing audit log entries.
+type ListAuditLogResponse struct {
+	Entries    []AuditEntryResponse `json:"entries" doc:"Entries, newest first"`
+	NextCursor *string              `json:"next_cursor,omitempty" doc:"Pass as cursor to get the next page; absent on the last page"`
+}
+
+// ListAuditLogInput is the input for GET /v1/account/audit.
+type ListAuditLogInput struct {
+	AuditLogFilter
+	Cursor string `query:"cursor" doc:"next_cursor of the previous page"`
+	Limit  int    `query:"limit" doc:"Maximum entries to return" default:"50" minimum:"1" maximum:"500"`
+}
+
+// ListAuditLogOutput is the output for GET /v1/account/audit.
+type ListAuditLogOutput struct {
+	Body ListAuditLogResponse
+}
+
+// ExportAuditLogInput is the input for GET /v1/account/audit/export.
+type ExportAuditLogInput struct {
+	AuditLogFilter
+	Format string `query:"format" doc:"Export format" enum:"json,csv" default:"json"`
+}
+
+// ExportAuditLogOutput is the output for GET /v1/account/audit/export: a JSON
+// array of AuditEntryResponse or a CSV file with the same columns.
+type ExportAuditLogOutput struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	Body               []byte
+}
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/google/uuid"
+)
+
+// Webhook event types
+const (
+	EventSessionCreated = "session.created"
+	EventSessionRunning = "session.running"
+	EventSessionExited  = "session.exited" // stopped, killed or failed
+	EventSessionTimeout = "session.timeout"
+	EventBuildReady     = "build.ready"
+	EventBuildFailed    = "build.failed"
+	EventAPIKeyExpiring = "api_key.expiring"
+)
+
+// webhookEventTypes lists the event types webhooks can subscribe to.
+var webhookEventTypes = []string{
+	EventSessionCreated,
+	EventSessionRunning,
+	EventSessionExited,
+	EventSessionTimeout,
+	EventBuildReady,
+	EventBuildFailed,
+	EventAPIKeyExpiring,
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+const (
+	// webhookTimeout bounds a single delivery attempt.
+	webhookTimeout = 10 * time.Second
+
+	// webhookPollInterval is how often due deliveries are picked up, e.g.
+	// retries or events published by another replica.
+	webhookPollInterval = 5 * time.Second
+
+	// webhookBatchSize is the most deliveries claimed at once.
+	webhookBatchSize = 20
+
+	// webhookMaxAttempts is how often a delivery is tried before it is given up.
+	// With webhookRetryBackoff doubling, the last attempt is about an hour after the first.
+	webhookMaxAttempts = 8
+
+	// webhookRetryBackoff is the wait before the first retry; it doubles with every attempt.
+	webhookRetryBackoff = 30 * time.Second
+
+	// WebhookSignatureHeader carries the timestamp and HMAC-SHA256 signature of a delivery.
+	WebhookSignatureHeader = "Execbox-Signature"
+)
+
+// WebhookEvent is the JSON body of every webhook delivery.
+type WebhookEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt string `json:"createdAt"`
+	Data      any    `json:"data"` // SessionResponse for session events, BuildResponse for build events, APIKeyResponse for key events
+}
+
+// WebhookDispatcher records events for the webhooks subscribed to them and
+// delivers them. Deliveries are stored before they are sent, so they survive
+// restarts and failed attempts are retried with exponential backoff.
+type WebhookDispatcher struct {
+	db     DBClient
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewWebhookDispatcher creates a new WebhookDispatcher. Its HTTP client refuses
+// to connect to loopback and private addresses, so webhooks cannot reach the
+// internal network.
+func NewWebhookDispatcher(db DBClient) *WebhookDispatcher {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: denyPrivateAddresses,
+	}
+	return &WebhookDispatcher{
+		db: db,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// Redirects could lead to addresses the URL check never saw
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// denyPrivateAddresses rejects connections to loopback, private and link-local addresses.
+func denyPrivateAddresses(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// Publish records a delivery of the event for every active webhook of the
+// account subscribed to eventType, then wakes the delivery loop. Failures are
+// logged and never fail the operation that raised the event.
+func (d *WebhookDispatcher) Publish(ctx context.Context, accountID uuid.UUID, eventType string, data any) {
+	if d == nil {
+		return
+	}
+
+	hooks, err := d.db.ListWebhooksForEvent(ctx, accountID, eventType)
+	if err != nil {
+		slog.Warn("failed to look up webhooks", "error", err, "account_id", accountID, "event", eventType)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	event := WebhookEvent{
+		ID:        generateEventID(),
+		Type:      eventType,
+		CreatedAt: now.Format(time.RFC3339),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Warn("failed to encode webhook event", "error", err, "event", eventType)
+		return
+	}
+
+	for _, hook := range hooks {
+		delivery := &db.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       payload,
+			NextAttemptAt: now,
+		}
+		if err := d.db.CreateWebhookDelivery(ctx, delivery); err != nil {
+			slog.Warn("failed to record webhook delivery", "error", err, "webhook_id", hook.ID, "event", eventType)
+		}
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// PublishSessionUpdate publishes the event, if any, for a session moving from
+// status from to the status in update. The event describes the session as it
+// is after the update.
+func (d *WebhookDispatcher) PublishSessionUpdate(ctx context.Context, session *db.Session, from string, update *db.SessionUpdate) {
+	if d == nil || update.Status == nil {
+		return
+	}
+	eventType := sessionEventType(from, *update.Status)
+	if eventType == "" {
+		return
+	}
+
+	d.Publish(ctx, session.AccountID, eventType, buildSessionResponse(applySessionUpdate(session, update)))
+}
+
+// sessionEventType returns the event for a session moving from one status to
+// another, or "" if the move is not an event.
+func sessionEventType(from, to string) string {
+	if from == to {
+		return ""
+	}
+	switch to {
+	case SessionStatusRunning:
+		return EventSessionRunning
+	case SessionStatusTimeout:
+		return EventSessionTimeout
+	case SessionStatusStopped, SessionStatusKilled, SessionStatusFailed:
+		if isActiveStatus(from) {
+			return EventSessionExited
+		}
+	}
+	return ""
+}
+
+// Run delivers due webhook deliveries every webhookPollInterval, and right away
+// when an event is published. It blocks until ctx is done.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.deliverDue(ctx); err != nil {
+			slog.Warn("failed to deliver webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue claims a batch of due deliveries and sends them concurrently.
+func (d *WebhookDispatcher) deliverDue(ctx context.Context) error {
+	// Leave attempts time to finish and be recorded before others may claim them
+	deliveries, err := d.db.ClaimWebhookDeliveries(ctx, webhookBatchSize, time.Now().Add(2*webhookTimeout))
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *db.DueWebhookDelivery) {
+			defer wg.Done()
+			d.deliver(ctx, delivery)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// deliver makes one attempt at a delivery and records the outcome: succeeded,
+// pending with the next attempt scheduled, or failed after webhookMaxAttempts.
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *db.DueWebhookDelivery) {
+	responseStatus, err := d.send(ctx, delivery)
+
+	now := time.Now().UTC()
+	result := &db.WebhookDeliveryResult{
+		Attempts:      delivery.Attempts + 1,
+		NextAttemptAt: now,
+	}
+	if responseStatus != 0 {
+		result.ResponseStatus = &responseStatus
+	}
+
+	switch {
+	case err == nil:
+		result.Status = WebhookDeliverySucceeded
+		result.CompletedAt = &now
+	case result.Attempts >= webhookMaxAttempts:
+		result.Status = WebhookDeliveryFailed
+		result.CompletedAt = &now
+	default:
+		result.Status = WebhookDeliveryPending
+		result.NextAttemptAt = now.Add(webhookRetryBackoff << (result.Attempts - 1))
+	}
+	if err != nil {
+		msg := err.Error()
+		result.Error = &msg
+		slog.Debug("webhook delivery attempt failed", "error", err, "delivery_id", delivery.ID, "attempts", result.Attempts)
+	}
+
+	if err := d.db.RecordWebhookDeliveryAttempt(ctx, delivery.ID, result); err != nil {
+		slog.Warn("failed to record webhook delivery attempt", "error", err, "delivery_id", delivery.ID)
+	}
+}
+
+// send posts a delivery's payload, signed with the webhook's secret. It returns
+// the response status, or 0 if there was no response, and an error unless the
+// endpoint answered with a 2xx status.
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *db.DueWebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Execbox-Event", delivery.EventType)
+	req.Header.Set("Execbox-Delivery", delivery.ID.String())
+	req.Header.Set(WebhookSignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, signWebhookPayload(delivery.Secret, timestamp, delivery.Payload)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<payload>" keyed
+// with the webhook secret. Receivers recompute it to check a delivery is
+// authentic, and reject old timestamps to stop replays.
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateEventID generates a unique event ID
+func generateEventID() string {
+	return fmt.Sprintf("evt_%s", randHex(24))
+}
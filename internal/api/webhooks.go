@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/burka/execbox-cloud/internal/db"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// WebhookService handles webhook subscriptions of the authenticated account.
+type WebhookService struct {
+	db DBClient
+}
+
+// NewWebhookService creates a new WebhookService.
+func NewWebhookService(db DBClient) *WebhookService {
+	return &WebhookService{db: db}
+}
+
+// ListWebhooks handles GET /v1/account/webhooks
+// Returns all webhooks of the authenticated account.
+func (s *WebhookService) ListWebhooks(ctx context.Context, input *ListWebhooksInput) (*ListWebhooksOutput, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	hooks, err := s.db.ListWebhooks(ctx, accountID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to list webhooks", err)
+	}
+
+	responses := make([]WebhookResponse, 0, len(hooks))
+	for i := range hooks {
+		responses = append(responses, webhookToResponse(&hooks[i]))
+	}
+
+	return &ListWebhooksOutput{Body: ListWebhooksResponse{Webhooks: responses}}, nil
+}
+
+// CreateWebhook handles POST /v1/account/webhooks
+// Subscribes a URL to events. The signing secret is only returned here.
+func (s *WebhookService) CreateWebhook(ctx context.Context, input *CreateWebhookInput) (*CreateWebhookOutput, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	req := input.Body
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	events, err := validateWebhookEvents(req.Events)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	hook := &db.Webhook{
+		ID:          uuid.New(),
+		AccountID:   accountID,
+		URL:         req.URL,
+		Secret:      generateWebhookSecret(),
+		Events:      events,
+		Description: req.Description,
+		IsActive:    true,
+	}
+	if err := s.db.CreateWebhook(ctx, hook); err != nil {
+		return nil, huma.Error500InternalServerError("failed to create webhook", err)
+	}
+
+	return &CreateWebhookOutput{
+		Body: CreateWebhookResponse{
+			WebhookResponse: webhookToResponse(hook),
+			Secret:          hook.Secret, // Only shown once
+		},
+	}, nil
+}
+
+// GetWebhook handles GET /v1/account/webhooks/{id}
+// Returns a webhook of the authenticated account.
+func (s *WebhookService) GetWebhook(ctx context.Context, input *GetWebhookInput) (*GetWebhookOutput, error) {
+	hook, err := s.getAuthorizedWebhook(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetWebhookOutput{Body: webhookToResponse(hook)}, nil
+}
+
+// UpdateWebhook handles PUT /v1/account/webhooks/{id}
+// Updates a webhook's URL, events, description or active state. Only specified fields are modified.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, input *UpdateWebhookInput) (*UpdateWebhookOutput, error) {
+	hook, err := s.getAuthorizedWebhook(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	req := input.Body
+	update := &db.WebhookUpdate{
+		Description: req.Description,
+		IsActive:    req.IsActive,
+	}
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		update.URL = req.URL
+	}
+	if req.Events != nil {
+		events, err := validateWebhookEvents(req.Events)
+		if err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		update.Events = events
+	}
+
+	if err := s.db.UpdateWebhook(ctx, hook.ID, update); err != nil {
+		return nil, huma.Error500InternalServerError("failed to update webhook", err)
+	}
+
+	hook, err = s.db.GetWebhook(ctx, hook.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to get webhook", err)
+	}
+
+	return &UpdateWebhookOutput{Body: webhookToResponse(hook)}, nil
+}
+
+// DeleteWebhook handles DELETE /v1/account/webhooks/{id}
+// Deletes a webhook and its delivery log. Pending deliveries are dropped.
+func (s *WebhookService) DeleteWebhook(ctx context.Context, input *DeleteWebhookInput) (*DeleteWebhookOutput, error) {
+	hook, err := s.getAuthorizedWebhook(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.DeleteWebhook(ctx, hook.ID); err != nil {
+		return nil, huma.Error500InternalServerError("failed to delete webhook", err)
+	}
+
+	return &DeleteWebhookOutput{}, nil
+}
+
+// ListWebhookDeliveries handles GET /v1/account/webhooks/{id}/deliveries
+// Returns the most recent deliveries of a webhook, newest first.
+func (s *WebhookService) ListWebhookDeliveries(ctx context.Context, input *ListWebhookDeliveriesInput) (*ListWebhookDeliveriesOutput, error) {
+	hook, err := s.getAuthorizedWebhook(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := input.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	deliveries, err := s.db.ListWebhookDeliveries(ctx, hook.ID, limit)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to list webhook deliveries", err)
+	}
+
+	responses := make([]WebhookDeliveryResponse, 0, len(deliveries))
+	for i := range deliveries {
+		responses = append(responses, webhookDeliveryToResponse(&deliveries[i]))
+	}
+
+	return &ListWebhookDeliveriesOutput{Body: ListWebhookDeliveriesResponse{Deliveries: responses}}, nil
+}
+
+// getAuthorizedWebhook retrieves a webhook and verifies the caller's account owns it.
+// Webhooks of other accounts are reported as not found.
+func (s *WebhookService) getAuthorizedWebhook(ctx context.Context, id string) (*db.Webhook, error) {
+	accountID, ok := callerAccountID(ctx)
+	if !ok {
+		return nil, huma.Error401Unauthorized("unauthorized")
+	}
+
+	hookID, err := parseUUID(id)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid webhook ID format")
+	}
+
+	hook, err := s.db.GetWebhook(ctx, hookID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, huma.Error404NotFound("webhook not found")
+		}
+		return nil, huma.Error500InternalServerError("failed to get webhook", err)
+	}
+	if hook.AccountID != accountID {
+		return nil, huma.Error404NotFound("webhook not found")
+	}
+
+	return hook, nil
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute HTTP or HTTPS URL.
+// Whether it resolves to a public address is checked on delivery.
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+	return nil
+}
+
+// validateWebhookEvents checks that events are known event types and returns
+// them without duplicates.
+func validateWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, fmt.Errorf("at least one event is required")
+	}
+
+	var valid []string
+	for _, event := range events {
+		if !slices.Contains(webhookEventTypes, event) {
+			return nil, fmt.Errorf("unknown event %q, must be one of: %s", event, strings.Join(webhookEventTypes, ", "))
+		}
+		if !slices.Contains(valid, event) {
+			valid = append(valid, event)
+		}
+	}
+	return valid, nil
+}
+
+// generateWebhookSecret generates a webhook signing secret
+func generateWebhookSecret() string {
+	return fmt.Sprintf("whsec_%s", randHex(32))
+}
+
+// webhookToResponse converts a db.Webhook to a WebhookResponse.
+func webhookToResponse(hook *db.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:          hook.ID.String(),
+		URL:         hook.URL,
+		Events:      hook.Events,
+		Description: hook.Description,
+		IsActive:    hook.IsActive,
+		CreatedAt:   hook.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   hook.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// webhookDeliveryToResponse converts a db.WebhookDelivery to a WebhookDeliveryResponse.
+func webhookDeliveryToResponse(delivery *db.WebhookDelivery) WebhookDeliveryResponse {
+	resp := WebhookDeliveryResponse{
+		ID:             delivery.ID.String(),
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		Error:          delivery.Error,
+		CreatedAt:      delivery.CreatedAt.Format(time.RFC3339),
+	}
+
+	if delivery.Status == WebhookDeliveryPending {
+		nextAttemptAt := delivery.NextAttemptAt.Format(time.RFC3339)
+		resp.NextAttemptAt = &nextAttemptAt
+	}
+
+	if delivery.CompletedAt != nil {
+		completedAt := delivery.CompletedAt.Format(time.RFC3339)
+		resp.CompletedAt = &completedAt
+	}
+
+	return resp
+}
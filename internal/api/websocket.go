@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/burka/execbox-cloud/internal/db"
 	"github.com/burka/execbox-cloud/internal/proto"
@@ -94,6 +95,11 @@ func (h *Handlers) AttachSession(w http.ResponseWriter, r *http.Request, session
 	}
 	defer conn.Close()
 
+	start := time.Now()
+	defer func() {
+		attachDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	writer := &wsWriter{conn: conn}
 
 	// 6. Attach to backend
@@ -196,6 +202,7 @@ func (h *Handlers) handleBinaryWSInput(ctx context.Context, conn *websocket.Conn
 					h.sendBinaryError(writer, fmt.Sprintf("failed to write to stdin: %v", err))
 					return
 				}
+				attachBytesTotal.WithLabelValues("stdin").Add(float64(len(msg.Data)))
 			}
 		case proto.MessageTypeStdinClose:
 			if stdin != nil {
@@ -226,6 +233,7 @@ func (h *Handlers) handleBinaryWSOutputNoCancel(writer *wsWriter, reader io.Read
 			if err := h.writeBinaryMessage(writer, msg); err != nil {
 				return
 			}
+			attachBytesTotal.WithLabelValues(streamName(msgType)).Add(float64(n))
 		}
 
 		if err != nil {
@@ -237,6 +245,14 @@ func (h *Handlers) handleBinaryWSOutputNoCancel(writer *wsWriter, reader io.Read
 	}
 }
 
+// streamName returns the metric label of an output stream message type
+func streamName(msgType proto.MessageType) string {
+	if msgType == proto.MessageTypeStderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
 // sendBinaryError sends a binary error message over WebSocket
 func (h *Handlers) sendBinaryError(writer *wsWriter, message string) {
 	msg := proto.BinaryMessage{
@@ -283,8 +283,10 @@ func quoteShellArg(arg string) string {
 	return "'" + escaped + "'"
 }
 
-// quoteShellCmd converts a command slice into a safely quoted shell command string.
-func quoteShellCmd(cmd []string) string {
+// QuoteShellCmd converts a command slice into a safely quoted shell command string.
+// The Fly exec API accepts a single command string, so callers outside this
+// package use this to avoid shell injection.
+func QuoteShellCmd(cmd []string) string {
 	if len(cmd) == 0 {
 		return ""
 	}
@@ -306,7 +308,7 @@ func (b *Backend) Exec(ctx context.Context, sessionID string, cmd []string) (std
 	}
 
 	// Fly Exec takes a single command string - use proper shell quoting to prevent injection
-	cmdStr := quoteShellCmd(cmd)
+	cmdStr := QuoteShellCmd(cmd)
 
 	resp, err := b.client.Exec(ctx, machineID, &ExecRequest{
 		Cmd: cmdStr,
@@ -3,15 +3,46 @@ package fly
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 )
 
 const (
 	imagePrefix = "execbox-"
 	hashLength  = 16 // 64 bits, collision at ~4 billion images
+
+	// BuilderImage is the Kaniko executor image used for builder machines.
+	BuilderImage = "gcr.io/kaniko-project/executor:v1.23.2"
+
+	// PusherImage is the crane image that pushes a built image to the registry.
+	// It is the only machine that receives registry credentials.
+	PusherImage = "gcr.io/go-containerregistry/crane:v0.20.2"
+
+	// DefaultBuildRegion is the region build volumes and machines run in.
+	DefaultBuildRegion = "iad"
+
+	// BuildTimeout is the maximum time allowed for a build.
+	BuildTimeout = 10 * time.Minute
+
+	// builderRoot is where the Dockerfile and build context are written in the builder machine.
+	builderRoot = "/workspace"
+
+	// outputDir is where the build volume is mounted; it carries the image
+	// tarball from the builder machine to the pusher machine.
+	outputDir     = "/out"
+	outputTarball = outputDir + "/image.tar"
+
+	// buildVolume names the per-build scratch volume.
+	buildVolume   = "execbox_build"
+	buildVolumeGB = 10
+
+	// pusherAuthDir holds the registry config in the pusher machine only.
+	pusherAuthDir = "/auth"
 )
 
 // BuildFile represents a file to include in the Docker build context.
@@ -81,9 +112,11 @@ func GenerateDockerfile(spec *BuildSpec) string {
 	// FROM base image
 	b.WriteString(fmt.Sprintf("FROM %s\n", spec.BaseImage))
 
-	// COPY files (if any)
+	// COPY files (if any), in the JSON form so spaces and quotes in paths
+	// stay part of the path
 	for _, f := range spec.Files {
-		b.WriteString(fmt.Sprintf("COPY %s %s\n", f.Path, f.Path))
+		paths, _ := json.Marshal([]string{f.Path, f.Path})
+		b.WriteString(fmt.Sprintf("COPY %s\n", paths))
 	}
 
 	// RUN setup commands
@@ -110,6 +143,7 @@ func ValidateSetup(setup []string) error {
 type Builder struct {
 	client  *Client
 	appName string
+	region  string
 }
 
 // NewBuilder creates a new Builder instance.
@@ -117,7 +151,16 @@ func NewBuilder(client *Client, appName string) *Builder {
 	return &Builder{
 		client:  client,
 		appName: appName,
+		region:  DefaultBuildRegion,
+	}
+}
+
+// WithRegion sets the region build machines and their volume run in
+func (b *Builder) WithRegion(region string) *Builder {
+	if region != "" {
+		b.region = region
 	}
+	return b
 }
 
 // Resolve resolves a build spec to a registry tag.
@@ -173,19 +216,154 @@ func (b *Builder) Resolve(ctx context.Context, spec *BuildSpec, cache BuildCache
 	return registryTag, nil
 }
 
-// build builds and pushes an image to the Fly registry.
-// This uses the Fly Machines API to create a temporary builder machine.
+// build builds and pushes an image to the Fly registry in two machines that
+// share a scratch volume. The Kaniko builder runs the tenant's RUN steps and
+// writes the image to the volume as a tarball; it gets no credentials. Once it
+// is gone, a crane machine pushes the tarball with a short-lived token scoped
+// to the image's repository, so build steps never see a registry secret.
 func (b *Builder) build(ctx context.Context, spec *BuildSpec, registryTag string) error {
-	// For now, we'll use the Fly CLI approach via subprocess
-	// In production, this would use the Fly API directly
-	//
-	// TODO: Implement proper Fly remote builder integration
-	// Options:
-	// 1. fly deploy --build-only (requires Dockerfile in temp dir)
-	// 2. Fly Machines API with builder image
-	// 3. Dedicated BuildKit machine
-
-	return fmt.Errorf("image building not yet implemented - use pre-built images for now")
+	ctx, cancel := context.WithTimeout(ctx, BuildTimeout)
+	defer cancel()
+
+	volume, err := b.client.CreateVolume(ctx, buildVolume, b.region, buildVolumeGB)
+	if err != nil {
+		return fmt.Errorf("create build volume: %w", err)
+	}
+
+	// Always remove the volume, even if the caller's context is gone
+	defer func() {
+		_ = b.client.DeleteVolume(context.Background(), volume.ID)
+	}()
+
+	// The machines API exposes no logs; the phase is all we can report
+	ReportBuildProgress(ctx, BuildPhaseBuilding, "")
+
+	if err := b.runToCompletion(ctx, "kaniko", b.builderMachineConfig(spec, registryTag, volume.ID)); err != nil {
+		return err
+	}
+
+	// A volume can only be attached to one machine at a time
+	if err := b.waitForDetach(ctx, volume.ID); err != nil {
+		return fmt.Errorf("wait for build volume: %w", err)
+	}
+
+	ReportBuildProgress(ctx, BuildPhasePushing, "")
+
+	token, err := b.client.RegistryPushToken(ctx, strings.TrimPrefix(registryTag, registryHost+"/"))
+	if err != nil {
+		return fmt.Errorf("get registry push token: %w", err)
+	}
+
+	return b.runToCompletion(ctx, "push", b.pusherMachineConfig(registryTag, volume.ID, token))
+}
+
+// runToCompletion boots a one-off machine, waits for it to exit, checks the
+// exit code and destroys it.
+func (b *Builder) runToCompletion(ctx context.Context, step string, config *MachineConfig) error {
+	machine, err := b.client.CreateMachineInRegion(ctx, b.region, config)
+	if err != nil {
+		return fmt.Errorf("create %s machine: %w", step, err)
+	}
+
+	// Always remove the machine, even if the caller's context is gone
+	defer func() {
+		_ = b.client.DestroyMachine(context.Background(), machine.ID)
+	}()
+
+	if err := b.client.WaitForState(ctx, machine.ID, "stopped", BuildTimeout); err != nil {
+		return fmt.Errorf("wait for %s machine: %w", step, err)
+	}
+
+	finished, err := b.client.GetMachine(ctx, machine.ID)
+	if err != nil {
+		return fmt.Errorf("get %s machine: %w", step, err)
+	}
+
+	code, ok := finished.ExitCode()
+	if !ok {
+		return fmt.Errorf("%s machine %s stopped without an exit event", step, machine.ID)
+	}
+	if code != 0 {
+		return fmt.Errorf("%s exited with code %d (see logs for machine %s)", step, code, machine.ID)
+	}
+
+	return nil
+}
+
+// waitForDetach polls a volume until no machine holds it. Destroying a
+// machine releases its volumes asynchronously.
+func (b *Builder) waitForDetach(ctx context.Context, volumeID string) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		volume, err := b.client.GetVolume(ctx, volumeID)
+		if err != nil {
+			return err
+		}
+		if volume.AttachedMachineID == "" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// builderMachineConfig returns the config for a Kaniko machine that builds spec
+// into a tarball tagged registryTag on the build volume. Files are placed under
+// the build context at their destination path, matching the COPY lines from
+// GenerateDockerfile.
+func (b *Builder) builderMachineConfig(spec *BuildSpec, registryTag, volumeID string) *MachineConfig {
+	files := make([]MachineFile, 0, len(spec.Files)+1)
+	files = append(files, MachineFile{
+		GuestPath: builderRoot + "/Dockerfile",
+		RawValue:  base64.StdEncoding.EncodeToString([]byte(GenerateDockerfile(spec))),
+	})
+	for _, f := range spec.Files {
+		files = append(files, MachineFile{
+			GuestPath: builderRoot + "/context/" + strings.TrimPrefix(f.Path, "/"),
+			RawValue:  base64.StdEncoding.EncodeToString(f.Content),
+		})
+	}
+
+	return &MachineConfig{
+		Image: BuilderImage,
+		Cmd: []string{
+			"--dockerfile=" + builderRoot + "/Dockerfile",
+			"--context=dir://" + builderRoot + "/context",
+			"--destination=" + registryTag,
+			"--no-push",
+			"--tar-path=" + outputTarball,
+		},
+		Guest:   &Guest{CPUs: 2, MemoryMB: 2048},
+		Files:   files,
+		Mounts:  []Mount{{Volume: volumeID, Path: outputDir}},
+		Restart: &RestartPolicy{Policy: "no"},
+	}
+}
+
+// pusherMachineConfig returns the config for a crane machine that pushes the
+// tarball on the build volume to registryTag using a registry token. It runs
+// no tenant code.
+func (b *Builder) pusherMachineConfig(registryTag, volumeID, token string) *MachineConfig {
+	auth := fmt.Sprintf(`{"auths":{%q:{"registrytoken":%q}}}`, registryHost, token)
+
+	return &MachineConfig{
+		Image: PusherImage,
+		Cmd:   []string{"push", outputTarball, registryTag},
+		Env:   map[string]string{"DOCKER_CONFIG": pusherAuthDir},
+		Guest: &Guest{CPUs: 1, MemoryMB: 512},
+		Files: []MachineFile{{
+			GuestPath: pusherAuthDir + "/config.json",
+			RawValue:  base64.StdEncoding.EncodeToString([]byte(auth)),
+		}},
+		Mounts:  []Mount{{Volume: volumeID, Path: outputDir}},
+		Restart: &RestartPolicy{Policy: "no"},
+	}
 }
 
 // BuildCache is the interface for image cache storage.
@@ -0,0 +1,254 @@
+package fly
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// buildRecord captures what a build did against the test server.
+type buildRecord struct {
+	configs       []MachineConfig
+	regions       []string
+	destroyed     map[string]bool
+	volumeDeleted bool
+	tokenScope    string
+	tokenAuth     string
+}
+
+// newBuilderServer returns a test server that plays the build's lifecycle: a
+// scratch volume, then a builder and a pusher machine that each report stopped
+// with the given exit code and are destroyed. It also serves the registry
+// token endpoint.
+func newBuilderServer(t *testing.T, exitCode int, rec *buildRecord) *httptest.Server {
+	t.Helper()
+	rec.destroyed = make(map[string]bool)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/token":
+			user, pass, _ := r.BasicAuth()
+			rec.tokenAuth = user + ":" + pass
+			rec.tokenScope = r.URL.Query().Get("scope")
+			fmt.Fprint(w, `{"token": "scoped-push-token", "expires_in": 300}`)
+
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/volumes"):
+			fmt.Fprint(w, `{"id": "vol-1", "name": "execbox_build", "region": "iad", "size_gb": 10}`)
+
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/volumes/vol-1"):
+			fmt.Fprint(w, `{"id": "vol-1", "state": "created", "attached_machine_id": ""}`)
+
+		case r.Method == http.MethodDelete && strings.HasSuffix(r.URL.Path, "/volumes/vol-1"):
+			rec.volumeDeleted = true
+			w.WriteHeader(http.StatusOK)
+
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/machines"):
+			var req createMachineRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %v", err)
+			}
+			rec.configs = append(rec.configs, *req.Config)
+			rec.regions = append(rec.regions, req.Region)
+			fmt.Fprintf(w, `{"id": "machine-%d", "state": "created"}`, len(rec.configs))
+
+		case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/machines/machine-"):
+			id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			fmt.Fprintf(w, `{"id": %q, "state": "stopped", "events": [
+				{"type": "start", "status": "started", "timestamp": 1},
+				{"type": "exit", "status": "stopped", "timestamp": 2, "request": {"exit_event": {"exit_code": %d}}}
+			]}`, id, exitCode)
+
+		case r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/machines/machine-"):
+			rec.destroyed[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]] = true
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// machineFiles decodes a machine config's files by guest path.
+func machineFiles(t *testing.T, config MachineConfig) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	for _, f := range config.Files {
+		content, err := base64.StdEncoding.DecodeString(f.RawValue)
+		if err != nil {
+			t.Fatalf("file %s is not base64: %v", f.GuestPath, err)
+		}
+		files[f.GuestPath] = string(content)
+	}
+	return files
+}
+
+func TestGenerateDockerfile(t *testing.T) {
+	dockerfile := GenerateDockerfile(&BuildSpec{
+		BaseImage: "python:3.12",
+		Setup:     []string{"pip install requests"},
+		Files: []BuildFile{
+			{Path: "/app/main.py"},
+			{Path: `/app/my "quoted" file.txt`},
+		},
+	})
+
+	want := "FROM python:3.12\n" +
+		`COPY ["/app/main.py","/app/main.py"]` + "\n" +
+		`COPY ["/app/my \"quoted\" file.txt","/app/my \"quoted\" file.txt"]` + "\n" +
+		"RUN pip install requests\n"
+	if dockerfile != want {
+		t.Errorf("GenerateDockerfile() = %q, want %q", dockerfile, want)
+	}
+}
+
+func TestBuilderBuild(t *testing.T) {
+	var rec buildRecord
+	server := newBuilderServer(t, 0, &rec)
+	defer server.Close()
+
+	client := New("test-token", "test-org", "test-app").WithBaseURL(server.URL).WithRegistryURL(server.URL)
+	builder := NewBuilder(client, "test-app")
+
+	spec := &BuildSpec{
+		BaseImage: "python:3.12",
+		Setup:     []string{"pip install requests"},
+		Files:     []BuildFile{{Path: "/app/main.py", Content: []byte("print('hi')")}},
+	}
+
+	var phases []string
+	ctx := WithBuildObserver(context.Background(), func(phase, logTail string) {
+		phases = append(phases, phase)
+	})
+
+	if err := builder.build(ctx, spec, "registry.fly.io/test-app/execbox-abc"); err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+
+	if len(phases) != 2 || phases[0] != BuildPhaseBuilding || phases[1] != BuildPhasePushing {
+		t.Errorf("expected %q then %q progress reports, got %v", BuildPhaseBuilding, BuildPhasePushing, phases)
+	}
+	if len(rec.configs) != 2 {
+		t.Fatalf("expected a builder and a pusher machine, got %d machines", len(rec.configs))
+	}
+	for i, region := range rec.regions {
+		if region != DefaultBuildRegion {
+			t.Errorf("machine %d: expected region %s, got %q", i, DefaultBuildRegion, region)
+		}
+	}
+
+	built := rec.configs[0]
+	if built.Image != BuilderImage {
+		t.Errorf("expected builder image %s, got %s", BuilderImage, built.Image)
+	}
+	if built.Restart == nil || built.Restart.Policy != "no" {
+		t.Errorf("expected restart policy 'no', got %+v", built.Restart)
+	}
+	cmd := strings.Join(built.Cmd, " ")
+	for _, arg := range []string{"--destination=registry.fly.io/test-app/execbox-abc", "--no-push", "--tar-path=/out/image.tar"} {
+		if !strings.Contains(cmd, arg) {
+			t.Errorf("expected builder arg %s, got %v", arg, built.Cmd)
+		}
+	}
+	if len(built.Mounts) != 1 || built.Mounts[0].Volume != "vol-1" || built.Mounts[0].Path != "/out" {
+		t.Errorf("expected build volume mounted at /out, got %+v", built.Mounts)
+	}
+
+	files := machineFiles(t, built)
+	if files["/workspace/context/app/main.py"] != "print('hi')" {
+		t.Errorf("expected build file in context, got %v", files)
+	}
+	if !strings.Contains(files["/workspace/Dockerfile"], "RUN pip install requests") {
+		t.Errorf("expected Dockerfile with setup, got %q", files["/workspace/Dockerfile"])
+	}
+	for path, content := range files {
+		if strings.Contains(content, "test-token") || strings.Contains(content, "scoped-push-token") || strings.HasSuffix(path, "config.json") {
+			t.Errorf("builder machine must not receive credentials, got %s", path)
+		}
+	}
+	for key, value := range built.Env {
+		if strings.Contains(value, "token") {
+			t.Errorf("builder machine must not receive credentials, got env %s", key)
+		}
+	}
+
+	pushed := rec.configs[1]
+	if pushed.Image != PusherImage {
+		t.Errorf("expected pusher image %s, got %s", PusherImage, pushed.Image)
+	}
+	if strings.Join(pushed.Cmd, " ") != "push /out/image.tar registry.fly.io/test-app/execbox-abc" {
+		t.Errorf("unexpected pusher command %v", pushed.Cmd)
+	}
+	if len(pushed.Mounts) != 1 || pushed.Mounts[0].Volume != "vol-1" {
+		t.Errorf("expected build volume on pusher, got %+v", pushed.Mounts)
+	}
+	auth := machineFiles(t, pushed)[pushed.Env["DOCKER_CONFIG"]+"/config.json"]
+	if !strings.Contains(auth, `"registrytoken":"scoped-push-token"`) {
+		t.Errorf("expected scoped registry token in pusher config, got %q", auth)
+	}
+	if strings.Contains(auth, "test-token") {
+		t.Error("pusher config must not carry the API token")
+	}
+
+	if rec.tokenScope != "repository:test-app/execbox-abc:push,pull" {
+		t.Errorf("expected token scoped to the image repository, got %q", rec.tokenScope)
+	}
+	if rec.tokenAuth != "x:test-token" {
+		t.Errorf("expected token request authenticated with the API token, got %q", rec.tokenAuth)
+	}
+
+	if !rec.destroyed["machine-1"] || !rec.destroyed["machine-2"] {
+		t.Errorf("expected both machines to be destroyed, got %v", rec.destroyed)
+	}
+	if !rec.volumeDeleted {
+		t.Error("expected build volume to be deleted")
+	}
+}
+
+func TestBuilderBuildFailure(t *testing.T) {
+	var rec buildRecord
+	server := newBuilderServer(t, 1, &rec)
+	defer server.Close()
+
+	client := New("test-token", "test-org", "test-app").WithBaseURL(server.URL).WithRegistryURL(server.URL)
+	builder := NewBuilder(client, "test-app").WithRegion("ams")
+
+	err := builder.build(context.Background(), &BuildSpec{BaseImage: "alpine", Setup: []string{"false"}}, "registry.fly.io/test-app/execbox-abc")
+	if err == nil || !strings.Contains(err.Error(), "exited with code 1") {
+		t.Errorf("expected exit code error, got %v", err)
+	}
+	if len(rec.configs) != 1 {
+		t.Errorf("expected no pusher machine after a failed build, got %d machines", len(rec.configs))
+	}
+	if len(rec.regions) > 0 && rec.regions[0] != "ams" {
+		t.Errorf("expected builder in region ams, got %q", rec.regions[0])
+	}
+	if rec.tokenAuth != "" {
+		t.Error("expected no registry token request after a failed build")
+	}
+	if !rec.destroyed["machine-1"] {
+		t.Error("expected builder machine to be destroyed after failure")
+	}
+	if !rec.volumeDeleted {
+		t.Error("expected build volume to be deleted after failure")
+	}
+}
+
+func TestMachineExitCode(t *testing.T) {
+	m := &Machine{}
+	if _, ok := m.ExitCode(); ok {
+		t.Error("expected no exit code without events")
+	}
+
+	m.Events = []MachineEvent{
+		{Type: "exit", Timestamp: 5, Request: &MachineEventInput{ExitEvent: &ExitEvent{ExitCode: 0}}},
+		{Type: "exit", Timestamp: 3, Request: &MachineEventInput{ExitEvent: &ExitEvent{ExitCode: 2}}},
+	}
+	if code, ok := m.ExitCode(); !ok || code != 0 {
+		t.Errorf("expected latest exit code 0, got %d (ok=%v)", code, ok)
+	}
+}
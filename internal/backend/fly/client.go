@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -22,11 +27,13 @@ const (
 
 // Client is an HTTP client for the Fly.io Machines API
 type Client struct {
-	httpClient *http.Client
-	baseURL    string
-	token      string
-	org        string
-	appName    string
+	httpClient  *http.Client
+	baseURL     string
+	registryURL string
+	metricsURL  string
+	token       string
+	org         string
+	appName     string
 }
 
 // New creates a new Fly.io API client
@@ -35,10 +42,12 @@ func New(token, org, appName string) *Client {
 		httpClient: &http.Client{
 			Timeout: defaultTimeout,
 		},
-		baseURL: defaultBaseURL,
-		token:   token,
-		org:     org,
-		appName: appName,
+		baseURL:     defaultBaseURL,
+		registryURL: defaultRegistryURL,
+		metricsURL:  defaultMetricsURL,
+		token:       token,
+		org:         org,
+		appName:     appName,
 	}
 }
 
@@ -54,8 +63,50 @@ func (c *Client) WithBaseURL(baseURL string) *Client {
 	return c
 }
 
-// request executes an HTTP request with retry logic for rate limiting
+// WithRegistryURL sets a custom registry URL for token requests (useful for testing)
+func (c *Client) WithRegistryURL(registryURL string) *Client {
+	c.registryURL = registryURL
+	return c
+}
+
+// WithMetricsURL sets a custom Prometheus URL for machine metrics (useful for testing)
+func (c *Client) WithMetricsURL(metricsURL string) *Client {
+	c.metricsURL = metricsURL
+	return c
+}
+
+// AppName returns the Fly app that machines are created in.
+func (c *Client) AppName() string {
+	return c.appName
+}
+
+// request executes an HTTP request with retry logic for rate limiting, recording
+// it as a client span.
 func (c *Client) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	ctx, span := tracer.Start(ctx, "fly "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", path),
+		))
+	defer span.End()
+
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		var flyErr *FlyError
+		if errors.As(err, &flyErr) {
+			span.SetAttributes(attribute.Int("http.response.status_code", flyErr.StatusCode))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	return resp, nil
+}
+
+// send executes an HTTP request, retrying with exponential backoff while rate limited.
+func (c *Client) send(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
 	var reqBody io.Reader
 	if body != nil {
 		jsonData, err := json.Marshal(body)
@@ -100,6 +151,9 @@ func (c *Client) request(ctx context.Context, method, path string, body interfac
 				}
 			}
 
+			trace.SpanFromContext(ctx).AddEvent("rate limited, retrying",
+				trace.WithAttributes(attribute.Int("retry.attempt", attempt+1)))
+
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
@@ -3,6 +3,7 @@ package fly
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -554,3 +555,52 @@ func TestFlyError(t *testing.T) {
 		})
 	}
 }
+
+func TestMachineUsage(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test-org/api/v1/query" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("unexpected auth header %q", r.Header.Get("Authorization"))
+		}
+		query := r.URL.Query().Get("query")
+		queries = append(queries, query)
+
+		value := "250"
+		if strings.Contains(query, "mem_total") {
+			value = "104857600"
+		}
+		fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "vector", "result": [{"metric": {}, "value": [1700000000, %q]}]}}`, value)
+	}))
+	defer server.Close()
+
+	client := New("test-token", "test-org", "test-app").WithMetricsURL(server.URL)
+	usage, err := client.MachineUsage(context.Background(), "machine-123")
+	if err != nil {
+		t.Fatalf("MachineUsage() error = %v", err)
+	}
+
+	// 250 busy centiseconds
+	if usage.CPUMillis != 2500 || usage.MemoryBytes != 104857600 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	for _, query := range queries {
+		if !strings.Contains(query, `instance="machine-123"`) || !strings.Contains(query, `app="test-app"`) {
+			t.Errorf("expected query scoped to the machine, got %s", query)
+		}
+	}
+}
+
+func TestMachineUsage_NoMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "success", "data": {"resultType": "vector", "result": []}}`)
+	}))
+	defer server.Close()
+
+	client := New("test-token", "test-org", "test-app").WithMetricsURL(server.URL)
+	if _, err := client.MachineUsage(context.Background(), "machine-123"); err == nil {
+		t.Error("expected error without metrics")
+	}
+}
@@ -0,0 +1,78 @@
+package fly
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrFileNotFound is returned when a requested file does not exist in the machine.
+	ErrFileNotFound = errors.New("file not found")
+	// ErrFileTooLarge is returned when a file exceeds the caller's size limit.
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// Exit codes used by the read script to report precondition failures.
+const (
+	fileNotFoundExitCode = 44
+	fileTooLargeExitCode = 45
+)
+
+// WriteFile writes content to an absolute path inside a running machine.
+// The exec API only carries text, so content is sent base64-encoded on stdin
+// and decoded in the machine. Parent directories are created as needed.
+func (c *Client) WriteFile(ctx context.Context, machineID, path string, content []byte) error {
+	// The path is passed as a positional argument so it is never interpreted by the shell
+	script := `mkdir -p "$(dirname "$1")" && base64 -d > "$1"`
+
+	resp, err := c.Exec(ctx, machineID, &ExecRequest{
+		Cmd:   QuoteShellCmd([]string{"sh", "-c", script, "sh", path}),
+		Stdin: base64.StdEncoding.EncodeToString(content),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if resp.ExitCode != 0 {
+		return fmt.Errorf("write file failed (exit %d): %s", resp.ExitCode, strings.TrimSpace(resp.Stderr))
+	}
+
+	return nil
+}
+
+// ReadFile reads a regular file from a running machine.
+// Returns ErrFileNotFound if the path is not a regular file and ErrFileTooLarge
+// if it is larger than maxSize bytes.
+func (c *Client) ReadFile(ctx context.Context, machineID, path string, maxSize int64) ([]byte, error) {
+	// Check existence and size before transferring anything
+	script := fmt.Sprintf(`[ -f "$1" ] || exit %d; [ "$(wc -c < "$1")" -le %d ] || exit %d; base64 "$1"`,
+		fileNotFoundExitCode, maxSize, fileTooLargeExitCode)
+
+	resp, err := c.Exec(ctx, machineID, &ExecRequest{
+		Cmd: QuoteShellCmd([]string{"sh", "-c", script, "sh", path}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	switch resp.ExitCode {
+	case 0:
+	case fileNotFoundExitCode:
+		return nil, ErrFileNotFound
+	case fileTooLargeExitCode:
+		return nil, ErrFileTooLarge
+	default:
+		return nil, fmt.Errorf("read file failed (exit %d): %s", resp.ExitCode, strings.TrimSpace(resp.Stderr))
+	}
+
+	// base64 wraps its output, strip line breaks before decoding
+	encoded := strings.Join(strings.Fields(resp.Stdout), "")
+	content, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file content: %w", err)
+	}
+
+	return content, nil
+}
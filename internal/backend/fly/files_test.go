@@ -0,0 +1,111 @@
+package fly
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newExecServer returns a test server that records exec requests and replies with resp.
+func newExecServer(t *testing.T, resp ExecResponse, got *ExecRequest) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/machines/machine-123/exec") {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+}
+
+func TestWriteFile(t *testing.T) {
+	var got ExecRequest
+	server := newExecServer(t, ExecResponse{ExitCode: 0}, &got)
+	defer server.Close()
+
+	client := New("test-token", "test-org", "test-app").WithBaseURL(server.URL)
+
+	err := client.WriteFile(context.Background(), "machine-123", "/app/data.bin", []byte{0x00, 0xff, 'a'})
+	if err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if got.Stdin != base64.StdEncoding.EncodeToString([]byte{0x00, 0xff, 'a'}) {
+		t.Errorf("expected base64 stdin, got %q", got.Stdin)
+	}
+	if !strings.HasSuffix(got.Cmd, "'/app/data.bin'") {
+		t.Errorf("expected quoted path as last argument, got %q", got.Cmd)
+	}
+}
+
+func TestWriteFileNonZeroExit(t *testing.T) {
+	var got ExecRequest
+	server := newExecServer(t, ExecResponse{ExitCode: 1, Stderr: "read-only file system"}, &got)
+	defer server.Close()
+
+	client := New("test-token", "test-org", "test-app").WithBaseURL(server.URL)
+
+	err := client.WriteFile(context.Background(), "machine-123", "/app/data.bin", []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "read-only file system") {
+		t.Errorf("expected error with stderr, got %v", err)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		resp      ExecResponse
+		wantData  string
+		wantError error
+	}{
+		{
+			name:     "success with wrapped output",
+			resp:     ExecResponse{ExitCode: 0, Stdout: "aGVsbG8g\nd29ybGQ=\n"},
+			wantData: "hello world",
+		},
+		{
+			name:      "missing file",
+			resp:      ExecResponse{ExitCode: fileNotFoundExitCode},
+			wantError: ErrFileNotFound,
+		},
+		{
+			name:      "file too large",
+			resp:      ExecResponse{ExitCode: fileTooLargeExitCode},
+			wantError: ErrFileTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ExecRequest
+			server := newExecServer(t, tt.resp, &got)
+			defer server.Close()
+
+			client := New("test-token", "test-org", "test-app").WithBaseURL(server.URL)
+
+			data, err := client.ReadFile(context.Background(), "machine-123", "/app/out.txt", 1024)
+			if tt.wantError != nil {
+				if !errors.Is(err, tt.wantError) {
+					t.Errorf("expected error %v, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if string(data) != tt.wantData {
+				t.Errorf("expected data %q, got %q", tt.wantData, string(data))
+			}
+		})
+	}
+}
@@ -14,6 +14,21 @@ type MachineConfig struct {
 	Services    []Service         `json:"services,omitempty"`
 	AutoDestroy bool              `json:"auto_destroy,omitempty"`
 	Guest       *Guest            `json:"guest,omitempty"`
+	Files       []MachineFile     `json:"files,omitempty"`
+	Restart     *RestartPolicy    `json:"restart,omitempty"`
+	Mounts      []Mount           `json:"mounts,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// MachineFile is a file written into the machine's filesystem before it boots
+type MachineFile struct {
+	GuestPath string `json:"guest_path"`
+	RawValue  string `json:"raw_value"` // base64-encoded content
+}
+
+// RestartPolicy controls whether Fly restarts a machine after its process exits
+type RestartPolicy struct {
+	Policy string `json:"policy"` // no|always|on-failure
 }
 
 // Service represents a service configuration for a machine
@@ -43,6 +58,40 @@ type Machine struct {
 	Region    string         `json:"region"`
 	Config    *MachineConfig `json:"config"`
 	CreatedAt string         `json:"created_at"`
+	Events    []MachineEvent `json:"events,omitempty"`
+}
+
+// MachineEvent represents an entry in a machine's event log
+type MachineEvent struct {
+	Type      string             `json:"type"`
+	Status    string             `json:"status"`
+	Timestamp int64              `json:"timestamp"`
+	Request   *MachineEventInput `json:"request,omitempty"`
+}
+
+// MachineEventInput carries event details; only exit events are decoded
+type MachineEventInput struct {
+	ExitEvent *ExitEvent `json:"exit_event,omitempty"`
+}
+
+// ExitEvent describes how the machine's main process exited
+type ExitEvent struct {
+	ExitCode int `json:"exit_code"`
+}
+
+// ExitCode returns the exit code of the most recent process exit recorded
+// in the machine's events. ok is false if the machine has not exited yet.
+func (m *Machine) ExitCode() (code int, ok bool) {
+	var latest int64
+	for _, ev := range m.Events {
+		if ev.Type != "exit" || ev.Request == nil || ev.Request.ExitEvent == nil {
+			continue
+		}
+		if !ok || ev.Timestamp >= latest {
+			code, latest, ok = ev.Request.ExitEvent.ExitCode, ev.Timestamp, true
+		}
+	}
+	return code, ok
 }
 
 // createMachineRequest is the request body for creating a machine
@@ -54,11 +103,18 @@ type createMachineRequest struct {
 
 // CreateMachine creates a new machine in the specified app
 func (c *Client) CreateMachine(ctx context.Context, config *MachineConfig) (*Machine, error) {
+	return c.CreateMachineInRegion(ctx, "", config)
+}
+
+// CreateMachineInRegion creates a new machine in a region of the app, which
+// must be the region of any volume it mounts. An empty region lets Fly choose.
+func (c *Client) CreateMachineInRegion(ctx context.Context, region string, config *MachineConfig) (*Machine, error) {
 	if config == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
 	req := createMachineRequest{
+		Region: region,
 		Config: config,
 	}
 
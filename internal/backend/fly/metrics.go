@@ -0,0 +1,95 @@
+package fly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const defaultMetricsURL = "https://api.fly.io/prometheus"
+
+// fly_instance_cpu counts the VM's CPU time in centiseconds, per CPU and mode.
+const cpuCentisecondsPerSecond = 100
+
+// MachineUsage is a machine's resource use as reported by Fly's metrics,
+// which are collected by the platform rather than by anything the machine runs.
+type MachineUsage struct {
+	CPUMillis   int64 // busy CPU time since the machine booted
+	MemoryBytes int64 // memory in use
+}
+
+// promResponse is a Prometheus instant query response
+type promResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		Result []struct {
+			Value [2]interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// MachineUsage returns the busy CPU time and memory in use of a machine from
+// the organization's Prometheus metrics. Metrics are scraped periodically, so
+// a freshly started machine may have none yet.
+func (c *Client) MachineUsage(ctx context.Context, machineID string) (*MachineUsage, error) {
+	if machineID == "" {
+		return nil, fmt.Errorf("machineID cannot be empty")
+	}
+	if c.org == "" {
+		return nil, fmt.Errorf("fly org required to read machine metrics")
+	}
+
+	selector := fmt.Sprintf(`app=%q,instance=%q`, c.appName, machineID)
+
+	centiseconds, err := c.queryMetric(ctx, fmt.Sprintf(`sum(fly_instance_cpu{%s,mode!~"idle|iowait"})`, selector))
+	if err != nil {
+		return nil, fmt.Errorf("query cpu: %w", err)
+	}
+	memoryBytes, err := c.queryMetric(ctx, fmt.Sprintf(
+		`sum(fly_instance_memory_mem_total{%[1]s}) - sum(fly_instance_memory_mem_available{%[1]s})`, selector))
+	if err != nil {
+		return nil, fmt.Errorf("query memory: %w", err)
+	}
+
+	return &MachineUsage{
+		CPUMillis:   int64(centiseconds * 1000 / cpuCentisecondsPerSecond),
+		MemoryBytes: int64(memoryBytes),
+	}, nil
+}
+
+// queryMetric runs a Prometheus instant query that yields a single value.
+func (c *Client) queryMetric(ctx context.Context, query string) (float64, error) {
+	endpoint := fmt.Sprintf("%s/%s/api/v1/query?%s", c.metricsURL, url.PathEscape(c.org), url.Values{"query": {query}}.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body promResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, &FlyError{StatusCode: resp.StatusCode, Message: "invalid metrics response"}
+	}
+	if resp.StatusCode != http.StatusOK || body.Status != "success" {
+		return 0, &FlyError{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+	if len(body.Data.Result) == 0 {
+		return 0, fmt.Errorf("no metrics reported yet")
+	}
+
+	raw, ok := body.Data.Result[0].Value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected metric value %v", body.Data.Result[0].Value[1])
+	}
+	return strconv.ParseFloat(raw, 64)
+}
@@ -0,0 +1,45 @@
+package fly
+
+import (
+	"context"
+	"io"
+)
+
+// Build phases reported while an image is being built.
+const (
+	BuildPhaseBuilding = "building" // Builder is running setup commands
+	BuildPhasePushing  = "pushing"  // Builder is pushing layers to the registry
+)
+
+// BuildObserver receives progress from a running build: the current phase and
+// the latest tail of the builder log (empty if the builder cannot provide logs).
+type BuildObserver func(phase, logTail string)
+
+type buildObserverKey struct{}
+
+type buildLogKey struct{}
+
+// WithBuildObserver returns a context that reports build progress to observer.
+// Builders pick the observer up from the context passed to Resolve.
+func WithBuildObserver(ctx context.Context, observer BuildObserver) context.Context {
+	return context.WithValue(ctx, buildObserverKey{}, observer)
+}
+
+// ReportBuildProgress forwards progress to the observer in ctx, if any.
+func ReportBuildProgress(ctx context.Context, phase, logTail string) {
+	if observer, ok := ctx.Value(buildObserverKey{}).(BuildObserver); ok && observer != nil {
+		observer(phase, logTail)
+	}
+}
+
+// WithBuildLog returns a context whose builds copy their raw builder output to w
+// as it is produced. Builders that cannot stream logs ignore it.
+func WithBuildLog(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, buildLogKey{}, w)
+}
+
+// BuildLogWriter returns the writer set by WithBuildLog, or nil if there is none.
+func BuildLogWriter(ctx context.Context) io.Writer {
+	w, _ := ctx.Value(buildLogKey{}).(io.Writer)
+	return w
+}
@@ -0,0 +1,62 @@
+package fly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// registryHost is the Fly.io image registry.
+	registryHost = "registry.fly.io"
+
+	defaultRegistryURL = "https://" + registryHost
+)
+
+// registryTokenResponse is the body of a registry token endpoint response
+type registryTokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// RegistryPushToken returns a short-lived registry token that can push and
+// pull repository (such as "my-app/execbox-3f2a9c1d") and nothing else. It is
+// issued by the registry's token endpoint in exchange for the client's API
+// token, which never leaves this process.
+func (c *Client) RegistryPushToken(ctx context.Context, repository string) (string, error) {
+	query := url.Values{
+		"service": {registryHost},
+		"scope":   {"repository:" + repository + ":push,pull"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.registryURL+"/token?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth("x", c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request registry token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &FlyError{StatusCode: resp.StatusCode, Message: "registry token request refused"}
+	}
+
+	var body registryTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	// Token servers may answer with either field
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry token response carried no token")
+}
@@ -0,0 +1,49 @@
+package fly
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/burka/execbox-cloud/internal/backend/fly")
+
+// TraceBuildPhases returns a context in which every build phase reported with
+// ReportBuildProgress is recorded as a "build.<phase>" span, lasting until the
+// next phase starts. Progress is still passed on to any observer already in ctx.
+// Call end once the build has finished to close the last phase span.
+func TraceBuildPhases(ctx context.Context) (context.Context, func()) {
+	observer, _ := ctx.Value(buildObserverKey{}).(BuildObserver)
+
+	var (
+		mu    sync.Mutex
+		phase string
+		span  trace.Span
+	)
+	end := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if span != nil {
+			span.End()
+			span = nil
+		}
+	}
+	traced := func(p, logTail string) {
+		mu.Lock()
+		if p != phase || span == nil {
+			if span != nil {
+				span.End()
+			}
+			phase = p
+			_, span = tracer.Start(ctx, "build."+p)
+		}
+		mu.Unlock()
+
+		if observer != nil {
+			observer(p, logTail)
+		}
+	}
+	return WithBuildObserver(ctx, traced), end
+}
@@ -0,0 +1,95 @@
+package fly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	testSpansOnce sync.Once
+	testSpans     *tracetest.InMemoryExporter
+)
+
+// recordSpans installs an in-memory exporter as the global tracer provider and
+// clears the spans recorded so far. The global provider can only be set once per
+// process, so all tests share the exporter.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	testSpansOnce.Do(func() {
+		testSpans = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(testSpans)))
+	})
+	testSpans.Reset()
+	return testSpans
+}
+
+func TestClientRequest_RecordsSpan(t *testing.T) {
+	spans := recordSpans(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"machine not found"}`))
+	}))
+	defer server.Close()
+
+	client := New("token", "org", "app").WithBaseURL(server.URL)
+	if _, err := client.GetMachine(context.Background(), "m_missing"); err == nil {
+		t.Fatal("expected error for missing machine")
+	}
+
+	recorded := spans.GetSpans()
+	if len(recorded) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(recorded))
+	}
+	span := recorded[0]
+	if span.Name != "fly GET" {
+		t.Errorf("expected span name 'fly GET', got %q", span.Name)
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("expected error status, got %v", span.Status.Code)
+	}
+	var status int64
+	for _, attr := range span.Attributes {
+		if attr.Key == "http.response.status_code" {
+			status = attr.Value.AsInt64()
+		}
+	}
+	if status != http.StatusNotFound {
+		t.Errorf("expected status code attribute 404, got %d", status)
+	}
+}
+
+func TestTraceBuildPhases(t *testing.T) {
+	spans := recordSpans(t)
+
+	var observed []string
+	ctx := WithBuildObserver(context.Background(), func(phase, logTail string) {
+		observed = append(observed, phase)
+	})
+	ctx, end := TraceBuildPhases(ctx)
+
+	ReportBuildProgress(ctx, BuildPhaseBuilding, "")
+	ReportBuildProgress(ctx, BuildPhaseBuilding, "step 1/2")
+	ReportBuildProgress(ctx, BuildPhasePushing, "")
+	end()
+
+	if len(observed) != 3 {
+		t.Errorf("expected progress to reach the existing observer 3 times, got %d", len(observed))
+	}
+
+	recorded := spans.GetSpans()
+	if len(recorded) != 2 {
+		t.Fatalf("expected 2 phase spans, got %d", len(recorded))
+	}
+	if recorded[0].Name != "build.building" || recorded[1].Name != "build.pushing" {
+		t.Errorf("expected build.building then build.pushing, got %s then %s", recorded[0].Name, recorded[1].Name)
+	}
+}
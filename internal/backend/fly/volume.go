@@ -0,0 +1,85 @@
+package fly
+
+import (
+	"context"
+	"fmt"
+)
+
+// Volume represents a Fly.io volume
+type Volume struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	State             string `json:"state"`
+	Region            string `json:"region"`
+	SizeGB            int    `json:"size_gb"`
+	AttachedMachineID string `json:"attached_machine_id,omitempty"`
+}
+
+// Mount attaches a volume to a machine at a path
+type Mount struct {
+	Volume string `json:"volume"`
+	Path   string `json:"path"`
+}
+
+// createVolumeRequest is the request body for creating a volume
+type createVolumeRequest struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	SizeGB int    `json:"size_gb"`
+}
+
+// CreateVolume creates a volume in the app. Machines mounting it must be
+// created in the same region.
+func (c *Client) CreateVolume(ctx context.Context, name, region string, sizeGB int) (*Volume, error) {
+	if name == "" || region == "" {
+		return nil, fmt.Errorf("volume name and region cannot be empty")
+	}
+
+	path := fmt.Sprintf("/apps/%s/volumes", c.appName)
+	resp, err := c.request(ctx, "POST", path, createVolumeRequest{Name: name, Region: region, SizeGB: sizeGB})
+	if err != nil {
+		return nil, err
+	}
+
+	var volume Volume
+	if err := decodeResponse(resp, &volume); err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+}
+
+// GetVolume retrieves a volume by ID
+func (c *Client) GetVolume(ctx context.Context, volumeID string) (*Volume, error) {
+	if volumeID == "" {
+		return nil, fmt.Errorf("volumeID cannot be empty")
+	}
+
+	path := fmt.Sprintf("/apps/%s/volumes/%s", c.appName, volumeID)
+	resp, err := c.request(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var volume Volume
+	if err := decodeResponse(resp, &volume); err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+}
+
+// DeleteVolume permanently deletes a volume and its data
+func (c *Client) DeleteVolume(ctx context.Context, volumeID string) error {
+	if volumeID == "" {
+		return fmt.Errorf("volumeID cannot be empty")
+	}
+
+	path := fmt.Sprintf("/apps/%s/volumes/%s", c.appName, volumeID)
+	resp, err := c.request(ctx, "DELETE", path, nil)
+	if err != nil {
+		return err
+	}
+
+	return decodeResponse(resp, nil)
+}
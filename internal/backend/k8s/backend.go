@@ -9,6 +9,10 @@ import (
 
 	"github.com/burka/execbox/pkg/execbox"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -19,6 +23,8 @@ import (
 	"k8s.io/client-go/tools/remotecommand"
 )
 
+var tracer = otel.Tracer("github.com/burka/execbox-cloud/internal/backend/k8s")
+
 // BackendConfig holds configuration for the Kubernetes backend.
 type BackendConfig struct {
 	Kubeconfig       string             // Path to kubeconfig (empty = in-cluster)
@@ -36,6 +42,7 @@ type Backend struct {
 	restConfig *rest.Config
 	config     BackendConfig
 	handles    map[string]*Handle
+	observer   StatusObserver
 	mu         sync.RWMutex
 }
 
@@ -127,6 +134,24 @@ func (b *Backend) Name() string {
 
 // Run creates a Kubernetes pod from spec and returns a Handle.
 func (b *Backend) Run(ctx context.Context, spec execbox.Spec) (execbox.Handle, error) {
+	ctx, span := tracer.Start(ctx, "k8s.Run", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", b.config.Namespace),
+		attribute.String("container.image.name", spec.Image),
+	))
+	defer span.End()
+
+	handle, err := b.run(ctx, spec)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("execbox.session_id", handle.ID()))
+	return handle, nil
+}
+
+// run creates the pod for Run and attaches to it.
+func (b *Backend) run(ctx context.Context, spec execbox.Spec) (*Handle, error) {
 	// Generate unique session ID
 	sessionID := uuid.New().String()
 
@@ -223,6 +248,11 @@ const (
 // waitForPodReady waits for a pod to reach Running or terminal state.
 // Returns the state and exit code (if terminal).
 func (b *Backend) waitForPodReady(ctx context.Context, podName string, timeout time.Duration) (podState, int, error) {
+	ctx, span := tracer.Start(ctx, "k8s.waitForPodReady", trace.WithAttributes(
+		attribute.String("k8s.pod.name", podName),
+	))
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -364,6 +394,17 @@ func (b *Backend) Get(ctx context.Context, id string) (execbox.SessionInfo, erro
 	return PodToSessionInfo(pod, id), nil
 }
 
+// URL returns a port-forwarded URL for a container port of a running pod.
+// If this process holds no handle for the session (e.g. after a restart), it
+// reconnects via Attach so the forwarder lives as long as the pod is watched.
+func (b *Backend) URL(ctx context.Context, id string, port int) (string, error) {
+	handle, err := b.Attach(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return handle.URL(port)
+}
+
 // List returns all sessions matching the filter.
 func (b *Backend) List(ctx context.Context, filter execbox.Filter) ([]execbox.SessionInfo, error) {
 	// Build label selector
@@ -687,16 +728,25 @@ func (b *Backend) attachStdinOnly(ctx context.Context, podName, containerName st
 
 // Exec runs a command in a running pod.
 func (b *Backend) Exec(ctx context.Context, sessionID string, cmd []string) (stdout, stderr string, exitCode int, err error) {
+	var stdoutBuf, stderrBuf streamBuffer
+	exitCode, err = b.execStream(ctx, sessionID, cmd, nil, &stdoutBuf, &stderrBuf)
+	return stdoutBuf.String(), stderrBuf.String(), exitCode, err
+}
+
+// execStream runs a command in a running pod, wiring the given readers and writers
+// to the process streams. stdin may be nil. Returns the command's exit code;
+// a non-zero exit is not reported as an error.
+func (b *Backend) execStream(ctx context.Context, sessionID string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
 	// Find pod
 	labelSelector := fmt.Sprintf("execbox.io/session-id=%s", sessionID)
 	pods, err := b.clientset.CoreV1().Pods(b.config.Namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: labelSelector,
 	})
 	if err != nil {
-		return "", "", -1, fmt.Errorf("failed to list pods: %w", err)
+		return -1, fmt.Errorf("failed to list pods: %w", err)
 	}
 	if len(pods.Items) == 0 {
-		return "", "", -1, execbox.ErrSessionNotFound
+		return -1, execbox.ErrSessionNotFound
 	}
 
 	pod := &pods.Items[0]
@@ -710,7 +760,7 @@ func (b *Backend) Exec(ctx context.Context, sessionID string, cmd []string) (std
 		VersionedParams(&corev1.PodExecOptions{
 			Command:   cmd,
 			Container: pod.Spec.Containers[0].Name,
-			Stdin:     false,
+			Stdin:     stdin != nil,
 			Stdout:    true,
 			Stderr:    true,
 			TTY:       false,
@@ -718,40 +768,36 @@ func (b *Backend) Exec(ctx context.Context, sessionID string, cmd []string) (std
 
 	executor, err := remotecommand.NewSPDYExecutor(b.restConfig, "POST", req.URL())
 	if err != nil {
-		return "", "", -1, fmt.Errorf("failed to create executor: %w", err)
+		return -1, fmt.Errorf("failed to create executor: %w", err)
 	}
 
-	// Create buffers for output
-	var stdoutBuf, stderrBuf streamBuffer
-
-	// Use a background context for the stream to prevent premature closure
-	// when the caller's context is cancelled. The command should complete
-	// naturally and return its exit code.
-	// If we need timeout behavior, we can implement it separately by monitoring ctx.
-	err = executor.StreamWithContext(context.Background(), remotecommand.StreamOptions{
-		Stdout: &stdoutBuf,
-		Stderr: &stderrBuf,
+	// The stream is bound to the caller's context so per-call timeouts abort the
+	// exec. Callers that need the command to outlive a request must pass a
+	// detached context.
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
 	})
 
-	// Determine exit code
-	exitCode = 0
+	// A cancelled or expired context takes precedence over whatever the stream returned
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return -1, fmt.Errorf("exec aborted: %w", ctxErr)
+	}
+
 	if err != nil {
 		// Try to extract exit code from error using Kubernetes exec.CodeExitError
-		var codeExitErr interface{ ExitStatus() int }
 		if errWithCode, ok := err.(interface{ ExitStatus() int }); ok {
-			exitCode = errWithCode.ExitStatus()
-			err = nil // Non-zero exit is not an error
-		} else if exitErr, ok := err.(ExitCoder); ok {
-			exitCode = exitErr.ExitCode()
-			err = nil // Non-zero exit is not an error
-		} else {
-			// Actual error, not just non-zero exit
-			_ = codeExitErr // avoid unused warning
-			return stdoutBuf.String(), stderrBuf.String(), -1, fmt.Errorf("exec stream failed: %w", err)
+			return errWithCode.ExitStatus(), nil // Non-zero exit is not an error
+		}
+		if exitErr, ok := err.(ExitCoder); ok {
+			return exitErr.ExitCode(), nil // Non-zero exit is not an error
 		}
+		// Actual error, not just non-zero exit
+		return -1, fmt.Errorf("exec stream failed: %w", err)
 	}
 
-	return stdoutBuf.String(), stderrBuf.String(), exitCode, nil
+	return 0, nil
 }
 
 // ExitCoder is an interface for errors that include an exit code.
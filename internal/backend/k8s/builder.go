@@ -4,8 +4,11 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,7 +22,7 @@ import (
 
 const (
 	// KanikoImage is the Kaniko executor image for building containers.
-	KanikoImage = "gcr.io/kaniko-project/executor:latest"
+	KanikoImage = "gcr.io/kaniko-project/executor:v1.23.2"
 
 	// DefaultImageTTL is the default TTL for built images on ttl.sh.
 	DefaultImageTTL = "4h"
@@ -27,6 +30,12 @@ const (
 	// BuildTimeout is the maximum time allowed for a build.
 	BuildTimeout = 10 * time.Minute
 
+	// logDrainTimeout bounds how long a finished build waits for its log stream to end.
+	logDrainTimeout = 5 * time.Second
+
+	// kanikoPushMarker is logged by Kaniko when it starts pushing the built image.
+	kanikoPushMarker = "Pushing image to"
+
 	// ImageHashLength is the length of the hash used for image tags.
 	ImageHashLength = 16
 )
@@ -65,11 +74,47 @@ func NewBuilder(clientset kubernetes.Interface, namespace string, cfg BuilderCon
 	}
 }
 
+// Builder returns an image builder that runs Kaniko pods in the backend's namespace.
+func (b *Backend) Builder(cfg BuilderConfig) *Builder {
+	return NewBuilder(b.clientset, b.config.Namespace, cfg)
+}
+
+// ImageLifetime reports how long built images stay pullable.
+// Only ttl.sh expires images; other registries keep them indefinitely (ok is false).
+// An unparseable TTL on ttl.sh yields a zero lifetime so images are never reused.
+func (b *Builder) ImageLifetime() (time.Duration, bool) {
+	if b.registry != "ttl.sh" {
+		return 0, false
+	}
+
+	// ttl.sh accepts day suffixes which time.ParseDuration does not
+	if days, found := strings.CutSuffix(b.imageTTL, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, true
+		}
+		return time.Duration(n) * 24 * time.Hour, true
+	}
+
+	d, err := time.ParseDuration(b.imageTTL)
+	if err != nil || d <= 0 {
+		return 0, true
+	}
+	return d, true
+}
+
 // BuildSpec defines what to build.
 type BuildSpec struct {
 	BaseImage string             // Base image (FROM)
 	Setup     []string           // Setup commands (RUN)
 	Files     []execbox.BuildFile // Files to include (COPY)
+
+	// OnProgress, if set, is called while the build runs with the current
+	// phase ("building" or "pushing") and the tail of the Kaniko log.
+	OnProgress func(phase, logTail string)
+
+	// LogWriter, if set, receives the Kaniko log as it is produced.
+	LogWriter io.Writer
 }
 
 // Build builds an image and returns the tag.
@@ -107,8 +152,27 @@ func (b *Builder) Build(ctx context.Context, spec BuildSpec) (string, error) {
 		return "", fmt.Errorf("failed to create kaniko pod: %w", err)
 	}
 
+	// Stream logs while the build runs; registered after the cleanup defer so the
+	// stream drains before the pod is deleted
+	if spec.LogWriter != nil {
+		logCtx, cancelLogs := context.WithCancel(ctx)
+		logsDone := make(chan struct{})
+		go func() {
+			defer close(logsDone)
+			b.followPodLogs(logCtx, podName, spec.LogWriter)
+		}()
+		defer func() {
+			select {
+			case <-logsDone:
+			case <-time.After(logDrainTimeout):
+			}
+			cancelLogs()
+			<-logsDone
+		}()
+	}
+
 	// Wait for build to complete
-	if err := b.waitForBuild(ctx, podName); err != nil {
+	if err := b.waitForBuild(ctx, podName, spec.OnProgress); err != nil {
 		// Get pod logs for debugging
 		logs := b.getPodLogs(ctx, podName)
 		return "", fmt.Errorf("build failed: %w\nLogs:\n%s", err, logs)
@@ -133,9 +197,11 @@ func (b *Builder) generateDockerfile(spec BuildSpec) string {
 		})
 
 		for _, f := range sortedFiles {
-			// Files are stored in ConfigMap, mounted at /build
+			// Files are stored in ConfigMap, mounted at /build. The JSON form
+			// keeps spaces and quotes in paths part of the path.
 			srcName := sanitizePathForConfigMapKey(f.Path)
-			lines = append(lines, fmt.Sprintf("COPY %s %s", srcName, f.Path))
+			paths, _ := json.Marshal([]string{srcName, f.Path})
+			lines = append(lines, fmt.Sprintf("COPY %s", paths))
 		}
 	}
 
@@ -304,7 +370,8 @@ func (b *Builder) createKanikoPod(name, configMapName, imageRef string) *corev1.
 }
 
 // waitForBuild waits for the Kaniko pod to complete.
-func (b *Builder) waitForBuild(ctx context.Context, podName string) error {
+// While the pod runs, progress (if non-nil) receives the build phase and log tail on every poll.
+func (b *Builder) waitForBuild(ctx context.Context, podName string, progress func(phase, logTail string)) error {
 	ctx, cancel := context.WithTimeout(ctx, BuildTimeout)
 	defer cancel()
 
@@ -335,13 +402,50 @@ func (b *Builder) waitForBuild(ctx context.Context, podName string) error {
 				}
 				return fmt.Errorf("build failed: %s", reason)
 
-			case corev1.PodPending, corev1.PodRunning:
-				// Still building, continue waiting
+			case corev1.PodRunning:
+				if progress != nil {
+					logs := b.getPodLogs(ctx, podName)
+					progress(buildPhase(logs), logs)
+				}
+
+			case corev1.PodPending:
+				// Still scheduling, continue waiting
 			}
 		}
 	}
 }
 
+// buildPhase derives the build phase from Kaniko output: once Kaniko starts
+// pushing, the setup commands have all run.
+func buildPhase(logs string) string {
+	if strings.Contains(logs, kanikoPushMarker) {
+		return "pushing"
+	}
+	return "building"
+}
+
+// followPodLogs copies the pod's log to w until the container exits or ctx ends.
+// The pod may still be pending, so opening the stream is retried every second.
+func (b *Builder) followPodLogs(ctx context.Context, podName string, w io.Writer) {
+	for {
+		req := b.clientset.CoreV1().Pods(b.namespace).GetLogs(podName, &corev1.PodLogOptions{
+			Follow: true,
+		})
+		stream, err := req.Stream(ctx)
+		if err == nil {
+			defer stream.Close()
+			_, _ = io.Copy(w, stream)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
 // getPodLogs retrieves logs from a pod for debugging.
 func (b *Builder) getPodLogs(ctx context.Context, podName string) string {
 	req := b.clientset.CoreV1().Pods(b.namespace).GetLogs(podName, &corev1.PodLogOptions{
@@ -0,0 +1,62 @@
+//nolint:staticcheck // fake.NewSimpleClientset is deprecated but fake.NewClientset requires generated apply configs
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuilderImageLifetime(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    BuilderConfig
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "default ttl.sh", cfg: BuilderConfig{}, want: 4 * time.Hour, wantOK: true},
+		{name: "minutes", cfg: BuilderConfig{ImageTTL: "30m"}, want: 30 * time.Minute, wantOK: true},
+		{name: "days", cfg: BuilderConfig{ImageTTL: "1d"}, want: 24 * time.Hour, wantOK: true},
+		{name: "invalid ttl never reused", cfg: BuilderConfig{ImageTTL: "soon"}, want: 0, wantOK: true},
+		{name: "private registry", cfg: BuilderConfig{Registry: "registry.example.com/execbox"}, want: 0, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder(nil, "default", tt.cfg)
+			got, ok := b.ImageLifetime()
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ImageLifetime() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestBuildPhase(t *testing.T) {
+	building := "INFO[0001] Retrieving image manifest python:3.12\nINFO[0012] RUN pip install requests"
+	if got := buildPhase(building); got != "building" {
+		t.Errorf("buildPhase() = %q, want building", got)
+	}
+
+	pushing := building + "\nINFO[0040] Pushing image to ttl.sh/execbox-abc:4h"
+	if got := buildPhase(pushing); got != "pushing" {
+		t.Errorf("buildPhase() = %q, want pushing", got)
+	}
+}
+
+func TestBuilderFollowPodLogs(t *testing.T) {
+	b := NewBuilder(fake.NewSimpleClientset(), "default", BuilderConfig{})
+
+	var out strings.Builder
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	b.followPodLogs(ctx, "kaniko-build-test", &out)
+
+	// The fake clientset serves a fixed log body for any pod
+	if out.Len() == 0 {
+		t.Error("expected pod logs to be copied to the writer")
+	}
+}
@@ -0,0 +1,133 @@
+package k8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrFileNotFound is returned when a requested file does not exist in the pod.
+	ErrFileNotFound = errors.New("file not found")
+	// ErrFileTooLarge is returned when a file exceeds the caller's size limit.
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// tarOverhead is the slack allowed on top of the file size for tar headers and padding.
+const tarOverhead = 64 * 1024
+
+// WriteFile copies content into a pod at the given absolute path.
+// Like kubectl cp, it streams a tar archive into `tar -x` inside the container,
+// so the image must ship sh and tar. Parent directories are created as needed.
+func (b *Backend) WriteFile(ctx context.Context, sessionID, filePath string, content []byte) error {
+	dir, name := path.Split(path.Clean(filePath))
+	if name == "" {
+		return fmt.Errorf("invalid file path: %s", filePath)
+	}
+
+	// Build a single-entry tar archive in memory
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(content)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write tar header: %w", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("failed to write tar content: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize tar archive: %w", err)
+	}
+
+	// Paths are passed as positional arguments so they are never interpreted by the shell
+	cmd := []string{"sh", "-c", `mkdir -p "$1" && tar -xmf - -C "$1"`, "sh", dir}
+
+	var stderr streamBuffer
+	exitCode, err := b.execStream(ctx, sessionID, cmd, &archive, io.Discard, &stderr)
+	if err != nil {
+		return fmt.Errorf("failed to copy file to pod: %w", err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("tar extract failed (exit %d): %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// ReadFile copies a single regular file out of a pod using `tar -c`.
+// Returns ErrFileNotFound if the path is not a regular file and ErrFileTooLarge
+// if the file is larger than maxSize bytes.
+func (b *Backend) ReadFile(ctx context.Context, sessionID, filePath string, maxSize int64) ([]byte, error) {
+	dir, name := path.Split(path.Clean(filePath))
+	if name == "" {
+		return nil, fmt.Errorf("invalid file path: %s", filePath)
+	}
+
+	// Prefix with ./ so names starting with '-' are not parsed as flags
+	cmd := []string{"tar", "-cf", "-", "-C", dir, "./" + name}
+
+	stdout := &limitedBuffer{limit: maxSize + tarOverhead}
+	var stderr streamBuffer
+	exitCode, err := b.execStream(ctx, sessionID, cmd, nil, stdout, &stderr)
+	if stdout.exceeded {
+		return nil, ErrFileTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy file from pod: %w", err)
+	}
+	if exitCode != 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "No such file") || strings.Contains(msg, "not found") {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("tar create failed (exit %d): %s", exitCode, msg)
+	}
+
+	tr := tar.NewReader(bytes.NewReader(stdout.buf.Bytes()))
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tar archive: %w", err)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		// Directories and special files are treated like a missing regular file
+		return nil, ErrFileNotFound
+	}
+	if hdr.Size > maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	content, err := io.ReadAll(tr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file from tar archive: %w", err)
+	}
+
+	return content, nil
+}
+
+// limitedBuffer is an io.Writer that stops accepting data once limit bytes are written.
+// It records the overflow instead of growing without bound.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	exceeded bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(lb.buf.Len()+len(p)) > lb.limit {
+		lb.exceeded = true
+		return 0, ErrFileTooLarge
+	}
+	return lb.buf.Write(p)
+}
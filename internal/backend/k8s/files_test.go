@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestLimitedBuffer_WithinLimit tests that writes within the limit are buffered.
+func TestLimitedBuffer_WithinLimit(t *testing.T) {
+	lb := &limitedBuffer{limit: 10}
+
+	n, err := lb.Write([]byte("hello"))
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if n != 5 {
+		t.Errorf("Write() n = %d, want 5", n)
+	}
+	if lb.exceeded {
+		t.Error("exceeded = true, want false")
+	}
+	if got := lb.buf.String(); got != "hello" {
+		t.Errorf("buf = %q, want %q", got, "hello")
+	}
+}
+
+// TestLimitedBuffer_ExceedsLimit tests that overflowing writes are rejected and recorded.
+func TestLimitedBuffer_ExceedsLimit(t *testing.T) {
+	lb := &limitedBuffer{limit: 8}
+
+	if _, err := lb.Write([]byte("hello")); err != nil {
+		t.Fatalf("first Write() error = %v", err)
+	}
+
+	_, err := lb.Write([]byte("world"))
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("second Write() error = %v, want ErrFileTooLarge", err)
+	}
+	if !lb.exceeded {
+		t.Error("exceeded = false, want true")
+	}
+	if got := lb.buf.String(); got != "hello" {
+		t.Errorf("buf = %q, want %q", got, "hello")
+	}
+}
@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/burka/execbox/pkg/execbox"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// metricsAPIPath is the pod metrics endpoint served by metrics-server.
+const metricsAPIPath = "/apis/metrics.k8s.io/v1beta1"
+
+// ContainerUsage is a session container's current resource use as measured by
+// the kubelet, outside the container.
+type ContainerUsage struct {
+	CPUMillicores int64 // CPU use averaged over the metrics window
+	MemoryBytes   int64 // working set
+}
+
+// podMetrics is the subset of a metrics.k8s.io PodMetrics object we read.
+type podMetrics struct {
+	Containers []struct {
+		Name  string            `json:"name"`
+		Usage map[string]string `json:"usage"`
+	} `json:"containers"`
+}
+
+// Usage returns the current CPU and memory use of a session's container from
+// the metrics API. Requires metrics-server in the cluster.
+func (b *Backend) Usage(ctx context.Context, sessionID string) (*ContainerUsage, error) {
+	labelSelector := fmt.Sprintf("execbox.io/session-id=%s", sessionID)
+	pods, err := b.clientset.CoreV1().Pods(b.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, execbox.ErrSessionNotFound
+	}
+	pod := &pods.Items[0]
+
+	data, err := b.clientset.CoreV1().RESTClient().Get().
+		AbsPath(metricsAPIPath, "namespaces", b.config.Namespace, "pods", pod.Name).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod metrics: %w", err)
+	}
+
+	return parsePodMetrics(data, pod.Spec.Containers[0].Name)
+}
+
+// parsePodMetrics reads a container's usage from a PodMetrics object.
+func parsePodMetrics(data []byte, container string) (*ContainerUsage, error) {
+	var metrics podMetrics
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, fmt.Errorf("failed to decode pod metrics: %w", err)
+	}
+
+	for _, c := range metrics.Containers {
+		if c.Name != container {
+			continue
+		}
+		cpu, err := resource.ParseQuantity(c.Usage["cpu"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu usage %q: %w", c.Usage["cpu"], err)
+		}
+		memory, err := resource.ParseQuantity(c.Usage["memory"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory usage %q: %w", c.Usage["memory"], err)
+		}
+		return &ContainerUsage{
+			CPUMillicores: cpu.MilliValue(),
+			MemoryBytes:   memory.Value(),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no metrics for container %s", container)
+}
@@ -0,0 +1,36 @@
+package k8s
+
+import "testing"
+
+func TestParsePodMetrics(t *testing.T) {
+	data := []byte(`{
+		"kind": "PodMetrics",
+		"apiVersion": "metrics.k8s.io/v1beta1",
+		"window": "15s",
+		"containers": [
+			{"name": "sidecar", "usage": {"cpu": "2", "memory": "1Gi"}},
+			{"name": "main", "usage": {"cpu": "250m", "memory": "64Mi"}}
+		]
+	}`)
+
+	usage, err := parsePodMetrics(data, "main")
+	if err != nil {
+		t.Fatalf("parsePodMetrics() error = %v", err)
+	}
+	if usage.CPUMillicores != 250 || usage.MemoryBytes != 64<<20 {
+		t.Errorf("parsePodMetrics() = %+v, want 250m and 64Mi", usage)
+	}
+
+	// metrics-server reports CPU in nanocores
+	usage, err = parsePodMetrics([]byte(`{"containers": [{"name": "main", "usage": {"cpu": "1500000n", "memory": "2048Ki"}}]}`), "main")
+	if err != nil {
+		t.Fatalf("parsePodMetrics() error = %v", err)
+	}
+	if usage.CPUMillicores != 2 || usage.MemoryBytes != 2<<20 {
+		t.Errorf("parsePodMetrics() = %+v, want 2m (rounded up) and 2Mi", usage)
+	}
+
+	if _, err := parsePodMetrics([]byte(`{"containers": []}`), "main"); err == nil {
+		t.Error("expected error without container metrics")
+	}
+}
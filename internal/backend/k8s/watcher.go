@@ -10,6 +10,29 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 )
 
+// StatusObserver is notified when the pod of a session starts running or
+// terminates. exitCode is set for terminated sessions.
+type StatusObserver func(sessionID string, status execbox.Status, exitCode *int)
+
+// SetStatusObserver sets the function notified of status changes seen by pod
+// watchers. Deletions are not reported; they come from Kill or Destroy.
+func (b *Backend) SetStatusObserver(observer StatusObserver) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.observer = observer
+}
+
+// notify reports a status change to the observer, if any.
+func (b *Backend) notify(sessionID string, status execbox.Status, exitCode *int) {
+	b.mu.RLock()
+	observer := b.observer
+	b.mu.RUnlock()
+
+	if observer != nil {
+		observer(sessionID, status, exitCode)
+	}
+}
+
 // watchPod watches for pod phase changes and signals exit when the pod terminates.
 func (b *Backend) watchPod(ctx context.Context, h *Handle, podName string) {
 	watcher, err := b.clientset.CoreV1().Pods(b.config.Namespace).Watch(ctx, metav1.ListOptions{
@@ -25,6 +48,7 @@ func (b *Backend) watchPod(ctx context.Context, h *Handle, podName string) {
 	}
 	defer watcher.Stop()
 
+	running := false
 	for {
 		select {
 		case <-ctx.Done():
@@ -54,8 +78,14 @@ func (b *Backend) watchPod(ctx context.Context, h *Handle, podName string) {
 				continue
 			}
 
-			// Check if pod has terminated
+			// Check if pod has started or terminated
 			switch pod.Status.Phase {
+			case corev1.PodRunning:
+				if !running {
+					running = true
+					b.notify(h.ID(), execbox.StatusRunning, nil)
+				}
+
 			case corev1.PodSucceeded, corev1.PodFailed:
 				// Pod has terminated, extract exit code
 				exitCode := 0
@@ -84,6 +114,12 @@ func (b *Backend) watchPod(ctx context.Context, h *Handle, podName string) {
 					Error: exitErr,
 				})
 
+				status := execbox.StatusStopped
+				if exitErr != nil {
+					status = execbox.StatusFailed
+				}
+				b.notify(h.ID(), status, &exitCode)
+
 				// Note: Do NOT remove the handle here. Clients may still want to
 				// attach and read the buffered output after the pod completes.
 				// The handle will be removed when:
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+)
+
+// apiKeyPrefixLen is the number of leading characters of an API key stored in
+// the clear to look the key up by.
+const apiKeyPrefixLen = 12
+
+// SetAPIKeyPepper sets the server-side secret API keys are hashed with.
+// Changing it invalidates every hashed key, so it must stay the same across
+// restarts and replicas.
+func (c *Client) SetAPIKeyPepper(pepper string) {
+	c.apiKeyPepper = []byte(pepper)
+}
+
+// generateAPIKey generates a new secure random API key.
+func generateAPIKey() (string, error) {
+	keyBytes := make([]byte, 32)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return fmt.Sprintf("sk_%s", hex.EncodeToString(keyBytes)), nil
+}
+
+// apiKeyPrefix returns the part of key stored in the clear for lookup.
+func apiKeyPrefix(key string) string {
+	if len(key) < apiKeyPrefixLen {
+		return key
+	}
+	return key[:apiKeyPrefixLen]
+}
+
+// hashAPIKey returns the hex HMAC-SHA256 of key under the server's pepper,
+// which is what the database stores for the key.
+func (c *Client) hashAPIKey(key string) string {
+	mac := hmac.New(sha256.New, c.apiKeyPepper)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// matchAPIKey reports whether key is the key stored as keyHash, or, for keys
+// not hashed yet, as the plaintext legacyKey. Comparisons take constant time.
+func (c *Client) matchAPIKey(key string, keyHash, legacyKey *string) bool {
+	if keyHash != nil {
+		return hmac.Equal([]byte(c.hashAPIKey(key)), []byte(*keyHash))
+	}
+	if legacyKey != nil {
+		return subtle.ConstantTimeCompare([]byte(key), []byte(*legacyKey)) == 1
+	}
+	return false
+}
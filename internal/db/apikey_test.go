@@ -0,0 +1,54 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, err := generateAPIKey()
+	if err != nil {
+		t.Fatalf("generateAPIKey failed: %v", err)
+	}
+	if !strings.HasPrefix(key, "sk_") || len(key) != 67 {
+		t.Errorf("unexpected key format %q", key)
+	}
+	if prefix := apiKeyPrefix(key); prefix != key[:apiKeyPrefixLen] {
+		t.Errorf("apiKeyPrefix = %q, want %q", prefix, key[:apiKeyPrefixLen])
+	}
+	if prefix := apiKeyPrefix("sk_short"); prefix != "sk_short" {
+		t.Errorf("apiKeyPrefix of a short key = %q, want it unchanged", prefix)
+	}
+}
+
+func TestMatchAPIKey(t *testing.T) {
+	client := &Client{}
+	client.SetAPIKeyPepper("pepper")
+	key := "sk_0123456789abcdef"
+	hash := client.hashAPIKey(key)
+	other := "sk_0123456789abcdeg"
+
+	if len(hash) != 64 || strings.Contains(hash, key) {
+		t.Errorf("unexpected hash %q", hash)
+	}
+	if !client.matchAPIKey(key, &hash, nil) {
+		t.Error("expected the key to match its hash")
+	}
+	if client.matchAPIKey(other, &hash, nil) {
+		t.Error("expected another key not to match the hash")
+	}
+	if !client.matchAPIKey(key, nil, &key) {
+		t.Error("expected a plaintext key to match itself")
+	}
+	if client.matchAPIKey(other, nil, &key) {
+		t.Error("expected another key not to match the plaintext key")
+	}
+	if client.matchAPIKey(key, nil, nil) {
+		t.Error("expected a row without hash or plaintext to match nothing")
+	}
+
+	unpeppered := &Client{}
+	if unpeppered.hashAPIKey(key) == hash {
+		t.Error("expected the pepper to change the hash")
+	}
+}
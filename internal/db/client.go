@@ -9,7 +9,8 @@ import (
 
 // Client wraps a PostgreSQL connection pool and provides database operations.
 type Client struct {
-	pool *pgxpool.Pool
+	pool         *pgxpool.Pool
+	apiKeyPepper []byte // Secret API keys are hashed with; see SetAPIKeyPepper
 }
 
 // New creates a new database client with the provided connection URL.
@@ -29,6 +30,9 @@ func New(ctx context.Context, databaseURL string) (*Client, error) {
 	config.MaxConns = 25
 	config.MinConns = 5
 
+	// Record a trace span for every query
+	config.ConnConfig.Tracer = queryTracer{}
+
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
@@ -2,51 +2,301 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-// RunMigrations executes all SQL migration files in order.
-// Migrations are idempotent (use IF NOT EXISTS) so safe to run multiple times.
-func (c *Client) RunMigrations(ctx context.Context) error {
-	// Get all migration files
+// migrationLockID identifies the advisory lock held while migrating, so replicas
+// starting at the same time apply each migration once.
+const migrationLockID int64 = 0x65786563626f78 // "execbox"
+
+// createSchemaMigrations creates the ledger of applied migrations.
+const createSchemaMigrations = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)
+`
+
+// Migration is a schema change embedded in the binary. Files are named
+// NNN_description.sql, with an optional NNN_description.down.sql reverting it.
+type Migration struct {
+	Version  int
+	Name     string // File name of the up migration
+	Checksum string // SHA-256 of the up migration
+	Up       string
+	Down     string // Empty if the migration cannot be reverted
+}
+
+// MigrationStatus is a migration and whether it has been applied.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time // Nil if pending
+	Modified  bool       // The file changed after it was applied
+}
+
+// appliedMigration is a row of schema_migrations.
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// loadMigrations reads the embedded migrations, ordered by version.
+func loadMigrations() ([]Migration, error) {
 	entries, err := fs.ReadDir(migrationsFS, "migrations")
 	if err != nil {
-		return fmt.Errorf("read migrations dir: %w", err)
+		return nil, fmt.Errorf("read migrations dir: %w", err)
 	}
 
-	// Sort by filename to ensure order
-	var files []string
+	byVersion := make(map[int]*Migration)
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
-			files = append(files, entry.Name())
+		file := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(file, ".sql") {
+			continue
 		}
-	}
-	sort.Strings(files)
 
-	// Run each migration
-	for _, file := range files {
-		slog.Info("running migration", "file", file)
+		prefix, _, _ := strings.Cut(file, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: file name must start with a version number", file)
+		}
 
 		content, err := migrationsFS.ReadFile("migrations/" + file)
 		if err != nil {
-			return fmt.Errorf("read migration %s: %w", file, err)
+			return nil, fmt.Errorf("read migration %s: %w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		if strings.HasSuffix(file, ".down.sql") {
+			m.Down = string(content)
+			continue
+		}
+		if m.Name != "" {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.Name, file, version)
+		}
+		sum := sha256.Sum256(content)
+		m.Name = file
+		m.Checksum = hex.EncodeToString(sum[:])
+		m.Up = string(content)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, m := range byVersion {
+		if m.Name == "" {
+			return nil, fmt.Errorf("down migration for version %d has no up migration", version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// withMigrationLock runs fn on a connection holding the migration advisory lock,
+// once the schema_migrations ledger exists. It waits for other replicas to
+// finish migrating first.
+func (c *Client) withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire migration connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// The lock belongs to the session, so a connection that fails to unlock
+		// must not go back to the pool still holding it
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			slog.Warn("failed to release migration lock", "error", err)
+			_ = conn.Conn().Close(context.Background())
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, createSchemaMigrations); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// appliedMigrations reads the ledger, keyed by version.
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("scan schema_migrations row: %w", err)
+		}
+		applied[version] = a
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schema_migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// MigrationStatus reports every embedded migration and whether it has been applied.
+func (c *Client) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = c.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
 		}
 
-		_, err = c.pool.Exec(ctx, string(content))
+		for _, m := range migrations {
+			status := MigrationStatus{Migration: m}
+			if a, ok := applied[m.Version]; ok {
+				appliedAt := a.appliedAt
+				status.AppliedAt = &appliedAt
+				status.Modified = a.checksum != m.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// RunMigrations applies pending migrations in order, each in its own
+// transaction together with its schema_migrations entry. It refuses to run if
+// an applied migration was modified since, and returns the migrations applied.
+func (c *Client) RunMigrations(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	err = c.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
 		if err != nil {
-			return fmt.Errorf("execute migration %s: %w", file, err)
+			return err
 		}
 
-		slog.Info("migration completed", "file", file)
+		for _, m := range migrations {
+			if a, ok := applied[m.Version]; ok {
+				if a.checksum != m.Checksum {
+					return fmt.Errorf("migration %s was modified after it was applied", m.Name)
+				}
+				continue
+			}
+
+			slog.Info("running migration", "file", m.Name)
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx,
+					`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+					m.Version, m.Name, m.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("execute migration %s: %w", m.Name, err)
+			}
+			slog.Info("migration completed", "file", m.Name)
+			ran = append(ran, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ran, nil
+}
+
+// RollbackMigration reverts the most recently applied migration with its down
+// migration, in a transaction that also removes its schema_migrations entry.
+// It returns the reverted migration, or nil if none is applied.
+func (c *Client) RollbackMigration(ctx context.Context) (*Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted *Migration
+	err = c.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		var version int
+		err := conn.QueryRow(ctx, `SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`).Scan(&version)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read schema_migrations: %w", err)
+		}
+
+		idx := sort.Search(len(migrations), func(i int) bool { return migrations[i].Version >= version })
+		if idx == len(migrations) || migrations[idx].Version != version {
+			return fmt.Errorf("applied migration %d is not known to this binary", version)
+		}
+		m := migrations[idx]
+		if m.Down == "" {
+			return fmt.Errorf("migration %s cannot be reverted: it has no down migration", m.Name)
+		}
+
+		slog.Info("reverting migration", "file", m.Name)
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("revert migration %s: %w", m.Name, err)
+		}
+		reverted = &m
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return reverted, nil
 }
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+// lastIrreversibleMigration is the last migration written before down
+// migrations were supported.
+const lastIrreversibleMigration = 7
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for i, m := range migrations {
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			t.Errorf("migration %s out of order after %s", m.Name, migrations[i-1].Name)
+		}
+		if strings.HasSuffix(m.Name, ".down.sql") {
+			t.Errorf("down migration %s loaded as an up migration", m.Name)
+		}
+		if len(m.Checksum) != 64 || m.Up == "" {
+			t.Errorf("migration %s: expected SQL and a SHA-256 checksum", m.Name)
+		}
+		if m.Version == 16 && !strings.Contains(m.Down, "DROP TABLE IF EXISTS rate_limit_buckets") {
+			t.Errorf("expected %s to carry its down migration", m.Name)
+		}
+		// Only the migrations that predate down migrations cannot be reverted
+		if m.Version > lastIrreversibleMigration && m.Down == "" {
+			t.Errorf("expected %s to have a down migration", m.Name)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+-- Revert migration 008: sessions no longer record their network mode.
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS network;
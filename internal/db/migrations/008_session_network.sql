@@ -0,0 +1,6 @@
+-- Migration 008: Track the network mode a session was created with
+-- Needed to decide whether per-port URLs can be handed out (only for 'exposed')
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS network TEXT;
+
+COMMENT ON COLUMN sessions.network IS 'Network mode requested at creation: none, outgoing, or exposed';
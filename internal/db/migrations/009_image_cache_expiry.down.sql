@@ -0,0 +1,4 @@
+-- Revert migration 009: cached images no longer expire.
+-- Entries on registries with limited retention match again after their tag is gone.
+
+ALTER TABLE image_cache DROP COLUMN IF EXISTS expires_at;
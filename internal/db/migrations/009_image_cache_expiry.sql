@@ -0,0 +1,6 @@
+-- Migration 009: Expire cached images on registries with limited retention
+-- ttl.sh deletes images after their TTL, so cache entries must stop matching before then
+
+ALTER TABLE image_cache ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN image_cache.expires_at IS 'When the registry tag stops being usable (NULL = never expires)';
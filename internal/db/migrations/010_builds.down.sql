@@ -0,0 +1,3 @@
+-- Revert migration 010: drop builds
+
+DROP TABLE IF EXISTS builds;
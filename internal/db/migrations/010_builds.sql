@@ -0,0 +1,29 @@
+-- Migration 010: Asynchronous image builds
+-- Kaniko builds can outlast a request, so they are tracked as their own resource
+
+CREATE TABLE IF NOT EXISTS builds (
+    id TEXT PRIMARY KEY,                    -- build_xxx
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    hash TEXT NOT NULL,                     -- Content-addressed setup hash (same as image_cache.hash)
+    base_image TEXT NOT NULL,
+    phase TEXT NOT NULL DEFAULT 'queued',
+    registry_tag TEXT,                      -- Set once the build is ready
+    error TEXT,                             -- Set when the build failed
+    log_tail TEXT,                          -- Last lines of builder output
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+
+    CONSTRAINT builds_phase_check CHECK (phase IN ('queued', 'building', 'pushing', 'ready', 'failed'))
+);
+
+-- Index for listing builds by API key
+CREATE INDEX IF NOT EXISTS idx_builds_api_key_id ON builds(api_key_id, created_at DESC);
+
+-- Index for finding unfinished builds after a restart
+CREATE INDEX IF NOT EXISTS idx_builds_unfinished ON builds(phase) WHERE phase IN ('queued', 'building', 'pushing');
+
+COMMENT ON TABLE builds IS 'Asynchronous custom image builds from setup commands and files';
+COMMENT ON COLUMN builds.phase IS 'Build phase: queued, building, pushing, ready, or failed';
+COMMENT ON COLUMN builds.registry_tag IS 'Image reference to run once the build is ready';
+COMMENT ON COLUMN builds.log_tail IS 'Tail of the builder log for progress and failure diagnosis';
@@ -0,0 +1,40 @@
+-- Revert migration 012: drop budget alerts and count costs only on INSERT again.
+-- Spend recovered from ended sessions is kept.
+
+DROP TABLE IF EXISTS budget_alerts;
+
+DROP TRIGGER IF EXISTS trigger_update_account_cost_tracking ON sessions;
+
+CREATE OR REPLACE FUNCTION update_account_cost_tracking()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO account_cost_tracking (
+        account_id,
+        date,
+        daily_cost_cents,
+        daily_executions,
+        billing_period_start,
+        billing_period_end,
+        updated_at
+    ) VALUES (
+        NEW.account_id,
+        DATE(NEW.created_at),
+        COALESCE(NEW.cost_estimate_cents, 0),
+        1,
+        DATE_TRUNC('month', NEW.created_at)::DATE,
+        (DATE_TRUNC('month', NEW.created_at) + INTERVAL '1 month' - INTERVAL '1 day')::DATE,
+        NOW()
+    )
+    ON CONFLICT (account_id, date) DO UPDATE SET
+        daily_cost_cents = account_cost_tracking.daily_cost_cents + COALESCE(NEW.cost_estimate_cents, 0),
+        daily_executions = account_cost_tracking.daily_executions + 1,
+        updated_at = NOW();
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_update_account_cost_tracking
+    AFTER INSERT ON sessions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_account_cost_tracking();
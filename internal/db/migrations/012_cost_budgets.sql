@@ -0,0 +1,100 @@
+-- Migration 012: Monthly cost budgets
+-- account_cost_tracking only ran on INSERT, before a session has a cost, so spend
+-- always stayed at zero. Costs are now added when the session ends.
+
+DROP TRIGGER IF EXISTS trigger_update_account_cost_tracking ON sessions;
+
+CREATE OR REPLACE FUNCTION update_account_cost_tracking()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Count executions when the session is created
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO account_cost_tracking (
+            account_id,
+            date,
+            daily_cost_cents,
+            daily_executions,
+            billing_period_start,
+            billing_period_end,
+            updated_at
+        ) VALUES (
+            NEW.account_id,
+            DATE(NEW.created_at),
+            COALESCE(NEW.cost_estimate_cents, 0),
+            1,
+            DATE_TRUNC('month', NEW.created_at)::DATE,
+            (DATE_TRUNC('month', NEW.created_at) + INTERVAL '1 month' - INTERVAL '1 day')::DATE,
+            NOW()
+        )
+        ON CONFLICT (account_id, date) DO UPDATE SET
+            daily_cost_cents = account_cost_tracking.daily_cost_cents + EXCLUDED.daily_cost_cents,
+            daily_executions = account_cost_tracking.daily_executions + 1,
+            updated_at = NOW();
+
+    -- Add the cost once the session reaches a terminal state
+    ELSIF TG_OP = 'UPDATE' AND
+          OLD.status NOT IN ('stopped', 'failed', 'killed', 'timeout') AND
+          NEW.status IN ('stopped', 'failed', 'killed', 'timeout') THEN
+        INSERT INTO account_cost_tracking (
+            account_id,
+            date,
+            daily_cost_cents,
+            daily_executions,
+            billing_period_start,
+            billing_period_end,
+            updated_at
+        ) VALUES (
+            NEW.account_id,
+            DATE(NEW.created_at),
+            COALESCE(NEW.cost_estimate_cents, 0),
+            0,
+            DATE_TRUNC('month', NEW.created_at)::DATE,
+            (DATE_TRUNC('month', NEW.created_at) + INTERVAL '1 month' - INTERVAL '1 day')::DATE,
+            NOW()
+        )
+        ON CONFLICT (account_id, date) DO UPDATE SET
+            daily_cost_cents = account_cost_tracking.daily_cost_cents + EXCLUDED.daily_cost_cents,
+            updated_at = NOW();
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_update_account_cost_tracking
+    AFTER INSERT OR UPDATE ON sessions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_account_cost_tracking();
+
+-- Recover the current month's spend from ended sessions. Rows that already
+-- have a cost are maintained by the trigger and left alone.
+UPDATE account_cost_tracking t
+SET daily_cost_cents = s.cost_cents, updated_at = NOW()
+FROM (
+    SELECT account_id, DATE(created_at) AS date, SUM(cost_estimate_cents) AS cost_cents
+    FROM sessions
+    WHERE created_at >= DATE_TRUNC('month', NOW())
+      AND status IN ('stopped', 'failed', 'killed', 'timeout')
+      AND cost_estimate_cents IS NOT NULL
+    GROUP BY account_id, DATE(created_at)
+) s
+WHERE t.account_id = s.account_id
+  AND t.date = s.date
+  AND t.daily_cost_cents = 0;
+
+-- One alert per account and billing period once spend crosses the alert threshold
+CREATE TABLE IF NOT EXISTS budget_alerts (
+    id BIGSERIAL PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    billing_period_start DATE NOT NULL,
+    threshold_percentage INTEGER NOT NULL,
+    spent_cents BIGINT NOT NULL,
+    limit_cents BIGINT NOT NULL,
+    billing_email TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT budget_alerts_account_period_unique UNIQUE(account_id, billing_period_start)
+);
+
+COMMENT ON TABLE budget_alerts IS 'Monthly cost alerts, at most one per account and billing period';
+COMMENT ON COLUMN budget_alerts.spent_cents IS 'Projected month-to-date cost when the alert fired';
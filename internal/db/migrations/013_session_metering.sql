@@ -0,0 +1,64 @@
+-- Migration 013: Metered session usage
+-- Sessions record their real CPU time and peak memory, sampled from the backend.
+-- endSessionUpdate has always written duration_ms, which sessions never had.
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS duration_ms BIGINT;
+ALTER TABLE sessions ALTER COLUMN cpu_millis_used TYPE BIGINT;
+
+-- started_at is only set for sessions that were seen pending, so hourly usage
+-- recorded no duration or memory for most sessions. Use the recorded duration
+-- and fall back to the session's lifetime.
+CREATE OR REPLACE FUNCTION update_hourly_account_usage()
+RETURNS TRIGGER AS $$
+DECLARE
+    session_duration_ms BIGINT;
+BEGIN
+    -- Only insert/update metrics when session ends (transitions to terminal state)
+    IF TG_OP = 'UPDATE' AND
+       OLD.status NOT IN ('stopped', 'failed', 'killed', 'timeout') AND
+       NEW.status IN ('stopped', 'failed', 'killed', 'timeout') THEN
+
+        session_duration_ms := COALESCE(
+            NEW.duration_ms,
+            EXTRACT(EPOCH FROM (NEW.ended_at - COALESCE(NEW.started_at, NEW.created_at))) * 1000,
+            0
+        );
+
+        INSERT INTO hourly_account_usage (
+            account_id,
+            hour,
+            executions,
+            duration_ms,
+            cost_estimate_cents,
+            cpu_millis_used,
+            memory_mb_seconds,
+            errors,
+            updated_at
+        ) VALUES (
+            NEW.account_id,
+            date_trunc('hour', NEW.created_at),
+            1,
+            session_duration_ms,
+            COALESCE(NEW.cost_estimate_cents, 0),
+            COALESCE(NEW.cpu_millis_used, 0),
+            COALESCE(NEW.memory_peak_mb, 0) * session_duration_ms / 1000,
+            CASE WHEN NEW.exit_code IS NOT NULL AND NEW.exit_code != 0 THEN 1 ELSE 0 END,
+            NOW()
+        )
+        ON CONFLICT (account_id, hour) DO UPDATE SET
+            executions = hourly_account_usage.executions + 1,
+            duration_ms = hourly_account_usage.duration_ms + EXCLUDED.duration_ms,
+            cost_estimate_cents = hourly_account_usage.cost_estimate_cents + EXCLUDED.cost_estimate_cents,
+            cpu_millis_used = hourly_account_usage.cpu_millis_used + EXCLUDED.cpu_millis_used,
+            memory_mb_seconds = hourly_account_usage.memory_mb_seconds + EXCLUDED.memory_mb_seconds,
+            errors = hourly_account_usage.errors + EXCLUDED.errors,
+            updated_at = NOW();
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON COLUMN sessions.duration_ms IS 'Time from creation to end in milliseconds; NULL while the session is live';
+COMMENT ON COLUMN sessions.cpu_millis_used IS 'CPU time sampled from the backend, or the duration for sessions never sampled';
+COMMENT ON COLUMN sessions.memory_peak_mb IS 'Peak memory sampled from the backend, or the default for sessions never sampled';
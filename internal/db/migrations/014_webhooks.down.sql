@@ -0,0 +1,4 @@
+-- Revert migration 014: drop webhooks and their deliveries
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,45 @@
+-- Migration 014: Outbound webhooks
+-- Accounts subscribe URLs to session and build events. Every event is stored as
+-- a delivery per subscribed webhook and retried until the endpoint accepts it.
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,                   -- HMAC-SHA256 signing key, whsec_xxx
+    events TEXT[] NOT NULL,
+    description TEXT,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for finding an account's webhooks when an event fires
+CREATE INDEX IF NOT EXISTS idx_webhooks_account_id ON webhooks(account_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,                 -- evt_xxx, shared by the deliveries of one event
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER,                -- HTTP status of the last attempt
+    error TEXT,                             -- Why the last attempt failed
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+
+    CONSTRAINT webhook_deliveries_status_check CHECK (status IN ('pending', 'succeeded', 'failed'))
+);
+
+-- Index for the delivery log of a webhook
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, created_at DESC);
+
+-- Index for claiming deliveries that are due
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+COMMENT ON TABLE webhooks IS 'Account subscriptions to session and build events';
+COMMENT ON TABLE webhook_deliveries IS 'One row per event and subscribed webhook, with the outcome of its latest attempt';
+COMMENT ON COLUMN webhook_deliveries.next_attempt_at IS 'When a pending delivery is next attempted; pushed forward while an attempt is in flight';
@@ -0,0 +1,3 @@
+-- Revert migration 015: drop the session event log
+
+DROP TABLE IF EXISTS session_events;
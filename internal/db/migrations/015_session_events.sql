@@ -0,0 +1,20 @@
+-- Migration 015: Session event log
+-- Status transitions of sessions, streamed to clients by GET /v1/events.
+-- The BIGSERIAL id is the SSE event ID, so clients resume with Last-Event-ID.
+
+CREATE TABLE IF NOT EXISTS session_events (
+    id BIGSERIAL PRIMARY KEY,
+    account_id UUID NOT NULL,
+    session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,                     -- session.created, session.running, session.exited, session.timeout
+    data JSONB NOT NULL,                    -- The session after the transition
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for reading an account's events after a given ID
+CREATE INDEX IF NOT EXISTS idx_session_events_account_id ON session_events(account_id, id);
+
+-- Index for pruning old events
+CREATE INDEX IF NOT EXISTS idx_session_events_created_at ON session_events(created_at);
+
+COMMENT ON TABLE session_events IS 'Session status transitions per account, kept for a day so event streams can resume';
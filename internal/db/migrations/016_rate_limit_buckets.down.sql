@@ -0,0 +1,3 @@
+-- Revert migration 016: drop shared rate limit buckets
+
+DROP TABLE IF EXISTS rate_limit_buckets;
@@ -0,0 +1,14 @@
+-- Migration 016: Shared rate limit buckets
+-- Token buckets kept in Postgres so every replica enforces the same limits.
+-- Buckets refill lazily: tokens is the level at updated_at.
+
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key TEXT PRIMARY KEY,                   -- Scope and subject, e.g. api_key:<uuid> or ip:<addr>
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for pruning idle buckets
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);
+
+COMMENT ON TABLE rate_limit_buckets IS 'Token buckets of the rate limiter, shared between API replicas';
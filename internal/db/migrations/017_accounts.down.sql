@@ -0,0 +1,32 @@
+-- Revert migration 017: account_id references the account's primary API key again.
+-- Accounts created after 017 must still have a key with the account's ID.
+
+ALTER TABLE usage_metrics DROP CONSTRAINT IF EXISTS usage_metrics_account_id_fkey;
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_account_id_fkey;
+ALTER TABLE account_limits DROP CONSTRAINT IF EXISTS account_limits_account_id_fkey;
+
+ALTER TABLE webhooks DROP CONSTRAINT IF EXISTS webhooks_account_id_fkey;
+ALTER TABLE webhooks ADD CONSTRAINT webhooks_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES api_keys(id) ON DELETE CASCADE;
+
+ALTER TABLE budget_alerts DROP CONSTRAINT IF EXISTS budget_alerts_account_id_fkey;
+ALTER TABLE budget_alerts ADD CONSTRAINT budget_alerts_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES api_keys(id) ON DELETE CASCADE;
+
+ALTER TABLE account_cost_tracking DROP CONSTRAINT IF EXISTS account_cost_tracking_account_id_fkey;
+ALTER TABLE account_cost_tracking ADD CONSTRAINT account_cost_tracking_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES api_keys(id) ON DELETE CASCADE;
+
+ALTER TABLE usage_attribution DROP CONSTRAINT IF EXISTS usage_attribution_account_id_fkey;
+ALTER TABLE usage_attribution ADD CONSTRAINT usage_attribution_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES api_keys(id) ON DELETE CASCADE;
+
+ALTER TABLE hourly_account_usage DROP CONSTRAINT IF EXISTS hourly_account_usage_account_id_fkey;
+ALTER TABLE hourly_account_usage ADD CONSTRAINT hourly_account_usage_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES api_keys(id) ON DELETE CASCADE;
+
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_account_id_fkey;
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES api_keys(id) ON DELETE CASCADE;
+
+DROP TABLE IF EXISTS accounts;
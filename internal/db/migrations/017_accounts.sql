@@ -0,0 +1,117 @@
+-- Migration 017: First-class accounts
+-- Until now an account was identified by the ID of its primary API key, and
+-- account_id columns referenced api_keys. Accounts get their own table; keys,
+-- sessions, limits, usage and cost all reference it. Existing accounts keep
+-- their ID, so data recorded against the primary key stays attributed.
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id UUID PRIMARY KEY,
+    name TEXT,
+    email TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One account per primary key, keeping the key's email
+INSERT INTO accounts (id, email, created_at, updated_at)
+SELECT k.id, k.email, k.created_at, NOW()
+FROM api_keys k
+WHERE k.id IN (SELECT account_id FROM api_keys)
+ON CONFLICT (id) DO NOTHING;
+
+-- Sessions and usage of sub-keys were partly recorded against the sub-key
+-- itself. Move them to the owning account.
+UPDATE sessions s
+SET account_id = k.account_id
+FROM api_keys k
+WHERE s.api_key_id = k.id AND s.account_id <> k.account_id;
+
+UPDATE usage_metrics u
+SET account_id = k.account_id
+FROM api_keys k
+WHERE u.api_key_id = k.id AND u.account_id <> k.account_id;
+
+UPDATE usage_attribution u
+SET account_id = k.account_id
+FROM api_keys k
+WHERE u.account_id = k.id AND k.account_id <> k.id;
+
+UPDATE webhooks w
+SET account_id = k.account_id
+FROM api_keys k
+WHERE w.account_id = k.id AND k.account_id <> k.id;
+
+-- Aggregates keyed by a sub-key are added to the account's rows
+INSERT INTO hourly_account_usage (account_id, hour, executions, duration_ms, cost_estimate_cents,
+                                  cpu_millis_used, memory_mb_seconds, errors, updated_at)
+SELECT k.account_id, h.hour, h.executions, h.duration_ms, h.cost_estimate_cents,
+       h.cpu_millis_used, h.memory_mb_seconds, h.errors, NOW()
+FROM hourly_account_usage h
+JOIN api_keys k ON k.id = h.account_id AND k.account_id <> k.id
+ON CONFLICT (account_id, hour) DO UPDATE SET
+    executions = hourly_account_usage.executions + EXCLUDED.executions,
+    duration_ms = hourly_account_usage.duration_ms + EXCLUDED.duration_ms,
+    cost_estimate_cents = hourly_account_usage.cost_estimate_cents + EXCLUDED.cost_estimate_cents,
+    cpu_millis_used = hourly_account_usage.cpu_millis_used + EXCLUDED.cpu_millis_used,
+    memory_mb_seconds = hourly_account_usage.memory_mb_seconds + EXCLUDED.memory_mb_seconds,
+    errors = hourly_account_usage.errors + EXCLUDED.errors,
+    updated_at = NOW();
+
+INSERT INTO account_cost_tracking (account_id, date, daily_cost_cents, daily_executions,
+                                   billing_period_start, billing_period_end, updated_at)
+SELECT k.account_id, t.date, t.daily_cost_cents, t.daily_executions,
+       t.billing_period_start, t.billing_period_end, NOW()
+FROM account_cost_tracking t
+JOIN api_keys k ON k.id = t.account_id AND k.account_id <> k.id
+ON CONFLICT (account_id, date) DO UPDATE SET
+    daily_cost_cents = account_cost_tracking.daily_cost_cents + EXCLUDED.daily_cost_cents,
+    daily_executions = account_cost_tracking.daily_executions + EXCLUDED.daily_executions,
+    updated_at = NOW();
+
+-- Rows left under sub-keys are now merged, or were never read: 006 created
+-- limits for every key, but only the account's limits apply
+DELETE FROM hourly_account_usage WHERE account_id NOT IN (SELECT id FROM accounts);
+DELETE FROM account_cost_tracking WHERE account_id NOT IN (SELECT id FROM accounts);
+DELETE FROM budget_alerts WHERE account_id NOT IN (SELECT id FROM accounts);
+DELETE FROM account_limits WHERE account_id NOT IN (SELECT id FROM accounts);
+
+-- Point every account_id at accounts
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_account_id_fkey;
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE hourly_account_usage DROP CONSTRAINT IF EXISTS hourly_account_usage_account_id_fkey;
+ALTER TABLE hourly_account_usage ADD CONSTRAINT hourly_account_usage_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE usage_attribution DROP CONSTRAINT IF EXISTS usage_attribution_account_id_fkey;
+ALTER TABLE usage_attribution ADD CONSTRAINT usage_attribution_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE account_cost_tracking DROP CONSTRAINT IF EXISTS account_cost_tracking_account_id_fkey;
+ALTER TABLE account_cost_tracking ADD CONSTRAINT account_cost_tracking_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE budget_alerts DROP CONSTRAINT IF EXISTS budget_alerts_account_id_fkey;
+ALTER TABLE budget_alerts ADD CONSTRAINT budget_alerts_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE webhooks DROP CONSTRAINT IF EXISTS webhooks_account_id_fkey;
+ALTER TABLE webhooks ADD CONSTRAINT webhooks_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE account_limits DROP CONSTRAINT IF EXISTS account_limits_account_id_fkey;
+ALTER TABLE account_limits ADD CONSTRAINT account_limits_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_account_id_fkey;
+ALTER TABLE sessions ADD CONSTRAINT sessions_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE usage_metrics DROP CONSTRAINT IF EXISTS usage_metrics_account_id_fkey;
+ALTER TABLE usage_metrics ADD CONSTRAINT usage_metrics_account_id_fkey
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+
+COMMENT ON TABLE accounts IS 'Customer accounts; API keys, sessions, limits, usage and cost belong to an account';
+COMMENT ON COLUMN accounts.email IS 'Contact email, initially the email the primary key was created with';
+COMMENT ON COLUMN api_keys.account_id IS 'Account owning the key';
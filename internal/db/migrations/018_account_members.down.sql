@@ -0,0 +1,9 @@
+-- Revert migration 018: drop members, invitations and the audit log.
+
+DROP TABLE IF EXISTS account_audit_log;
+
+DROP INDEX IF EXISTS idx_api_keys_member_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS member_id;
+
+DROP TABLE IF EXISTS account_invitations;
+DROP TABLE IF EXISTS account_members;
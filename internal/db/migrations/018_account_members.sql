@@ -0,0 +1,73 @@
+-- Migration 018: Account members, invitations and audit log
+-- People on an account are members with a role. Every API key belongs to the
+-- member it was issued to and acts with that member's role. Members join by
+-- accepting an invitation. Changes to members, keys, the account and its
+-- limits are recorded in account_audit_log.
+
+CREATE TABLE IF NOT EXISTS account_members (
+    id UUID PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    name TEXT,
+    role TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT account_members_role_check CHECK (role IN ('owner', 'admin', 'developer', 'billing-viewer')),
+    CONSTRAINT account_members_account_email_key UNIQUE (account_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS account_invitations (
+    id UUID PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,        -- SHA-256 of the inv_xxx token; the token itself is never stored
+    invited_by UUID REFERENCES account_members(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT account_invitations_role_check CHECK (role IN ('owner', 'admin', 'developer', 'billing-viewer'))
+);
+
+-- Index for listing an account's pending invitations
+CREATE INDEX IF NOT EXISTS idx_account_invitations_account_id ON account_invitations(account_id, created_at DESC);
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS member_id UUID REFERENCES account_members(id) ON DELETE SET NULL;
+
+-- Index for finding a member's keys
+CREATE INDEX IF NOT EXISTS idx_api_keys_member_id ON api_keys(member_id);
+
+CREATE TABLE IF NOT EXISTS account_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    actor_key_id UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    actor_member_id UUID REFERENCES account_members(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,                   -- e.g. member.invited, api_key.rotated
+    target TEXT,                            -- ID of the member, key or invitation acted on
+    details JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for reading an account's audit log, newest first
+CREATE INDEX IF NOT EXISTS idx_account_audit_log_account_id ON account_audit_log(account_id, created_at DESC);
+
+-- Whoever held the primary key becomes the account's owner, and every existing
+-- key of the account is theirs
+INSERT INTO account_members (id, account_id, email, name, role, created_at, updated_at)
+SELECT gen_random_uuid(), a.id, COALESCE(a.email, k.email, ''), a.name, 'owner', a.created_at, NOW()
+FROM accounts a
+LEFT JOIN api_keys k ON k.id = a.id
+ON CONFLICT (account_id, email) DO NOTHING;
+
+UPDATE api_keys k
+SET member_id = m.id
+FROM account_members m
+WHERE m.account_id = k.account_id AND m.role = 'owner' AND k.member_id IS NULL;
+
+COMMENT ON TABLE account_members IS 'People with access to an account and their role';
+COMMENT ON COLUMN account_members.role IS 'owner, admin, developer or billing-viewer';
+COMMENT ON TABLE account_invitations IS 'Pending and accepted invitations to join an account';
+COMMENT ON COLUMN api_keys.member_id IS 'Member the key was issued to; the key acts with their role';
+COMMENT ON TABLE account_audit_log IS 'Who changed what on an account: members, invitations, keys, account settings and limits';
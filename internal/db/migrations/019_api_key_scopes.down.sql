@@ -0,0 +1,3 @@
+-- Revert migration 019: drop API key scopes.
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS scopes;
@@ -0,0 +1,9 @@
+-- Migration 019: API key scopes
+-- A key with scopes can only call the operations its scopes cover, so a CI
+-- system can be given a key that runs sessions but cannot mint more keys or
+-- change limits. Keys without scopes (NULL) keep full access within their
+-- member's role, which is what every existing key has.
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT[];
+
+COMMENT ON COLUMN api_keys.scopes IS 'Scopes the key is limited to, e.g. sessions:create; NULL for an unrestricted key';
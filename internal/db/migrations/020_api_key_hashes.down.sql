@@ -0,0 +1,14 @@
+-- Revert migration 020: store plaintext keys again.
+-- Hashed keys cannot be turned back into keys, so they are deactivated and
+-- must be rotated or recreated.
+
+UPDATE api_keys
+SET is_active = false, key = 'revoked_' || id::text
+WHERE key IS NULL;
+
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_key_or_hash_check;
+ALTER TABLE api_keys ALTER COLUMN key SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_api_keys_key_prefix;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS key_hash;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS key_prefix;
@@ -0,0 +1,21 @@
+-- Migration 020: Hashed API key storage
+-- Keys are stored as an HMAC-SHA256 of the key, under a server-side pepper,
+-- and found by their first 12 characters. The key itself is only returned when
+-- it is created or rotated. Existing keys keep their plaintext until they are
+-- next used, when the server hashes them and clears the plaintext.
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_prefix TEXT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_hash TEXT;
+
+UPDATE api_keys SET key_prefix = LEFT(key, 12) WHERE key_prefix IS NULL;
+
+ALTER TABLE api_keys ALTER COLUMN key_prefix SET NOT NULL;
+ALTER TABLE api_keys ALTER COLUMN key DROP NOT NULL;
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_key_or_hash_check CHECK (key IS NOT NULL OR key_hash IS NOT NULL);
+
+-- Index for looking keys up by prefix
+CREATE INDEX IF NOT EXISTS idx_api_keys_key_prefix ON api_keys(key_prefix);
+
+COMMENT ON COLUMN api_keys.key IS 'Plaintext key of keys not yet hashed; cleared when the key is next used';
+COMMENT ON COLUMN api_keys.key_prefix IS 'First 12 characters of the key, for lookup and display';
+COMMENT ON COLUMN api_keys.key_hash IS 'Hex HMAC-SHA256 of the key under the server''s API_KEY_PEPPER';
@@ -0,0 +1,6 @@
+-- Revert migration 021: previous key values stop working at once.
+
+DROP INDEX IF EXISTS idx_api_keys_rotating_key_prefix;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS rotating_expires_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS rotating_key_hash;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS rotating_key_prefix;
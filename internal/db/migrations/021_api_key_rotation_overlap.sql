@@ -0,0 +1,17 @@
+-- Migration 021: API key rotation with an overlap window
+-- Rotating a key can keep its previous value working for a while, so deployed
+-- workers can switch over without a hard cutover. The previous value is kept
+-- as the key's rotating value until rotating_expires_at, after which it no
+-- longer authenticates.
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotating_key_prefix TEXT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotating_key_hash TEXT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotating_expires_at TIMESTAMPTZ;
+
+-- Index for looking keys up by the prefix of their rotating value
+CREATE INDEX IF NOT EXISTS idx_api_keys_rotating_key_prefix ON api_keys(rotating_key_prefix)
+    WHERE rotating_key_prefix IS NOT NULL;
+
+COMMENT ON COLUMN api_keys.rotating_key_prefix IS 'First 12 characters of the value the key had before its last rotation';
+COMMENT ON COLUMN api_keys.rotating_key_hash IS 'Hash of the previous value, which authenticates until rotating_expires_at';
+COMMENT ON COLUMN api_keys.rotating_expires_at IS 'End of the rotation overlap; NULL when the key is not rotating';
@@ -0,0 +1,5 @@
+-- Revert migration 022: expiry notices are no longer tracked.
+
+DROP INDEX IF EXISTS idx_api_keys_tier_expires_at;
+DROP INDEX IF EXISTS idx_api_keys_expires_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS expiry_notified_at;
@@ -0,0 +1,16 @@
+-- Migration 022: API key expiry notices
+-- Owners are notified once before an API key expires. expiry_notified_at
+-- records the notice so it is not sent again; it is cleared when the key's
+-- expiration changes.
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS expiry_notified_at TIMESTAMPTZ;
+
+-- Index for finding active keys that are about to expire or long expired
+CREATE INDEX IF NOT EXISTS idx_api_keys_expires_at ON api_keys(expires_at)
+    WHERE is_active = true AND expires_at IS NOT NULL;
+
+-- Index for finding keys whose tier has run out
+CREATE INDEX IF NOT EXISTS idx_api_keys_tier_expires_at ON api_keys(tier_expires_at)
+    WHERE tier_expires_at IS NOT NULL;
+
+COMMENT ON COLUMN api_keys.expiry_notified_at IS 'When the owners were notified that the key is about to expire';
@@ -0,0 +1,7 @@
+-- Revert migration 023: audit entries no longer record client IPs.
+
+DROP INDEX IF EXISTS idx_account_audit_log_account_created;
+CREATE INDEX IF NOT EXISTS idx_account_audit_log_account_id ON account_audit_log(account_id, created_at DESC);
+ALTER TABLE account_audit_log DROP COLUMN IF EXISTS ip_address;
+
+COMMENT ON TABLE account_audit_log IS 'Who changed what on an account: members, invitations, keys, account settings and limits';
@@ -0,0 +1,12 @@
+-- Migration 023: Audit log client IPs and paging
+-- Entries record the IP address the request came from, and the log is read
+-- newest first in pages keyed by (created_at, id).
+
+ALTER TABLE account_audit_log ADD COLUMN IF NOT EXISTS ip_address TEXT;
+
+-- Replace the read index with one covering the page key
+DROP INDEX IF EXISTS idx_account_audit_log_account_id;
+CREATE INDEX IF NOT EXISTS idx_account_audit_log_account_created ON account_audit_log(account_id, created_at DESC, id DESC);
+
+COMMENT ON COLUMN account_audit_log.ip_address IS 'Client IP address of the request that made the change';
+COMMENT ON TABLE account_audit_log IS 'Who did what on an account, with which key and from which IP: members, invitations, keys, account settings, limits, sessions and exec calls';
@@ -0,0 +1,7 @@
+-- Revert migration 024: sessions no longer record labels or their backend.
+
+DROP INDEX IF EXISTS idx_sessions_labels;
+DROP INDEX IF EXISTS idx_sessions_api_key_created;
+CREATE INDEX IF NOT EXISTS idx_sessions_api_key_id ON sessions(api_key_id);
+ALTER TABLE sessions DROP COLUMN IF EXISTS backend;
+ALTER TABLE sessions DROP COLUMN IF EXISTS labels;
@@ -0,0 +1,14 @@
+-- Migration 024: Session labels, backend and list paging
+-- Sessions carry caller-defined labels and the name of the backend that ran
+-- them, and are listed in pages keyed by (created_at, id).
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS backend TEXT;
+
+-- Replace the per-key index with one covering the page key
+DROP INDEX IF EXISTS idx_sessions_api_key_id;
+CREATE INDEX IF NOT EXISTS idx_sessions_api_key_created ON sessions(api_key_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_sessions_labels ON sessions USING GIN (labels jsonb_path_ops);
+
+COMMENT ON COLUMN sessions.labels IS 'Key/value labels set at creation, for filtering session lists';
+COMMENT ON COLUMN sessions.backend IS 'Backend that ran the session: fly or kubernetes; NULL for sessions created before migration 024';
@@ -0,0 +1,3 @@
+-- Revert migration 025: sessions no longer record when they were last sampled.
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_sampled_at;
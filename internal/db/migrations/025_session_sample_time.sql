@@ -0,0 +1,7 @@
+-- Migration 025: Session sample time
+-- Usage samples are added to a session only if no other replica sampled it
+-- since the reading was taken, so each interval is metered exactly once.
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_sampled_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN sessions.last_sampled_at IS 'When cpu_millis_used and memory_peak_mb were last sampled; NULL until the first sample';
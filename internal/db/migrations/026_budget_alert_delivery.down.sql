@@ -0,0 +1,6 @@
+-- Revert migration 026: budget alerts no longer track their delivery.
+
+DROP INDEX IF EXISTS idx_budget_alerts_next_delivery;
+ALTER TABLE budget_alerts DROP COLUMN IF EXISTS delivered_at;
+ALTER TABLE budget_alerts DROP COLUMN IF EXISTS next_delivery_at;
+ALTER TABLE budget_alerts DROP COLUMN IF EXISTS delivery_attempts;
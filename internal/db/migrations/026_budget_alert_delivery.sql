@@ -0,0 +1,16 @@
+-- Migration 026: Budget alert delivery
+-- Budget alerts record whether they reached the account's notifiers, so a
+-- failed delivery is retried instead of being lost once the alert exists.
+
+ALTER TABLE budget_alerts ADD COLUMN IF NOT EXISTS delivery_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE budget_alerts ADD COLUMN IF NOT EXISTS next_delivery_at TIMESTAMPTZ DEFAULT NOW();
+ALTER TABLE budget_alerts ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMPTZ;
+
+-- Alerts recorded before delivery was tracked were handed to the notifiers
+-- once already; don't send them again
+UPDATE budget_alerts SET next_delivery_at = NULL WHERE delivered_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_budget_alerts_next_delivery ON budget_alerts(next_delivery_at) WHERE next_delivery_at IS NOT NULL;
+
+COMMENT ON COLUMN budget_alerts.next_delivery_at IS 'When delivery is next attempted; NULL once delivered or given up';
+COMMENT ON COLUMN budget_alerts.delivered_at IS 'When the alert reached every notifier; NULL until then';
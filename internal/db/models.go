@@ -9,7 +9,8 @@ import (
 // APIKey represents an API key with tier-based configuration and rate limiting.
 type APIKey struct {
 	ID            uuid.UUID  `json:"id"`
-	Key           string     `json:"key"`
+	Key           string     `json:"key,omitempty"` // Only set when the key is created or rotated
+	KeyPrefix     string     `json:"key_prefix"`    // First characters of the key, stored in the clear (migration 020)
 	Email         *string    `json:"email,omitempty"`
 	Tier          string     `json:"tier"` // free|starter|pro|enterprise
 	TierExpiresAt *time.Time `json:"tier_expires_at,omitempty"`
@@ -28,6 +29,16 @@ type APIKey struct {
 	CustomConcurrentLimit *int       `json:"custom_concurrent_limit,omitempty"`
 	LastUpdatedBy         *string    `json:"last_updated_by,omitempty"`
 	Metadata              *string    `json:"metadata,omitempty"`
+	// Member the key was issued to (migration 018)
+	MemberID   *uuid.UUID `json:"member_id,omitempty"`
+	MemberRole *string    `json:"member_role,omitempty"` // Role of the member, read with the key
+	// Scopes the key is limited to, nil for an unrestricted key (migration 019)
+	Scopes []string `json:"scopes,omitempty"`
+	// End of a pending rotation overlap, during which the key's previous value
+	// still authenticates (migration 021)
+	RotatingExpiresAt *time.Time `json:"rotating_expires_at,omitempty"`
+	// Set by GetAPIKeyByKey when the key was found by its previous value
+	UsedRotatingKey bool `json:"-"`
 }
 
 // APIKeyUpdate contains fields that can be updated on an API key.
@@ -41,6 +52,94 @@ type APIKeyUpdate struct {
 	LastUpdatedBy         *string    `json:"last_updated_by,omitempty"`
 }
 
+// Account owns API keys. Sessions, limits, usage and cost are attributed to
+// the account rather than to the key that created them.
+type Account struct {
+	ID        uuid.UUID `json:"id"`
+	Name      *string   `json:"name,omitempty"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AccountUpdate contains fields that can be updated on an account.
+type AccountUpdate struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+// AccountMember is a person with access to an account. API keys issued to a
+// member act with the member's role.
+// Unique constraint: (account_id, email)
+type AccountMember struct {
+	ID        uuid.UUID `json:"id"`
+	AccountID uuid.UUID `json:"account_id"`
+	Email     string    `json:"email"`
+	Name      *string   `json:"name,omitempty"`
+	Role      string    `json:"role"` // owner|admin|developer|billing-viewer
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AccountInvitation invites an email address to join an account with a role.
+type AccountInvitation struct {
+	ID         uuid.UUID  `json:"id"`
+	AccountID  uuid.UUID  `json:"account_id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	TokenHash  string     `json:"-"` // SHA-256 of the token; the token is only known to the invitee
+	InvitedBy  *uuid.UUID `json:"invited_by,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// AuditEntry records a change made to an account, and by whom.
+type AuditEntry struct {
+	ID            int64      `json:"id"`
+	AccountID     uuid.UUID  `json:"account_id"`
+	ActorKeyID    *uuid.UUID `json:"actor_key_id,omitempty"`
+	ActorMemberID *uuid.UUID `json:"actor_member_id,omitempty"`
+	Action        string     `json:"action"`               // e.g. member.invited, api_key.rotated
+	Target        *string    `json:"target,omitempty"`     // ID of the member, key or invitation acted on
+	Details       []byte     `json:"details,omitempty"`    // JSON encoded, nil if none
+	IPAddress     *string    `json:"ip_address,omitempty"` // Client IP of the request (migration 023)
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// AuditFilter selects entries of an account's audit log, newest first.
+// Zero fields match every entry.
+type AuditFilter struct {
+	ActorKeyID    *uuid.UUID
+	ActorMemberID *uuid.UUID
+	Action        string     // Exact action, or a prefix ending in ".*" such as "api_key.*"
+	Since         *time.Time // Entries created at or after
+	Until         *time.Time // Entries created before
+	// Page key: only entries older than the last entry of the previous page
+	BeforeCreatedAt *time.Time
+	BeforeID        int64
+	Limit           int // At most this many entries; 0 for all
+}
+
+// SessionFilter selects the sessions of an API key. Zero fields match every
+// session.
+type SessionFilter struct {
+	APIKeyID      uuid.UUID
+	Status        *string
+	Image         *string
+	Backend       *string
+	ExitCode      *int
+	Labels        map[string]string // Sessions carrying all of these labels
+	CreatedAfter  *time.Time        // Sessions created at or after
+	CreatedBefore *time.Time        // Sessions created before
+	Ascending     bool              // Oldest first instead of newest first
+	// Page key: only sessions after the last session of the previous page in
+	// the chosen order
+	AfterCreatedAt *time.Time
+	AfterID        string
+	Limit          int // At most this many sessions; 0 for all
+}
+
 // Session represents an execution session with backend mapping and lifecycle tracking.
 type Session struct {
 	ID           string            `json:"id"` // sess_xxx
@@ -53,12 +152,21 @@ type Session struct {
 	Command      []string          `json:"command,omitempty"`
 	Env          map[string]string `json:"env,omitempty"`
 	SetupHash    *string           `json:"setup_hash,omitempty"`
-	Status       string            `json:"status"` // pending|running|stopped|failed
+	Status       string            `json:"status"` // pending|running|stopped|killed|failed|timeout
 	ExitCode     *int              `json:"exit_code,omitempty"`
 	Ports        []Port            `json:"ports,omitempty"`
+	Network      *string           `json:"network,omitempty"` // none|outgoing|exposed
+	Labels       map[string]string `json:"labels,omitempty"`
+	Backend      *string           `json:"backend,omitempty"` // fly|kubernetes; nil for sessions predating migration 024
 	CreatedAt    time.Time         `json:"created_at"`
 	StartedAt    *time.Time        `json:"started_at,omitempty"`
 	EndedAt      *time.Time        `json:"ended_at,omitempty"`
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"` // Deadline enforced by the API; nil if unlimited
+
+	// Metered resource usage; nil until the session has been sampled
+	CPUMillisUsed *int64     `json:"cpu_millis_used,omitempty"`
+	MemoryPeakMB  *int64     `json:"memory_peak_mb,omitempty"`
+	LastSampledAt *time.Time `json:"last_sampled_at,omitempty"`
 }
 
 // GetBackendID returns the backend-specific ID for this session.
@@ -105,6 +213,50 @@ type SessionUpdate struct {
 	DurationMs        *int64     `json:"duration_ms,omitempty"`
 }
 
+// SessionSample is a usage reading for a running session. It is recorded
+// only if the session was last sampled at PreviousSampledAt, so concurrent
+// samplers never count the same interval twice.
+type SessionSample struct {
+	PreviousSampledAt *time.Time // last_sampled_at the reading builds on; nil for the first sample
+	SampledAt         time.Time
+	CPUMillis         int64 // Cumulative CPU time reported by the backend
+	CPUMillisAdded    int64 // CPU time used since PreviousSampledAt
+	MemoryPeakMB      int64
+}
+
+// SessionSampleResult holds a session's stored usage after a sample.
+type SessionSampleResult struct {
+	CPUMillisUsed *int64
+	MemoryPeakMB  *int64
+	LastSampledAt *time.Time
+	Recorded      bool // False if another sample was recorded first
+}
+
+// Build represents an asynchronous custom image build.
+type Build struct {
+	ID          string     `json:"id"` // build_xxx
+	APIKeyID    uuid.UUID  `json:"api_key_id"`
+	Hash        string     `json:"hash"`
+	BaseImage   string     `json:"base_image"`
+	Phase       string     `json:"phase"` // queued|building|pushing|ready|failed
+	RegistryTag *string    `json:"registry_tag,omitempty"`
+	Error       *string    `json:"error,omitempty"`
+	LogTail     *string    `json:"log_tail,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// BuildUpdate contains fields that can be updated on a build.
+type BuildUpdate struct {
+	Phase       *string    `json:"phase,omitempty"`
+	RegistryTag *string    `json:"registry_tag,omitempty"`
+	Error       *string    `json:"error,omitempty"`
+	LogTail     *string    `json:"log_tail,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
 // QuotaRequest represents a request from a user for increased quota.
 type QuotaRequest struct {
 	ID              int        `json:"id"`
@@ -163,3 +315,91 @@ type AccountCostTracking struct {
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
 }
+
+// AccountSpend is an account's cost so far in a billing period.
+type AccountSpend struct {
+	SettledCents        int64       // Cost of sessions that ended
+	ActiveSessionStarts []time.Time // Creation times of sessions still running
+}
+
+// BudgetAlert records that an account's spend crossed its alert threshold.
+// Unique constraint: (account_id, billing_period_start)
+type BudgetAlert struct {
+	ID                  int64     `json:"id"`
+	AccountID           uuid.UUID `json:"account_id"`
+	BillingPeriodStart  time.Time `json:"billing_period_start"`
+	ThresholdPercentage int       `json:"threshold_percentage"`
+	SpentCents          int64     `json:"spent_cents"`
+	LimitCents          int64     `json:"limit_cents"`
+	BillingEmail        *string   `json:"billing_email,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+
+	// Delivery to the account's notifiers
+	DeliveryAttempts int        `json:"delivery_attempts"`
+	NextDeliveryAt   *time.Time `json:"next_delivery_at,omitempty"` // nil once delivered or given up
+	DeliveredAt      *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Webhook is an account's subscription to event notifications.
+type Webhook struct {
+	ID          uuid.UUID `json:"id"`
+	AccountID   uuid.UUID `json:"account_id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"` // Signs every delivery; never returned after creation
+	Events      []string  `json:"events"`
+	Description *string   `json:"description,omitempty"`
+	IsActive    bool      `json:"is_active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookUpdate holds fields that can be updated in a webhook.
+type WebhookUpdate struct {
+	URL         *string  `json:"url,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	IsActive    *bool    `json:"is_active,omitempty"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to one webhook.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	WebhookID      uuid.UUID  `json:"webhook_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        []byte     `json:"payload"`
+	Status         string     `json:"status"` // pending, succeeded or failed
+	Attempts       int        `json:"attempts"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	Error          *string    `json:"error,omitempty"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// DueWebhookDelivery is a claimed delivery with the endpoint it goes to.
+type DueWebhookDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+// WebhookDeliveryResult records the outcome of a delivery attempt.
+type WebhookDeliveryResult struct {
+	Status         string
+	Attempts       int
+	ResponseStatus *int
+	Error          *string
+	NextAttemptAt  time.Time
+	CompletedAt    *time.Time
+}
+
+// SessionEvent is a session status transition in an account's event log.
+type SessionEvent struct {
+	ID        int64     `json:"id"` // Increases with every event; clients resume after it
+	AccountID uuid.UUID `json:"account_id"`
+	SessionID string    `json:"session_id"`
+	Type      string    `json:"type"`
+	Data      []byte    `json:"data"` // JSON encoded session after the transition
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -2,10 +2,10 @@ package db
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,21 +13,29 @@ import (
 )
 
 // apiKeyColumns is the list of columns to select for API key queries
-const apiKeyColumns = `id, key, email, tier, tier_expires_at, tier_updated_at, rate_limit_rps,
+// A tier past its tier_expires_at reads as free, with the free tier's rate limit.
+const apiKeyColumns = `id, key_prefix, email,
+    CASE WHEN tier_expires_at <= NOW() THEN 'free' ELSE tier END, tier_expires_at, tier_updated_at,
+    CASE WHEN tier_expires_at <= NOW() THEN 10 ELSE rate_limit_rps END,
     created_at, last_used_at, name, description, is_active, expires_at,
     parent_key_id, account_id, custom_daily_limit, custom_concurrent_limit,
-    last_updated_by, metadata`
+    last_updated_by, metadata, member_id,
+    (SELECT m.role FROM account_members m WHERE m.id = api_keys.member_id), scopes,
+    CASE WHEN rotating_expires_at > NOW() THEN rotating_expires_at END`
 
-// scanAPIKey scans a database row into an APIKey struct
-func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+// scanAPIKey scans a database row into an APIKey struct. Columns selected
+// after apiKeyColumns are scanned into extra.
+func scanAPIKey(row interface{ Scan(...any) error }, extra ...any) (*APIKey, error) {
 	var key APIKey
-	err := row.Scan(
-		&key.ID, &key.Key, &key.Email, &key.Tier, &key.TierExpiresAt,
+	dest := []any{
+		&key.ID, &key.KeyPrefix, &key.Email, &key.Tier, &key.TierExpiresAt,
 		&key.TierUpdatedAt, &key.RateLimitRPS, &key.CreatedAt, &key.LastUsedAt,
 		&key.Name, &key.Description, &key.IsActive, &key.ExpiresAt,
 		&key.ParentKeyID, &key.AccountID, &key.CustomDailyLimit,
 		&key.CustomConcurrentLimit, &key.LastUpdatedBy, &key.Metadata,
-	)
+		&key.MemberID, &key.MemberRole, &key.Scopes, &key.RotatingExpiresAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -35,27 +43,78 @@ func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
 }
 
 // GetAPIKeyByKey retrieves an API key by its key string.
-// Returns an error if the key is not found, deactivated, expired, or if the query fails.
+// Candidates are looked up by the key's prefix and matched against their hash.
+// A key still stored in plaintext is hashed, and its plaintext cleared, when it
+// matches. During a rotation overlap the key's previous value matches too, and
+// the returned key has UsedRotatingKey set. Returns an error if the key is not
+// found or if the query fails, and an error saying so if the key is
+// deactivated or expired.
 func (c *Client) GetAPIKeyByKey(ctx context.Context, key string) (*APIKey, error) {
 	query := fmt.Sprintf(`
-		SELECT %s
+		SELECT %s, key_hash, key, rotating_key_hash, COALESCE(expires_at <= NOW(), false)
 		FROM api_keys
-		WHERE key = $1
-		  AND is_active = true
-		  AND (expires_at IS NULL OR expires_at > NOW())
+		WHERE key_prefix = $1 OR (rotating_key_prefix = $1 AND rotating_expires_at > NOW())
 	`, apiKeyColumns)
 
-	apiKey, err := scanAPIKey(c.pool.QueryRow(ctx, query, key))
+	rows, err := c.pool.Query(ctx, query, apiKeyPrefix(key))
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("API key not found")
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	defer rows.Close()
+
+	var apiKey *APIKey
+	var needsHash, expired bool
+	for rows.Next() {
+		var keyHash, legacyKey, rotatingKeyHash *string
+		var candidateExpired bool
+		candidate, err := scanAPIKey(rows, &keyHash, &legacyKey, &rotatingKeyHash, &candidateExpired)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get API key: %w", err)
 		}
+		switch {
+		case c.matchAPIKey(key, keyHash, legacyKey):
+			apiKey, expired = candidate, candidateExpired
+			needsHash = keyHash == nil
+		case candidate.RotatingExpiresAt != nil && c.matchAPIKey(key, rotatingKeyHash, nil):
+			apiKey, expired = candidate, candidateExpired
+			apiKey.UsedRotatingKey = true
+		}
+	}
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("failed to get API key: %w", err)
 	}
+	if apiKey == nil {
+		return nil, fmt.Errorf("API key not found")
+	}
+	// Only callers holding the key learn why it no longer works
+	if !apiKey.IsActive {
+		return nil, fmt.Errorf("API key inactive")
+	}
+	if expired {
+		return nil, fmt.Errorf("API key expired")
+	}
+
+	if needsHash {
+		if err := c.hashLegacyAPIKey(ctx, apiKey.ID, key); err != nil {
+			// The key stays usable in plaintext and is hashed on a later use
+			slog.Warn("failed to hash API key", "error", err, "api_key_id", apiKey.ID)
+		}
+	}
 
 	return apiKey, nil
 }
 
+// hashLegacyAPIKey replaces the plaintext of a key stored before keys were
+// hashed with its hash.
+func (c *Client) hashLegacyAPIKey(ctx context.Context, id uuid.UUID, key string) error {
+	_, err := c.pool.Exec(ctx, `
+		UPDATE api_keys
+		SET key_hash = $2, key = NULL
+		WHERE id = $1 AND key_hash IS NULL
+	`, id, c.hashAPIKey(key))
+	return err
+}
+
 // GetAPIKeyByID retrieves an API key by its ID.
 // Returns the key regardless of active/expired status (for management operations).
 func (c *Client) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*APIKey, error) {
@@ -78,39 +137,62 @@ func (c *Client) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*APIKey, erro
 
 // CreateAPIKey creates a new API key for the given email with free tier.
 // Returns the created API key with a newly generated key string.
-// This creates the primary key for a new account (account_id = key id).
+// This creates a new account, named name, its owner with the given email, and
+// the account's primary key, issued to the owner.
 func (c *Client) CreateAPIKey(ctx context.Context, email string, name *string) (*APIKey, error) {
 	// Generate a secure random API key
-	keyBytes := make([]byte, 32)
-	if _, err := rand.Read(keyBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, err
 	}
-	key := fmt.Sprintf("sk_%s", hex.EncodeToString(keyBytes))
 
-	// For primary keys, account_id equals the key's own ID
-	keyID := uuid.New()
+	accountID := uuid.New()
 
-	query := fmt.Sprintf(`
-		INSERT INTO api_keys (id, key, email, tier, rate_limit_rps, is_active, account_id, created_at)
-		VALUES ($1, $2, $3, 'free', 10, true, $1, NOW())
+	memberID := uuid.New()
+
+	accountQuery := `
+		INSERT INTO accounts (id, name, email, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+	`
+
+	memberQuery := `
+		INSERT INTO account_members (id, account_id, email, name, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 'owner', NOW(), NOW())
+	`
+
+	keyQuery := fmt.Sprintf(`
+		INSERT INTO api_keys (id, key_prefix, key_hash, email, tier, rate_limit_rps, is_active, account_id, member_id, created_at)
+		VALUES ($1, $2, $3, $4, 'free', 10, true, $5, $6, NOW())
 		RETURNING %s
 	`, apiKeyColumns)
 
-	apiKey, err := scanAPIKey(c.pool.QueryRow(ctx, query, keyID, key, email))
+	var apiKey *APIKey
+	err = pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, accountQuery, accountID, name, email); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, memberQuery, memberID, accountID, email, name); err != nil {
+			return err
+		}
+		var err error
+		apiKey, err = scanAPIKey(tx.QueryRow(ctx, keyQuery, uuid.New(), apiKeyPrefix(key), c.hashAPIKey(key), email, accountID, memberID))
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create API key: %w", err)
 	}
+	apiKey.Key = key
 
 	// Create default account limits for the new account
 	limitsQuery := `
 		INSERT INTO account_limits (account_id, daily_requests_limit, concurrent_requests_limit, alert_threshold_percentage, timezone, created_at, updated_at)
 		VALUES ($1, 100, 5, 80, 'UTC', NOW(), NOW())
 	`
-	_, limitsErr := c.pool.Exec(ctx, limitsQuery, apiKey.ID)
+	_, limitsErr := c.pool.Exec(ctx, limitsQuery, accountID)
 	if limitsErr != nil {
 		// Log the error but don't fail the API key creation
 		// GetAccountLimits has a fallback, so this is not critical
-		fmt.Printf("Warning: failed to create default account limits for %s: %v\n", apiKey.ID, limitsErr)
+		fmt.Printf("Warning: failed to create default account limits for %s: %v\n", accountID, limitsErr)
 	}
 
 	return apiKey, nil
@@ -154,12 +236,21 @@ func (c *Client) CreateSession(ctx context.Context, sess *Session) error {
 		return fmt.Errorf("failed to marshal ports: %w", err)
 	}
 
+	labels := sess.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal labels: %w", err)
+	}
+
 	query := `
 		INSERT INTO sessions (
 			id, api_key_id, account_id, fly_machine_id, fly_app_id, image, command, env,
-			setup_hash, status, exit_code, ports, created_at, started_at, ended_at
+			setup_hash, status, exit_code, ports, network, labels, backend, created_at, started_at, ended_at, expires_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 	`
 
 	_, err = c.pool.Exec(ctx, query,
@@ -175,9 +266,13 @@ func (c *Client) CreateSession(ctx context.Context, sess *Session) error {
 		sess.Status,
 		sess.ExitCode,
 		portsJSON,
+		sess.Network,
+		labelsJSON,
+		sess.Backend,
 		sess.CreatedAt,
 		sess.StartedAt,
 		sess.EndedAt,
+		sess.ExpiresAt,
 	)
 
 	if err != nil {
@@ -189,17 +284,31 @@ func (c *Client) CreateSession(ctx context.Context, sess *Session) error {
 
 // GetSession retrieves a session by its ID.
 func (c *Client) GetSession(ctx context.Context, id string) (*Session, error) {
+	return c.getSession(ctx, "id = $1", id)
+}
+
+// GetActiveSessionByBackendID retrieves the pending or running session backed
+// by a pod or machine.
+func (c *Client) GetActiveSessionByBackendID(ctx context.Context, backendID string) (*Session, error) {
+	return c.getSession(ctx, "fly_machine_id = $1 AND status IN ('pending', 'running')", backendID)
+}
+
+// getSession retrieves the session matching a WHERE clause.
+func (c *Client) getSession(ctx context.Context, where string, args ...any) (*Session, error) {
 	query := `
 		SELECT id, api_key_id, account_id, fly_machine_id, fly_app_id, image, command, env,
-		       setup_hash, status, exit_code, ports, created_at, started_at, ended_at
+		       setup_hash, status, exit_code, ports, network, labels, backend, created_at, started_at, ended_at, expires_at,
+		       cpu_millis_used, memory_peak_mb, last_sampled_at
 		FROM sessions
-		WHERE id = $1
+		WHERE ` + where + `
+		ORDER BY created_at DESC
+		LIMIT 1
 	`
 
 	var sess Session
-	var commandJSON, envJSON, portsJSON []byte
+	var commandJSON, envJSON, portsJSON, labelsJSON []byte
 
-	err := c.pool.QueryRow(ctx, query, id).Scan(
+	err := c.pool.QueryRow(ctx, query, args...).Scan(
 		&sess.ID,
 		&sess.APIKeyID,
 		&sess.AccountID,
@@ -212,9 +321,16 @@ func (c *Client) GetSession(ctx context.Context, id string) (*Session, error) {
 		&sess.Status,
 		&sess.ExitCode,
 		&portsJSON,
+		&sess.Network,
+		&labelsJSON,
+		&sess.Backend,
 		&sess.CreatedAt,
 		&sess.StartedAt,
 		&sess.EndedAt,
+		&sess.ExpiresAt,
+		&sess.CPUMillisUsed,
+		&sess.MemoryPeakMB,
+		&sess.LastSampledAt,
 	)
 
 	if err != nil {
@@ -243,32 +359,69 @@ func (c *Client) GetSession(ctx context.Context, id string) (*Session, error) {
 		}
 	}
 
+	if err := unmarshalLabels(labelsJSON, &sess); err != nil {
+		return nil, err
+	}
+
 	return &sess, nil
 }
 
-// ListSessions retrieves sessions for an API key, optionally filtered by status.
-func (c *Client) ListSessions(ctx context.Context, apiKeyID uuid.UUID, status *string) ([]Session, error) {
-	var query string
-	var args []interface{}
-
-	if status != nil {
-		query = `
-			SELECT id, api_key_id, account_id, fly_machine_id, fly_app_id, image, command, env,
-			       setup_hash, status, exit_code, ports, created_at, started_at, ended_at
-			FROM sessions
-			WHERE api_key_id = $1 AND status = $2
-			ORDER BY created_at DESC
-		`
-		args = []interface{}{apiKeyID, *status}
-	} else {
-		query = `
-			SELECT id, api_key_id, account_id, fly_machine_id, fly_app_id, image, command, env,
-			       setup_hash, status, exit_code, ports, created_at, started_at, ended_at
-			FROM sessions
-			WHERE api_key_id = $1
-			ORDER BY created_at DESC
-		`
-		args = []interface{}{apiKeyID}
+// ListSessions retrieves the sessions of an API key matching filter, newest
+// first unless filter.Ascending, ordered by (created_at, id).
+func (c *Client) ListSessions(ctx context.Context, filter *SessionFilter) ([]Session, error) {
+	query := `
+		SELECT id, api_key_id, account_id, fly_machine_id, fly_app_id, image, command, env,
+		       setup_hash, status, exit_code, ports, network, labels, backend, created_at, started_at, ended_at, expires_at,
+		       cpu_millis_used, memory_peak_mb, last_sampled_at
+		FROM sessions
+		WHERE api_key_id = $1`
+	args := []interface{}{filter.APIKeyID}
+
+	if filter.Status != nil {
+		args = append(args, *filter.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if filter.Image != nil {
+		args = append(args, *filter.Image)
+		query += fmt.Sprintf(" AND image = $%d", len(args))
+	}
+	if filter.Backend != nil {
+		args = append(args, *filter.Backend)
+		query += fmt.Sprintf(" AND backend = $%d", len(args))
+	}
+	if filter.ExitCode != nil {
+		args = append(args, *filter.ExitCode)
+		query += fmt.Sprintf(" AND exit_code = $%d", len(args))
+	}
+	if len(filter.Labels) > 0 {
+		labelsJSON, err := json.Marshal(filter.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal labels: %w", err)
+		}
+		args = append(args, labelsJSON)
+		query += fmt.Sprintf(" AND labels @> $%d::jsonb", len(args))
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, *filter.CreatedBefore)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+
+	order, after := "DESC", "<"
+	if filter.Ascending {
+		order, after = "ASC", ">"
+	}
+	if filter.AfterCreatedAt != nil {
+		args = append(args, *filter.AfterCreatedAt, filter.AfterID)
+		query += fmt.Sprintf(" AND (created_at, id) %s ($%d, $%d)", after, len(args)-1, len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s", order, order)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
 	}
 
 	rows, err := c.pool.Query(ctx, query, args...)
@@ -280,7 +433,7 @@ func (c *Client) ListSessions(ctx context.Context, apiKeyID uuid.UUID, status *s
 	var sessions []Session
 	for rows.Next() {
 		var sess Session
-		var commandJSON, envJSON, portsJSON []byte
+		var commandJSON, envJSON, portsJSON, labelsJSON []byte
 
 		err := rows.Scan(
 			&sess.ID,
@@ -295,9 +448,16 @@ func (c *Client) ListSessions(ctx context.Context, apiKeyID uuid.UUID, status *s
 			&sess.Status,
 			&sess.ExitCode,
 			&portsJSON,
+			&sess.Network,
+			&labelsJSON,
+			&sess.Backend,
 			&sess.CreatedAt,
 			&sess.StartedAt,
 			&sess.EndedAt,
+			&sess.ExpiresAt,
+			&sess.CPUMillisUsed,
+			&sess.MemoryPeakMB,
+			&sess.LastSampledAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session row: %w", err)
@@ -322,6 +482,129 @@ func (c *Client) ListSessions(ctx context.Context, apiKeyID uuid.UUID, status *s
 			}
 		}
 
+		if err := unmarshalLabels(labelsJSON, &sess); err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, sess)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// unmarshalLabels decodes a session's labels column. Sessions without labels
+// are left with a nil map.
+func unmarshalLabels(labelsJSON []byte, sess *Session) error {
+	if len(labelsJSON) == 0 {
+		return nil
+	}
+	var labels map[string]string
+	if err := json.Unmarshal(labelsJSON, &labels); err != nil {
+		return fmt.Errorf("failed to unmarshal labels: %w", err)
+	}
+	if len(labels) > 0 {
+		sess.Labels = labels
+	}
+	return nil
+}
+
+// ListExpiringSessions retrieves the pending or running sessions that have a deadline,
+// oldest deadline first. Only the fields needed to enforce the deadline are populated.
+func (c *Client) ListExpiringSessions(ctx context.Context) ([]Session, error) {
+	query := `
+		SELECT id, api_key_id, account_id, fly_machine_id, status, created_at, started_at, expires_at,
+		       cpu_millis_used, memory_peak_mb, last_sampled_at
+		FROM sessions
+		WHERE expires_at IS NOT NULL
+		  AND status IN ('pending', 'running')
+		ORDER BY expires_at
+	`
+
+	rows, err := c.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expiring sessions: %w", err)
+	}
+	return scanLifecycleSessions(rows)
+}
+
+// ListActiveSessions retrieves all pending or running sessions across API keys,
+// oldest first. Only the fields needed to track the session lifecycle are populated.
+func (c *Client) ListActiveSessions(ctx context.Context) ([]Session, error) {
+	query := `
+		SELECT id, api_key_id, account_id, fly_machine_id, status, created_at, started_at, expires_at,
+		       cpu_millis_used, memory_peak_mb, last_sampled_at
+		FROM sessions
+		WHERE status IN ('pending', 'running')
+		ORDER BY created_at
+	`
+
+	rows, err := c.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active sessions: %w", err)
+	}
+	return scanLifecycleSessions(rows)
+}
+
+// CountActiveSessionsByTier returns the number of pending or running sessions
+// per tier of the API key that created them.
+func (c *Client) CountActiveSessionsByTier(ctx context.Context) (map[string]int, error) {
+	query := `
+		SELECT k.tier, COUNT(*)
+		FROM sessions s
+		JOIN api_keys k ON k.id = s.api_key_id
+		WHERE s.status IN ('pending', 'running')
+		GROUP BY k.tier
+	`
+
+	rows, err := c.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var tier string
+		var count int
+		if err := rows.Scan(&tier, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan session count: %w", err)
+		}
+		counts[tier] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// scanLifecycleSessions scans rows selected by ListExpiringSessions and ListActiveSessions.
+func scanLifecycleSessions(rows pgx.Rows) ([]Session, error) {
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var sess Session
+		err := rows.Scan(
+			&sess.ID,
+			&sess.APIKeyID,
+			&sess.AccountID,
+			&sess.FlyMachineID,
+			&sess.Status,
+			&sess.CreatedAt,
+			&sess.StartedAt,
+			&sess.ExpiresAt,
+			&sess.CPUMillisUsed,
+			&sess.MemoryPeakMB,
+			&sess.LastSampledAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session row: %w", err)
+		}
 		sessions = append(sessions, sess)
 	}
 
@@ -332,8 +615,67 @@ func (c *Client) ListSessions(ctx context.Context, apiKeyID uuid.UUID, status *s
 	return sessions, nil
 }
 
+// FilterKnownBackendIDs returns the subset of backendIDs that belong to a session
+// row, whatever its status.
+func (c *Client) FilterKnownBackendIDs(ctx context.Context, backendIDs []string) ([]string, error) {
+	if len(backendIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT DISTINCT fly_machine_id
+		FROM sessions
+		WHERE fly_machine_id = ANY($1)
+	`
+
+	rows, err := c.pool.Query(ctx, query, backendIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter backend IDs: %w", err)
+	}
+	defer rows.Close()
+
+	var known []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan backend ID: %w", err)
+		}
+		known = append(known, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating backend IDs: %w", err)
+	}
+
+	return known, nil
+}
+
 // UpdateSession updates a session with the provided fields.
 func (c *Client) UpdateSession(ctx context.Context, id string, update *SessionUpdate) error {
+	n, err := c.updateSession(ctx, id, update, "")
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// EndActiveSession applies update to a session only if it is still pending or
+// running, so concurrent callers agree on which of them ended it. Returns
+// false if the session had already ended or does not exist.
+func (c *Client) EndActiveSession(ctx context.Context, id string, update *SessionUpdate) (bool, error) {
+	n, err := c.updateSession(ctx, id, update, " AND status IN ('pending', 'running')")
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// updateSession applies update to the session with id, if it also matches the
+// extra WHERE condition, and returns the number of rows changed.
+func (c *Client) updateSession(ctx context.Context, id string, update *SessionUpdate, condition string) (int64, error) {
 	// Build dynamic update query based on provided fields
 	query := "UPDATE sessions SET"
 	args := []interface{}{}
@@ -367,7 +709,7 @@ func (c *Client) UpdateSession(ctx context.Context, id string, update *SessionUp
 	if update.Ports != nil {
 		portsJSON, err := json.Marshal(update.Ports)
 		if err != nil {
-			return fmt.Errorf("failed to marshal ports: %w", err)
+			return 0, fmt.Errorf("failed to marshal ports: %w", err)
 		}
 		updates = append(updates, fmt.Sprintf(" ports = $%d", argPos))
 		args = append(args, portsJSON)
@@ -392,14 +734,15 @@ func (c *Client) UpdateSession(ctx context.Context, id string, update *SessionUp
 		argPos++
 	}
 
+	// Usage figures only grow, so a late writer never lowers a concurrent sample
 	if update.CPUMillisUsed != nil {
-		updates = append(updates, fmt.Sprintf(" cpu_millis_used = $%d", argPos))
+		updates = append(updates, fmt.Sprintf(" cpu_millis_used = GREATEST(COALESCE(cpu_millis_used, 0), $%d)", argPos))
 		args = append(args, *update.CPUMillisUsed)
 		argPos++
 	}
 
 	if update.MemoryPeakMB != nil {
-		updates = append(updates, fmt.Sprintf(" memory_peak_mb = $%d", argPos))
+		updates = append(updates, fmt.Sprintf(" memory_peak_mb = GREATEST(COALESCE(memory_peak_mb, 0), $%d)", argPos))
 		args = append(args, *update.MemoryPeakMB)
 		argPos++
 	}
@@ -411,7 +754,7 @@ func (c *Client) UpdateSession(ctx context.Context, id string, update *SessionUp
 	}
 
 	if len(updates) == 0 {
-		return fmt.Errorf("no fields to update")
+		return 0, fmt.Errorf("no fields to update")
 	}
 
 	// Complete the query
@@ -421,19 +764,54 @@ func (c *Client) UpdateSession(ctx context.Context, id string, update *SessionUp
 		}
 		query += u
 	}
-	query += fmt.Sprintf(" WHERE id = $%d", argPos)
+	query += fmt.Sprintf(" WHERE id = $%d", argPos) + condition
 	args = append(args, id)
 
 	result, err := c.pool.Exec(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to update session: %w", err)
+		return 0, fmt.Errorf("failed to update session: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("session not found")
+	return result.RowsAffected(), nil
+}
+
+// RecordSessionSample adds a usage sample to a session unless another sample
+// was recorded since sample.PreviousSampledAt. CPU time grows by
+// sample.CPUMillisAdded, or to sample.CPUMillis if that is higher, and the
+// memory peak only rises. Either way the session's stored usage is returned.
+func (c *Client) RecordSessionSample(ctx context.Context, id string, sample *SessionSample) (*SessionSampleResult, error) {
+	query := `
+		WITH sampled AS (
+			UPDATE sessions
+			SET cpu_millis_used = GREATEST(COALESCE(cpu_millis_used, 0) + $3, $4),
+			    memory_peak_mb = GREATEST(COALESCE(memory_peak_mb, 0), $5),
+			    last_sampled_at = $6
+			WHERE id = $1 AND last_sampled_at IS NOT DISTINCT FROM $2
+			RETURNING cpu_millis_used, memory_peak_mb, last_sampled_at
+		)
+		SELECT cpu_millis_used, memory_peak_mb, last_sampled_at, TRUE FROM sampled
+		UNION ALL
+		SELECT cpu_millis_used, memory_peak_mb, last_sampled_at, FALSE FROM sessions
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM sampled)
+	`
+
+	var result SessionSampleResult
+	err := c.pool.QueryRow(ctx, query,
+		id,
+		sample.PreviousSampledAt,
+		sample.CPUMillisAdded,
+		sample.CPUMillis,
+		sample.MemoryPeakMB,
+		sample.SampledAt,
+	).Scan(&result.CPUMillisUsed, &result.MemoryPeakMB, &result.LastSampledAt, &result.Recorded)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("failed to record session sample: %w", err)
 	}
 
-	return nil
+	return &result, nil
 }
 
 // DeleteSession deletes a session by its ID.
@@ -453,11 +831,14 @@ func (c *Client) DeleteSession(ctx context.Context, id string) error {
 }
 
 // IncrementUsage increments usage metrics for an API key for today's date.
+// The metric is attributed to the account owning the key.
 // This uses an INSERT ... ON CONFLICT to atomically update or create the daily metric.
 func (c *Client) IncrementUsage(ctx context.Context, apiKeyID uuid.UUID, durationMs int64) error {
 	query := `
-		INSERT INTO usage_metrics (api_key_id, date, executions, duration_ms)
-		VALUES ($1, $2, 1, $3)
+		INSERT INTO usage_metrics (api_key_id, account_id, date, executions, duration_ms)
+		SELECT id, account_id, $2, 1, $3
+		FROM api_keys
+		WHERE id = $1
 		ON CONFLICT (api_key_id, date)
 		DO UPDATE SET
 			executions = usage_metrics.executions + 1,
@@ -485,6 +866,7 @@ func (c *Client) GetImageCache(ctx context.Context, hash string) (string, bool,
 		SELECT registry_tag
 		FROM image_cache
 		WHERE hash = $1
+		  AND (expires_at IS NULL OR expires_at > NOW())
 	`
 
 	var registryTag string
@@ -515,6 +897,27 @@ func (c *Client) PutImageCache(ctx context.Context, hash, baseImage, registryTag
 	return nil
 }
 
+// PutExpiringImageCache stores an image cache entry that stops matching at expiresAt.
+// An existing entry for the hash is replaced, since it refers to an image that has expired.
+func (c *Client) PutExpiringImageCache(ctx context.Context, hash, baseImage, registryTag string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO image_cache (hash, base_image, registry_tag, created_at, expires_at)
+		VALUES ($1, $2, $3, NOW(), $4)
+		ON CONFLICT (hash) DO UPDATE
+		SET registry_tag = EXCLUDED.registry_tag,
+		    created_at = NOW(),
+		    last_used_at = NULL,
+		    expires_at = EXCLUDED.expires_at
+	`
+
+	_, err := c.pool.Exec(ctx, query, hash, baseImage, registryTag, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to put image cache: %w", err)
+	}
+
+	return nil
+}
+
 // TouchImageCache updates the last_used_at timestamp for a cached image.
 func (c *Client) TouchImageCache(ctx context.Context, hash string) error {
 	query := `
@@ -532,487 +935,1887 @@ func (c *Client) TouchImageCache(ctx context.Context, hash string) error {
 }
 
 // ============================================================================
-// Quota Enforcement Queries
+// Image Build Queries
 // ============================================================================
 
-// GetActiveSessionCount counts sessions with status 'running' or 'pending' for an API key.
-func (c *Client) GetActiveSessionCount(ctx context.Context, apiKeyID uuid.UUID) (int, error) {
+// CreateBuild inserts a new build record.
+func (c *Client) CreateBuild(ctx context.Context, build *Build) error {
 	query := `
-		SELECT COUNT(*)
-		FROM sessions
-		WHERE api_key_id = $1
-		  AND status IN ('running', 'pending')
+		INSERT INTO builds (id, api_key_id, hash, base_image, phase, registry_tag, error, log_tail,
+		                    created_at, started_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 
-	var count int
-	err := c.pool.QueryRow(ctx, query, apiKeyID).Scan(&count)
+	_, err := c.pool.Exec(ctx, query,
+		build.ID,
+		build.APIKeyID,
+		build.Hash,
+		build.BaseImage,
+		build.Phase,
+		build.RegistryTag,
+		build.Error,
+		build.LogTail,
+		build.CreatedAt,
+		build.StartedAt,
+		build.CompletedAt,
+	)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get active session count: %w", err)
+		return fmt.Errorf("failed to create build: %w", err)
 	}
 
-	return count, nil
+	return nil
 }
 
-// GetDailySessionCount counts sessions created today (UTC) for an API key.
-func (c *Client) GetDailySessionCount(ctx context.Context, apiKeyID uuid.UUID) (int, error) {
+// GetBuild retrieves a build by its ID.
+func (c *Client) GetBuild(ctx context.Context, id string) (*Build, error) {
 	query := `
-		SELECT COUNT(*)
-		FROM sessions
-		WHERE api_key_id = $1
-		  AND created_at >= DATE_TRUNC('day', NOW() AT TIME ZONE 'UTC')
+		SELECT id, api_key_id, hash, base_image, phase, registry_tag, error, log_tail,
+		       created_at, started_at, completed_at
+		FROM builds
+		WHERE id = $1
 	`
 
-	var count int
-	err := c.pool.QueryRow(ctx, query, apiKeyID).Scan(&count)
+	var build Build
+	err := c.pool.QueryRow(ctx, query, id).Scan(
+		&build.ID,
+		&build.APIKeyID,
+		&build.Hash,
+		&build.BaseImage,
+		&build.Phase,
+		&build.RegistryTag,
+		&build.Error,
+		&build.LogTail,
+		&build.CreatedAt,
+		&build.StartedAt,
+		&build.CompletedAt,
+	)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get daily session count: %w", err)
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("build not found")
+		}
+		return nil, fmt.Errorf("failed to get build: %w", err)
 	}
 
-	return count, nil
+	return &build, nil
 }
 
-// ============================================================================
-// Quota Request Queries
-// ============================================================================
+// UpdateBuild updates a build with the provided fields.
+// Only non-nil fields in the update struct will be updated. Builds already
+// marked failed are left unchanged and reported as an error.
+func (c *Client) UpdateBuild(ctx context.Context, id string, update *BuildUpdate) error {
+	// Build dynamic update query based on provided fields
+	query := "UPDATE builds SET"
+	args := []interface{}{}
+	argPos := 1
+	updates := []string{}
 
-// CreateQuotaRequest creates a new quota request and returns the created record.
-func (c *Client) CreateQuotaRequest(ctx context.Context, req *QuotaRequest) (*QuotaRequest, error) {
-	query := `
-		INSERT INTO quota_requests (
-			api_key_id, email, name, company, current_tier,
-			requested_limits, budget, use_case, status, created_at
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'pending', NOW())
-		RETURNING id, created_at
-	`
+	if update.Phase != nil {
+		updates = append(updates, fmt.Sprintf(" phase = $%d", argPos))
+		args = append(args, *update.Phase)
+		argPos++
+	}
 
-	err := c.pool.QueryRow(ctx, query,
-		req.APIKeyID,
-		req.Email,
-		req.Name,
-		req.Company,
-		req.CurrentTier,
-		req.RequestedLimits,
-		req.Budget,
-		req.UseCase,
-	).Scan(&req.ID, &req.CreatedAt)
+	if update.RegistryTag != nil {
+		updates = append(updates, fmt.Sprintf(" registry_tag = $%d", argPos))
+		args = append(args, *update.RegistryTag)
+		argPos++
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to create quota request: %w", err)
+	if update.Error != nil {
+		updates = append(updates, fmt.Sprintf(" error = $%d", argPos))
+		args = append(args, *update.Error)
+		argPos++
 	}
 
-	req.Status = "pending"
-	return req, nil
-}
+	if update.LogTail != nil {
+		updates = append(updates, fmt.Sprintf(" log_tail = $%d", argPos))
+		args = append(args, *update.LogTail)
+		argPos++
+	}
+
+	if update.StartedAt != nil {
+		updates = append(updates, fmt.Sprintf(" started_at = $%d", argPos))
+		args = append(args, *update.StartedAt)
+		argPos++
+	}
+
+	if update.CompletedAt != nil {
+		updates = append(updates, fmt.Sprintf(" completed_at = $%d", argPos))
+		args = append(args, *update.CompletedAt)
+		argPos++
+	}
+
+	if len(updates) == 0 {
+		return fmt.Errorf("no fields to update")
+	}
+
+	for i, u := range updates {
+		if i > 0 {
+			query += ","
+		}
+		query += u
+	}
+	// A failed build is final, even if the process running it is still alive
+	query += fmt.Sprintf(" WHERE id = $%d AND phase <> 'failed'", argPos)
+	args = append(args, id)
+
+	result, err := c.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update build: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("build not found or already failed")
+	}
+
+	return nil
+}
+
+// FailStaleBuilds marks builds as failed that have been running since before
+// startedBefore, or queued since before queuedBefore, skipping the builds in
+// excluding. Builds run inside a server process, so one that outlived every
+// timeout was orphaned by a restart and will never finish. Returns the number
+// of builds marked failed.
+func (c *Client) FailStaleBuilds(ctx context.Context, startedBefore, queuedBefore time.Time, excluding []string, reason string) (int64, error) {
+	query := `
+		UPDATE builds
+		SET phase = 'failed', error = $4, completed_at = NOW()
+		WHERE ((phase IN ('building', 'pushing') AND COALESCE(started_at, created_at) < $1)
+		    OR (phase = 'queued' AND created_at < $2))
+		  AND NOT (id = ANY($3))
+	`
+
+	if excluding == nil {
+		excluding = []string{}
+	}
+	result, err := c.pool.Exec(ctx, query, startedBefore, queuedBefore, excluding, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail stale builds: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// ============================================================================
+// Quota Enforcement Queries
+// ============================================================================
+
+// GetActiveSessionCount counts sessions with status 'running' or 'pending' for an API key.
+func (c *Client) GetActiveSessionCount(ctx context.Context, apiKeyID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE api_key_id = $1
+		  AND status IN ('running', 'pending')
+	`
+
+	var count int
+	err := c.pool.QueryRow(ctx, query, apiKeyID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get active session count: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetDailySessionCount counts sessions created today (UTC) for an API key.
+func (c *Client) GetDailySessionCount(ctx context.Context, apiKeyID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE api_key_id = $1
+		  AND created_at >= DATE_TRUNC('day', NOW() AT TIME ZONE 'UTC')
+	`
+
+	var count int
+	err := c.pool.QueryRow(ctx, query, apiKeyID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get daily session count: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetAccountActiveSessionCount counts running and pending sessions across all API keys of an account.
+func (c *Client) GetAccountActiveSessionCount(ctx context.Context, accountID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE account_id = $1
+		  AND status IN ('running', 'pending')
+	`
+
+	var count int
+	err := c.pool.QueryRow(ctx, query, accountID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get account active session count: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetAccountDailySessionCount counts sessions created today (UTC) across all API keys of an account.
+func (c *Client) GetAccountDailySessionCount(ctx context.Context, accountID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE account_id = $1
+		  AND created_at >= DATE_TRUNC('day', NOW() AT TIME ZONE 'UTC')
+	`
+
+	var count int
+	err := c.pool.QueryRow(ctx, query, accountID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get account daily session count: %w", err)
+	}
+
+	return count, nil
+}
+
+// ============================================================================
+// Quota Request Queries
+// ============================================================================
+
+// CreateQuotaRequest creates a new quota request and returns the created record.
+func (c *Client) CreateQuotaRequest(ctx context.Context, req *QuotaRequest) (*QuotaRequest, error) {
+	query := `
+		INSERT INTO quota_requests (
+			api_key_id, email, name, company, current_tier,
+			requested_limits, budget, use_case, status, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'pending', NOW())
+		RETURNING id, created_at
+	`
+
+	err := c.pool.QueryRow(ctx, query,
+		req.APIKeyID,
+		req.Email,
+		req.Name,
+		req.Company,
+		req.CurrentTier,
+		req.RequestedLimits,
+		req.Budget,
+		req.UseCase,
+	).Scan(&req.ID, &req.CreatedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quota request: %w", err)
+	}
+
+	req.Status = "pending"
+	return req, nil
+}
+
+// ============================================================================
+// Account Queries
+// ============================================================================
+
+// GetAccount retrieves an account by its ID.
+// Returns an error if the account is not found or if the query fails.
+func (c *Client) GetAccount(ctx context.Context, id uuid.UUID) (*Account, error) {
+	query := `
+		SELECT id, name, email, created_at, updated_at
+		FROM accounts
+		WHERE id = $1
+	`
+
+	var account Account
+	err := c.pool.QueryRow(ctx, query, id).Scan(
+		&account.ID,
+		&account.Name,
+		&account.Email,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// UpdateAccount updates an account's fields and returns the updated account.
+// Only non-nil fields in the update struct will be changed.
+func (c *Client) UpdateAccount(ctx context.Context, id uuid.UUID, update *AccountUpdate) (*Account, error) {
+	query := "UPDATE accounts SET updated_at = NOW()"
+	args := []interface{}{}
+	argPos := 1
+
+	if update.Name != nil {
+		query += fmt.Sprintf(", name = $%d", argPos)
+		args = append(args, *update.Name)
+		argPos++
+	}
+
+	if update.Email != nil {
+		query += fmt.Sprintf(", email = $%d", argPos)
+		args = append(args, *update.Email)
+		argPos++
+	}
+
+	query += fmt.Sprintf(" WHERE id = $%d RETURNING id, name, email, created_at, updated_at", argPos)
+	args = append(args, id)
+
+	var account Account
+	err := c.pool.QueryRow(ctx, query, args...).Scan(
+		&account.ID,
+		&account.Name,
+		&account.Email,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// ============================================================================
+// Account Member Queries
+// ============================================================================
+
+// memberColumns is the list of columns to select for account member queries
+const memberColumns = `id, account_id, email, name, role, created_at, updated_at`
+
+// scanMember scans a database row into an AccountMember struct
+func scanMember(row interface{ Scan(...any) error }) (*AccountMember, error) {
+	var m AccountMember
+	err := row.Scan(&m.ID, &m.AccountID, &m.Email, &m.Name, &m.Role, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListAccountMembers retrieves all members of an account, oldest first.
+func (c *Client) ListAccountMembers(ctx context.Context, accountID uuid.UUID) ([]AccountMember, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM account_members
+		WHERE account_id = $1
+		ORDER BY created_at ASC
+	`, memberColumns)
+
+	rows, err := c.pool.Query(ctx, query, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list account members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []AccountMember
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account member row: %w", err)
+		}
+		members = append(members, *m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating account members: %w", err)
+	}
+
+	return members, nil
+}
+
+// GetAccountMember retrieves a member by its ID.
+func (c *Client) GetAccountMember(ctx context.Context, id uuid.UUID) (*AccountMember, error) {
+	query := fmt.Sprintf(`SELECT %s FROM account_members WHERE id = $1`, memberColumns)
+
+	m, err := scanMember(c.pool.QueryRow(ctx, query, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("member not found")
+		}
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+
+	return m, nil
+}
+
+// UpdateAccountMemberRole changes a member's role and returns the updated member.
+// The member's API keys act with the new role from their next request.
+func (c *Client) UpdateAccountMemberRole(ctx context.Context, id uuid.UUID, role string) (*AccountMember, error) {
+	query := fmt.Sprintf(`
+		UPDATE account_members
+		SET role = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING %s
+	`, memberColumns)
+
+	m, err := scanMember(c.pool.QueryRow(ctx, query, id, role))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("member not found")
+		}
+		return nil, fmt.Errorf("failed to update member role: %w", err)
+	}
+
+	return m, nil
+}
+
+// RemoveAccountMember removes a member from its account and deactivates the
+// API keys issued to them, recording who performed the action on the keys.
+func (c *Client) RemoveAccountMember(ctx context.Context, id uuid.UUID, performedBy string) error {
+	var failure error
+	err := pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE api_keys
+			SET is_active = false, last_updated_by = $2
+			WHERE member_id = $1 AND is_active
+		`, id, performedBy)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(ctx, `DELETE FROM account_members WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			failure = fmt.Errorf("member not found")
+			return failure
+		}
+		return nil
+	})
+	if err != nil {
+		if failure != nil {
+			return failure
+		}
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	return nil
+}
+
+// invitationColumns is the list of columns to select for invitation queries
+const invitationColumns = `id, account_id, email, role, token_hash, invited_by, expires_at, accepted_at, created_at`
+
+// scanInvitation scans a database row into an AccountInvitation struct
+func scanInvitation(row interface{ Scan(...any) error }) (*AccountInvitation, error) {
+	var inv AccountInvitation
+	err := row.Scan(
+		&inv.ID, &inv.AccountID, &inv.Email, &inv.Role, &inv.TokenHash,
+		&inv.InvitedBy, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// CreateAccountInvitation inserts a new invitation and sets its creation time.
+func (c *Client) CreateAccountInvitation(ctx context.Context, inv *AccountInvitation) error {
+	query := `
+		INSERT INTO account_invitations (id, account_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`
+
+	err := c.pool.QueryRow(ctx, query,
+		inv.ID,
+		inv.AccountID,
+		inv.Email,
+		inv.Role,
+		inv.TokenHash,
+		inv.InvitedBy,
+		inv.ExpiresAt,
+	).Scan(&inv.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return nil
+}
+
+// ListAccountInvitations retrieves the pending invitations of an account,
+// newest first. Accepted and expired invitations are left out.
+func (c *Client) ListAccountInvitations(ctx context.Context, accountID uuid.UUID) ([]AccountInvitation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM account_invitations
+		WHERE account_id = $1
+		  AND accepted_at IS NULL
+		  AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`, invitationColumns)
+
+	rows, err := c.pool.Query(ctx, query, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []AccountInvitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation row: %w", err)
+		}
+		invitations = append(invitations, *inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// GetAccountInvitation retrieves an invitation by its ID.
+func (c *Client) GetAccountInvitation(ctx context.Context, id uuid.UUID) (*AccountInvitation, error) {
+	query := fmt.Sprintf(`SELECT %s FROM account_invitations WHERE id = $1`, invitationColumns)
+
+	inv, err := scanInvitation(c.pool.QueryRow(ctx, query, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("invitation not found")
+		}
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	return inv, nil
+}
+
+// DeleteAccountInvitation revokes an invitation.
+func (c *Client) DeleteAccountInvitation(ctx context.Context, id uuid.UUID) error {
+	result, err := c.pool.Exec(ctx, "DELETE FROM account_invitations WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("invitation not found")
+	}
+
+	return nil
+}
+
+// AcceptAccountInvitation redeems the pending invitation whose token hashes to
+// tokenHash. In one transaction it marks the invitation accepted, adds the
+// invitee as a member with the invited role, and issues them an API key with
+// the tier of the account's primary key. Returns "invitation not found" if the
+// token is unknown, expired or already used, and "already a member" if the
+// email belongs to a member of the account.
+func (c *Client) AcceptAccountInvitation(ctx context.Context, tokenHash string, name *string) (*AccountMember, *APIKey, error) {
+	// Generate a secure random API key
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	acceptQuery := `
+		UPDATE account_invitations
+		SET accepted_at = NOW()
+		WHERE token_hash = $1
+		  AND accepted_at IS NULL
+		  AND expires_at > NOW()
+		RETURNING account_id, email, role
+	`
+
+	memberQuery := fmt.Sprintf(`
+		INSERT INTO account_members (id, account_id, email, name, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		ON CONFLICT (account_id, email) DO NOTHING
+		RETURNING %s
+	`, memberColumns)
+
+	keyQuery := fmt.Sprintf(`
+		INSERT INTO api_keys (id, key_prefix, key_hash, email, tier, rate_limit_rps, is_active, account_id, parent_key_id, member_id, created_at)
+		SELECT $1, $2, $3, $4, tier, rate_limit_rps, true, account_id, id, $5, NOW()
+		FROM api_keys
+		WHERE account_id = $6 AND parent_key_id IS NULL
+		ORDER BY created_at ASC
+		LIMIT 1
+		RETURNING %s
+	`, apiKeyColumns)
+
+	var member *AccountMember
+	var apiKey *APIKey
+	var failure error
+	err = pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+		var accountID uuid.UUID
+		var email, role string
+		err := tx.QueryRow(ctx, acceptQuery, tokenHash).Scan(&accountID, &email, &role)
+		if err == pgx.ErrNoRows {
+			failure = fmt.Errorf("invitation not found")
+			return failure
+		}
+		if err != nil {
+			return err
+		}
+
+		member, err = scanMember(tx.QueryRow(ctx, memberQuery, uuid.New(), accountID, email, name, role))
+		if err == pgx.ErrNoRows {
+			failure = fmt.Errorf("already a member")
+			return failure
+		}
+		if err != nil {
+			return err
+		}
+
+		apiKey, err = scanAPIKey(tx.QueryRow(ctx, keyQuery, uuid.New(), apiKeyPrefix(key), c.hashAPIKey(key), email, member.ID, accountID))
+		return err
+	})
+	if err != nil {
+		if failure != nil {
+			return nil, nil, failure
+		}
+		return nil, nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	apiKey.Key = key
+
+	return member, apiKey, nil
+}
+
+// ============================================================================
+// Account Audit Log Queries
+// ============================================================================
+
+// CreateAuditEntry appends an entry to an account's audit log and sets its ID and timestamp.
+func (c *Client) CreateAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	query := `
+		INSERT INTO account_audit_log (account_id, actor_key_id, actor_member_id, action, target, details, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	err := c.pool.QueryRow(ctx, query,
+		entry.AccountID,
+		entry.ActorKeyID,
+		entry.ActorMemberID,
+		entry.Action,
+		entry.Target,
+		entry.Details,
+		entry.IPAddress,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// ListAuditEntries returns the entries of an account's audit log matching
+// filter, newest first.
+func (c *Client) ListAuditEntries(ctx context.Context, accountID uuid.UUID, filter *AuditFilter) ([]AuditEntry, error) {
+	query := `
+		SELECT id, account_id, actor_key_id, actor_member_id, action, target, details, ip_address, created_at
+		FROM account_audit_log
+		WHERE account_id = $1`
+	args := []interface{}{accountID}
+
+	if filter.ActorKeyID != nil {
+		args = append(args, *filter.ActorKeyID)
+		query += fmt.Sprintf(" AND actor_key_id = $%d", len(args))
+	}
+	if filter.ActorMemberID != nil {
+		args = append(args, *filter.ActorMemberID)
+		query += fmt.Sprintf(" AND actor_member_id = $%d", len(args))
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+		args = append(args, prefix)
+		query += fmt.Sprintf(" AND starts_with(action, $%d)", len(args))
+	} else if filter.Action != "" {
+		args = append(args, filter.Action)
+		query += fmt.Sprintf(" AND action = $%d", len(args))
+	}
+	if filter.Since != nil {
+		args = append(args, *filter.Since)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if filter.Until != nil {
+		args = append(args, *filter.Until)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	if filter.BeforeCreatedAt != nil {
+		args = append(args, *filter.BeforeCreatedAt, filter.BeforeID)
+		query += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := c.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(
+			&entry.ID, &entry.AccountID, &entry.ActorKeyID, &entry.ActorMemberID,
+			&entry.Action, &entry.Target, &entry.Details, &entry.IPAddress, &entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// ============================================================================
+// Account Usage Queries
+// ============================================================================
+
+// GetAccountLimits retrieves account limits by account ID.
+// Returns an error if the limits are not found or if the query fails.
+func (c *Client) GetAccountLimits(ctx context.Context, accountID uuid.UUID) (*AccountLimits, error) {
+	query := `
+		SELECT account_id, daily_requests_limit, concurrent_requests_limit,
+		       CASE WHEN monthly_cost_limit IS NOT NULL THEN (monthly_cost_limit * 100)::bigint ELSE NULL END,
+		       alert_threshold_percentage, billing_email, timezone, updated_at, created_at
+		FROM account_limits
+		WHERE account_id = $1
+	`
+
+	var limits AccountLimits
+	err := c.pool.QueryRow(ctx, query, accountID).Scan(
+		&limits.AccountID,
+		&limits.DailyRequestsLimit,
+		&limits.ConcurrentRequestsLimit,
+		&limits.MonthlyCostLimitCents,
+		&limits.AlertThresholdPercentage,
+		&limits.BillingEmail,
+		&limits.Timezone,
+		&limits.UpdatedAt,
+		&limits.CreatedAt,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("account limits not found")
+		}
+		return nil, fmt.Errorf("failed to get account limits: %w", err)
+	}
+
+	return &limits, nil
+}
+
+// UpsertAccountLimits creates or updates account limits.
+// Uses INSERT ... ON CONFLICT to atomically create or update the record.
+func (c *Client) UpsertAccountLimits(ctx context.Context, limits *AccountLimits) error {
+	query := `
+		INSERT INTO account_limits (
+			account_id, daily_requests_limit, concurrent_requests_limit, monthly_cost_limit,
+			alert_threshold_percentage, billing_email, timezone, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, CASE WHEN $4::bigint IS NOT NULL THEN $4::numeric / 100 ELSE NULL END, $5, $6, $7, NOW(), NOW())
+		ON CONFLICT (account_id) DO UPDATE SET
+			daily_requests_limit = EXCLUDED.daily_requests_limit,
+			concurrent_requests_limit = EXCLUDED.concurrent_requests_limit,
+			monthly_cost_limit = EXCLUDED.monthly_cost_limit,
+			alert_threshold_percentage = EXCLUDED.alert_threshold_percentage,
+			billing_email = EXCLUDED.billing_email,
+			timezone = EXCLUDED.timezone,
+			updated_at = NOW()
+	`
+
+	_, err := c.pool.Exec(ctx, query,
+		limits.AccountID,
+		limits.DailyRequestsLimit,
+		limits.ConcurrentRequestsLimit,
+		limits.MonthlyCostLimitCents,
+		limits.AlertThresholdPercentage,
+		limits.BillingEmail,
+		limits.Timezone,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to upsert account limits: %w", err)
+	}
+
+	return nil
+}
+
+// GetHourlyAccountUsage retrieves hourly usage metrics for an account within a time range.
+// Returns an empty slice if no records are found.
+func (c *Client) GetHourlyAccountUsage(ctx context.Context, accountID uuid.UUID, start, end time.Time) ([]HourlyAccountUsage, error) {
+	query := `
+		SELECT id, account_id, hour, executions, duration_ms, cost_estimate_cents, cpu_millis_used, memory_mb_seconds, errors, created_at, updated_at
+		FROM hourly_account_usage
+		WHERE account_id = $1
+		  AND hour BETWEEN $2 AND $3
+		ORDER BY hour ASC
+	`
+
+	rows, err := c.pool.Query(ctx, query, accountID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hourly account usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []HourlyAccountUsage
+	for rows.Next() {
+		var u HourlyAccountUsage
+		err := rows.Scan(
+			&u.ID,
+			&u.AccountID,
+			&u.Hour,
+			&u.Executions,
+			&u.DurationMs,
+			&u.CostEstimateCents,
+			&u.CPUMillisUsed,
+			&u.MemoryMBSeconds,
+			&u.Errors,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan hourly account usage row: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating hourly account usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// GetDailyAccountUsage retrieves daily aggregated usage metrics for an account.
+// Returns an empty slice if no records are found.
+func (c *Client) GetDailyAccountUsage(ctx context.Context, accountID uuid.UUID, days int) ([]UsageMetric, error) {
+	query := `
+		SELECT id, api_key_id, date, executions, duration_ms
+		FROM usage_metrics
+		WHERE account_id = $1
+		  AND date >= CURRENT_DATE - $2 * INTERVAL '1 day'
+		ORDER BY date DESC
+	`
+
+	rows, err := c.pool.Query(ctx, query, accountID, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily account usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []UsageMetric
+	for rows.Next() {
+		var u UsageMetric
+		err := rows.Scan(
+			&u.ID,
+			&u.APIKeyID,
+			&u.Date,
+			&u.Executions,
+			&u.DurationMs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan daily account usage row: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating daily account usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// GetAccountCostTracking retrieves cost tracking data for an account for a specific billing period.
+// Returns an empty slice if no records are found.
+func (c *Client) GetAccountCostTracking(ctx context.Context, accountID uuid.UUID, periodStart time.Time) ([]AccountCostTracking, error) {
+	query := `
+		SELECT id, account_id, date, daily_cost_cents, daily_executions, billing_period_start, billing_period_end, created_at, updated_at
+		FROM account_cost_tracking
+		WHERE account_id = $1
+		  AND billing_period_start = $2
+		ORDER BY date ASC
+	`
+
+	rows, err := c.pool.Query(ctx, query, accountID, periodStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account cost tracking: %w", err)
+	}
+	defer rows.Close()
+
+	var tracking []AccountCostTracking
+	for rows.Next() {
+		var t AccountCostTracking
+		err := rows.Scan(
+			&t.ID,
+			&t.AccountID,
+			&t.Date,
+			&t.DailyCostCents,
+			&t.DailyExecutions,
+			&t.BillingPeriodStart,
+			&t.BillingPeriodEnd,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account cost tracking row: %w", err)
+		}
+		tracking = append(tracking, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating account cost tracking: %w", err)
+	}
+
+	return tracking, nil
+}
+
+// ============================================================================
+// Multi-Key Management Queries
+// ============================================================================
+
+// GetAPIKeysByAccount retrieves all API keys owned by an account.
+// Returns all keys including deactivated/expired ones (for management display).
+func (c *Client) GetAPIKeysByAccount(ctx context.Context, accountID uuid.UUID) ([]APIKey, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM api_keys
+		WHERE account_id = $1
+		ORDER BY created_at ASC
+	`, apiKeyColumns)
+
+	rows, err := c.pool.Query(ctx, query, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys for account: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key row: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// CreateAPIKeyForAccount creates a new API key for an existing account.
+// The new key inherits tier settings and the member from the parent key, and is
+// limited to scopes unless scopes is nil.
+func (c *Client) CreateAPIKeyForAccount(ctx context.Context, accountID uuid.UUID, name, description string, parentKeyID uuid.UUID, scopes []string) (*APIKey, error) {
+	// Generate a secure random API key
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO api_keys (id, key_prefix, key_hash, email, tier, rate_limit_rps, is_active, account_id, parent_key_id, name, description, member_id, scopes, created_at)
+		SELECT $1, $2, $3, email, tier, rate_limit_rps, true, $4, $5, $6, $7, member_id, $8, NOW()
+		FROM api_keys
+		WHERE id = $5
+		RETURNING %s
+	`, apiKeyColumns)
+
+	apiKey, err := scanAPIKey(c.pool.QueryRow(ctx, query, uuid.New(), apiKeyPrefix(key), c.hashAPIKey(key), accountID, parentKeyID, name, description, scopes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key for account: %w", err)
+	}
+	apiKey.Key = key
+
+	return apiKey, nil
+}
+
+// UpdateAPIKey updates an API key's fields.
+// Only non-nil fields in the update struct will be changed.
+func (c *Client) UpdateAPIKey(ctx context.Context, keyID uuid.UUID, update *APIKeyUpdate) error {
+	query := "UPDATE api_keys SET"
+	args := []interface{}{}
+	argPos := 1
+	updates := []string{}
+
+	if update.Name != nil {
+		updates = append(updates, fmt.Sprintf(" name = $%d", argPos))
+		args = append(args, *update.Name)
+		argPos++
+	}
+
+	if update.Description != nil {
+		updates = append(updates, fmt.Sprintf(" description = $%d", argPos))
+		args = append(args, *update.Description)
+		argPos++
+	}
+
+	if update.IsActive != nil {
+		updates = append(updates, fmt.Sprintf(" is_active = $%d", argPos))
+		args = append(args, *update.IsActive)
+		argPos++
+	}
+
+	if update.ExpiresAt != nil {
+		// A new expiration gets a new notice
+		updates = append(updates, " expiry_notified_at = NULL")
+		updates = append(updates, fmt.Sprintf(" expires_at = $%d", argPos))
+		args = append(args, *update.ExpiresAt)
+		argPos++
+	}
+
+	if update.CustomDailyLimit != nil {
+		updates = append(updates, fmt.Sprintf(" custom_daily_limit = $%d", argPos))
+		args = append(args, *update.CustomDailyLimit)
+		argPos++
+	}
+
+	if update.CustomConcurrentLimit != nil {
+		updates = append(updates, fmt.Sprintf(" custom_concurrent_limit = $%d", argPos))
+		args = append(args, *update.CustomConcurrentLimit)
+		argPos++
+	}
+
+	if update.LastUpdatedBy != nil {
+		updates = append(updates, fmt.Sprintf(" last_updated_by = $%d", argPos))
+		args = append(args, *update.LastUpdatedBy)
+		argPos++
+	}
+
+	if len(updates) == 0 {
+		return fmt.Errorf("no fields to update")
+	}
+
+	// Complete the query
+	for i, u := range updates {
+		if i > 0 {
+			query += ","
+		}
+		query += u
+	}
+	query += fmt.Sprintf(" WHERE id = $%d", argPos)
+	args = append(args, keyID)
+
+	result, err := c.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
 
-// ============================================================================
-// Account Usage Queries
-// ============================================================================
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("API key not found")
+	}
 
-// GetAccountLimits retrieves account limits by account ID.
-// Returns an error if the limits are not found or if the query fails.
-func (c *Client) GetAccountLimits(ctx context.Context, accountID uuid.UUID) (*AccountLimits, error) {
+	return nil
+}
+
+// DeactivateAPIKey soft-deletes an API key by setting is_active=false.
+// Also records who performed the action in last_updated_by.
+func (c *Client) DeactivateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string) error {
 	query := `
-		SELECT account_id, daily_requests_limit, concurrent_requests_limit,
-		       CASE WHEN monthly_cost_limit IS NOT NULL THEN (monthly_cost_limit * 100)::bigint ELSE NULL END,
-		       alert_threshold_percentage, billing_email, timezone, updated_at, created_at
-		FROM account_limits
-		WHERE account_id = $1
+		UPDATE api_keys
+		SET is_active = false, last_updated_by = $2
+		WHERE id = $1
 	`
 
-	var limits AccountLimits
-	err := c.pool.QueryRow(ctx, query, accountID).Scan(
-		&limits.AccountID,
-		&limits.DailyRequestsLimit,
-		&limits.ConcurrentRequestsLimit,
-		&limits.MonthlyCostLimitCents,
-		&limits.AlertThresholdPercentage,
-		&limits.BillingEmail,
-		&limits.Timezone,
-		&limits.UpdatedAt,
-		&limits.CreatedAt,
-	)
+	result, err := c.pool.Exec(ctx, query, keyID, performedBy)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate API key: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
 
+// ListAPIKeysExpiringBefore returns the active keys that expire between now
+// and before and whose owners have not been notified yet, soonest first.
+func (c *Client) ListAPIKeysExpiringBefore(ctx context.Context, before time.Time) ([]APIKey, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM api_keys
+		WHERE is_active = true
+		  AND expires_at > NOW() AND expires_at <= $1
+		  AND expiry_notified_at IS NULL
+		ORDER BY expires_at
+	`, apiKeyColumns)
+
+	rows, err := c.pool.Query(ctx, query, before)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("account limits not found")
+		return nil, fmt.Errorf("failed to list expiring API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
 		}
-		return nil, fmt.Errorf("failed to get account limits: %w", err)
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list expiring API keys: %w", err)
 	}
 
-	return &limits, nil
+	return keys, nil
 }
 
-// UpsertAccountLimits creates or updates account limits.
-// Uses INSERT ... ON CONFLICT to atomically create or update the record.
-func (c *Client) UpsertAccountLimits(ctx context.Context, limits *AccountLimits) error {
-	query := `
-		INSERT INTO account_limits (
-			account_id, daily_requests_limit, concurrent_requests_limit, monthly_cost_limit,
-			alert_threshold_percentage, billing_email, timezone, created_at, updated_at
-		)
-		VALUES ($1, $2, $3, CASE WHEN $4::bigint IS NOT NULL THEN $4::numeric / 100 ELSE NULL END, $5, $6, $7, NOW(), NOW())
-		ON CONFLICT (account_id) DO UPDATE SET
-			daily_requests_limit = EXCLUDED.daily_requests_limit,
-			concurrent_requests_limit = EXCLUDED.concurrent_requests_limit,
-			monthly_cost_limit = EXCLUDED.monthly_cost_limit,
-			alert_threshold_percentage = EXCLUDED.alert_threshold_percentage,
-			billing_email = EXCLUDED.billing_email,
-			timezone = EXCLUDED.timezone,
-			updated_at = NOW()
+// ClaimAPIKeyExpiryNotice records that the owners of a key are being notified
+// of its upcoming expiration. Returns false if the key was already claimed, by
+// this or another replica, so each expiration is notified once.
+func (c *Client) ClaimAPIKeyExpiryNotice(ctx context.Context, keyID uuid.UUID) (bool, error) {
+	result, err := c.pool.Exec(ctx, `
+		UPDATE api_keys SET expiry_notified_at = NOW()
+		WHERE id = $1 AND expiry_notified_at IS NULL
+	`, keyID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim API key expiry notice: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ReleaseAPIKeyExpiryNotice undoes ClaimAPIKeyExpiryNotice after the notice
+// failed, so the key is listed as expiring again.
+func (c *Client) ReleaseAPIKeyExpiryNotice(ctx context.Context, keyID uuid.UUID) error {
+	result, err := c.pool.Exec(ctx, `UPDATE api_keys SET expiry_notified_at = NULL WHERE id = $1`, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to release API key expiry notice: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("API key not found")
+	}
+	return nil
+}
+
+// DeactivateExpiredAPIKeys deactivates the keys that expired before
+// expiredBefore, ending any rotation overlap, and records performedBy in
+// last_updated_by. Returns how many keys were deactivated.
+func (c *Client) DeactivateExpiredAPIKeys(ctx context.Context, expiredBefore time.Time, performedBy string) (int64, error) {
+	result, err := c.pool.Exec(ctx, `
+		UPDATE api_keys
+		SET is_active = false, last_updated_by = $2,
+		    rotating_key_prefix = NULL, rotating_key_hash = NULL, rotating_expires_at = NULL
+		WHERE is_active = true AND expires_at < $1
+	`, expiredBefore, performedBy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to deactivate expired API keys: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// DowngradeExpiredTiers moves keys whose tier_expires_at has passed back to
+// the free tier and its rate limit. Returns how many keys were downgraded.
+func (c *Client) DowngradeExpiredTiers(ctx context.Context) (int64, error) {
+	result, err := c.pool.Exec(ctx, `
+		UPDATE api_keys
+		SET tier = 'free', rate_limit_rps = 10, tier_expires_at = NULL, tier_updated_at = NOW()
+		WHERE tier_expires_at <= NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to downgrade expired tiers: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// RotateAPIKey creates a new key value while preserving the key's settings.
+// With a positive overlap the previous value keeps authenticating for that
+// long, replacing any previous value still in its overlap; otherwise it stops
+// working at once. Returns the updated key with the new key value, which is
+// not stored.
+func (c *Client) RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string, overlap time.Duration) (*APIKey, error) {
+	// Generate a new secure random API key
+	newKey, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	currentQuery := `
+		SELECT key_prefix, key_hash, key
+		FROM api_keys
+		WHERE id = $1
+		FOR UPDATE
 	`
 
-	_, err := c.pool.Exec(ctx, query,
-		limits.AccountID,
-		limits.DailyRequestsLimit,
-		limits.ConcurrentRequestsLimit,
-		limits.MonthlyCostLimitCents,
-		limits.AlertThresholdPercentage,
-		limits.BillingEmail,
-		limits.Timezone,
-	)
+	updateQuery := fmt.Sprintf(`
+		UPDATE api_keys
+		SET key = NULL, key_prefix = $2, key_hash = $3, last_updated_by = $4,
+		    rotating_key_prefix = $5, rotating_key_hash = $6, rotating_expires_at = $7
+		WHERE id = $1
+		RETURNING %s
+	`, apiKeyColumns)
+
+	var apiKey *APIKey
+	var failure error
+	err = pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+		var currentPrefix string
+		var currentHash, legacyKey *string
+		err := tx.QueryRow(ctx, currentQuery, keyID).Scan(&currentPrefix, &currentHash, &legacyKey)
+		if err == pgx.ErrNoRows {
+			failure = fmt.Errorf("API key not found")
+			return failure
+		}
+		if err != nil {
+			return err
+		}
+
+		// The current value becomes the rotating one for the overlap
+		var rotatingPrefix, rotatingHash *string
+		var rotatingExpiresAt *time.Time
+		if overlap > 0 {
+			if currentHash == nil && legacyKey != nil {
+				hash := c.hashAPIKey(*legacyKey)
+				currentHash = &hash
+			}
+			expiresAt := time.Now().UTC().Add(overlap)
+			rotatingPrefix, rotatingHash, rotatingExpiresAt = &currentPrefix, currentHash, &expiresAt
+		}
 
+		apiKey, err = scanAPIKey(tx.QueryRow(ctx, updateQuery, keyID, apiKeyPrefix(newKey), c.hashAPIKey(newKey), performedBy,
+			rotatingPrefix, rotatingHash, rotatingExpiresAt))
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to upsert account limits: %w", err)
+		if failure != nil {
+			return nil, failure
+		}
+		return nil, fmt.Errorf("failed to rotate API key: %w", err)
 	}
+	apiKey.Key = newKey
 
-	return nil
+	return apiKey, nil
 }
 
-// GetHourlyAccountUsage retrieves hourly usage metrics for an account within a time range.
-// Returns an empty slice if no records are found.
-func (c *Client) GetHourlyAccountUsage(ctx context.Context, accountID uuid.UUID, start, end time.Time) ([]HourlyAccountUsage, error) {
+// IsPrimaryKey checks if the given key is the primary key for its account.
+// Primary keys are created with the account and have no parent_key_id.
+func (c *Client) IsPrimaryKey(ctx context.Context, keyID uuid.UUID) (bool, error) {
 	query := `
-		SELECT id, account_id, hour, executions, duration_ms, cost_estimate_cents, cpu_millis_used, memory_mb_seconds, errors, created_at, updated_at
-		FROM hourly_account_usage
-		WHERE account_id = $1
-		  AND hour BETWEEN $2 AND $3
-		ORDER BY hour ASC
+		SELECT parent_key_id IS NULL
+		FROM api_keys
+		WHERE id = $1
 	`
 
-	rows, err := c.pool.Query(ctx, query, accountID, start, end)
+	var isPrimary bool
+	err := c.pool.QueryRow(ctx, query, keyID).Scan(&isPrimary)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get hourly account usage: %w", err)
+		if err == pgx.ErrNoRows {
+			return false, fmt.Errorf("API key not found")
+		}
+		return false, fmt.Errorf("failed to check if primary key: %w", err)
+	}
+
+	return isPrimary, nil
+}
+
+// GetAccountSpend returns an account's settled cost for the billing period
+// starting at periodStart, and the start times of its sessions created in that
+// period that are still running.
+func (c *Client) GetAccountSpend(ctx context.Context, accountID uuid.UUID, periodStart time.Time) (*AccountSpend, error) {
+	var spend AccountSpend
+
+	err := c.pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(daily_cost_cents), 0)
+		FROM account_cost_tracking
+		WHERE account_id = $1
+		  AND billing_period_start = $2
+	`, accountID, periodStart).Scan(&spend.SettledCents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account spend: %w", err)
+	}
+
+	rows, err := c.pool.Query(ctx, `
+		SELECT created_at
+		FROM sessions
+		WHERE account_id = $1
+		  AND status IN ('running', 'pending')
+		  AND created_at >= $2
+	`, accountID, periodStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active sessions: %w", err)
 	}
 	defer rows.Close()
 
-	var usage []HourlyAccountUsage
 	for rows.Next() {
-		var u HourlyAccountUsage
-		err := rows.Scan(
-			&u.ID,
-			&u.AccountID,
-			&u.Hour,
-			&u.Executions,
-			&u.DurationMs,
-			&u.CostEstimateCents,
-			&u.CPUMillisUsed,
-			&u.MemoryMBSeconds,
-			&u.Errors,
-			&u.CreatedAt,
-			&u.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan hourly account usage row: %w", err)
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan active session: %w", err)
 		}
-		usage = append(usage, u)
+		spend.ActiveSessionStarts = append(spend.ActiveSessionStarts, createdAt)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating hourly account usage: %w", err)
+		return nil, fmt.Errorf("error iterating active sessions: %w", err)
 	}
 
-	return usage, nil
+	return &spend, nil
 }
 
-// GetDailyAccountUsage retrieves daily aggregated usage metrics for an account.
-// Returns an empty slice if no records are found.
-func (c *Client) GetDailyAccountUsage(ctx context.Context, accountID uuid.UUID, days int) ([]UsageMetric, error) {
+// CreateBudgetAlert records a budget alert unless the account already has one
+// for the billing period. Its first delivery attempt is due at
+// alert.NextDeliveryAt, or right away if that is nil. Returns true if the
+// alert was created.
+func (c *Client) CreateBudgetAlert(ctx context.Context, alert *BudgetAlert) (bool, error) {
 	query := `
-		SELECT id, api_key_id, date, executions, duration_ms
-		FROM usage_metrics
-		WHERE account_id = $1
-		  AND date >= CURRENT_DATE - $2 * INTERVAL '1 day'
-		ORDER BY date DESC
+		INSERT INTO budget_alerts (
+			account_id, billing_period_start, threshold_percentage, spent_cents, limit_cents, billing_email,
+			next_delivery_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, NOW()))
+		ON CONFLICT (account_id, billing_period_start) DO NOTHING
+		RETURNING id, created_at, next_delivery_at
 	`
 
-	rows, err := c.pool.Query(ctx, query, accountID, days)
+	err := c.pool.QueryRow(ctx, query,
+		alert.AccountID,
+		alert.BillingPeriodStart,
+		alert.ThresholdPercentage,
+		alert.SpentCents,
+		alert.LimitCents,
+		alert.BillingEmail,
+		alert.NextDeliveryAt,
+	).Scan(&alert.ID, &alert.CreatedAt, &alert.NextDeliveryAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get daily account usage: %w", err)
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create budget alert: %w", err)
+	}
+
+	return true, nil
+}
+
+// ClaimBudgetAlerts returns up to limit undelivered budget alerts whose next
+// delivery attempt is due, and pushes that attempt to leaseUntil so no other
+// replica claims them while they are being delivered.
+func (c *Client) ClaimBudgetAlerts(ctx context.Context, limit int, leaseUntil time.Time) ([]BudgetAlert, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM budget_alerts
+			WHERE next_delivery_at <= NOW()
+			ORDER BY next_delivery_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE budget_alerts a
+		SET next_delivery_at = $2
+		FROM due
+		WHERE a.id = due.id
+		RETURNING a.id, a.account_id, a.billing_period_start, a.threshold_percentage, a.spent_cents,
+		          a.limit_cents, a.billing_email, a.created_at, a.delivery_attempts, a.next_delivery_at,
+		          a.delivered_at
+	`
+
+	rows, err := c.pool.Query(ctx, query, limit, leaseUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim budget alerts: %w", err)
 	}
 	defer rows.Close()
 
-	var usage []UsageMetric
+	var alerts []BudgetAlert
 	for rows.Next() {
-		var u UsageMetric
-		err := rows.Scan(
-			&u.ID,
-			&u.APIKeyID,
-			&u.Date,
-			&u.Executions,
-			&u.DurationMs,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan daily account usage row: %w", err)
+		var a BudgetAlert
+		if err := rows.Scan(
+			&a.ID, &a.AccountID, &a.BillingPeriodStart, &a.ThresholdPercentage, &a.SpentCents,
+			&a.LimitCents, &a.BillingEmail, &a.CreatedAt, &a.DeliveryAttempts, &a.NextDeliveryAt,
+			&a.DeliveredAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan budget alert row: %w", err)
 		}
-		usage = append(usage, u)
+		alerts = append(alerts, a)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating daily account usage: %w", err)
+		return nil, fmt.Errorf("error iterating budget alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// RecordBudgetAlertDelivery stores the outcome of a delivery attempt: the
+// attempts made so far, when the alert was delivered, and when to try next.
+// A nil nextDeliveryAt ends delivery, whether or not it succeeded.
+func (c *Client) RecordBudgetAlertDelivery(ctx context.Context, id int64, attempts int, deliveredAt, nextDeliveryAt *time.Time) error {
+	query := `
+		UPDATE budget_alerts
+		SET delivery_attempts = $2, delivered_at = $3, next_delivery_at = $4
+		WHERE id = $1
+	`
+
+	result, err := c.pool.Exec(ctx, query, id, attempts, deliveredAt, nextDeliveryAt)
+	if err != nil {
+		return fmt.Errorf("failed to record budget alert delivery: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("budget alert not found")
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Webhook Queries
+// ============================================================================
+
+// webhookColumns is the list of columns to select for webhook queries
+const webhookColumns = `id, account_id, url, secret, events, description, is_active, created_at, updated_at`
+
+// scanWebhook scans a database row into a Webhook struct
+func scanWebhook(row interface{ Scan(...any) error }) (*Webhook, error) {
+	var hook Webhook
+	err := row.Scan(
+		&hook.ID, &hook.AccountID, &hook.URL, &hook.Secret, &hook.Events,
+		&hook.Description, &hook.IsActive, &hook.CreatedAt, &hook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
 	}
-
-	return usage, nil
+	return &hook, nil
 }
 
-// GetAccountCostTracking retrieves cost tracking data for an account for a specific billing period.
-// Returns an empty slice if no records are found.
-func (c *Client) GetAccountCostTracking(ctx context.Context, accountID uuid.UUID, periodStart time.Time) ([]AccountCostTracking, error) {
+// CreateWebhook inserts a new webhook and sets its timestamps.
+func (c *Client) CreateWebhook(ctx context.Context, hook *Webhook) error {
 	query := `
-		SELECT id, account_id, date, daily_cost_cents, daily_executions, billing_period_start, billing_period_end, created_at, updated_at
-		FROM account_cost_tracking
-		WHERE account_id = $1
-		  AND billing_period_start = $2
-		ORDER BY date ASC
+		INSERT INTO webhooks (id, account_id, url, secret, events, description, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at, updated_at
 	`
 
-	rows, err := c.pool.Query(ctx, query, accountID, periodStart)
+	err := c.pool.QueryRow(ctx, query,
+		hook.ID,
+		hook.AccountID,
+		hook.URL,
+		hook.Secret,
+		hook.Events,
+		hook.Description,
+		hook.IsActive,
+	).Scan(&hook.CreatedAt, &hook.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account cost tracking: %w", err)
+		return fmt.Errorf("failed to create webhook: %w", err)
 	}
-	defer rows.Close()
 
-	var tracking []AccountCostTracking
-	for rows.Next() {
-		var t AccountCostTracking
-		err := rows.Scan(
-			&t.ID,
-			&t.AccountID,
-			&t.Date,
-			&t.DailyCostCents,
-			&t.DailyExecutions,
-			&t.BillingPeriodStart,
-			&t.BillingPeriodEnd,
-			&t.CreatedAt,
-			&t.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan account cost tracking row: %w", err)
-		}
-		tracking = append(tracking, t)
-	}
+	return nil
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating account cost tracking: %w", err)
+// GetWebhook retrieves a webhook by its ID.
+func (c *Client) GetWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	query := fmt.Sprintf(`SELECT %s FROM webhooks WHERE id = $1`, webhookColumns)
+
+	hook, err := scanWebhook(c.pool.QueryRow(ctx, query, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("webhook not found")
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
 	}
 
-	return tracking, nil
+	return hook, nil
 }
 
-// ============================================================================
-// Multi-Key Management Queries
-// ============================================================================
-
-// GetAPIKeysByAccount retrieves all API keys owned by an account.
-// Returns all keys including deactivated/expired ones (for management display).
-func (c *Client) GetAPIKeysByAccount(ctx context.Context, accountID uuid.UUID) ([]APIKey, error) {
+// ListWebhooks retrieves all webhooks of an account, oldest first.
+func (c *Client) ListWebhooks(ctx context.Context, accountID uuid.UUID) ([]Webhook, error) {
 	query := fmt.Sprintf(`
 		SELECT %s
-		FROM api_keys
+		FROM webhooks
 		WHERE account_id = $1
 		ORDER BY created_at ASC
-	`, apiKeyColumns)
+	`, webhookColumns)
 
-	rows, err := c.pool.Query(ctx, query, accountID)
+	return c.queryWebhooks(ctx, query, accountID)
+}
+
+// ListWebhooksForEvent retrieves the active webhooks of an account subscribed to an event type.
+func (c *Client) ListWebhooksForEvent(ctx context.Context, accountID uuid.UUID, eventType string) ([]Webhook, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM webhooks
+		WHERE account_id = $1
+		  AND is_active
+		  AND $2 = ANY(events)
+	`, webhookColumns)
+
+	return c.queryWebhooks(ctx, query, accountID, eventType)
+}
+
+// queryWebhooks runs a query selecting webhookColumns.
+func (c *Client) queryWebhooks(ctx context.Context, query string, args ...any) ([]Webhook, error) {
+	rows, err := c.pool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get API keys for account: %w", err)
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
 	}
 	defer rows.Close()
 
-	var keys []APIKey
+	var hooks []Webhook
 	for rows.Next() {
-		k, err := scanAPIKey(rows)
+		hook, err := scanWebhook(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan API key row: %w", err)
+			return nil, fmt.Errorf("failed to scan webhook row: %w", err)
 		}
-		keys = append(keys, *k)
+		hooks = append(hooks, *hook)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating API keys: %w", err)
-	}
-
-	return keys, nil
-}
-
-// CreateAPIKeyForAccount creates a new API key for an existing account.
-// The new key inherits tier settings from the parent key.
-func (c *Client) CreateAPIKeyForAccount(ctx context.Context, accountID uuid.UUID, name, description string, parentKeyID uuid.UUID) (*APIKey, error) {
-	// Generate a secure random API key
-	keyBytes := make([]byte, 32)
-	if _, err := rand.Read(keyBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate API key: %w", err)
-	}
-	key := fmt.Sprintf("sk_%s", hex.EncodeToString(keyBytes))
-
-	query := fmt.Sprintf(`
-		INSERT INTO api_keys (id, key, email, tier, rate_limit_rps, is_active, account_id, parent_key_id, name, description, created_at)
-		SELECT $1, $2, email, tier, rate_limit_rps, true, $3, $4, $5, $6, NOW()
-		FROM api_keys
-		WHERE id = $4
-		RETURNING %s
-	`, apiKeyColumns)
-
-	apiKey, err := scanAPIKey(c.pool.QueryRow(ctx, query, uuid.New(), key, accountID, parentKeyID, name, description))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create API key for account: %w", err)
+		return nil, fmt.Errorf("error iterating webhooks: %w", err)
 	}
 
-	return apiKey, nil
+	return hooks, nil
 }
 
-// UpdateAPIKey updates an API key's fields.
-// Only non-nil fields in the update struct will be changed.
-func (c *Client) UpdateAPIKey(ctx context.Context, keyID uuid.UUID, update *APIKeyUpdate) error {
-	query := "UPDATE api_keys SET"
+// UpdateWebhook updates a webhook with the provided fields.
+// Only non-nil fields in the update struct will be updated.
+func (c *Client) UpdateWebhook(ctx context.Context, id uuid.UUID, update *WebhookUpdate) error {
+	query := "UPDATE webhooks SET updated_at = NOW()"
 	args := []interface{}{}
 	argPos := 1
-	updates := []string{}
 
-	if update.Name != nil {
-		updates = append(updates, fmt.Sprintf(" name = $%d", argPos))
-		args = append(args, *update.Name)
+	if update.URL != nil {
+		query += fmt.Sprintf(", url = $%d", argPos)
+		args = append(args, *update.URL)
+		argPos++
+	}
+
+	if update.Events != nil {
+		query += fmt.Sprintf(", events = $%d", argPos)
+		args = append(args, update.Events)
 		argPos++
 	}
 
 	if update.Description != nil {
-		updates = append(updates, fmt.Sprintf(" description = $%d", argPos))
+		query += fmt.Sprintf(", description = $%d", argPos)
 		args = append(args, *update.Description)
 		argPos++
 	}
 
 	if update.IsActive != nil {
-		updates = append(updates, fmt.Sprintf(" is_active = $%d", argPos))
+		query += fmt.Sprintf(", is_active = $%d", argPos)
 		args = append(args, *update.IsActive)
 		argPos++
 	}
 
-	if update.ExpiresAt != nil {
-		updates = append(updates, fmt.Sprintf(" expires_at = $%d", argPos))
-		args = append(args, *update.ExpiresAt)
-		argPos++
+	query += fmt.Sprintf(" WHERE id = $%d", argPos)
+	args = append(args, id)
+
+	result, err := c.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
 	}
 
-	if update.CustomDailyLimit != nil {
-		updates = append(updates, fmt.Sprintf(" custom_daily_limit = $%d", argPos))
-		args = append(args, *update.CustomDailyLimit)
-		argPos++
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("webhook not found")
 	}
 
-	if update.CustomConcurrentLimit != nil {
-		updates = append(updates, fmt.Sprintf(" custom_concurrent_limit = $%d", argPos))
-		args = append(args, *update.CustomConcurrentLimit)
-		argPos++
+	return nil
+}
+
+// DeleteWebhook deletes a webhook and its delivery log.
+func (c *Client) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	result, err := c.pool.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
 	}
 
-	if update.LastUpdatedBy != nil {
-		updates = append(updates, fmt.Sprintf(" last_updated_by = $%d", argPos))
-		args = append(args, *update.LastUpdatedBy)
-		argPos++
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("webhook not found")
 	}
 
-	if len(updates) == 0 {
-		return fmt.Errorf("no fields to update")
+	return nil
+}
+
+// CreateWebhookDelivery inserts a pending delivery, due at its NextAttemptAt.
+func (c *Client) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, 'pending', $6)
+		RETURNING created_at
+	`
+
+	err := c.pool.QueryRow(ctx, query,
+		delivery.ID,
+		delivery.WebhookID,
+		delivery.EventID,
+		delivery.EventType,
+		delivery.Payload,
+		delivery.NextAttemptAt,
+	).Scan(&delivery.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
 	}
+	delivery.Status = "pending"
 
-	// Complete the query
-	for i, u := range updates {
-		if i > 0 {
-			query += ","
+	return nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries that are due and
+// pushes their next attempt to leaseUntil, so no other replica sends them while
+// they are in flight. A delivery whose attempt is never recorded is retried then.
+func (c *Client) ClaimWebhookDeliveries(ctx context.Context, limit int, leaseUntil time.Time) ([]DueWebhookDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = $2
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+		          d.response_status, d.error, d.next_attempt_at, d.created_at, d.completed_at,
+		          w.url, w.secret
+	`
+
+	rows, err := c.pool.Query(ctx, query, limit, leaseUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []DueWebhookDelivery
+	for rows.Next() {
+		var d DueWebhookDelivery
+		if err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.Error, &d.NextAttemptAt, &d.CreatedAt, &d.CompletedAt,
+			&d.URL, &d.Secret,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery row: %w", err)
 		}
-		query += u
+		deliveries = append(deliveries, d)
 	}
-	query += fmt.Sprintf(" WHERE id = $%d", argPos)
-	args = append(args, keyID)
 
-	result, err := c.pool.Exec(ctx, query, args...)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookDeliveryAttempt stores the outcome of a delivery attempt.
+func (c *Client) RecordWebhookDeliveryAttempt(ctx context.Context, id uuid.UUID, result *WebhookDeliveryResult) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, response_status = $4, error = $5,
+		    next_attempt_at = $6, completed_at = $7
+		WHERE id = $1
+	`
+
+	tag, err := c.pool.Exec(ctx, query,
+		id,
+		result.Status,
+		result.Attempts,
+		result.ResponseStatus,
+		result.Error,
+		result.NextAttemptAt,
+		result.CompletedAt,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to update API key: %w", err)
+		return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("API key not found")
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("webhook delivery not found")
 	}
 
 	return nil
 }
 
-// DeactivateAPIKey soft-deletes an API key by setting is_active=false.
-// Also records who performed the action in last_updated_by.
-func (c *Client) DeactivateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string) error {
+// ListWebhookDeliveries retrieves the most recent deliveries of a webhook, newest first.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]WebhookDelivery, error) {
 	query := `
-		UPDATE api_keys
-		SET is_active = false, last_updated_by = $2
-		WHERE id = $1
+		SELECT id, webhook_id, event_id, event_type, payload, status, attempts,
+		       response_status, error, next_attempt_at, created_at, completed_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
 	`
 
-	result, err := c.pool.Exec(ctx, query, keyID, performedBy)
+	rows, err := c.pool.Query(ctx, query, webhookID, limit)
 	if err != nil {
-		return fmt.Errorf("failed to deactivate API key: %w", err)
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.Error, &d.NextAttemptAt, &d.CreatedAt, &d.CompletedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery row: %w", err)
+		}
+		deliveries = append(deliveries, d)
 	}
 
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("API key not found")
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %w", err)
 	}
 
-	return nil
+	return deliveries, nil
 }
 
-// RotateAPIKey creates a new key value while preserving the key's settings.
-// Returns the updated key with the new key value.
-func (c *Client) RotateAPIKey(ctx context.Context, keyID uuid.UUID, performedBy string) (*APIKey, error) {
-	// Generate a new secure random API key
-	keyBytes := make([]byte, 32)
-	if _, err := rand.Read(keyBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate API key: %w", err)
+// ============================================================================
+// Session Event Queries
+// ============================================================================
+
+// sessionEventLockClass namespaces the advisory locks that serialize each
+// account's event writes.
+const sessionEventLockClass int32 = 0x65766e74 // "evnt"
+
+// CreateSessionEvent appends an event to an account's event log and sets its ID and timestamp.
+// An account's events are written one at a time under a transaction-scoped
+// advisory lock, so their IDs become visible in order: a reader that has seen
+// an ID will never later find a lower one, and resuming after it skips nothing.
+func (c *Client) CreateSessionEvent(ctx context.Context, event *SessionEvent) error {
+	query := `
+		INSERT INTO session_events (account_id, session_id, type, data)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	err := pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1, hashtext($2::text))", sessionEventLockClass, event.AccountID); err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, query, event.AccountID, event.SessionID, event.Type, event.Data).
+			Scan(&event.ID, &event.CreatedAt)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create session event: %w", err)
 	}
-	newKey := fmt.Sprintf("sk_%s", hex.EncodeToString(keyBytes))
 
-	query := fmt.Sprintf(`
-		UPDATE api_keys
-		SET key = $2, last_updated_by = $3
-		WHERE id = $1
-		RETURNING %s
-	`, apiKeyColumns)
+	return nil
+}
+
+// ListSessionEvents retrieves up to limit events of an account with an ID
+// greater than afterID, oldest first.
+func (c *Client) ListSessionEvents(ctx context.Context, accountID uuid.UUID, afterID int64, limit int) ([]SessionEvent, error) {
+	query := `
+		SELECT id, account_id, session_id, type, data, created_at
+		FROM session_events
+		WHERE account_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`
 
-	apiKey, err := scanAPIKey(c.pool.QueryRow(ctx, query, keyID, newKey, performedBy))
+	rows, err := c.pool.Query(ctx, query, accountID, afterID, limit)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("API key not found")
+		return nil, fmt.Errorf("failed to list session events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []SessionEvent
+	for rows.Next() {
+		var e SessionEvent
+		if err := rows.Scan(&e.ID, &e.AccountID, &e.SessionID, &e.Type, &e.Data, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session event row: %w", err)
 		}
-		return nil, fmt.Errorf("failed to rotate API key: %w", err)
+		events = append(events, e)
 	}
 
-	return apiKey, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session events: %w", err)
+	}
+
+	return events, nil
 }
 
-// IsPrimaryKey checks if the given key is the primary key for its account.
-// Primary keys have account_id equal to their own ID (or no parent_key_id).
-func (c *Client) IsPrimaryKey(ctx context.Context, keyID uuid.UUID) (bool, error) {
+// GetLatestSessionEventID returns the ID of an account's most recent event, or 0 if it has none.
+func (c *Client) GetLatestSessionEventID(ctx context.Context, accountID uuid.UUID) (int64, error) {
 	query := `
-		SELECT account_id = id OR parent_key_id IS NULL
-		FROM api_keys
-		WHERE id = $1
+		SELECT COALESCE(MAX(id), 0)
+		FROM session_events
+		WHERE account_id = $1
 	`
 
-	var isPrimary bool
-	err := c.pool.QueryRow(ctx, query, keyID).Scan(&isPrimary)
+	var id int64
+	if err := c.pool.QueryRow(ctx, query, accountID).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get latest session event: %w", err)
+	}
+
+	return id, nil
+}
+
+// PruneSessionEvents deletes events created before the given time.
+// Returns the number of events deleted.
+func (c *Client) PruneSessionEvents(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM session_events WHERE created_at < $1`
+
+	result, err := c.pool.Exec(ctx, query, before)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return false, fmt.Errorf("API key not found")
-		}
-		return false, fmt.Errorf("failed to check if primary key: %w", err)
+		return 0, fmt.Errorf("failed to prune session events: %w", err)
 	}
 
-	return isPrimary, nil
+	return result.RowsAffected(), nil
+}
+
+// ============================================================================
+// Rate Limit Queries
+// ============================================================================
+
+// TakeRateLimitToken takes a token from the bucket identified by key, which
+// refills at rate tokens per second up to burst tokens. It reports whether a
+// token was available and the tokens left afterwards. Concurrent callers are
+// serialized on the bucket row, so the limit holds across replicas.
+func (c *Client) TakeRateLimitToken(ctx context.Context, key string, rate, burst float64) (bool, float64, error) {
+	// Only update when the refilled bucket holds a token; otherwise leave the
+	// row alone so it keeps refilling from its last update
+	query := `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+		VALUES ($1, $3::float8 - 1, NOW())
+		ON CONFLICT (key) DO UPDATE
+		SET tokens = LEAST($3::float8, rate_limit_buckets.tokens +
+				EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * $2::float8) - 1,
+			updated_at = NOW()
+		WHERE LEAST($3::float8, rate_limit_buckets.tokens +
+				EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * $2::float8) >= 1
+		RETURNING tokens
+	`
+
+	var tokens float64
+	err := c.pool.QueryRow(ctx, query, key, rate, burst).Scan(&tokens)
+	if err == nil {
+		return true, tokens, nil
+	}
+	if err != pgx.ErrNoRows {
+		return false, 0, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	// Rate limited: report the current level
+	query = `
+		SELECT LEAST($2::float8, tokens +
+			EXTRACT(EPOCH FROM NOW() - updated_at)::float8 * $3::float8)
+		FROM rate_limit_buckets
+		WHERE key = $1
+	`
+	if err := c.pool.QueryRow(ctx, query, key, burst, rate).Scan(&tokens); err != nil {
+		return false, 0, fmt.Errorf("failed to get rate limit bucket: %w", err)
+	}
+
+	return false, tokens, nil
+}
+
+// PruneRateLimitBuckets deletes buckets not used since the given time.
+// Returns the number of buckets deleted.
+func (c *Client) PruneRateLimitBuckets(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM rate_limit_buckets WHERE updated_at < $1`
+
+	result, err := c.pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune rate limit buckets: %w", err)
+	}
+
+	return result.RowsAffected(), nil
 }
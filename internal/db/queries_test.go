@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"testing"
 	"time"
 
@@ -35,11 +36,15 @@ func createTestAPIKey(t *testing.T, client *Client, ctx context.Context) *APIKey
 	apiKeyID := uuid.New()
 	keyStr := fmt.Sprintf("eb_test_%s", apiKeyID.String()[:8])
 
+	// The key's account shares its ID, like accounts created before migration 017
 	query := `
-		INSERT INTO api_keys (id, key, tier, rate_limit_rps, created_at)
-		VALUES ($1, $2, 'free', 10, NOW())
+		WITH account AS (
+			INSERT INTO accounts (id) VALUES ($1)
+		)
+		INSERT INTO api_keys (id, key_prefix, key_hash, tier, rate_limit_rps, account_id, created_at)
+		VALUES ($1, $2, $3, 'free', 10, $1, NOW())
 	`
-	_, err := client.pool.Exec(ctx, query, apiKeyID, keyStr)
+	_, err := client.pool.Exec(ctx, query, apiKeyID, apiKeyPrefix(keyStr), client.hashAPIKey(keyStr))
 	if err != nil {
 		t.Fatalf("failed to create test API key: %v", err)
 	}
@@ -49,12 +54,19 @@ func createTestAPIKey(t *testing.T, client *Client, ctx context.Context) *APIKey
 		Key:          keyStr,
 		Tier:         "free",
 		RateLimitRPS: 10,
+		IsActive:     true,
+		AccountID:    apiKeyID,
 	}
 }
 
 func cleanupTestData(t *testing.T, client *Client, ctx context.Context, apiKeyID uuid.UUID) {
-	// Clean up sessions first (due to foreign key)
-	_, err := client.pool.Exec(ctx, "DELETE FROM sessions WHERE api_key_id = $1", apiKeyID)
+	// Clean up sessions and builds first (due to foreign key)
+	_, err := client.pool.Exec(ctx, "DELETE FROM builds WHERE api_key_id = $1", apiKeyID)
+	if err != nil {
+		t.Logf("warning: failed to cleanup test builds: %v", err)
+	}
+
+	_, err = client.pool.Exec(ctx, "DELETE FROM sessions WHERE api_key_id = $1", apiKeyID)
 	if err != nil {
 		t.Logf("warning: failed to cleanup test sessions: %v", err)
 	}
@@ -64,6 +76,12 @@ func cleanupTestData(t *testing.T, client *Client, ctx context.Context, apiKeyID
 	if err != nil {
 		t.Logf("warning: failed to cleanup test API key: %v", err)
 	}
+
+	// Clean up the key's account and everything attributed to it
+	_, err = client.pool.Exec(ctx, "DELETE FROM accounts WHERE id = $1", apiKeyID)
+	if err != nil {
+		t.Logf("warning: failed to cleanup test account: %v", err)
+	}
 }
 
 func TestGetAPIKeyByKey(t *testing.T) {
@@ -81,12 +99,64 @@ func TestGetAPIKeyByKey(t *testing.T) {
 	if got.ID != apiKey.ID {
 		t.Errorf("got ID %s, want %s", got.ID, apiKey.ID)
 	}
-	if got.Key != apiKey.Key {
-		t.Errorf("got Key %s, want %s", got.Key, apiKey.Key)
+	if got.Key != "" {
+		t.Errorf("expected the key itself not to be returned, got %s", got.Key)
+	}
+	if got.KeyPrefix != apiKeyPrefix(apiKey.Key) {
+		t.Errorf("got KeyPrefix %s, want %s", got.KeyPrefix, apiKeyPrefix(apiKey.Key))
 	}
 	if got.Tier != "free" {
 		t.Errorf("got Tier %s, want free", got.Tier)
 	}
+
+	// A key sharing the prefix does not match
+	if _, err := client.GetAPIKeyByKey(ctx, apiKey.Key+"x"); err == nil {
+		t.Error("expected an error for a key that only shares the prefix")
+	}
+}
+
+func TestGetAPIKeyByKeyHashesLegacyKey(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	// Keys created before migration 020 are stored in plaintext
+	apiKeyID := uuid.New()
+	keyStr := fmt.Sprintf("sk_legacy_%s", apiKeyID.String()[:8])
+	query := `
+		WITH account AS (
+			INSERT INTO accounts (id) VALUES ($1)
+		)
+		INSERT INTO api_keys (id, key, key_prefix, tier, rate_limit_rps, account_id, created_at)
+		VALUES ($1, $2, LEFT($2, 12), 'free', 10, $1, NOW())
+	`
+	if _, err := client.pool.Exec(ctx, query, apiKeyID, keyStr); err != nil {
+		t.Fatalf("failed to create legacy API key: %v", err)
+	}
+	defer cleanupTestData(t, client, ctx, apiKeyID)
+
+	got, err := client.GetAPIKeyByKey(ctx, keyStr)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByKey failed: %v", err)
+	}
+	if got.ID != apiKeyID {
+		t.Errorf("got ID %s, want %s", got.ID, apiKeyID)
+	}
+
+	// The first use replaces the plaintext with the hash
+	var plaintext, keyHash *string
+	if err := client.pool.QueryRow(ctx, "SELECT key, key_hash FROM api_keys WHERE id = $1", apiKeyID).Scan(&plaintext, &keyHash); err != nil {
+		t.Fatalf("failed to read API key: %v", err)
+	}
+	if plaintext != nil {
+		t.Errorf("expected the plaintext key to be cleared, got %s", *plaintext)
+	}
+	if keyHash == nil || *keyHash != client.hashAPIKey(keyStr) {
+		t.Errorf("expected the key to be hashed, got %v", keyHash)
+	}
+
+	if _, err := client.GetAPIKeyByKey(ctx, keyStr); err != nil {
+		t.Errorf("expected the hashed key to still authenticate, got %v", err)
+	}
 }
 
 func TestGetAPIKeyByKeyNotFound(t *testing.T) {
@@ -99,6 +169,120 @@ func TestGetAPIKeyByKeyNotFound(t *testing.T) {
 	}
 }
 
+func TestAPIKeysStoredHashed(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	primary, err := client.CreateAPIKey(ctx, "hashed@example.com", nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	defer cleanupTestData(t, client, ctx, primary.AccountID)
+	defer cleanupTestData(t, client, ctx, primary.ID)
+
+	// The key is only returned on creation and never stored
+	if primary.Key == "" || primary.KeyPrefix != apiKeyPrefix(primary.Key) {
+		t.Fatalf("expected the new key and its prefix, got %q and %q", primary.Key, primary.KeyPrefix)
+	}
+	var plaintext *string
+	if err := client.pool.QueryRow(ctx, "SELECT key FROM api_keys WHERE id = $1", primary.ID).Scan(&plaintext); err != nil {
+		t.Fatalf("failed to read API key: %v", err)
+	}
+	if plaintext != nil {
+		t.Errorf("expected no plaintext key to be stored, got %s", *plaintext)
+	}
+	if _, err := client.GetAPIKeyByKey(ctx, primary.Key); err != nil {
+		t.Errorf("GetAPIKeyByKey failed: %v", err)
+	}
+
+	// Rotation replaces the hash, so only the new key authenticates
+	rotated, err := client.RotateAPIKey(ctx, primary.ID, "test", 0)
+	if err != nil {
+		t.Fatalf("RotateAPIKey failed: %v", err)
+	}
+	if rotated.Key == "" || rotated.Key == primary.Key {
+		t.Fatalf("expected a new key, got %q", rotated.Key)
+	}
+	if _, err := client.GetAPIKeyByKey(ctx, primary.Key); err == nil {
+		t.Error("expected the old key to stop authenticating")
+	}
+	if _, err := client.GetAPIKeyByKey(ctx, rotated.Key); err != nil {
+		t.Errorf("GetAPIKeyByKey failed for the rotated key: %v", err)
+	}
+
+	// A different pepper makes every hash unknown
+	other := &Client{pool: client.pool}
+	other.SetAPIKeyPepper("another-pepper")
+	if _, err := other.GetAPIKeyByKey(ctx, rotated.Key); err == nil {
+		t.Error("expected the key not to match under another pepper")
+	}
+}
+
+func TestRotateAPIKeyWithOverlap(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	rotated, err := client.RotateAPIKey(ctx, apiKey.ID, "test", time.Hour)
+	if err != nil {
+		t.Fatalf("RotateAPIKey failed: %v", err)
+	}
+	if rotated.RotatingExpiresAt == nil || time.Until(*rotated.RotatingExpiresAt) < 59*time.Minute {
+		t.Errorf("expected the overlap to end in an hour, got %v", rotated.RotatingExpiresAt)
+	}
+
+	// Both values authenticate during the overlap; the old one is flagged
+	got, err := client.GetAPIKeyByKey(ctx, apiKey.Key)
+	if err != nil {
+		t.Fatalf("expected the old key to authenticate during the overlap: %v", err)
+	}
+	if got.ID != apiKey.ID || !got.UsedRotatingKey {
+		t.Errorf("expected the key found by its rotating value, got %+v", got)
+	}
+	got, err = client.GetAPIKeyByKey(ctx, rotated.Key)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByKey failed for the new key: %v", err)
+	}
+	if got.UsedRotatingKey {
+		t.Error("expected the new key not to be flagged as rotating")
+	}
+
+	// The overlap ends on its own
+	if _, err := client.pool.Exec(ctx, "UPDATE api_keys SET rotating_expires_at = NOW() - INTERVAL '1 second' WHERE id = $1", apiKey.ID); err != nil {
+		t.Fatalf("failed to end the overlap: %v", err)
+	}
+	if _, err := client.GetAPIKeyByKey(ctx, apiKey.Key); err == nil {
+		t.Error("expected the old key to stop authenticating after the overlap")
+	}
+	got, err = client.GetAPIKeyByID(ctx, apiKey.ID)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByID failed: %v", err)
+	}
+	if got.RotatingExpiresAt != nil {
+		t.Errorf("expected no pending expiration after the overlap, got %v", got.RotatingExpiresAt)
+	}
+
+	// Rotating again replaces the rotating value
+	again, err := client.RotateAPIKey(ctx, apiKey.ID, "test", time.Hour)
+	if err != nil {
+		t.Fatalf("RotateAPIKey failed: %v", err)
+	}
+	final, err := client.RotateAPIKey(ctx, apiKey.ID, "test", 0)
+	if err != nil {
+		t.Fatalf("RotateAPIKey failed: %v", err)
+	}
+	if final.RotatingExpiresAt != nil {
+		t.Errorf("expected no overlap, got %v", final.RotatingExpiresAt)
+	}
+	for _, old := range []string{rotated.Key, again.Key} {
+		if _, err := client.GetAPIKeyByKey(ctx, old); err == nil {
+			t.Errorf("expected %s to stop authenticating", old[:apiKeyPrefixLen])
+		}
+	}
+}
+
 func TestUpdateAPIKeyLastUsed(t *testing.T) {
 	client := getTestDB(t)
 	ctx := context.Background()
@@ -123,6 +307,168 @@ func TestUpdateAPIKeyLastUsed(t *testing.T) {
 	}
 }
 
+func TestGetAPIKeyByKeyInactiveOrExpired(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	if err := client.UpdateAPIKey(ctx, apiKey.ID, &APIKeyUpdate{ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("UpdateAPIKey failed: %v", err)
+	}
+	if _, err := client.GetAPIKeyByKey(ctx, apiKey.Key); err == nil || err.Error() != "API key expired" {
+		t.Errorf("expected API key expired, got %v", err)
+	}
+
+	if err := client.DeactivateAPIKey(ctx, apiKey.ID, "test"); err != nil {
+		t.Fatalf("DeactivateAPIKey failed: %v", err)
+	}
+	if _, err := client.GetAPIKeyByKey(ctx, apiKey.Key); err == nil || err.Error() != "API key inactive" {
+		t.Errorf("expected API key inactive, got %v", err)
+	}
+}
+
+func TestAPIKeyExpiryNotices(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	expiring := func() bool {
+		keys, err := client.ListAPIKeysExpiringBefore(ctx, time.Now().Add(24*time.Hour))
+		if err != nil {
+			t.Fatalf("ListAPIKeysExpiringBefore failed: %v", err)
+		}
+		for _, key := range keys {
+			if key.ID == apiKey.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	if err := client.UpdateAPIKey(ctx, apiKey.ID, &APIKeyUpdate{ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("UpdateAPIKey failed: %v", err)
+	}
+	if !expiring() {
+		t.Fatal("expected the key to be listed as expiring")
+	}
+
+	// A key is listed until its notice is claimed, and claimed once
+	claimed, err := client.ClaimAPIKeyExpiryNotice(ctx, apiKey.ID)
+	if err != nil {
+		t.Fatalf("ClaimAPIKeyExpiryNotice failed: %v", err)
+	}
+	if !claimed {
+		t.Fatal("expected the first claim to succeed")
+	}
+	if claimed, _ := client.ClaimAPIKeyExpiryNotice(ctx, apiKey.ID); claimed {
+		t.Error("expected a second claim to fail")
+	}
+	if expiring() {
+		t.Error("expected a claimed key not to be listed again")
+	}
+
+	// A released claim is listed again
+	if err := client.ReleaseAPIKeyExpiryNotice(ctx, apiKey.ID); err != nil {
+		t.Fatalf("ReleaseAPIKeyExpiryNotice failed: %v", err)
+	}
+	if !expiring() {
+		t.Fatal("expected a released key to be listed again")
+	}
+	if _, err := client.ClaimAPIKeyExpiryNotice(ctx, apiKey.ID); err != nil {
+		t.Fatalf("ClaimAPIKeyExpiryNotice failed: %v", err)
+	}
+
+	// A new expiration gets a new notice
+	expiresAt = time.Now().Add(2 * time.Hour)
+	if err := client.UpdateAPIKey(ctx, apiKey.ID, &APIKeyUpdate{ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("UpdateAPIKey failed: %v", err)
+	}
+	if !expiring() {
+		t.Error("expected the key to be listed again after its expiration changed")
+	}
+}
+
+func TestDeactivateExpiredAPIKeys(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	expiresAt := time.Now().Add(-48 * time.Hour)
+	if err := client.UpdateAPIKey(ctx, apiKey.ID, &APIKeyUpdate{ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("UpdateAPIKey failed: %v", err)
+	}
+
+	// Keys expired more recently than the cutoff are left alone
+	if _, err := client.DeactivateExpiredAPIKeys(ctx, time.Now().Add(-72*time.Hour), "test"); err != nil {
+		t.Fatalf("DeactivateExpiredAPIKeys failed: %v", err)
+	}
+	got, err := client.GetAPIKeyByID(ctx, apiKey.ID)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByID failed: %v", err)
+	}
+	if !got.IsActive {
+		t.Fatal("expected the key to stay active")
+	}
+
+	count, err := client.DeactivateExpiredAPIKeys(ctx, time.Now().Add(-24*time.Hour), "test")
+	if err != nil {
+		t.Fatalf("DeactivateExpiredAPIKeys failed: %v", err)
+	}
+	if count < 1 {
+		t.Errorf("expected at least 1 deactivated key, got %d", count)
+	}
+	got, err = client.GetAPIKeyByID(ctx, apiKey.ID)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByID failed: %v", err)
+	}
+	if got.IsActive || got.LastUpdatedBy == nil || *got.LastUpdatedBy != "test" {
+		t.Errorf("expected the key deactivated by test, got active=%v by %v", got.IsActive, got.LastUpdatedBy)
+	}
+}
+
+func TestExpiredTierFallsBackToFree(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	if _, err := client.pool.Exec(ctx, "UPDATE api_keys SET tier = 'pro', rate_limit_rps = 100, tier_expires_at = NOW() - INTERVAL '1 second' WHERE id = $1", apiKey.ID); err != nil {
+		t.Fatalf("failed to set tier: %v", err)
+	}
+
+	// The key reads as free as soon as its tier expires
+	got, err := client.GetAPIKeyByKey(ctx, apiKey.Key)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByKey failed: %v", err)
+	}
+	if got.Tier != "free" || got.RateLimitRPS != 10 {
+		t.Errorf("expected tier free at 10 rps, got %s at %d", got.Tier, got.RateLimitRPS)
+	}
+
+	// and is stored as free once downgraded
+	if _, err := client.DowngradeExpiredTiers(ctx); err != nil {
+		t.Fatalf("DowngradeExpiredTiers failed: %v", err)
+	}
+	var tier string
+	var rateLimitRPS int
+	var tierExpiresAt *time.Time
+	if err := client.pool.QueryRow(ctx, "SELECT tier, rate_limit_rps, tier_expires_at FROM api_keys WHERE id = $1", apiKey.ID).Scan(&tier, &rateLimitRPS, &tierExpiresAt); err != nil {
+		t.Fatalf("failed to read tier: %v", err)
+	}
+	if tier != "free" || rateLimitRPS != 10 || tierExpiresAt != nil {
+		t.Errorf("expected tier free at 10 rps without expiration, got %s at %d expiring %v", tier, rateLimitRPS, tierExpiresAt)
+	}
+}
+
 func TestCreateAndGetSession(t *testing.T) {
 	client := getTestDB(t)
 	ctx := context.Background()
@@ -320,6 +666,82 @@ func TestUpdateSessionNoFields(t *testing.T) {
 	}
 }
 
+func TestRecordSessionSample(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	session := &Session{
+		ID:        "sess_sample_test",
+		APIKeyID:  apiKey.ID,
+		Image:     "alpine:3.20",
+		Status:    "running",
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := client.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	first := time.Now().UTC().Truncate(time.Microsecond)
+	result, err := client.RecordSessionSample(ctx, session.ID, &SessionSample{
+		SampledAt:      first,
+		CPUMillisAdded: 1500,
+		MemoryPeakMB:   200,
+	})
+	if err != nil {
+		t.Fatalf("RecordSessionSample failed: %v", err)
+	}
+	if !result.Recorded || *result.CPUMillisUsed != 1500 || *result.MemoryPeakMB != 200 {
+		t.Fatalf("expected first sample recorded, got %+v", result)
+	}
+
+	// A second sampler that read the session before the first sample loses
+	result, err = client.RecordSessionSample(ctx, session.ID, &SessionSample{
+		SampledAt:      first.Add(time.Second),
+		CPUMillisAdded: 1500,
+		MemoryPeakMB:   500,
+	})
+	if err != nil {
+		t.Fatalf("RecordSessionSample failed: %v", err)
+	}
+	if result.Recorded || *result.CPUMillisUsed != 1500 || *result.MemoryPeakMB != 200 {
+		t.Errorf("expected stale sample to be dropped, got %+v", result)
+	}
+
+	// A sample building on the stored one adds to it
+	result, err = client.RecordSessionSample(ctx, session.ID, &SessionSample{
+		PreviousSampledAt: result.LastSampledAt,
+		SampledAt:         first.Add(15 * time.Second),
+		CPUMillisAdded:    1000,
+		MemoryPeakMB:      100,
+	})
+	if err != nil {
+		t.Fatalf("RecordSessionSample failed: %v", err)
+	}
+	if !result.Recorded || *result.CPUMillisUsed != 2500 || *result.MemoryPeakMB != 200 {
+		t.Errorf("expected 2500ms CPU and a 200MB peak, got %+v", result)
+	}
+
+	// Later absolute updates never lower the figures
+	lower := int64(10)
+	if err := client.UpdateSession(ctx, session.ID, &SessionUpdate{CPUMillisUsed: &lower, MemoryPeakMB: &lower}); err != nil {
+		t.Fatalf("UpdateSession failed: %v", err)
+	}
+	got, err := client.GetSession(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if *got.CPUMillisUsed != 2500 || *got.MemoryPeakMB != 200 || got.LastSampledAt == nil {
+		t.Errorf("expected stored usage to be kept, got %d ms, %d MB", *got.CPUMillisUsed, *got.MemoryPeakMB)
+	}
+
+	if _, err := client.RecordSessionSample(ctx, "sess_missing", &SessionSample{SampledAt: first}); err == nil {
+		t.Error("expected error for unknown session")
+	}
+}
+
 func TestListSessions(t *testing.T) {
 	client := getTestDB(t)
 	ctx := context.Background()
@@ -341,7 +763,7 @@ func TestListSessions(t *testing.T) {
 		}
 	}
 
-	sessions, err := client.ListSessions(ctx, apiKey.ID, nil)
+	sessions, err := client.ListSessions(ctx, &SessionFilter{APIKeyID: apiKey.ID})
 	if err != nil {
 		t.Fatalf("ListSessions failed: %v", err)
 	}
@@ -375,7 +797,7 @@ func TestListSessionsWithStatusFilter(t *testing.T) {
 
 	// List only running sessions
 	runningStatus := "running"
-	sessions, err := client.ListSessions(ctx, apiKey.ID, &runningStatus)
+	sessions, err := client.ListSessions(ctx, &SessionFilter{APIKeyID: apiKey.ID, Status: &runningStatus})
 	if err != nil {
 		t.Fatalf("ListSessions failed: %v", err)
 	}
@@ -390,6 +812,83 @@ func TestListSessionsWithStatusFilter(t *testing.T) {
 	}
 }
 
+func TestListSessionsFiltersAndPaging(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	fly, k8s := "fly", "kubernetes"
+	zero, one := 0, 1
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	sessions := []*Session{
+		{ID: "sess_page_0", Image: "alpine", Backend: &fly, ExitCode: &zero, Labels: map[string]string{"team": "a", "ci": "true"}},
+		{ID: "sess_page_1", Image: "python:3.12", Backend: &k8s, ExitCode: &one, Labels: map[string]string{"team": "b"}},
+		{ID: "sess_page_2", Image: "alpine", Backend: &fly, ExitCode: &one, Labels: map[string]string{"team": "a"}},
+		{ID: "sess_page_3", Image: "alpine", Backend: &k8s},
+	}
+	for i, session := range sessions {
+		session.APIKeyID = apiKey.ID
+		session.Status = "stopped"
+		// The last two share a creation time, so paging must break the tie on id
+		session.CreatedAt = base.Add(time.Duration(min(i, 2)) * time.Minute)
+		if err := client.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+	}
+
+	ids := func(filter SessionFilter) []string {
+		t.Helper()
+		filter.APIKeyID = apiKey.ID
+		list, err := client.ListSessions(ctx, &filter)
+		if err != nil {
+			t.Fatalf("ListSessions failed: %v", err)
+		}
+		out := make([]string, 0, len(list))
+		for _, s := range list {
+			out = append(out, s.ID)
+		}
+		return out
+	}
+
+	alpine := "alpine"
+	since := base.Add(time.Minute)
+	tests := []struct {
+		name   string
+		filter SessionFilter
+		want   []string
+	}{
+		{"newest first", SessionFilter{}, []string{"sess_page_3", "sess_page_2", "sess_page_1", "sess_page_0"}},
+		{"oldest first", SessionFilter{Ascending: true}, []string{"sess_page_0", "sess_page_1", "sess_page_2", "sess_page_3"}},
+		{"image", SessionFilter{Image: &alpine}, []string{"sess_page_3", "sess_page_2", "sess_page_0"}},
+		{"backend", SessionFilter{Backend: &k8s}, []string{"sess_page_3", "sess_page_1"}},
+		{"exit code", SessionFilter{ExitCode: &one}, []string{"sess_page_2", "sess_page_1"}},
+		{"label", SessionFilter{Labels: map[string]string{"team": "a"}}, []string{"sess_page_2", "sess_page_0"}},
+		{"labels", SessionFilter{Labels: map[string]string{"team": "a", "ci": "true"}}, []string{"sess_page_0"}},
+		{"time range", SessionFilter{CreatedAfter: &since, CreatedBefore: &sessions[3].CreatedAt}, []string{"sess_page_1"}},
+		{"page after tie", SessionFilter{AfterCreatedAt: &sessions[3].CreatedAt, AfterID: "sess_page_3", Limit: 2}, []string{"sess_page_2", "sess_page_1"}},
+		{"ascending page", SessionFilter{Ascending: true, AfterCreatedAt: &sessions[2].CreatedAt, AfterID: "sess_page_2"}, []string{"sess_page_3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(tt.filter); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Labels and backend are read back
+	got, err := client.GetSession(ctx, "sess_page_0")
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if got.Labels["ci"] != "true" || got.Backend == nil || *got.Backend != "fly" {
+		t.Errorf("got labels %v and backend %v, want ci=true and fly", got.Labels, got.Backend)
+	}
+}
+
 func TestDeleteSession(t *testing.T) {
 	client := getTestDB(t)
 	ctx := context.Background()
@@ -495,48 +994,436 @@ func TestGetDailySessionCount(t *testing.T) {
 	}
 }
 
-func TestIncrementUsage(t *testing.T) {
+func TestGetAccountSessionCounts(t *testing.T) {
 	client := getTestDB(t)
 	ctx := context.Background()
 
 	apiKey := createTestAPIKey(t, client, ctx)
 	defer cleanupTestData(t, client, ctx, apiKey.ID)
 
-	// Increment usage
-	err := client.IncrementUsage(ctx, apiKey.ID, 1000)
-	if err != nil {
-		t.Fatalf("IncrementUsage failed: %v", err)
+	// Sessions count towards the account they were created under
+	statuses := []string{"pending", "running", "stopped"}
+	for i, status := range statuses {
+		session := &Session{
+			ID:        fmt.Sprintf("sess_account_count_%d", i),
+			APIKeyID:  apiKey.ID,
+			AccountID: apiKey.ID,
+			Image:     "alpine",
+			Status:    status,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := client.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
 	}
 
-	// Increment again to test ON CONFLICT
-	err = client.IncrementUsage(ctx, apiKey.ID, 2000)
+	active, err := client.GetAccountActiveSessionCount(ctx, apiKey.ID)
 	if err != nil {
-		t.Fatalf("IncrementUsage (second call) failed: %v", err)
+		t.Fatalf("GetAccountActiveSessionCount failed: %v", err)
+	}
+	if active != 2 {
+		t.Errorf("got active count %d, want 2 (pending + running)", active)
 	}
 
-	// Verify the usage was recorded
-	query := `
-		SELECT executions, duration_ms
-		FROM usage_metrics
-		WHERE api_key_id = $1 AND date = $2
-	`
-	today := time.Now().UTC().Truncate(24 * time.Hour)
-
-	var executions int
-	var durationMs int64
-	err = client.pool.QueryRow(ctx, query, apiKey.ID, today).Scan(&executions, &durationMs)
+	daily, err := client.GetAccountDailySessionCount(ctx, apiKey.ID)
 	if err != nil {
-		t.Fatalf("failed to query usage metrics: %v", err)
+		t.Fatalf("GetAccountDailySessionCount failed: %v", err)
 	}
-
-	if executions != 2 {
-		t.Errorf("got executions %d, want 2", executions)
+	if daily != 3 {
+		t.Errorf("got daily count %d, want 3", daily)
+	}
+
+	// Other accounts see none of them
+	other, err := client.GetAccountActiveSessionCount(ctx, uuid.New())
+	if err != nil {
+		t.Fatalf("GetAccountActiveSessionCount failed: %v", err)
+	}
+	if other != 0 {
+		t.Errorf("got count %d for another account, want 0", other)
+	}
+}
+
+func TestListExpiringSessions(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	deadline := time.Now().UTC().Add(time.Minute)
+	sessions := []*Session{
+		{ID: "sess_expiring_running", Status: "running", ExpiresAt: &deadline},
+		{ID: "sess_expiring_stopped", Status: "stopped", ExpiresAt: &deadline},
+		{ID: "sess_expiring_unlimited", Status: "running"},
+	}
+	for _, session := range sessions {
+		session.APIKeyID = apiKey.ID
+		session.Image = "alpine"
+		session.CreatedAt = time.Now().UTC()
+		if err := client.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+	}
+
+	expiring, err := client.ListExpiringSessions(ctx)
+	if err != nil {
+		t.Fatalf("ListExpiringSessions failed: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, session := range expiring {
+		if session.APIKeyID == apiKey.ID {
+			found[session.ID] = true
+			if session.ExpiresAt == nil {
+				t.Errorf("session %s returned without a deadline", session.ID)
+			}
+		}
+	}
+	if !found["sess_expiring_running"] || len(found) != 1 {
+		t.Errorf("expected only the running session with a deadline, got %v", found)
+	}
+}
+
+func TestListActiveSessionsAndFilterKnownBackendIDs(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	running, stopped := "machine_active_running", "machine_active_stopped"
+	sessions := []*Session{
+		{ID: "sess_active_running", Status: "running", FlyMachineID: &running},
+		{ID: "sess_active_stopped", Status: "stopped", FlyMachineID: &stopped},
+	}
+	for _, session := range sessions {
+		session.APIKeyID = apiKey.ID
+		session.Image = "alpine"
+		session.CreatedAt = time.Now().UTC()
+		if err := client.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+	}
+
+	active, err := client.ListActiveSessions(ctx)
+	if err != nil {
+		t.Fatalf("ListActiveSessions failed: %v", err)
+	}
+	found := make(map[string]bool)
+	for _, session := range active {
+		if session.APIKeyID == apiKey.ID {
+			found[session.ID] = true
+		}
+	}
+	if !found["sess_active_running"] || len(found) != 1 {
+		t.Errorf("expected only the running session, got %v", found)
+	}
+
+	known, err := client.FilterKnownBackendIDs(ctx, []string{running, stopped, "machine_orphan"})
+	if err != nil {
+		t.Fatalf("FilterKnownBackendIDs failed: %v", err)
+	}
+	if len(known) != 2 {
+		t.Errorf("expected both session machines to be known, got %v", known)
+	}
+
+	session, err := client.GetActiveSessionByBackendID(ctx, running)
+	if err != nil || session.ID != "sess_active_running" {
+		t.Errorf("expected the running session, got %+v, %v", session, err)
+	}
+	if _, err := client.GetActiveSessionByBackendID(ctx, stopped); err == nil {
+		t.Error("expected no active session on the stopped machine")
+	}
+
+	counts, err := client.CountActiveSessionsByTier(ctx)
+	if err != nil {
+		t.Fatalf("CountActiveSessionsByTier failed: %v", err)
+	}
+	if counts[apiKey.Tier] < 1 {
+		t.Errorf("expected the running session to be counted for tier %s, got %v", apiKey.Tier, counts)
+	}
+}
+
+func TestIncrementUsage(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	// Increment usage
+	err := client.IncrementUsage(ctx, apiKey.ID, 1000)
+	if err != nil {
+		t.Fatalf("IncrementUsage failed: %v", err)
+	}
+
+	// Increment again to test ON CONFLICT
+	err = client.IncrementUsage(ctx, apiKey.ID, 2000)
+	if err != nil {
+		t.Fatalf("IncrementUsage (second call) failed: %v", err)
+	}
+
+	// Verify the usage was recorded
+	query := `
+		SELECT executions, duration_ms
+		FROM usage_metrics
+		WHERE api_key_id = $1 AND date = $2
+	`
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	var executions int
+	var durationMs int64
+	err = client.pool.QueryRow(ctx, query, apiKey.ID, today).Scan(&executions, &durationMs)
+	if err != nil {
+		t.Fatalf("failed to query usage metrics: %v", err)
+	}
+
+	if executions != 2 {
+		t.Errorf("got executions %d, want 2", executions)
 	}
 	if durationMs != 3000 {
 		t.Errorf("got duration_ms %d, want 3000", durationMs)
 	}
 }
 
+func TestAccounts(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	name := "Acme"
+	primary, err := client.CreateAPIKey(ctx, "owner@example.com", &name)
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	defer cleanupTestData(t, client, ctx, primary.AccountID)
+	defer cleanupTestData(t, client, ctx, primary.ID)
+
+	if primary.AccountID == primary.ID {
+		t.Error("expected the account to have its own ID")
+	}
+
+	account, err := client.GetAccount(ctx, primary.AccountID)
+	if err != nil {
+		t.Fatalf("GetAccount failed: %v", err)
+	}
+	if account.Name == nil || *account.Name != "Acme" || account.Email == nil || *account.Email != "owner@example.com" {
+		t.Errorf("unexpected account %+v", account)
+	}
+
+	email := "billing@example.com"
+	updated, err := client.UpdateAccount(ctx, account.ID, &AccountUpdate{Email: &email})
+	if err != nil {
+		t.Fatalf("UpdateAccount failed: %v", err)
+	}
+	if *updated.Email != email || *updated.Name != "Acme" {
+		t.Errorf("expected only the email to change, got %+v", updated)
+	}
+
+	// Usage of a sub-key is attributed to the account
+	subKey, err := client.CreateAPIKeyForAccount(ctx, account.ID, "ci", "", primary.ID, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKeyForAccount failed: %v", err)
+	}
+	defer cleanupTestData(t, client, ctx, subKey.ID)
+
+	if err := client.IncrementUsage(ctx, subKey.ID, 1000); err != nil {
+		t.Fatalf("IncrementUsage failed: %v", err)
+	}
+	usage, err := client.GetDailyAccountUsage(ctx, account.ID, 1)
+	if err != nil {
+		t.Fatalf("GetDailyAccountUsage failed: %v", err)
+	}
+	if len(usage) != 1 || usage[0].APIKeyID != subKey.ID {
+		t.Errorf("expected the sub-key's usage on the account, got %+v", usage)
+	}
+
+	if _, err := client.GetAccount(ctx, uuid.New()); err == nil {
+		t.Error("expected an error for an unknown account")
+	}
+}
+
+func TestAccountMembers(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	primary, err := client.CreateAPIKey(ctx, "owner@example.com", nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	defer cleanupTestData(t, client, ctx, primary.AccountID)
+	defer cleanupTestData(t, client, ctx, primary.ID)
+
+	// The primary key is issued to the account's owner
+	if primary.MemberID == nil || primary.MemberRole == nil || *primary.MemberRole != "owner" {
+		t.Fatalf("expected the primary key to belong to the owner, got member %v role %v", primary.MemberID, primary.MemberRole)
+	}
+
+	invitation := &AccountInvitation{
+		ID:        uuid.New(),
+		AccountID: primary.AccountID,
+		Email:     "dev@example.com",
+		Role:      "developer",
+		TokenHash: "hash-" + uuid.NewString(),
+		InvitedBy: primary.MemberID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := client.CreateAccountInvitation(ctx, invitation); err != nil {
+		t.Fatalf("CreateAccountInvitation failed: %v", err)
+	}
+
+	pending, err := client.ListAccountInvitations(ctx, primary.AccountID)
+	if err != nil {
+		t.Fatalf("ListAccountInvitations failed: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != invitation.ID {
+		t.Fatalf("expected the invitation to be pending, got %+v", pending)
+	}
+
+	name := "Dev"
+	member, key, err := client.AcceptAccountInvitation(ctx, invitation.TokenHash, &name)
+	if err != nil {
+		t.Fatalf("AcceptAccountInvitation failed: %v", err)
+	}
+	defer cleanupTestData(t, client, ctx, key.ID)
+
+	if member.Role != "developer" || member.Email != "dev@example.com" {
+		t.Errorf("unexpected member %+v", member)
+	}
+	if key.AccountID != primary.AccountID || key.ParentKeyID == nil || *key.ParentKeyID != primary.ID {
+		t.Errorf("expected a sub-key of the primary key, got %+v", key)
+	}
+	if key.MemberRole == nil || *key.MemberRole != "developer" {
+		t.Errorf("expected the key to act as developer, got %v", key.MemberRole)
+	}
+
+	// Tokens are single use
+	if _, _, err := client.AcceptAccountInvitation(ctx, invitation.TokenHash, nil); err == nil || err.Error() != "invitation not found" {
+		t.Errorf("expected a used invitation to be rejected, got %v", err)
+	}
+
+	// Keys created by a member belong to them and keep their scopes
+	subKey, err := client.CreateAPIKeyForAccount(ctx, primary.AccountID, "ci", "", key.ID, []string{"sessions:create", "sessions:read"})
+	if err != nil {
+		t.Fatalf("CreateAPIKeyForAccount failed: %v", err)
+	}
+	defer cleanupTestData(t, client, ctx, subKey.ID)
+	if subKey.MemberID == nil || *subKey.MemberID != member.ID {
+		t.Errorf("expected the new key to belong to the member, got %v", subKey.MemberID)
+	}
+	if len(subKey.Scopes) != 2 || subKey.Scopes[0] != "sessions:create" || subKey.Scopes[1] != "sessions:read" {
+		t.Errorf("expected the new key's scopes to be stored, got %v", subKey.Scopes)
+	}
+	if key.Scopes != nil {
+		t.Errorf("expected an accepted invitation's key to be unrestricted, got %v", key.Scopes)
+	}
+
+	updated, err := client.UpdateAccountMemberRole(ctx, member.ID, "admin")
+	if err != nil {
+		t.Fatalf("UpdateAccountMemberRole failed: %v", err)
+	}
+	if updated.Role != "admin" {
+		t.Errorf("expected role admin, got %s", updated.Role)
+	}
+
+	members, err := client.ListAccountMembers(ctx, primary.AccountID)
+	if err != nil {
+		t.Fatalf("ListAccountMembers failed: %v", err)
+	}
+	if len(members) != 2 {
+		t.Errorf("expected 2 members, got %d", len(members))
+	}
+
+	// Removing a member deactivates their keys
+	if err := client.RemoveAccountMember(ctx, member.ID, primary.ID.String()); err != nil {
+		t.Fatalf("RemoveAccountMember failed: %v", err)
+	}
+	if _, err := client.GetAPIKeyByKey(ctx, subKey.Key); err == nil {
+		t.Error("expected the removed member's key to be deactivated")
+	}
+	if err := client.RemoveAccountMember(ctx, member.ID, primary.ID.String()); err == nil || err.Error() != "member not found" {
+		t.Errorf("expected member not found, got %v", err)
+	}
+
+	details := []byte(`{"role":"admin"}`)
+	target := member.ID.String()
+	entry := &AuditEntry{
+		AccountID:     primary.AccountID,
+		ActorKeyID:    &primary.ID,
+		ActorMemberID: primary.MemberID,
+		Action:        "member.removed",
+		Target:        &target,
+		Details:       details,
+	}
+	if err := client.CreateAuditEntry(ctx, entry); err != nil {
+		t.Fatalf("CreateAuditEntry failed: %v", err)
+	}
+	if entry.ID == 0 || entry.CreatedAt.IsZero() {
+		t.Errorf("expected the entry's ID and timestamp to be set, got %+v", entry)
+	}
+}
+
+func TestListAuditEntries(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	ip := "203.0.113.7"
+	for _, action := range []string{"api_key.created", "session.created", "api_key.rotated"} {
+		entry := &AuditEntry{AccountID: apiKey.AccountID, ActorKeyID: &apiKey.ID, Action: action, IPAddress: &ip}
+		if err := client.CreateAuditEntry(ctx, entry); err != nil {
+			t.Fatalf("CreateAuditEntry failed: %v", err)
+		}
+	}
+
+	all, err := client.ListAuditEntries(ctx, apiKey.AccountID, &AuditFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEntries failed: %v", err)
+	}
+	if len(all) != 3 || all[0].Action != "api_key.rotated" {
+		t.Fatalf("expected 3 entries newest first, got %+v", all)
+	}
+	if all[0].IPAddress == nil || *all[0].IPAddress != ip {
+		t.Errorf("expected IP %s, got %v", ip, all[0].IPAddress)
+	}
+
+	keys, err := client.ListAuditEntries(ctx, apiKey.AccountID, &AuditFilter{Action: "api_key.*"})
+	if err != nil {
+		t.Fatalf("ListAuditEntries failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("expected 2 api_key entries, got %d", len(keys))
+	}
+
+	// Pages continue after the last entry of the previous one
+	page, err := client.ListAuditEntries(ctx, apiKey.AccountID, &AuditFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListAuditEntries failed: %v", err)
+	}
+	last := page[len(page)-1]
+	rest, err := client.ListAuditEntries(ctx, apiKey.AccountID, &AuditFilter{
+		Limit:           2,
+		BeforeCreatedAt: &last.CreatedAt,
+		BeforeID:        last.ID,
+	})
+	if err != nil {
+		t.Fatalf("ListAuditEntries failed: %v", err)
+	}
+	if len(page) != 2 || len(rest) != 1 || rest[0].ID != all[2].ID {
+		t.Errorf("expected pages of 2 and 1 entries, got %d and %d", len(page), len(rest))
+	}
+
+	future := time.Now().Add(time.Hour)
+	later, err := client.ListAuditEntries(ctx, apiKey.AccountID, &AuditFilter{Since: &future})
+	if err != nil {
+		t.Fatalf("ListAuditEntries failed: %v", err)
+	}
+	if len(later) != 0 {
+		t.Errorf("expected no entries after now, got %d", len(later))
+	}
+}
+
 func TestImageCacheOperations(t *testing.T) {
 	client := getTestDB(t)
 	ctx := context.Background()
@@ -624,6 +1511,150 @@ func TestPutImageCacheDuplicate(t *testing.T) {
 	}
 }
 
+func TestPutExpiringImageCache(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	hash := "test_expiring_01"
+	baseImage := "alpine"
+
+	// An already expired entry should not be returned
+	err := client.PutExpiringImageCache(ctx, hash, baseImage, "ttl.sh/old:1h", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("PutExpiringImageCache failed: %v", err)
+	}
+
+	_, found, err := client.GetImageCache(ctx, hash)
+	if err != nil {
+		t.Fatalf("GetImageCache failed: %v", err)
+	}
+	if found {
+		t.Error("expected cache miss for expired entry, got hit")
+	}
+
+	// Re-putting replaces the expired entry
+	err = client.PutExpiringImageCache(ctx, hash, baseImage, "ttl.sh/new:1h", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("PutExpiringImageCache (replace) failed: %v", err)
+	}
+
+	gotTag, found, err := client.GetImageCache(ctx, hash)
+	if err != nil {
+		t.Fatalf("GetImageCache failed: %v", err)
+	}
+	if !found {
+		t.Error("expected cache hit, got miss")
+	}
+	if gotTag != "ttl.sh/new:1h" {
+		t.Errorf("got registry tag %s, want ttl.sh/new:1h", gotTag)
+	}
+
+	// Cleanup
+	_, err = client.pool.Exec(ctx, "DELETE FROM image_cache WHERE hash = $1", hash)
+	if err != nil {
+		t.Logf("warning: failed to cleanup image cache: %v", err)
+	}
+}
+
+func TestBuildLifecycle(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	build := &Build{
+		ID:        fmt.Sprintf("build_test_%s", uuid.New().String()[:8]),
+		APIKeyID:  apiKey.ID,
+		Hash:      "0123456789abcdef",
+		BaseImage: "python:3.12",
+		Phase:     "queued",
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := client.CreateBuild(ctx, build); err != nil {
+		t.Fatalf("CreateBuild failed: %v", err)
+	}
+
+	phase := "ready"
+	tag := "ttl.sh/execbox-test:4h"
+	now := time.Now().UTC()
+	err := client.UpdateBuild(ctx, build.ID, &BuildUpdate{
+		Phase:       &phase,
+		RegistryTag: &tag,
+		CompletedAt: &now,
+	})
+	if err != nil {
+		t.Fatalf("UpdateBuild failed: %v", err)
+	}
+
+	got, err := client.GetBuild(ctx, build.ID)
+	if err != nil {
+		t.Fatalf("GetBuild failed: %v", err)
+	}
+	if got.Phase != "ready" {
+		t.Errorf("got phase %s, want ready", got.Phase)
+	}
+	if got.RegistryTag == nil || *got.RegistryTag != tag {
+		t.Errorf("got registry tag %v, want %s", got.RegistryTag, tag)
+	}
+
+	// A ready build is never considered stale
+	future := time.Now().Add(time.Hour)
+	n, err := client.FailStaleBuilds(ctx, future, future, nil, "interrupted")
+	if err != nil {
+		t.Fatalf("FailStaleBuilds failed: %v", err)
+	}
+	got, _ = client.GetBuild(ctx, build.ID)
+	if got.Phase != "ready" {
+		t.Errorf("expected ready build to be untouched (marked %d), got phase %s", n, got.Phase)
+	}
+
+	// A running build is stale by its start time, and never while excluded
+	running := &Build{
+		ID:        fmt.Sprintf("build_test_%s", uuid.New().String()[:8]),
+		APIKeyID:  apiKey.ID,
+		Hash:      "fedcba9876543210",
+		BaseImage: "python:3.12",
+		Phase:     "queued",
+		CreatedAt: time.Now().UTC().Add(-2 * time.Hour),
+	}
+	if err := client.CreateBuild(ctx, running); err != nil {
+		t.Fatalf("CreateBuild failed: %v", err)
+	}
+	phase = "building"
+	if err := client.UpdateBuild(ctx, running.ID, &BuildUpdate{Phase: &phase, StartedAt: &now}); err != nil {
+		t.Fatalf("UpdateBuild failed: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if _, err := client.FailStaleBuilds(ctx, past, future, nil, "interrupted"); err != nil {
+		t.Fatalf("FailStaleBuilds failed: %v", err)
+	}
+	if got, _ = client.GetBuild(ctx, running.ID); got.Phase != "building" {
+		t.Errorf("expected recently started build to be untouched, got phase %s", got.Phase)
+	}
+	if _, err := client.FailStaleBuilds(ctx, future, future, []string{running.ID}, "interrupted"); err != nil {
+		t.Fatalf("FailStaleBuilds failed: %v", err)
+	}
+	if got, _ = client.GetBuild(ctx, running.ID); got.Phase != "building" {
+		t.Errorf("expected excluded build to be untouched, got phase %s", got.Phase)
+	}
+	if _, err := client.FailStaleBuilds(ctx, future, future, nil, "interrupted"); err != nil {
+		t.Fatalf("FailStaleBuilds failed: %v", err)
+	}
+	if got, _ = client.GetBuild(ctx, running.ID); got.Phase != "failed" {
+		t.Errorf("expected stale build to be failed, got phase %s", got.Phase)
+	}
+
+	// A failed build is final
+	phase = "ready"
+	if err := client.UpdateBuild(ctx, running.ID, &BuildUpdate{Phase: &phase}); err == nil {
+		t.Error("expected updating a failed build to fail")
+	}
+	if got, _ = client.GetBuild(ctx, running.ID); got.Phase != "failed" {
+		t.Errorf("expected failed build to stay failed, got phase %s", got.Phase)
+	}
+}
+
 func TestCreateQuotaRequest(t *testing.T) {
 	client := getTestDB(t)
 	ctx := context.Background()
@@ -713,3 +1744,374 @@ func TestCreateQuotaRequestWithAllFields(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestGetAccountSpendAndCreateBudgetAlert(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	now := time.Now().UTC()
+	periodStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	for _, id := range []string{"sess_spend_ended", "sess_spend_running"} {
+		session := &Session{
+			ID:        id,
+			APIKeyID:  apiKey.ID,
+			AccountID: apiKey.ID,
+			Image:     "alpine",
+			Status:    "running",
+			CreatedAt: now,
+		}
+		if err := client.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+	}
+
+	// The cost is counted once the session ends
+	status, endedAt, cost := "stopped", now, int64(42)
+	if err := client.UpdateSession(ctx, "sess_spend_ended", &SessionUpdate{
+		Status:            &status,
+		EndedAt:           &endedAt,
+		CostEstimateCents: &cost,
+	}); err != nil {
+		t.Fatalf("UpdateSession failed: %v", err)
+	}
+
+	spend, err := client.GetAccountSpend(ctx, apiKey.ID, periodStart)
+	if err != nil {
+		t.Fatalf("GetAccountSpend failed: %v", err)
+	}
+	if spend.SettledCents != 42 {
+		t.Errorf("got settled cost %d, want 42", spend.SettledCents)
+	}
+	if len(spend.ActiveSessionStarts) != 1 {
+		t.Errorf("got %d active sessions, want 1", len(spend.ActiveSessionStarts))
+	}
+
+	alert := &BudgetAlert{
+		AccountID:           apiKey.ID,
+		BillingPeriodStart:  periodStart,
+		ThresholdPercentage: 80,
+		SpentCents:          42,
+		LimitCents:          50,
+	}
+	created, err := client.CreateBudgetAlert(ctx, alert)
+	if err != nil {
+		t.Fatalf("CreateBudgetAlert failed: %v", err)
+	}
+	if !created || alert.ID == 0 {
+		t.Errorf("expected first alert to be created, got created=%v id=%d", created, alert.ID)
+	}
+
+	// A second alert in the same billing period is dropped
+	created, err = client.CreateBudgetAlert(ctx, &BudgetAlert{
+		AccountID:           apiKey.ID,
+		BillingPeriodStart:  periodStart,
+		ThresholdPercentage: 80,
+		SpentCents:          48,
+		LimitCents:          50,
+	})
+	if err != nil {
+		t.Fatalf("CreateBudgetAlert failed: %v", err)
+	}
+	if created {
+		t.Error("expected second alert in the same period to be skipped")
+	}
+
+	// The new alert is due for delivery; a claim leases it
+	claimed := func() *BudgetAlert {
+		t.Helper()
+		alerts, err := client.ClaimBudgetAlerts(ctx, 100, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("ClaimBudgetAlerts failed: %v", err)
+		}
+		for i := range alerts {
+			if alerts[i].ID == alert.ID {
+				return &alerts[i]
+			}
+		}
+		return nil
+	}
+	if got := claimed(); got == nil || got.DeliveredAt != nil {
+		t.Fatalf("expected the undelivered alert to be claimed, got %+v", got)
+	}
+	if got := claimed(); got != nil {
+		t.Error("expected a leased alert not to be claimed again")
+	}
+
+	// A failed attempt is retried when due; a delivered alert never is
+	past := time.Now().Add(-time.Second)
+	if err := client.RecordBudgetAlertDelivery(ctx, alert.ID, 1, nil, &past); err != nil {
+		t.Fatalf("RecordBudgetAlertDelivery failed: %v", err)
+	}
+	if got := claimed(); got == nil || got.DeliveryAttempts != 1 {
+		t.Fatalf("expected the failed alert to be claimed for a retry, got %+v", got)
+	}
+	deliveredAt := time.Now()
+	if err := client.RecordBudgetAlertDelivery(ctx, alert.ID, 2, &deliveredAt, nil); err != nil {
+		t.Fatalf("RecordBudgetAlertDelivery failed: %v", err)
+	}
+	if got := claimed(); got != nil {
+		t.Error("expected a delivered alert not to be claimed")
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	hook := &Webhook{
+		ID:        uuid.New(),
+		AccountID: apiKey.ID,
+		URL:       "https://example.com/hooks",
+		Secret:    "whsec_test",
+		Events:    []string{"session.exited", "build.ready"},
+		IsActive:  true,
+	}
+	if err := client.CreateWebhook(ctx, hook); err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+
+	hooks, err := client.ListWebhooksForEvent(ctx, apiKey.ID, "session.exited")
+	if err != nil {
+		t.Fatalf("ListWebhooksForEvent failed: %v", err)
+	}
+	if len(hooks) != 1 || hooks[0].ID != hook.ID {
+		t.Fatalf("expected the subscribed webhook, got %+v", hooks)
+	}
+	if hooks, _ := client.ListWebhooksForEvent(ctx, apiKey.ID, "session.created"); len(hooks) != 0 {
+		t.Errorf("expected no webhooks for an unsubscribed event, got %d", len(hooks))
+	}
+
+	delivery := &WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     hook.ID,
+		EventID:       "evt_test",
+		EventType:     "session.exited",
+		Payload:       []byte(`{"type":"session.exited"}`),
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if err := client.CreateWebhookDelivery(ctx, delivery); err != nil {
+		t.Fatalf("CreateWebhookDelivery failed: %v", err)
+	}
+
+	// A claimed delivery is not handed out again while its lease runs
+	due, err := client.ClaimWebhookDeliveries(ctx, 10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries failed: %v", err)
+	}
+	if len(due) != 1 || due[0].ID != delivery.ID || due[0].URL != hook.URL || due[0].Secret != hook.Secret {
+		t.Fatalf("expected the delivery with its endpoint, got %+v", due)
+	}
+	if due, _ := client.ClaimWebhookDeliveries(ctx, 10, time.Now().Add(time.Minute)); len(due) != 0 {
+		t.Errorf("expected leased delivery to be skipped, got %d", len(due))
+	}
+
+	completedAt, responseStatus := time.Now().UTC(), 204
+	if err := client.RecordWebhookDeliveryAttempt(ctx, delivery.ID, &WebhookDeliveryResult{
+		Status:         "succeeded",
+		Attempts:       1,
+		ResponseStatus: &responseStatus,
+		NextAttemptAt:  completedAt,
+		CompletedAt:    &completedAt,
+	}); err != nil {
+		t.Fatalf("RecordWebhookDeliveryAttempt failed: %v", err)
+	}
+
+	log, err := client.ListWebhookDeliveries(ctx, hook.ID, 10)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries failed: %v", err)
+	}
+	if len(log) != 1 || log[0].Status != "succeeded" || log[0].Attempts != 1 {
+		t.Errorf("expected one succeeded delivery, got %+v", log)
+	}
+
+	if err := client.DeleteWebhook(ctx, hook.ID); err != nil {
+		t.Fatalf("DeleteWebhook failed: %v", err)
+	}
+	if _, err := client.GetWebhook(ctx, hook.ID); err == nil {
+		t.Error("expected deleted webhook to be gone")
+	}
+}
+
+func TestSessionEvents(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+
+	session := &Session{ID: "sess_events", APIKeyID: apiKey.ID, AccountID: apiKey.ID, Image: "alpine", Status: "pending", CreatedAt: time.Now().UTC()}
+	if err := client.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	latest, err := client.GetLatestSessionEventID(ctx, apiKey.ID)
+	if err != nil || latest != 0 {
+		t.Fatalf("expected no events yet, got %d, %v", latest, err)
+	}
+
+	var ids []int64
+	for _, eventType := range []string{"session.created", "session.running", "session.exited"} {
+		event := &SessionEvent{AccountID: apiKey.ID, SessionID: session.ID, Type: eventType, Data: []byte(`{"id":"sess_events"}`)}
+		if err := client.CreateSessionEvent(ctx, event); err != nil {
+			t.Fatalf("CreateSessionEvent failed: %v", err)
+		}
+		ids = append(ids, event.ID)
+	}
+
+	events, err := client.ListSessionEvents(ctx, apiKey.ID, ids[0], 10)
+	if err != nil {
+		t.Fatalf("ListSessionEvents failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != "session.running" || events[1].ID != ids[2] {
+		t.Errorf("expected the events after the first, got %+v", events)
+	}
+	if latest, _ := client.GetLatestSessionEventID(ctx, apiKey.ID); latest != ids[2] {
+		t.Errorf("expected latest event %d, got %d", ids[2], latest)
+	}
+
+	if _, err := client.PruneSessionEvents(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PruneSessionEvents failed: %v", err)
+	}
+	if events, _ := client.ListSessionEvents(ctx, apiKey.ID, 0, 10); len(events) != 0 {
+		t.Errorf("expected pruned events to be gone, got %d", len(events))
+	}
+}
+
+func TestSessionEventsResumeUnderConcurrentWrites(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	apiKey := createTestAPIKey(t, client, ctx)
+	defer cleanupTestData(t, client, ctx, apiKey.ID)
+	defer func() {
+		_, _ = client.pool.Exec(ctx, "DELETE FROM session_events WHERE account_id = $1", apiKey.ID)
+	}()
+
+	const writers, perWriter = 8, 25
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		go func() {
+			for i := 0; i < perWriter; i++ {
+				event := &SessionEvent{AccountID: apiKey.ID, SessionID: "sess_concurrent", Type: "session.running", Data: []byte(`{}`)}
+				if err := client.CreateSessionEvent(ctx, event); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+
+	// Resume after the last ID seen while the writers run, as a stream would
+	seen := make(map[int64]bool)
+	var afterID int64
+	read := func() {
+		events, err := client.ListSessionEvents(ctx, apiKey.ID, afterID, 1000)
+		if err != nil {
+			t.Fatalf("ListSessionEvents failed: %v", err)
+		}
+		for _, e := range events {
+			seen[e.ID] = true
+			afterID = e.ID
+		}
+	}
+	for done := 0; done < writers; {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("CreateSessionEvent failed: %v", err)
+			}
+			done++
+		default:
+			read()
+		}
+	}
+	read()
+
+	if len(seen) != writers*perWriter {
+		t.Errorf("expected all %d events to be read, got %d", writers*perWriter, len(seen))
+	}
+}
+
+func TestTakeRateLimitToken(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	key := "api_key:" + uuid.New().String()
+	defer func() {
+		_, _ = client.pool.Exec(ctx, "DELETE FROM rate_limit_buckets WHERE key = $1", key)
+	}()
+
+	// A rate this low does not refill a token while the test runs
+	for i, wantRemaining := range []float64{1, 0} {
+		allowed, remaining, err := client.TakeRateLimitToken(ctx, key, 0.001, 2)
+		if err != nil {
+			t.Fatalf("TakeRateLimitToken failed: %v", err)
+		}
+		if !allowed || remaining < wantRemaining || remaining > wantRemaining+0.1 {
+			t.Fatalf("request %d: expected allowed with %v tokens left, got %v with %v", i+1, wantRemaining, allowed, remaining)
+		}
+	}
+
+	allowed, remaining, err := client.TakeRateLimitToken(ctx, key, 0.001, 2)
+	if err != nil {
+		t.Fatalf("TakeRateLimitToken failed: %v", err)
+	}
+	if allowed || remaining >= 1 {
+		t.Errorf("expected rate limited bucket, got allowed=%v with %v tokens", allowed, remaining)
+	}
+
+	pruned, err := client.PruneRateLimitBuckets(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PruneRateLimitBuckets failed: %v", err)
+	}
+	if pruned < 1 {
+		t.Errorf("expected the bucket to be pruned, got %d", pruned)
+	}
+}
+
+func TestMigrationLedger(t *testing.T) {
+	client := getTestDB(t)
+	ctx := context.Background()
+
+	if _, err := client.RunMigrations(ctx); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+
+	// Everything is recorded, so a second run applies nothing
+	ran, err := client.RunMigrations(ctx)
+	if err != nil || len(ran) != 0 {
+		t.Fatalf("expected no pending migrations, got %d, %v", len(ran), err)
+	}
+
+	statuses, err := client.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus failed: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil || status.Modified {
+			t.Errorf("expected %s to be applied unmodified", status.Name)
+		}
+	}
+
+	reverted, err := client.RollbackMigration(ctx)
+	if err != nil {
+		t.Fatalf("RollbackMigration failed: %v", err)
+	}
+	latest := statuses[len(statuses)-1]
+	if reverted == nil || reverted.Version != latest.Version {
+		t.Fatalf("expected migration %s to be reverted, got %+v", latest.Name, reverted)
+	}
+
+	ran, err = client.RunMigrations(ctx)
+	if err != nil || len(ran) != 1 || ran[0].Version != latest.Version {
+		t.Fatalf("expected %s to be applied again, got %d migrations, %v", latest.Name, len(ran), err)
+	}
+}
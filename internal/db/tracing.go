@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/burka/execbox-cloud/internal/db")
+
+// queryTracer records a client span for every query run through the pool.
+// It implements pgx.QueryTracer.
+type queryTracer struct{}
+
+// TraceQueryStart starts the span for a query.
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = tracer.Start(ctx, querySpanName(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.query.text", data.SQL),
+		))
+	return ctx
+}
+
+// TraceQueryEnd ends the span started by TraceQueryStart.
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// querySpanName names a query span after its operation and the table it
+// targets, e.g. "SELECT sessions". Queries whose table cannot be found are
+// named after the operation alone.
+func querySpanName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "db.query"
+	}
+	operation := strings.ToUpper(fields[0])
+	if operation == "UPDATE" && len(fields) > 1 {
+		return operation + " " + tableName(fields[1])
+	}
+	for i, field := range fields[:len(fields)-1] {
+		switch strings.ToUpper(field) {
+		case "FROM", "INTO":
+			return operation + " " + tableName(fields[i+1])
+		}
+	}
+	return operation
+}
+
+// tableName strips punctuation surrounding a table name in SQL.
+func tableName(field string) string {
+	return strings.Trim(field, `"(),;`)
+}
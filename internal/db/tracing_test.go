@@ -0,0 +1,23 @@
+package db
+
+import "testing"
+
+func TestQuerySpanName(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT id, status FROM sessions WHERE id = $1", "SELECT sessions"},
+		{"\n\t\tINSERT INTO api_keys (key, tier)\n\t\tVALUES ($1, $2)", "INSERT api_keys"},
+		{"UPDATE sessions SET status = $2 WHERE id = $1", "UPDATE sessions"},
+		{"delete from webhooks where id = $1", "DELETE webhooks"},
+		{"SELECT 1", "SELECT"},
+		{"   ", "db.query"},
+	}
+
+	for _, tt := range tests {
+		if got := querySpanName(tt.sql); got != tt.want {
+			t.Errorf("querySpanName(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}